@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shauera/messages/metrics"
+	"github.com/shauera/messages/utils"
+)
+
+// Analyzer - computes a property of a message content
+type Analyzer interface {
+	// Name - the name of the property in analysis reports
+	Name() string
+	// Analyze - returns the property of the given content
+	Analyze(content string) interface{}
+}
+
+// Analyzers - a set of analyzers run together on a message content
+type Analyzers []Analyzer
+
+// Default - all the available analyzers
+var Default = Analyzers{Palindrome{}, Length{}, WordCount{}}
+
+// Names - the names of the analyzers
+func (as Analyzers) Names() []string {
+	names := make([]string, 0, len(as))
+	for _, analyzer := range as {
+		names = append(names, analyzer.Name())
+	}
+	return names
+}
+
+// Select - the analyzers of the given names in the order they are listed in, all the analyzers when names is empty.
+// Unknown names are ignored.
+func (as Analyzers) Select(names []string) Analyzers {
+	if len(names) == 0 {
+		return as
+	}
+	selected := make(Analyzers, 0, len(names))
+	for _, analyzer := range as {
+		for _, name := range names {
+			if analyzer.Name() == name {
+				selected = append(selected, analyzer)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// Report - the properties computed by the analyzers by analyzer name
+type Report map[string]interface{}
+
+// Analyze - run all the analyzers on the given content, the time each analyzer takes is measured
+func (as Analyzers) Analyze(content string) Report {
+	report := make(Report, len(as))
+	for _, analyzer := range as {
+		start := time.Now()
+		report[analyzer.Name()] = analyzer.Analyze(content)
+		metrics.AnalyzerDuration.WithLabelValues(analyzer.Name()).Observe(metrics.Since(start))
+	}
+	return report
+}
+
+// Palindrome - reports if the content is a palindrome (see utils.IsPalindrome)
+type Palindrome struct{}
+
+// Name - implementation of Analyzer
+func (Palindrome) Name() string {
+	return "palindrome"
+}
+
+// Analyze - implementation of Analyzer
+func (Palindrome) Analyze(content string) interface{} {
+	return utils.IsPalindrome(content)
+}
+
+// Length - the number of characters of the content
+type Length struct{}
+
+// Name - implementation of Analyzer
+func (Length) Name() string {
+	return "length"
+}
+
+// Analyze - implementation of Analyzer
+func (Length) Analyze(content string) interface{} {
+	return utf8.RuneCountInString(content)
+}
+
+// WordCount - the number of white space separated words of the content
+type WordCount struct{}
+
+// Name - implementation of Analyzer
+func (WordCount) Name() string {
+	return "wordCount"
+}
+
+// Analyze - implementation of Analyzer
+func (WordCount) Analyze(content string) interface{} {
+	return len(strings.Fields(content))
+}
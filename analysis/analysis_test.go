@@ -0,0 +1,49 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	config "github.com/spf13/viper"
+)
+
+func TestAnalyze(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected Report
+	}{
+		{content: "", expected: Report{"palindrome": true, "length": 0, "wordCount": 0}},
+		{content: "Was it a car or a cat I saw?", expected: Report{"palindrome": true, "length": 28, "wordCount": 9}},
+		{content: "naïve", expected: Report{"palindrome": false, "length": 5, "wordCount": 1}},
+		{content: "Not a palindrome", expected: Report{"palindrome": false, "length": 16, "wordCount": 3}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.content, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Default.Analyze(testCase.content))
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	assert.Equal(t, []string{"palindrome", "length", "wordCount"}, Default.Select(nil).Names())
+	assert.Equal(t, []string{"palindrome", "wordCount"}, Default.Select([]string{"wordCount", "palindrome", "unknown"}).Names())
+}
+
+func TestLoadAnalyzers(t *testing.T) {
+	defer config.Reset()
+
+	analyzers, err := LoadAnalyzers()
+	assert.NoError(t, err)
+	assert.Equal(t, Default, analyzers)
+
+	config.Set("analysis.analyzers", []string{"wordCount", "length"})
+	analyzers, err = LoadAnalyzers()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"length", "wordCount"}, analyzers.Names())
+
+	config.Set("analysis.analyzers", []string{"sentiment"})
+	_, err = LoadAnalyzers()
+	assert.EqualError(t, err, `analysis.analyzers: unknown analyzer "sentiment"`)
+}
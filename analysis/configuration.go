@@ -0,0 +1,18 @@
+package analysis
+
+import (
+	"fmt"
+
+	config "github.com/spf13/viper"
+)
+
+//LoadAnalyzers - the analyzers named in the analysis.analyzers configuration, all the analyzers when none are named
+func LoadAnalyzers() (Analyzers, error) {
+	names := config.GetStringSlice("analysis.analyzers")
+	for _, name := range names {
+		if len(Default.Select([]string{name})) == 0 {
+			return nil, fmt.Errorf("analysis.analyzers: unknown analyzer %q", name)
+		}
+	}
+	return Default.Select(names), nil
+}
@@ -0,0 +1,187 @@
+package application
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	config "github.com/spf13/viper"
+)
+
+// Sources of setting values, from the highest precedence
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDefault = "default"
+	SourceUnset   = "unset"
+)
+
+const configUsage = `Usage: messages config <command>
+
+Commands:
+  check               validate the configuration, listing all its problems
+  print [--effective] print the configuration, --effective lists every setting with the source of its value
+  schema              print the JSON schema of the configuration file
+`
+
+// ServiceCheck - validates the configuration the way the service does when it starts, beyond the settings themselves
+type ServiceCheck func() error
+
+// RunConfigCommand - run the "messages config" command with the given arguments, writing to out.
+// check validates what the service builds from the settings, it runs once the settings are valid.
+// Returns the exit status of the command.
+func RunConfigCommand(args []string, out io.Writer, check ServiceCheck) int {
+	if len(args) == 0 {
+		fmt.Fprint(out, configUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "check":
+		return checkConfiguration(out, check)
+	case "print":
+		flags := flag.NewFlagSet("messages config print", flag.ContinueOnError)
+		flags.SetOutput(out)
+		effective := flags.Bool("effective", false, "list every setting with its value and the source of the value")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if *effective {
+			return printEffectiveConfiguration(out)
+		}
+		return printConfiguration(out)
+	case "schema":
+		schema, err := ConfigurationSchema()
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 1
+		}
+		out.Write(schema)
+		return 0
+	}
+
+	fmt.Fprintf(out, "Unknown command %q\n\n%s", args[0], configUsage)
+	return 2
+}
+
+func checkConfiguration(out io.Writer, check ServiceCheck) int {
+	if file := config.ConfigFileUsed(); file != "" {
+		fmt.Fprintf(out, "Configuration file: %s\n", file)
+	} else {
+		fmt.Fprintln(out, "No configuration file, using the defaults and the environment")
+	}
+
+	// the service does not start with invalid settings, what it builds from them is checked once they are valid
+	_, err := LoadConfiguration()
+	if err == nil && check != nil {
+		err = check()
+	}
+	if err != nil {
+		problems := []string{err.Error()}
+		if configurationError, ok := err.(ConfigurationError); ok {
+			problems = configurationError.Problems
+		}
+		fmt.Fprintf(out, "The configuration has %d problem(s):\n", len(problems))
+		for _, problem := range problems {
+			fmt.Fprintf(out, "  %s\n", problem)
+		}
+		return 1
+	}
+	fmt.Fprintln(out, "The configuration is valid")
+	return 0
+}
+
+func printConfiguration(out io.Writer) int {
+	data, err := yaml.Marshal(RedactedSettings())
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	out.Write(data)
+	return 0
+}
+
+func printEffectiveConfiguration(out io.Writer) int {
+	fileSettings := config.New()
+	if file := config.ConfigFileUsed(); file != "" {
+		fileSettings.SetConfigFile(file)
+		if err := fileSettings.ReadInConfig(); err != nil {
+			fmt.Fprintln(out, err)
+			return 1
+		}
+	}
+
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "SETTING\tVALUE\tSOURCE")
+	for _, key := range settingKeys("", reflect.TypeOf(Configuration{})) {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", key, formatSetting(key), settingSource(key, fileSettings))
+	}
+	table.Flush()
+	return 0
+}
+
+// settingKeys - the keys of the settings of the struct type, in the order of its fields
+func settingKeys(prefix string, structType reflect.Type) []string {
+	var keys []string
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		key := prefix + field.Tag.Get("config")
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			keys = append(keys, settingKeys(key+".", field.Type)...)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// formatSetting - the redacted value of the setting, lists and maps as JSON
+func formatSetting(key string) string {
+	value := config.Get(key)
+	if value == nil {
+		return ""
+	}
+
+	secrets.mutex.RLock()
+	redacted := secrets.redact(key, value)
+	secrets.mutex.RUnlock()
+	return formatValue(redacted)
+}
+
+// formatValue - the value as text, lists and maps as JSON
+func formatValue(value interface{}) string {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Map:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+// settingSource - where the value of the setting comes from, in the order of precedence
+func settingSource(key string, fileSettings *config.Viper) string {
+	variable := envPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+	if _, ok := os.LookupEnv(variable); ok {
+		return SourceEnv
+	}
+	if _, ok := os.LookupEnv(variable + fileEnvSuffix); ok {
+		return SourceEnv + " (" + variable + fileEnvSuffix + ")"
+	}
+	if fileSettings.IsSet(key) {
+		return SourceFile
+	}
+	if config.IsSet(key) {
+		return SourceDefault
+	}
+	return SourceUnset
+}
@@ -11,21 +11,21 @@ import (
 //This will read the configuration file and set defaults for each
 //missing configuration entry
 func InitConfig() {
-    // Prefix all envirinment variables with "messages"
+	// Prefix all envirinment variables with "messages"
 	config.SetEnvPrefix("messages")
 	// Compound variable names with `_` instead of `.``
 	config.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	// Automatically read (and use as overrides) environment variables
 	config.AutomaticEnv()
-	
+
 	// Source
 	config.SetConfigName("config")
 	config.AddConfigPath("/etc/messages")
 	config.AddConfigPath(".")
 
-	// Find and read the config file
+	// Find and read the config file, without one the defaults and the environment are used
 	err := config.ReadInConfig()
-	if err != nil {
+	if _, notFound := err.(config.ConfigFileNotFoundError); err != nil && !notFound {
 		log.WithError(err).Fatal("Could not read config file")
 	}
 
@@ -39,13 +39,157 @@ func InitConfig() {
 	config.SetDefault(
 		"service", map[string]interface{}{
 			"port":                  "8090",
+			"shutdownDelay":         "0s",
 			"shutdownGraceDuration": "10s",
+			"mode":                  "normal",
+			"modeRetryAfter":        "1m",
+		},
+	)
+
+	config.SetDefault(
+		"metrics", map[string]interface{}{
+			"port": "",
+		},
+	)
+
+	config.SetDefault(
+		"admin", map[string]interface{}{
+			"port":    "",
+			"address": "127.0.0.1",
+		},
+	)
+
+	config.SetDefault(
+		"health", map[string]interface{}{
+			"timeout": "2s",
+		},
+	)
+
+	config.SetDefault(
+		"cors", map[string]interface{}{
+			"enabled":          false,
+			"allowedOrigins":   []string{},
+			"allowedMethods":   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			"allowedHeaders":   []string{"Authorization", "Content-Type", "Idempotency-Key", "X-Correlation-ID", "X-Tenant-ID", "X-Time-Format"},
+			"exposedHeaders":   []string{"X-Correlation-ID", "Idempotent-Replayed", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Quota-Limit", "X-Quota-Remaining", "X-Quota-Reset", "X-Service-Mode"},
+			"allowCredentials": false,
+			"maxAge":           "10m",
+		},
+	)
+
+	config.SetDefault(
+		"tracing", map[string]interface{}{
+			"enabled":     false,
+			"serviceName": "messages",
+			"exporter":    "otlp",
+			"sampleRatio": 1.0,
+			"otlp": map[string]interface{}{
+				"endpoint": "http://localhost:4318/v1/traces",
+				"timeout":  "10s",
+				"headers":  map[string]string{},
+			},
+			"file": map[string]interface{}{
+				"path": "traces.jsonl",
+			},
 		},
 	)
 
 	config.SetDefault(
 		"database", map[string]interface{}{
-			"type": "memory",
+			"type":    "memory",
+			"dbname":  "MessageManager",
+			"timeout": "10s",
+			"connectRetry": map[string]interface{}{
+				"initialBackoff": "500ms",
+				"maxBackoff":     "30s",
+				"multiplier":     2.0,
+				"jitter":         0.5,
+				"maxAttempts":    0,
+			},
+			"circuitBreaker": map[string]interface{}{
+				"enabled":          true,
+				"failureThreshold": 5,
+				"openDuration":     "10s",
+			},
+		},
+	)
+
+	config.SetDefault(
+		"tenancy", map[string]interface{}{
+			"enabled":   false,
+			"header":    "X-Tenant-ID",
+			"isolation": "field",
+			"cacheTTL":  "30s",
+		},
+	)
+
+	config.SetDefault(
+		"rateLimit", map[string]interface{}{
+			"enabled": false,
+			"default": map[string]interface{}{
+				"requests": 100,
+				"per":      "1m",
+			},
+		},
+	)
+
+	config.SetDefault(
+		"quotas", map[string]interface{}{
+			"enabled":      false,
+			"writesPerDay": 1000,
+		},
+	)
+
+	config.SetDefault(
+		"idempotency", map[string]interface{}{
+			"enabled":     true,
+			"ttl":         "24h",
+			"lockTimeout": "1m",
+		},
+	)
+
+	config.SetDefault(
+		"auth", map[string]interface{}{
+			"enabled": false,
+			"jwt": map[string]interface{}{
+				"rolesClaim":  "roles",
+				"tenantClaim": "tenant",
+				"leeway":      "30s",
+			},
+			"apiKeys": map[string]interface{}{
+				"enabled": true,
+			},
+			"users": map[string]interface{}{
+				"enabled":          true,
+				"tokenTTL":         "1h",
+				"defaultRoles":     []string{"contributor"},
+				"passwordHashCost": 12,
+				"maxFailedLogins":  5,
+				"lockoutDuration":  "15m",
+				"resetTokenTTL":    "1h",
+			},
 		},
 	)
+
+	config.SetDefault(
+		"analysis", map[string]interface{}{
+			"analyzers": []string{},
+		},
+	)
+
+	config.SetDefault(
+		"reload", map[string]interface{}{
+			"watchFile": true,
+		},
+	)
+
+	config.SetDefault(
+		"secrets", map[string]interface{}{
+			"refreshInterval": "1m",
+		},
+	)
+
+	// Values of *_FILE environment variables and ${env:...}, ${file:...} references,
+	// secrets that can't be read are problems of the configuration (see LoadConfiguration)
+	resolveSecrets()
 }
@@ -6,6 +6,8 @@ import (
 	"runtime"
 	"strings"
 
+	"go.opentelemetry.io/otel/trace"
+
 	log "github.com/sirupsen/logrus"
 
 	config "github.com/spf13/viper"
@@ -47,4 +49,31 @@ func InitLogging() {
 		return fmt.Sprintf("%s()", functionName), fmt.Sprintf("%s:%d", fileName, f.Line)
 	}
 	log.SetFormatter(formatter)
+
+	// Entries logged with the context of a traced request carry its trace and span ids
+	log.AddHook(TraceLogHook{})
+
+	// Secret configuration values never reach the logs
+	log.AddHook(SecretsLogHook{})
+}
+
+// TraceLogHook - adds the trace and the span ids of the span of the entry context to log entries,
+// so the logs of a request can be found from its trace. Entries are given a context with log.WithContext.
+type TraceLogHook struct{}
+
+// Levels - implementation of log.Hook, all levels
+func (TraceLogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire - implementation of log.Hook
+func (TraceLogHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if spanContext := trace.SpanContextFromContext(entry.Context); spanContext.IsValid() {
+		entry.Data["traceId"] = spanContext.TraceID().String()
+		entry.Data["spanId"] = spanContext.SpanID().String()
+	}
+	return nil
 }
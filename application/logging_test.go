@@ -0,0 +1,25 @@
+package application
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceLogHook(t *testing.T) {
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	entry := log.WithContext(ctx).WithField("subject", "will")
+	assert.NoError(t, TraceLogHook{}.Fire(entry))
+	assert.Equal(t, span.SpanContext().TraceID().String(), entry.Data["traceId"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), entry.Data["spanId"])
+
+	entry = log.WithField("subject", "will")
+	assert.NoError(t, TraceLogHook{}.Fire(entry))
+	assert.NotContains(t, entry.Data, "traceId")
+}
@@ -0,0 +1,357 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/shauera/messages/metrics"
+
+	log "github.com/sirupsen/logrus"
+	config "github.com/spf13/viper"
+)
+
+// Results of reloading the configuration
+const (
+	ReloadApplied   = "applied"
+	ReloadUnchanged = "unchanged"
+	ReloadRejected  = "rejected"
+)
+
+// Triggers of reloading the configuration
+const (
+	TriggerFile    = "file"
+	TriggerSignal  = "signal"
+	TriggerSecrets = "secrets"
+)
+
+// PrepareReload - checks the new configuration and prepares the settings of a part of the service,
+// such as the rate limiter. The returned apply function switches the part to the prepared settings,
+// it is only called when every part prepared its settings without an error.
+type PrepareReload func(configuration Configuration) (apply func(), err error)
+
+type reloadHook struct {
+	name    string
+	prepare PrepareReload
+}
+
+// SettingChange - a setting whose value changed, secret values are redacted
+type SettingChange struct {
+	Key        string `json:"key"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Reloadable bool   `json:"reloadable"`
+}
+
+// ReloadEvent - the audit record of reloading the configuration
+type ReloadEvent struct {
+	Trigger string          `json:"trigger"`
+	Result  string          `json:"result"`
+	Changes []SettingChange `json:"changes,omitempty"`
+	// RestartRequired - the changed settings that only take effect when the service is restarted
+	RestartRequired []string `json:"restartRequired,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// configLock - guards the configuration values while the service runs, a reload replaces them while the admin API
+// may be dumping them. viper is not safe for concurrent use, every access after startup holds the lock.
+var configLock sync.RWMutex
+
+// Reloader - applies the changes of the configuration file while the service runs. Only the settings
+// tagged reload:"true" are reloaded, a change of any other setting rejects the whole reload and the
+// service keeps its current configuration.
+type Reloader struct {
+	mutex   sync.Mutex
+	current Configuration
+	// fileData - the content of the configuration file the current configuration was read from
+	fileData []byte
+	hooks    []reloadHook
+}
+
+//NewReloader - return a reloader of the configuration the service started with, the logging
+//level is reloaded by it, the other parts of the service are added with OnReload
+func NewReloader(current Configuration) *Reloader {
+	reloader := &Reloader{current: current}
+	if file := config.ConfigFileUsed(); file != "" {
+		if data, err := ioutil.ReadFile(file); err == nil {
+			reloader.fileData = data
+		}
+	}
+
+	reloader.OnReload("logging", func(configuration Configuration) (func(), error) {
+		level := log.InfoLevel
+		if configuration.Logging.Level != "" {
+			var err error
+			if level, err = log.ParseLevel(configuration.Logging.Level); err != nil {
+				return nil, err
+			}
+		}
+		return func() { log.SetLevel(level) }, nil
+	})
+	return reloader
+}
+
+// OnReload - adds the named part of the service, whose settings are prepared and applied on every reload
+func (r *Reloader) OnReload(name string, prepare PrepareReload) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hooks = append(r.hooks, reloadHook{name: name, prepare: prepare})
+}
+
+// Current - the configuration the service currently runs with
+func (r *Reloader) Current() Configuration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.current
+}
+
+// Watch - reload the configuration on SIGHUP, when reload.watchFile is set whenever the configuration
+// file changes and whenever a secret file changes, until ctx is done
+func (r *Reloader) Watch(ctx context.Context) {
+	if file := config.ConfigFileUsed(); config.GetBool("reload.watchFile") && file != "" {
+		go r.watchFile(ctx, file)
+	}
+	if interval := config.GetDuration("secrets.refreshInterval"); interval > 0 {
+		go r.watchSecrets(ctx, interval)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			r.Reload(TriggerSignal)
+		}
+	}
+}
+
+// watchFile - reloads the configuration whenever the file changes, until ctx is done. The directory of the file
+// is watched, so files replaced by editors or by swapping a symbolic link (Kubernetes config maps) are noticed too.
+// Only Reload reads the file, the configuration is never read outside of the configuration lock.
+func (r *Reloader) watchFile(ctx context.Context, file string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.WithError(err).Warn("Could not watch the configuration file, SIGHUP still reloads it")
+		return
+	}
+	defer watcher.Close()
+
+	file = filepath.Clean(file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		log.WithError(err).WithField("file", file).Warn("Could not watch the configuration file, SIGHUP still reloads it")
+		return
+	}
+	// target - the file a symbolic link configuration file points to, a change of it is a change of the file
+	target, _ := filepath.EvalSymlinks(file)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			currentTarget, _ := filepath.EvalSymlinks(file)
+			written := filepath.Clean(event.Name) == file && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+			if written || (currentTarget != "" && currentTarget != target) {
+				target = currentTarget
+				r.Reload(TriggerFile)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.WithError(err).Warn("Error watching the configuration file")
+		}
+	}
+}
+
+// watchSecrets - reloads the configuration whenever a secret file changes, the files are read every interval
+// until ctx is done. Rotated secrets are applied like the other changes of the configuration.
+func (r *Reloader) watchSecrets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if secretFilesChanged() {
+				r.Reload(TriggerSecrets)
+			}
+		}
+	}
+}
+
+// Reload - read the configuration file and the secret files again and apply their changes, all of them or none.
+// The returned event is logged as an audit record.
+func (r *Reloader) Reload(trigger string) ReloadEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// the parts of the service read the reloaded configuration when they prepare their settings
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	event := r.reload(trigger)
+	metrics.ConfigReloads.WithLabelValues(event.Result).Inc()
+
+	logEntry := log.WithFields(log.Fields{
+		"audit":   "configuration.reload",
+		"trigger": event.Trigger,
+		"result":  event.Result,
+	})
+	if len(event.Changes) > 0 {
+		logEntry = logEntry.WithField("changes", event.Changes)
+	}
+	if len(event.RestartRequired) > 0 {
+		logEntry = logEntry.WithField("restartRequired", event.RestartRequired)
+	}
+	if event.Result == ReloadRejected {
+		logEntry.WithField("error", event.Error).Warn("Configuration reload rejected, the current configuration is kept")
+	} else {
+		logEntry.Info("Configuration reloaded")
+	}
+	return event
+}
+
+// reload - the reloader must be locked
+func (r *Reloader) reload(trigger string) ReloadEvent {
+	event := ReloadEvent{Trigger: trigger}
+	reject := func(err error) ReloadEvent {
+		event.Result = ReloadRejected
+		event.Error = err.Error()
+		return event
+	}
+
+	// without a configuration file only the secret files are read again
+	var data []byte
+	if file := config.ConfigFileUsed(); file != "" {
+		var err error
+		if data, err = ioutil.ReadFile(file); err != nil {
+			return reject(err)
+		}
+	} else if trigger != TriggerSecrets {
+		return reject(errors.New("there is no configuration file to reload"))
+	}
+
+	if err := readConfiguration(data); err != nil {
+		r.restore()
+		return reject(err)
+	}
+	configuration, err := LoadConfiguration()
+	if err != nil {
+		r.restore()
+		return reject(err)
+	}
+
+	event.Changes = diffSettings("", false, reflect.ValueOf(r.current), reflect.ValueOf(configuration))
+	for _, change := range event.Changes {
+		if !change.Reloadable {
+			event.RestartRequired = append(event.RestartRequired, change.Key)
+		}
+	}
+	if len(event.RestartRequired) > 0 {
+		r.restore()
+		return reject(fmt.Errorf("restart the service to change %s", strings.Join(event.RestartRequired, ", ")))
+	}
+	if len(event.Changes) == 0 {
+		r.fileData = data
+		event.Result = ReloadUnchanged
+		return event
+	}
+
+	applies := make([]func(), 0, len(r.hooks))
+	for _, hook := range r.hooks {
+		apply, err := hook.prepare(configuration)
+		if err != nil {
+			r.restore()
+			return reject(fmt.Errorf("%s: %v", hook.name, err))
+		}
+		applies = append(applies, apply)
+	}
+	for _, apply := range applies {
+		apply()
+	}
+
+	r.current = configuration
+	r.fileData = data
+	event.Result = ReloadApplied
+	return event
+}
+
+// restore - read the configuration file content of the current configuration back
+func (r *Reloader) restore() {
+	if err := readConfiguration(r.fileData); err != nil {
+		log.WithError(err).Error("Could not restore the current configuration")
+	}
+}
+
+// readConfiguration - replace the values of the configuration file with the content and resolve the references
+// again, without a configuration file (nil content) only the references are resolved again
+func readConfiguration(data []byte) error {
+	if data != nil {
+		if err := config.ReadConfig(bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	return reloadSecrets()
+}
+
+// diffSettings - the settings of the struct values that changed. A setting is reloadable by its reload tag,
+// or the tag of its closest section that has one.
+func diffSettings(prefix string, reloadable bool, before, after reflect.Value) []SettingChange {
+	var changes []SettingChange
+	for index := 0; index < before.NumField(); index++ {
+		field := before.Type().Field(index)
+		key := prefix + field.Tag.Get("config")
+		fieldReloadable := reloadable
+		if tag, ok := field.Tag.Lookup("reload"); ok {
+			fieldReloadable = tag == "true"
+		}
+
+		beforeValue := before.Field(index).Interface()
+		afterValue := after.Field(index).Interface()
+		switch {
+		case field.Type.Kind() == reflect.Struct && field.Type != durationType:
+			changes = append(changes, diffSettings(key+".", fieldReloadable, before.Field(index), after.Field(index))...)
+		case reflect.DeepEqual(beforeValue, afterValue):
+		default:
+			changes = append(changes, SettingChange{
+				Key:        key,
+				From:       formatChangedValue(key, beforeValue),
+				To:         formatChangedValue(key, afterValue),
+				Reloadable: fieldReloadable,
+			})
+		}
+	}
+	return changes
+}
+
+// formatChangedValue - the value as text, values of secret settings are redacted
+func formatChangedValue(key string, value interface{}) string {
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+
+	text := formatValue(value)
+	if secrets.isSecretKey(key) && text != "" {
+		return Redacted
+	}
+	return secrets.redactString(text)
+}
@@ -0,0 +1,174 @@
+package application
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	log "github.com/sirupsen/logrus"
+	config "github.com/spf13/viper"
+)
+
+func TestReload(t *testing.T) {
+	defer config.Reset()
+	defer log.SetLevel(log.GetLevel())
+
+	dir, err := ioutil.TempDir("", "reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yml")
+	write := func(content string) {
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0600))
+	}
+
+	write("logging:\n  level: info\nrateLimit:\n  enabled: false\ndatabase:\n  password: first\n")
+	// the configuration file is found in the working directory
+	workingDir, _ := os.Getwd()
+	defer os.Chdir(workingDir)
+	assert.NoError(t, os.Chdir(dir))
+	InitConfig()
+	configuration, err := LoadConfiguration()
+	assert.NoError(t, err)
+
+	reloader := NewReloader(configuration)
+	var applied []Configuration
+	reloader.OnReload("test", func(configuration Configuration) (func(), error) {
+		return func() { applied = append(applied, configuration) }, nil
+	})
+
+	t.Run("Success path - reloadable settings are applied", func(t *testing.T) {
+		write("logging:\n  level: debug\nrateLimit:\n  enabled: true\ndatabase:\n  password: first\n")
+		event := reloader.Reload(TriggerSignal)
+		assert.Equal(t, ReloadApplied, event.Result)
+		assert.Equal(t, []SettingChange{
+			{Key: "logging.level", From: "info", To: "debug", Reloadable: true},
+			{Key: "rateLimit.enabled", From: "false", To: "true", Reloadable: true},
+		}, event.Changes)
+		assert.Equal(t, log.DebugLevel, log.GetLevel())
+		assert.Len(t, applied, 1)
+		assert.True(t, applied[0].RateLimit.Enabled)
+		assert.True(t, reloader.Current().RateLimit.Enabled)
+	})
+
+	t.Run("Success path - the same configuration is unchanged", func(t *testing.T) {
+		event := reloader.Reload(TriggerFile)
+		assert.Equal(t, ReloadUnchanged, event.Result)
+		assert.Len(t, applied, 1)
+	})
+
+	t.Run("Fail path - restart-only settings reject the reload", func(t *testing.T) {
+		write("logging:\n  level: warn\nrateLimit:\n  enabled: true\ndatabase:\n  password: second\nservice:\n  port: 9000\n")
+		event := reloader.Reload(TriggerSignal)
+		assert.Equal(t, ReloadRejected, event.Result)
+		assert.Equal(t, []string{"service.port"}, event.RestartRequired)
+		assert.Contains(t, event.Changes, SettingChange{Key: "database.password", From: Redacted, To: Redacted, Reloadable: true})
+		assert.Equal(t, log.DebugLevel, log.GetLevel(), "nothing is applied")
+		assert.Len(t, applied, 1)
+		assert.Equal(t, 8090, config.GetInt("service.port"), "the current configuration file is read back")
+		assert.Equal(t, "debug", config.GetString("logging.level"))
+	})
+
+	t.Run("Fail path - an invalid configuration is rejected", func(t *testing.T) {
+		write("logging:\n  level: loud\n")
+		event := reloader.Reload(TriggerSignal)
+		assert.Equal(t, ReloadRejected, event.Result)
+		assert.Contains(t, event.Error, `logging.level: unknown value "loud"`)
+		assert.Equal(t, "debug", config.GetString("logging.level"))
+	})
+
+	t.Run("Fail path - a failing part rejects the reload", func(t *testing.T) {
+		write("logging:\n  level: debug\nrateLimit:\n  enabled: true\ndatabase:\n  password: first\n")
+		failing := NewReloader(reloader.Current())
+		failing.OnReload("failing", func(Configuration) (func(), error) {
+			return nil, assert.AnError
+		})
+		write("logging:\n  level: error\nrateLimit:\n  enabled: true\ndatabase:\n  password: first\n")
+		event := failing.Reload(TriggerSignal)
+		assert.Equal(t, ReloadRejected, event.Result)
+		assert.Equal(t, "failing: "+assert.AnError.Error(), event.Error)
+		assert.Equal(t, log.DebugLevel, log.GetLevel())
+	})
+
+	t.Run("Success path - changes of the file are reloaded", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go reloader.watchFile(ctx, file)
+
+		// the watcher may not be watching yet, the file is written until the change is noticed
+		for deadline := time.Now().Add(2 * time.Second); reloader.Current().Logging.Level != "warn" && time.Now().Before(deadline); {
+			write("logging:\n  level: warn\nrateLimit:\n  enabled: true\ndatabase:\n  password: first\n")
+			time.Sleep(20 * time.Millisecond)
+		}
+		assert.Equal(t, "warn", reloader.Current().Logging.Level)
+		assert.Equal(t, log.WarnLevel, log.GetLevel())
+	})
+}
+
+func TestReloadSecrets(t *testing.T) {
+	defer config.Reset()
+
+	dir, err := ioutil.TempDir("", "reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	write := func(content string) {
+		assert.NoError(t, ioutil.WriteFile(passwordFile, []byte(content), 0600))
+	}
+
+	write("first")
+	os.Setenv("MESSAGES_DATABASE_PASSWORD_FILE", passwordFile)
+	defer os.Unsetenv("MESSAGES_DATABASE_PASSWORD_FILE")
+	// there is no configuration file in the working directory
+	workingDir, _ := os.Getwd()
+	defer os.Chdir(workingDir)
+	assert.NoError(t, os.Chdir(dir))
+	InitConfig()
+	configuration, err := LoadConfiguration()
+	assert.NoError(t, err)
+
+	reloader := NewReloader(configuration)
+	var applied []Configuration
+	reloader.OnReload("test", func(configuration Configuration) (func(), error) {
+		return func() { applied = append(applied, configuration) }, nil
+	})
+
+	t.Run("Success path - unchanged secret files are not reloaded", func(t *testing.T) {
+		assert.False(t, secretFilesChanged())
+		event := reloader.Reload(TriggerSecrets)
+		assert.Equal(t, ReloadUnchanged, event.Result)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("Success path - rotated secret files are applied", func(t *testing.T) {
+		write("second")
+		assert.True(t, secretFilesChanged())
+		event := reloader.Reload(TriggerSecrets)
+		assert.Equal(t, ReloadApplied, event.Result)
+		assert.Equal(t, []SettingChange{{Key: "database.password", From: Redacted, To: Redacted, Reloadable: true}}, event.Changes)
+		assert.Len(t, applied, 1)
+		assert.Equal(t, "second", applied[0].Database.Password)
+		assert.Equal(t, "second", config.GetString("database.password"))
+		assert.False(t, secretFilesChanged())
+	})
+
+	t.Run("Fail path - only the secret files are read again without a configuration file", func(t *testing.T) {
+		event := reloader.Reload(TriggerSignal)
+		assert.Equal(t, ReloadRejected, event.Result)
+		assert.Equal(t, "there is no configuration file to reload", event.Error)
+	})
+
+	t.Run("Fail path - a secret file that can't be read rejects the reload", func(t *testing.T) {
+		assert.NoError(t, os.Remove(passwordFile))
+		assert.True(t, secretFilesChanged())
+		event := reloader.Reload(TriggerSecrets)
+		assert.Equal(t, ReloadRejected, event.Result)
+		assert.Contains(t, event.Error, "database.password")
+		assert.Len(t, applied, 1)
+		assert.Equal(t, "second", reloader.Current().Database.Password)
+	})
+}
@@ -0,0 +1,411 @@
+package application
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+	config "github.com/spf13/viper"
+)
+
+// Redacted - replaces secret values in logs and configuration dumps
+const Redacted = "[REDACTED]"
+
+const (
+	// envPrefix - the prefix of the environment variables overriding configuration values
+	envPrefix = "MESSAGES_"
+	// fileEnvSuffix - environment variables with this suffix name a file holding the value of the variable without it
+	fileEnvSuffix = "_FILE"
+	// minSecretLength - shorter secret values are not redacted from log messages, they would redact ordinary words
+	minSecretLength = 4
+)
+
+var (
+	// referencePattern - ${env:NAME} and ${file:PATH} references in configuration values
+	referencePattern = regexp.MustCompile(`\$\{(env|file):([^}]*)\}`)
+	// secretKeyPattern - the names of settings whose values are secrets
+	secretKeyPattern = regexp.MustCompile(`(?i)(password|secret|token)$`)
+)
+
+// secretStore - the configuration values read from files, kept to notice rotated files,
+// and the secret values redacted from logs
+type secretStore struct {
+	mutex sync.RWMutex
+	// references - the configuration value of each key holding file references, before resolving them
+	references map[string]interface{}
+	// resolved - the resolved value of each key in references
+	resolved map[string]interface{}
+	// fileKeys - the keys of values read from files, all of them are secrets
+	fileKeys map[string]bool
+	// values - the secret values, longest first
+	values []string
+	// keys - the keys set when resolving, dropped before resolving a reloaded configuration file
+	keys []string
+	// err - why the last resolving failed, reported as a problem of the configuration
+	err error
+}
+
+var secrets = &secretStore{}
+
+// resolveSecrets - set the configuration values given by *_FILE environment variables and resolve
+// the ${env:NAME} and ${file:PATH} references of all the configuration values
+func resolveSecrets() error {
+	secrets.mutex.Lock()
+	defer secrets.mutex.Unlock()
+
+	secrets.err = secrets.resolve()
+	return secrets.err
+}
+
+// reloadSecrets - resolve the references again after the configuration file was read again,
+// the values resolved before are dropped so the references of the new file are used
+func reloadSecrets() error {
+	secrets.mutex.Lock()
+	defer secrets.mutex.Unlock()
+
+	for _, key := range secrets.keys {
+		config.Set(key, nil)
+	}
+	secrets.err = secrets.resolve()
+	return secrets.err
+}
+
+// secretsError - why the secrets of the configuration could not be resolved, nil when they were
+func secretsError() error {
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+
+	return secrets.err
+}
+
+// resolve - the store must be locked
+func (ss *secretStore) resolve() error {
+	ss.references = make(map[string]interface{})
+	ss.resolved = make(map[string]interface{})
+	ss.fileKeys = make(map[string]bool)
+	ss.keys = nil
+	defer ss.collectValues()
+
+	// MESSAGES_DATABASE_PASSWORD_FILE=/run/secrets/db sets database.password to the content of the file
+	for _, variable := range os.Environ() {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if !strings.HasPrefix(name, envPrefix) || !strings.HasSuffix(name, fileEnvSuffix) || len(name) <= len(envPrefix)+len(fileEnvSuffix) {
+			continue
+		}
+		valueName := strings.TrimSuffix(name, fileEnvSuffix)
+		if _, ok := os.LookupEnv(valueName); ok {
+			return fmt.Errorf("both %s and %s are set, set only one of them", valueName, name)
+		}
+		key := strings.ToLower(strings.Replace(strings.TrimPrefix(valueName, envPrefix), "_", ".", -1))
+		config.Set(key, "${file:"+os.Getenv(name)+"}")
+		ss.keys = append(ss.keys, key)
+	}
+
+	for _, key := range config.AllKeys() {
+		value := config.Get(key)
+		if !hasReference(value) {
+			continue
+		}
+		fileKeys := make(map[string]bool)
+		resolvedValue, err := resolveReferences(key, value, fileKeys)
+		if err != nil {
+			return err
+		}
+		config.Set(key, resolvedValue)
+		ss.keys = append(ss.keys, key)
+		if len(fileKeys) > 0 {
+			ss.references[key] = value
+			ss.resolved[key] = resolvedValue
+		}
+		for fileKey := range fileKeys {
+			ss.fileKeys[fileKey] = true
+		}
+	}
+	return nil
+}
+
+// secretFilesChanged - reports if any secret file reads differently than when the configuration was resolved,
+// a file that can't be read any more is a change too so reloading reports it
+func secretFilesChanged() bool {
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+
+	for key, value := range secrets.references {
+		resolvedValue, err := resolveReferences(key, value, make(map[string]bool))
+		if err != nil || !reflect.DeepEqual(resolvedValue, secrets.resolved[key]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasReference - reports if any string in the value holds a reference
+func hasReference(value interface{}) bool {
+	switch typed := value.(type) {
+	case string:
+		return referencePattern.MatchString(typed)
+	case []interface{}:
+		for _, item := range typed {
+			if hasReference(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range typed {
+			if hasReference(item) {
+				return true
+			}
+		}
+	case map[interface{}]interface{}:
+		for _, item := range typed {
+			if hasReference(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveReferences - a copy of the value of the key with the references in its strings replaced,
+// the keys of strings with file references are added to fileKeys
+func resolveReferences(key string, value interface{}, fileKeys map[string]bool) (interface{}, error) {
+	switch typed := value.(type) {
+	case string:
+		return resolveString(key, typed, fileKeys)
+	case []interface{}:
+		resolved := make([]interface{}, len(typed))
+		for index, item := range typed {
+			var err error
+			if resolved[index], err = resolveReferences(key, item, fileKeys); err != nil {
+				return nil, err
+			}
+		}
+		return resolved, nil
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(typed))
+		for name, item := range typed {
+			var err error
+			if resolved[name], err = resolveReferences(key+"."+name, item, fileKeys); err != nil {
+				return nil, err
+			}
+		}
+		return resolved, nil
+	case map[interface{}]interface{}:
+		resolved := make(map[interface{}]interface{}, len(typed))
+		for name, item := range typed {
+			var err error
+			if resolved[name], err = resolveReferences(fmt.Sprintf("%s.%v", key, name), item, fileKeys); err != nil {
+				return nil, err
+			}
+		}
+		return resolved, nil
+	}
+	return value, nil
+}
+
+// resolveString - the value with its references replaced, environment variables must be set and files must be readable
+func resolveString(key string, value string, fileKeys map[string]bool) (string, error) {
+	var err error
+	resolved := referencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		match := referencePattern.FindStringSubmatch(reference)
+		kind, name := match[1], match[2]
+		if err != nil {
+			return reference
+		}
+
+		if kind == "env" {
+			resolvedValue, ok := os.LookupEnv(name)
+			if !ok {
+				err = fmt.Errorf("%s: environment variable %s is not set", key, name)
+			}
+			return resolvedValue
+		}
+
+		fileKeys[strings.ToLower(key)] = true
+		data, readErr := ioutil.ReadFile(name)
+		if readErr != nil {
+			err = errors.Wrap(readErr, key)
+			return reference
+		}
+		// secret files usually end with a new line that is not part of the secret
+		return strings.TrimRight(string(data), "\r\n")
+	})
+	return resolved, err
+}
+
+// collectValues - collect the secret values of the configuration to redact them from logs, the store must be locked
+func (ss *secretStore) collectValues() {
+	unique := make(map[string]bool)
+	for _, key := range config.AllKeys() {
+		ss.walkValues(key, config.Get(key), unique)
+	}
+	// the password of a connection string is a secret as well
+	if uri, err := url.Parse(config.GetString("database.uri")); err == nil && uri.User != nil {
+		if password, ok := uri.User.Password(); ok {
+			unique[password] = true
+		}
+	}
+
+	ss.values = ss.values[:0]
+	for value := range unique {
+		if len(value) >= minSecretLength {
+			ss.values = append(ss.values, value)
+		}
+	}
+	// a secret containing another secret is redacted first
+	sort.Slice(ss.values, func(i, j int) bool { return len(ss.values[i]) > len(ss.values[j]) })
+}
+
+// walkValues - add the strings of secret keys in the value of the key to values
+func (ss *secretStore) walkValues(key string, value interface{}, values map[string]bool) {
+	switch typed := value.(type) {
+	case string:
+		if ss.isSecretKey(key) {
+			values[typed] = true
+		}
+	case []interface{}:
+		for _, item := range typed {
+			ss.walkValues(key, item, values)
+		}
+	case map[string]interface{}:
+		for name, item := range typed {
+			ss.walkValues(key+"."+name, item, values)
+		}
+	case map[interface{}]interface{}:
+		for name, item := range typed {
+			ss.walkValues(fmt.Sprintf("%s.%v", key, name), item, values)
+		}
+	}
+}
+
+// isSecretKey - reports if the value of the key is a secret, by its name or because it was read from a file
+func (ss *secretStore) isSecretKey(key string) bool {
+	if ss.fileKeys[strings.ToLower(key)] {
+		return true
+	}
+	segments := strings.Split(key, ".")
+	if secretKeyPattern.MatchString(segments[len(segments)-1]) {
+		return true
+	}
+	// headers carry credentials, such as the headers of trace exports
+	for _, segment := range segments {
+		if strings.EqualFold(segment, "headers") {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactedSettings - all the configuration settings with the secret values redacted, to be dumped
+func RedactedSettings() map[string]interface{} {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+
+	redacted := make(map[string]interface{})
+	for key, value := range config.AllSettings() {
+		redacted[key] = secrets.redact(key, value)
+	}
+	return redacted
+}
+
+// redact - a copy of the value of the key with the strings of secret keys redacted
+func (ss *secretStore) redact(key string, value interface{}) interface{} {
+	switch typed := value.(type) {
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for index, item := range typed {
+			redacted[index] = ss.redact(key, item)
+		}
+		return redacted
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(typed))
+		for name, item := range typed {
+			redacted[name] = ss.redact(key+"."+name, item)
+		}
+		return redacted
+	case map[interface{}]interface{}:
+		redacted := make(map[string]interface{}, len(typed))
+		for name, item := range typed {
+			redacted[fmt.Sprint(name)] = ss.redact(fmt.Sprintf("%s.%v", key, name), item)
+		}
+		return redacted
+	case string:
+		if ss.isSecretKey(key) {
+			if typed == "" {
+				return typed
+			}
+			return Redacted
+		}
+		return ss.redactString(typed)
+	}
+	return value
+}
+
+// redactString - the text with the secret values in it replaced
+func (ss *secretStore) redactString(text string) string {
+	for _, value := range ss.values {
+		if strings.Contains(text, value) {
+			text = strings.Replace(text, value, Redacted, -1)
+		}
+	}
+	return text
+}
+
+// SecretsLogHook - redacts the secret values of the configuration from the messages and the fields of log entries
+type SecretsLogHook struct{}
+
+// Levels - implementation of log.Hook, all levels
+func (SecretsLogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire - implementation of log.Hook
+func (SecretsLogHook) Fire(entry *log.Entry) error {
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+	if len(secrets.values) == 0 {
+		return nil
+	}
+
+	entry.Message = secrets.redactString(entry.Message)
+
+	// the fields may be shared with other entries, a redacted copy is made
+	var data log.Fields
+	for name, value := range entry.Data {
+		var text string
+		switch typed := value.(type) {
+		case string:
+			text = typed
+		case error:
+			text = typed.Error()
+		case fmt.Stringer:
+			text = typed.String()
+		default:
+			continue
+		}
+		if redacted := secrets.redactString(text); redacted != text {
+			if data == nil {
+				data = make(log.Fields, len(entry.Data))
+				for copiedName, copiedValue := range entry.Data {
+					data[copiedName] = copiedValue
+				}
+			}
+			data[name] = redacted
+		}
+	}
+	if data != nil {
+		entry.Data = data
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package application
+
+import (
+	"time"
+)
+
+// The configuration of the service. Each setting is described by the tags of its field:
+// config - the name of the setting, description - shown in the JSON schema,
+// enum - the allowed values separated by |, min and max - the allowed range of numbers and durations,
+// reload - "true" when changes are applied by reloading the configuration, inherited by the settings of sections.
+
+// Configuration - the settings of the service, from the defaults, the configuration file and the environment
+type Configuration struct {
+	Service     ServiceSettings     `config:"service"`
+	Metrics     MetricsSettings     `config:"metrics"`
+	Admin       AdminSettings       `config:"admin"`
+	Health      HealthSettings      `config:"health"`
+	CORS        CORSSettings        `config:"cors" reload:"true"`
+	Logging     LoggingSettings     `config:"logging"`
+	Reload      ReloadSettings      `config:"reload"`
+	Secrets     SecretsSettings     `config:"secrets"`
+	Tracing     TracingSettings     `config:"tracing"`
+	Database    DatabaseSettings    `config:"database"`
+	Tenancy     TenancySettings     `config:"tenancy"`
+	RateLimit   RateLimitSettings   `config:"rateLimit" reload:"true"`
+	Quotas      QuotaSettings       `config:"quotas" reload:"true"`
+	Idempotency IdempotencySettings `config:"idempotency"`
+	Auth        AuthSettings        `config:"auth"`
+	Validation  ValidationSettings  `config:"validation" reload:"true"`
+	Analysis    AnalysisSettings    `config:"analysis" reload:"true"`
+}
+
+// ServiceSettings - the "service" section
+type ServiceSettings struct {
+	Port                  int           `config:"port" min:"1" max:"65535" description:"TCP port that the service listens on"`
+	ShutdownDelay         time.Duration `config:"shutdownDelay" min:"0s" description:"Requests are still served this long after readiness fails on shutdown"`
+	ShutdownGraceDuration time.Duration `config:"shutdownGraceDuration" min:"0s" description:"In-flight requests and cleanup must finish within this period"`
+	Mode                  string        `config:"mode" enum:"normal|read-only|maintenance" reload:"true" description:"read-only rejects changes of messages, maintenance serves the health endpoints only"`
+	ModeRetryAfter        time.Duration `config:"modeRetryAfter" min:"1s" description:"The Retry-After of requests rejected because of the mode"`
+}
+
+// MetricsSettings - the "metrics" section
+type MetricsSettings struct {
+	Port int `config:"port" min:"0" max:"65535" description:"TCP port that metrics are served on, the service port when empty"`
+}
+
+// AdminSettings - the "admin" section
+type AdminSettings struct {
+	Port    int    `config:"port" min:"0" max:"65535" description:"TCP port that the admin API is served on, disabled when empty"`
+	Address string `config:"address" description:"The address the admin API listens on, the loopback interface by default so it is reachable from within the host only"`
+}
+
+// HealthSettings - the "health" section
+type HealthSettings struct {
+	Timeout time.Duration `config:"timeout" min:"1ms" description:"Each health check must complete within this duration"`
+}
+
+// CORSSettings - the "cors" section
+type CORSSettings struct {
+	Enabled          bool          `config:"enabled" description:"Answer the cross-origin requests of browsers from the allowed origins"`
+	AllowedOrigins   []string      `config:"allowedOrigins" description:"The origins allowed to call the service, such as https://app.example.com, * allows any origin"`
+	AllowedMethods   []string      `config:"allowedMethods" description:"The methods cross-origin requests may use"`
+	AllowedHeaders   []string      `config:"allowedHeaders" description:"The request headers cross-origin requests may send"`
+	ExposedHeaders   []string      `config:"exposedHeaders" description:"The response headers the pages of the allowed origins may read"`
+	AllowCredentials bool          `config:"allowCredentials" description:"Browsers may send credentials such as cookies, not allowed with the * origin"`
+	MaxAge           time.Duration `config:"maxAge" min:"0s" description:"How long browsers cache the answer of a preflight request"`
+}
+
+// LoggingSettings - the "logging" section
+type LoggingSettings struct {
+	Level string `config:"level" enum:"panic|fatal|error|warn|warning|info|debug|trace" reload:"true" description:"The minimal level of logged entries"`
+}
+
+// ReloadSettings - the "reload" section
+type ReloadSettings struct {
+	WatchFile bool `config:"watchFile" description:"Reload the configuration when the configuration file changes, SIGHUP always reloads it"`
+}
+
+// SecretsSettings - the "secrets" section
+type SecretsSettings struct {
+	RefreshInterval time.Duration `config:"refreshInterval" min:"0s" description:"Secret files are read again this often and the configuration is reloaded when one changed, 0 disables it"`
+}
+
+// TracingSettings - the "tracing" section
+type TracingSettings struct {
+	Enabled     bool                `config:"enabled" description:"Record and export traces"`
+	ServiceName string              `config:"serviceName" description:"The service name of exported spans"`
+	Exporter    string              `config:"exporter" enum:"otlp|stdout|file" description:"Where spans are exported to"`
+	SampleRatio float64             `config:"sampleRatio" min:"0" max:"1" description:"The part of new traces recorded"`
+	OTLP        TracingOTLPSettings `config:"otlp"`
+	File        TracingFileSettings `config:"file"`
+}
+
+// TracingOTLPSettings - the "tracing.otlp" section
+type TracingOTLPSettings struct {
+	Endpoint string            `config:"endpoint" description:"The OTLP/HTTP traces endpoint of the collector"`
+	Timeout  time.Duration     `config:"timeout" min:"1ms" description:"The timeout of each export request"`
+	Headers  map[string]string `config:"headers" description:"Headers sent with each export request"`
+}
+
+// TracingFileSettings - the "tracing.file" section
+type TracingFileSettings struct {
+	Path string `config:"path" description:"The file spans are appended to"`
+}
+
+// DatabaseSettings - the "database" section
+type DatabaseSettings struct {
+	Type                   string                 `config:"type" enum:"memory|mongo" description:"mongo to work against MongoDB, memory to keep everything in memory"`
+	URI                    string                 `config:"uri" description:"A mongodb:// or mongodb+srv:// connection string, instead of the server"`
+	Server                 string                 `config:"server" description:"host:port of the server, or a comma separated list of them"`
+	DBName                 string                 `config:"dbname" description:"The database to work against"`
+	Username               string                 `config:"username" reload:"true" description:"Reloaded by connecting again with the new credentials"`
+	Password               string                 `config:"password" reload:"true" description:"Reloaded by connecting again with the new credentials"`
+	AuthSource             string                 `config:"authSource" description:"The database the user is defined in"`
+	AuthMechanism          string                 `config:"authMechanism" enum:"SCRAM-SHA-256|SCRAM-SHA-1|MONGODB-CR|PLAIN|GSSAPI|MONGODB-X509"`
+	ReplicaSet             string                 `config:"replicaSet" description:"The name of the replica set"`
+	TLS                    DatabaseTLSSettings    `config:"tls"`
+	ReadPreference         string                 `config:"readPreference" enum:"primary|primaryPreferred|secondary|secondaryPreferred|nearest"`
+	WriteConcern           WriteConcernSettings   `config:"writeConcern"`
+	Pool                   PoolSettings           `config:"pool"`
+	ServerSelectionTimeout time.Duration          `config:"serverSelectionTimeout" min:"0s" description:"How long operations wait for a suitable server"`
+	Timeout                time.Duration          `config:"timeout" min:"1ms" description:"The timeout of operations without a timeout of their own in timeouts"`
+	Timeouts               DatabaseTimeouts       `config:"timeouts"`
+	ConnectRetry           ConnectRetrySettings   `config:"connectRetry"`
+	CircuitBreaker         CircuitBreakerSettings `config:"circuitBreaker"`
+}
+
+// DatabaseTLSSettings - the "database.tls" section
+type DatabaseTLSSettings struct {
+	Enabled                bool   `config:"enabled" description:"Connect with TLS"`
+	CAFile                 string `config:"caFile" description:"A PEM file with the certificate authorities verifying the server"`
+	CertificateKeyFile     string `config:"certificateKeyFile" description:"A PEM file with a client certificate and key"`
+	CertificateKeyPassword string `config:"certificateKeyPassword" description:"The password of an encrypted client key"`
+	Insecure               bool   `config:"insecure" description:"Skip verifying the server certificate"`
+}
+
+// WriteConcernSettings - the "database.writeConcern" section
+type WriteConcernSettings struct {
+	W       string        `config:"w" description:"majority, a number of members or a tag set"`
+	Journal bool          `config:"journal" description:"Acknowledge writes once written to the journal"`
+	Timeout time.Duration `config:"timeout" min:"0s" description:"How long to wait for the acknowledgement"`
+}
+
+// PoolSettings - the "database.pool" section
+type PoolSettings struct {
+	MaxSize     int           `config:"maxSize" min:"0" max:"65535" description:"The maximal size of the connection pool"`
+	MaxIdleTime time.Duration `config:"maxIdleTime" min:"0s" description:"Idle connections are closed after this duration"`
+}
+
+// DatabaseTimeouts - the "database.timeouts" section
+type DatabaseTimeouts struct {
+	Connect time.Duration `config:"connect" min:"1ms"`
+	Ping    time.Duration `config:"ping" min:"1ms"`
+	Read    time.Duration `config:"read" min:"1ms"`
+	Write   time.Duration `config:"write" min:"1ms"`
+	Stream  time.Duration `config:"stream" min:"1ms" description:"Fetching each batch of a streamed list"`
+	Index   time.Duration `config:"index" min:"1ms" description:"Creating indexes at startup"`
+}
+
+// ConnectRetrySettings - the "database.connectRetry" section
+type ConnectRetrySettings struct {
+	InitialBackoff time.Duration `config:"initialBackoff" min:"0s"`
+	MaxBackoff     time.Duration `config:"maxBackoff" min:"0s"`
+	Multiplier     float64       `config:"multiplier" min:"1"`
+	Jitter         float64       `config:"jitter" min:"0" max:"1"`
+	MaxAttempts    int           `config:"maxAttempts" min:"0" description:"Attempts to connect at startup, 0 retries until stopped"`
+}
+
+// CircuitBreakerSettings - the "database.circuitBreaker" section
+type CircuitBreakerSettings struct {
+	Enabled          bool          `config:"enabled" description:"Fail database calls fast while the database is down"`
+	FailureThreshold int           `config:"failureThreshold" min:"1" description:"Consecutive failures opening the breaker"`
+	OpenDuration     time.Duration `config:"openDuration" min:"1ms" description:"How long calls fail fast before a trial call"`
+}
+
+// TenancySettings - the "tenancy" section
+type TenancySettings struct {
+	Enabled       bool          `config:"enabled" description:"Serve several tenants"`
+	Header        string        `config:"header" description:"The request header naming the tenant"`
+	Domain        string        `config:"domain" description:"Tenants are named by the subdomain of this domain"`
+	DefaultTenant string        `config:"defaultTenant" description:"The tenant of requests naming no tenant"`
+	Isolation     string        `config:"isolation" enum:"field|database" description:"How the messages of tenants are kept apart in mongo"`
+	CacheTTL      time.Duration `config:"cacheTTL" min:"0s" description:"How long tenants are cached"`
+}
+
+// RateLimitSettings - the "rateLimit" section
+type RateLimitSettings struct {
+	Enabled        bool                          `config:"enabled" description:"Limit the request rate of clients"`
+	TrustedProxies []string                      `config:"trustedProxies" reload:"false" description:"Proxies whose X-Forwarded-For headers name the clients of requests"`
+	Default        RouteLimitSettings            `config:"default" description:"The limit of routes without a limit of their own"`
+	Routes         map[string]RouteLimitSettings `config:"routes" description:"The limits of routes, by METHOD /path"`
+}
+
+// RouteLimitSettings - the rate limit of a route
+type RouteLimitSettings struct {
+	Requests int                      `config:"requests" min:"0"`
+	Per      time.Duration            `config:"per" min:"0s"`
+	Burst    int                      `config:"burst" min:"0"`
+	Roles    map[string]LimitSettings `config:"roles" description:"The limits of roles"`
+}
+
+// LimitSettings - a rate limit
+type LimitSettings struct {
+	Requests int           `config:"requests" min:"0"`
+	Per      time.Duration `config:"per" min:"0s"`
+	Burst    int           `config:"burst" min:"0"`
+}
+
+// QuotaSettings - the "quotas" section
+type QuotaSettings struct {
+	Enabled      bool           `config:"enabled" description:"Limit the writes of clients per day"`
+	WritesPerDay int            `config:"writesPerDay" min:"0"`
+	Roles        map[string]int `config:"roles" description:"The writes per day of roles, 0 is unlimited"`
+}
+
+// IdempotencySettings - the "idempotency" section
+type IdempotencySettings struct {
+	Enabled     bool          `config:"enabled" description:"Replay the responses of repeated Idempotency-Key requests"`
+	TTL         time.Duration `config:"ttl" min:"1s"`
+	LockTimeout time.Duration `config:"lockTimeout" min:"1s"`
+}
+
+// AuthSettings - the "auth" section
+type AuthSettings struct {
+	Enabled bool           `config:"enabled" description:"Authenticate requests, every request is served as an admin when false"`
+	JWT     JWTSettings    `config:"jwt"`
+	APIKeys APIKeySettings `config:"apiKeys"`
+	Users   UserSettings   `config:"users"`
+}
+
+// JWTSettings - the "auth.jwt" section
+type JWTSettings struct {
+	Issuer      string            `config:"issuer"`
+	Audience    string            `config:"audience"`
+	Leeway      time.Duration     `config:"leeway" min:"0s"`
+	RolesClaim  string            `config:"rolesClaim"`
+	RoleMapping map[string]string `config:"roleMapping" description:"Roles of claim values"`
+	TenantClaim string            `config:"tenantClaim"`
+	JWKSFile    string            `config:"jwksFile" reload:"true" description:"A JSON Web Key Set file with verification keys"`
+	Keys        []JWTKeySettings  `config:"keys" reload:"true"`
+}
+
+// JWTKeySettings - a key of the "auth.jwt.keys" list
+type JWTKeySettings struct {
+	ID            string `config:"kid"`
+	Algorithm     string `config:"alg" enum:"HS256|RS256|EdDSA"`
+	Secret        string `config:"secret" description:"The secret of an HS256 key"`
+	PublicKey     string `config:"publicKey" description:"A PEM public key"`
+	PublicKeyFile string `config:"publicKeyFile" description:"A PEM public key file"`
+}
+
+// APIKeySettings - the "auth.apiKeys" section
+type APIKeySettings struct {
+	Enabled bool `config:"enabled" description:"Accept API keys"`
+}
+
+// UserSettings - the "auth.users" section
+type UserSettings struct {
+	Enabled          bool          `config:"enabled" description:"Serve user accounts"`
+	SigningKey       string        `config:"signingKey" description:"The kid of the auth.jwt.keys secret tokens are signed with"`
+	TokenTTL         time.Duration `config:"tokenTTL" min:"1s"`
+	DefaultRoles     []string      `config:"defaultRoles" enum:"reader|contributor|editor|admin"`
+	PasswordHashCost int           `config:"passwordHashCost" min:"4" max:"31" description:"The bcrypt work factor of password hashes"`
+	MaxFailedLogins  int           `config:"maxFailedLogins" min:"0"`
+	LockoutDuration  time.Duration `config:"lockoutDuration" min:"0s"`
+	ResetTokenTTL    time.Duration `config:"resetTokenTTL" min:"1s"`
+}
+
+// ValidationSettings - the "validation" section, rules that are not set keep their defaults
+type ValidationSettings struct {
+	Content   StringRuleSettings `config:"content"`
+	Author    StringRuleSettings `config:"author"`
+	CreatedAt TimeRuleSettings   `config:"createdAt"`
+	Username  StringRuleSettings `config:"username"`
+	Password  StringRuleSettings `config:"password"`
+}
+
+// StringRuleSettings - the validation rule of a string field
+type StringRuleSettings struct {
+	Required  bool     `config:"required"`
+	MinLength int      `config:"minLength" min:"0"`
+	MaxLength int      `config:"maxLength" min:"0"`
+	Pattern   string   `config:"pattern" description:"A regular expression the value must match"`
+	Charsets  []string `config:"charsets" enum:"letter|mark|number|space|punctuation|symbol"`
+}
+
+// TimeRuleSettings - the validation rule of a time field
+type TimeRuleSettings struct {
+	Required    bool          `config:"required"`
+	NotInFuture bool          `config:"notInFuture"`
+	ClockSkew   time.Duration `config:"clockSkew" min:"0s"`
+}
+
+// AnalysisSettings - the "analysis" section
+type AnalysisSettings struct {
+	Analyzers []string `config:"analyzers" enum:"palindrome|length|wordCount" description:"The analyzers of expand=analysis, all of them when empty"`
+}
@@ -0,0 +1,356 @@
+package application
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/spf13/viper"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ConfigurationError - the problems of an invalid configuration
+type ConfigurationError struct {
+	Problems []string
+}
+
+func (ce ConfigurationError) Error() string {
+	return "Invalid configuration: " + strings.Join(ce.Problems, "; ")
+}
+
+// LoadConfiguration - read the configuration into its typed settings and validate it.
+// All the problems of the configuration are reported in the returned ConfigurationError.
+func LoadConfiguration() (Configuration, error) {
+	var configuration Configuration
+	loader := &settingsLoader{}
+	if err := secretsError(); err != nil {
+		loader.problem("%v", err)
+	}
+	loader.loadStruct("", reflect.ValueOf(&configuration).Elem())
+	loader.checkUnknownKeys(config.AllKeys())
+
+	if len(loader.problems) > 0 {
+		return configuration, ConfigurationError{Problems: loader.problems}
+	}
+	return configuration, nil
+}
+
+// settingsLoader - reads settings from the configuration, collecting the problems of the settings
+type settingsLoader struct {
+	problems []string
+	// known - the lower case keys of the settings
+	known map[string]bool
+	// sections - the lower case keys of the sections
+	sections map[string]bool
+	// open - the lower case keys of maps and lists, whose keys are checked when they are decoded
+	open []string
+}
+
+func (sl *settingsLoader) problem(format string, args ...interface{}) {
+	sl.problems = append(sl.problems, fmt.Sprintf(format, args...))
+}
+
+// loadStruct - read each setting of the struct from the configuration, so environment variables override them
+func (sl *settingsLoader) loadStruct(prefix string, target reflect.Value) {
+	if sl.known == nil {
+		sl.known = make(map[string]bool)
+		sl.sections = make(map[string]bool)
+	}
+	for index := 0; index < target.NumField(); index++ {
+		field := target.Type().Field(index)
+		key := prefix + field.Tag.Get("config")
+
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			if field.Type != durationType {
+				sl.sections[strings.ToLower(key)] = true
+				sl.loadStruct(key+".", target.Field(index))
+				continue
+			}
+		case reflect.Map, reflect.Slice:
+			sl.open = append(sl.open, strings.ToLower(key))
+		}
+
+		sl.known[strings.ToLower(key)] = true
+		if value := config.Get(key); value != nil {
+			sl.decode(key, field, value, target.Field(index))
+		}
+	}
+}
+
+// checkUnknownKeys - report the keys with a value that are not settings, such as misspelled ones
+func (sl *settingsLoader) checkUnknownKeys(keys []string) {
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch {
+		case sl.known[key] || sl.inOpen(key) || config.Get(key) == nil:
+		case sl.sections[key]:
+			sl.problem("%s: must be a map of settings", key)
+		default:
+			sl.problem("%s: unknown setting", key)
+		}
+	}
+}
+
+func (sl *settingsLoader) inOpen(key string) bool {
+	for _, open := range sl.open {
+		if strings.HasPrefix(key, open+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// decode - convert the value of the key to the type of the target and check it against the tags of the field
+func (sl *settingsLoader) decode(key string, field reflect.StructField, value interface{}, target reflect.Value) {
+	if target.Type() == durationType {
+		duration, ok := toDuration(value)
+		if !ok {
+			sl.problem("%s: %q is not a duration, use a number with a unit such as 10s", key, fmt.Sprint(value))
+			return
+		}
+		target.SetInt(int64(duration))
+		sl.checkRange(key, field, float64(duration), func(limit string) (float64, error) {
+			limitDuration, err := time.ParseDuration(limit)
+			return float64(limitDuration), err
+		}, func(value float64) string { return time.Duration(value).String() })
+		return
+	}
+
+	switch target.Kind() {
+	case reflect.String:
+		text, ok := toString(value)
+		if !ok {
+			sl.problem("%s: must be a text", key)
+			return
+		}
+		target.SetString(text)
+		sl.checkEnum(key, field, text)
+
+	case reflect.Bool:
+		switch typed := value.(type) {
+		case bool:
+			target.SetBool(typed)
+		case string:
+			parsed, err := strconv.ParseBool(typed)
+			if err != nil {
+				sl.problem("%s: %q is not true or false", key, typed)
+				return
+			}
+			target.SetBool(parsed)
+		default:
+			sl.problem("%s: %v is not true or false", key, value)
+		}
+
+	case reflect.Int:
+		number, ok := toNumber(value)
+		if !ok || number != math.Trunc(number) {
+			sl.problem("%s: %q is not a whole number", key, fmt.Sprint(value))
+			return
+		}
+		target.SetInt(int64(number))
+		sl.checkRange(key, field, number, parseNumber, formatNumber)
+
+	case reflect.Float64:
+		number, ok := toNumber(value)
+		if !ok {
+			sl.problem("%s: %q is not a number", key, fmt.Sprint(value))
+			return
+		}
+		target.SetFloat(number)
+		sl.checkRange(key, field, number, parseNumber, formatNumber)
+
+	case reflect.Slice:
+		items, ok := toList(value)
+		if !ok {
+			sl.problem("%s: must be a list", key)
+			return
+		}
+		list := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for index, item := range items {
+			sl.decode(fmt.Sprintf("%s[%d]", key, index), field, item, list.Index(index))
+		}
+		target.Set(list)
+
+	case reflect.Map:
+		entries, ok := toMap(value)
+		if !ok {
+			sl.problem("%s: must be a map", key)
+			return
+		}
+		settings := reflect.MakeMap(target.Type())
+		for _, name := range sortedKeys(entries) {
+			entry := reflect.New(target.Type().Elem()).Elem()
+			sl.decode(key+"."+name, field, entries[name], entry)
+			settings.SetMapIndex(reflect.ValueOf(name), entry)
+		}
+		target.Set(settings)
+
+	case reflect.Struct:
+		// the structs of maps and lists, such as rate limits of routes, are decoded from their values
+		entries, ok := toMap(value)
+		if !ok {
+			sl.problem("%s: must be a map", key)
+			return
+		}
+		known := make(map[string]bool)
+		for index := 0; index < target.NumField(); index++ {
+			itemField := target.Type().Field(index)
+			name := itemField.Tag.Get("config")
+			known[strings.ToLower(name)] = true
+			for entryName, entryValue := range entries {
+				if strings.EqualFold(entryName, name) && entryValue != nil {
+					sl.decode(key+"."+name, itemField, entryValue, target.Field(index))
+				}
+			}
+		}
+		for _, name := range sortedKeys(entries) {
+			if !known[strings.ToLower(name)] {
+				sl.problem("%s.%s: unknown setting", key, name)
+			}
+		}
+	}
+}
+
+// checkEnum - report a value that is not one of the values of the enum tag, empty values are not set
+func (sl *settingsLoader) checkEnum(key string, field reflect.StructField, value string) {
+	enum := field.Tag.Get("enum")
+	if enum == "" || value == "" {
+		return
+	}
+	allowed := strings.Split(enum, "|")
+	for _, name := range allowed {
+		if strings.EqualFold(name, value) {
+			return
+		}
+	}
+	sl.problem("%s: unknown value %q, one of %s", key, value, strings.Join(allowed, ", "))
+}
+
+// checkRange - report a value outside the min and max tags
+func (sl *settingsLoader) checkRange(key string, field reflect.StructField, value float64, parse func(string) (float64, error), format func(float64) string) {
+	min, hasMin := field.Tag.Lookup("min")
+	max, hasMax := field.Tag.Lookup("max")
+	minValue, _ := parse(min)
+	maxValue, _ := parse(max)
+
+	switch {
+	case hasMin && hasMax && (value < minValue || value > maxValue):
+		sl.problem("%s: must be between %s and %s, got %s", key, format(minValue), format(maxValue), format(value))
+	case hasMin && !hasMax && value < minValue:
+		sl.problem("%s: must be at least %s, got %s", key, format(minValue), format(value))
+	case hasMax && !hasMin && value > maxValue:
+		sl.problem("%s: must be at most %s, got %s", key, format(maxValue), format(value))
+	}
+}
+
+func parseNumber(text string) (float64, error) {
+	return strconv.ParseFloat(text, 64)
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// toDuration - durations must have a unit, only 0 is allowed without one
+func toDuration(value interface{}) (time.Duration, bool) {
+	switch typed := value.(type) {
+	case time.Duration:
+		return typed, true
+	case string:
+		if typed == "" || typed == "0" {
+			return 0, true
+		}
+		duration, err := time.ParseDuration(typed)
+		return duration, err == nil
+	}
+	number, ok := toNumber(value)
+	return 0, ok && number == 0
+}
+
+// toString - texts, and numbers and booleans written without quotes
+func toString(value interface{}) (string, bool) {
+	switch typed := value.(type) {
+	case string:
+		return typed, true
+	case bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return fmt.Sprint(typed), true
+	}
+	return "", false
+}
+
+// toNumber - numbers, and texts of numbers such as environment variables, an empty text is 0
+func toNumber(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case uint:
+		return float64(typed), true
+	case uint32:
+		return float64(typed), true
+	case uint64:
+		return float64(typed), true
+	case float32:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	case string:
+		if strings.TrimSpace(typed) == "" {
+			return 0, true
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(typed), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// toList - lists, and texts of space separated values such as environment variables
+func toList(value interface{}) ([]interface{}, bool) {
+	if text, ok := value.(string); ok {
+		var items []interface{}
+		for _, item := range strings.Fields(text) {
+			items = append(items, item)
+		}
+		return items, true
+	}
+	list := reflect.ValueOf(value)
+	if list.Kind() != reflect.Slice {
+		return nil, false
+	}
+	items := make([]interface{}, list.Len())
+	for index := range items {
+		items[index] = list.Index(index).Interface()
+	}
+	return items, true
+}
+
+// toMap - maps of any key type, keys are converted to texts
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	entries := reflect.ValueOf(value)
+	if entries.Kind() != reflect.Map {
+		return nil, false
+	}
+	converted := make(map[string]interface{}, entries.Len())
+	for _, name := range entries.MapKeys() {
+		converted[fmt.Sprint(name.Interface())] = entries.MapIndex(name).Interface()
+	}
+	return converted, true
+}
+
+func sortedKeys(entries map[string]interface{}) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,80 @@
+package application
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// durationPattern - a Go duration such as 1m30s, or 0
+const durationPattern = `^(0|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`
+
+// ConfigurationSchema - a JSON schema of the configuration file, generated from the settings of Configuration
+func ConfigurationSchema() ([]byte, error) {
+	schema := structSchema(reflect.TypeOf(Configuration{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "Messages Manager configuration"
+	schema["description"] = "The config.yml file of the Messages Manager service, every setting is optional"
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// structSchema - an object with a property per field, settings that are not known are not allowed
+func structSchema(structType reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		properties[field.Tag.Get("config")] = fieldSchema(field, field.Type)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// fieldSchema - the schema of a value of the given type of the field, described by the tags of the field
+func fieldSchema(field reflect.StructField, fieldType reflect.Type) map[string]interface{} {
+	var schema map[string]interface{}
+
+	switch {
+	case fieldType == durationType:
+		schema = map[string]interface{}{"type": "string", "pattern": durationPattern}
+	case fieldType.Kind() == reflect.Struct:
+		schema = structSchema(fieldType)
+	case fieldType.Kind() == reflect.Slice:
+		schema = map[string]interface{}{"type": "array", "items": fieldSchema(field, fieldType.Elem())}
+	case fieldType.Kind() == reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": fieldSchema(field, fieldType.Elem())}
+	case fieldType.Kind() == reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, "|")
+		}
+	case fieldType.Kind() == reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case fieldType.Kind() == reflect.Int:
+		schema = map[string]interface{}{"type": "integer"}
+	case fieldType.Kind() == reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	}
+
+	// ranges of durations are checked when loading, a pattern can't express them
+	if fieldType.Kind() == reflect.Int || fieldType.Kind() == reflect.Float64 {
+		if min, err := strconv.ParseFloat(field.Tag.Get("min"), 64); err == nil {
+			schema["minimum"] = min
+		}
+		if max, err := strconv.ParseFloat(field.Tag.Get("max"), 64); err == nil {
+			schema["maximum"] = max
+		}
+	}
+	if description := field.Tag.Get("description"); description != "" && fieldType == field.Type {
+		schema["description"] = description
+	}
+	return schema
+}
@@ -0,0 +1,90 @@
+package application
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	config "github.com/spf13/viper"
+)
+
+func TestLoadConfiguration(t *testing.T) {
+	defer config.Reset()
+	InitConfig()
+
+	configuration, err := LoadConfiguration()
+	assert.NoError(t, err, "the defaults are valid")
+	assert.Equal(t, 8090, configuration.Service.Port)
+	assert.Equal(t, "memory", configuration.Database.Type)
+	assert.Equal(t, 30*time.Second, configuration.Database.ConnectRetry.MaxBackoff)
+	assert.Equal(t, []string{"contributor"}, configuration.Auth.Users.DefaultRoles)
+
+	os.Setenv("MESSAGES_SERVICE_PORT", "9000")
+	defer os.Unsetenv("MESSAGES_SERVICE_PORT")
+	config.Set("database.type", "mong")
+	config.Set("database.timeout", "10")
+	config.Set("database.timeouts.reed", "5s")
+	config.Set("tracing.sampleRatio", 2)
+	config.Set("auth.jwt.keys", []interface{}{map[interface{}]interface{}{"kid": "a", "alg": "HS257", "secrett": "x"}})
+	config.Set("rateLimit.routes", map[string]interface{}{"GET /messages": map[string]interface{}{"requests": 10, "per": "soon"}})
+
+	configuration, err = LoadConfiguration()
+	assert.Equal(t, 9000, configuration.Service.Port, "environment variables override the settings")
+	assert.Equal(t, ConfigurationError{Problems: []string{
+		`tracing.sampleRatio: must be between 0 and 1, got 2`,
+		`database.type: unknown value "mong", one of memory, mongo`,
+		`database.timeout: "10" is not a duration, use a number with a unit such as 10s`,
+		`rateLimit.routes.get /messages.per: "soon" is not a duration, use a number with a unit such as 10s`,
+		`auth.jwt.keys[0].alg: unknown value "HS257", one of HS256, RS256, EdDSA`,
+		`auth.jwt.keys[0].secrett: unknown setting`,
+		`database.timeouts.reed: unknown setting`,
+	}}, err, "all the problems are reported")
+}
+
+func TestConfigurationSchema(t *testing.T) {
+	schema, err := ConfigurationSchema()
+	assert.NoError(t, err)
+
+	committed, err := ioutil.ReadFile("../config.schema.json")
+	assert.NoError(t, err)
+	assert.Equal(t, string(schema), string(committed), "config.schema.json is regenerated with make schema")
+}
+
+func TestConfigCommand(t *testing.T) {
+	defer config.Reset()
+	InitConfig()
+	config.Set("database.password", "example")
+	os.Setenv("MESSAGES_LOGGING_LEVEL", "warn")
+	defer os.Unsetenv("MESSAGES_LOGGING_LEVEL")
+
+	var out bytes.Buffer
+	valid := func() error { return nil }
+	assert.Equal(t, 0, RunConfigCommand([]string{"check"}, &out, valid))
+	assert.Contains(t, out.String(), "The configuration is valid")
+
+	out.Reset()
+	invalid := func() error {
+		return ConfigurationError{Problems: []string{"auth.jwt: no keys configured", "tenancy.cacheTTL must not be negative"}}
+	}
+	assert.Equal(t, 1, RunConfigCommand([]string{"check"}, &out, invalid))
+	assert.Contains(t, out.String(), "The configuration has 2 problem(s):\n  auth.jwt: no keys configured\n  tenancy.cacheTTL")
+
+	out.Reset()
+	assert.Equal(t, 0, RunConfigCommand([]string{"print", "--effective"}, &out, nil))
+	assert.Regexp(t, `logging.level +warn +env\n`, out.String())
+	assert.Regexp(t, `service.port +8090 +default\n`, out.String())
+	assert.Regexp(t, `database.uri +unset\n`, out.String())
+	assert.Regexp(t, `database.password +\[REDACTED\] +default\n`, out.String())
+	assert.NotContains(t, out.String(), "example")
+
+	out.Reset()
+	config.Set("database.type", "mong")
+	assert.Equal(t, 1, RunConfigCommand([]string{"check"}, &out, invalid))
+	assert.Contains(t, out.String(), "The configuration has 1 problem(s):\n  database.type: unknown value", "the service is checked once the settings are valid")
+
+	assert.Equal(t, 2, RunConfigCommand([]string{"lint"}, &out, nil))
+}
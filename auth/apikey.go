@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// APIKeyRepository - repository abstraction to be implemented by persisters of API keys
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key model.APIKey) error
+	FindAPIKeyByID(ctx context.Context, id string) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context) (model.APIKeys, error)
+	RevokeAPIKeyByID(ctx context.Context, id string, revokedAt time.Time) error
+	TouchAPIKeyByID(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// API key generation parameters
+const (
+	apiKeyIDBytes     = 8
+	apiKeySecretBytes = 32
+	// apiKeyHashCost - the secrets are random so the hash is not the only protection against guessing,
+	// a moderate work factor keeps authentication of every request cheap
+	apiKeyHashCost = 8
+	// lastUsedResolution - the last used time of a key is updated at most this often
+	lastUsedResolution = time.Minute
+)
+
+// GenerateAPIKey - returns a new key of the request and the key to hand to the client.
+// The key is <id>.<secret>, only a hash of the secret is kept in the returned record.
+func GenerateAPIKey(request model.APIKeyRequest, now time.Time) (model.APIKey, error) {
+	id := make([]byte, apiKeyIDBytes)
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(id); err != nil {
+		return model.APIKey{}, errors.Wrap(err, "Could not generate API key")
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return model.APIKey{}, errors.Wrap(err, "Could not generate API key")
+	}
+
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	hash, err := HashSecret(encodedSecret, apiKeyHashCost)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+
+	key := model.APIKey{
+		ID:        hex.EncodeToString(id),
+		Scopes:    request.Scopes,
+		Hash:      hash,
+		CreatedAt: now.UTC(),
+	}
+	if request.Name != nil {
+		key.Name = *request.Name
+	}
+	if request.Tenant != nil {
+		key.Tenant = *request.Tenant
+	}
+	if request.ExpiresAt != nil {
+		expiresAt := request.ExpiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+	key.Key = key.ID + "." + encodedSecret
+	return key, nil
+}
+
+// APIKeyAuthenticator - authenticates API keys of service clients
+type APIKeyAuthenticator struct {
+	repository APIKeyRepository
+	now        func() time.Time
+}
+
+//NewAPIKeyAuthenticator - return an authenticator of the keys stored in the repository
+func NewAPIKeyAuthenticator(repository APIKeyRepository) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{repository: repository, now: time.Now}
+}
+
+// Scheme - implementation of Authenticator
+func (ka *APIKeyAuthenticator) Scheme() string {
+	return "ApiKey"
+}
+
+// Authenticate - implementation of Authenticator
+// The principal of a key is granted the scopes of the key. Repository errors other than
+// a missing key are returned as is.
+func (ka *APIKeyAuthenticator) Authenticate(ctx context.Context, credentials string) (Principal, error) {
+	separator := strings.IndexByte(credentials, '.')
+	if separator <= 0 {
+		return Principal{}, errors.Wrap(ErrorInvalidAPIKey, "malformed key")
+	}
+	id, secret := credentials[:separator], credentials[separator+1:]
+
+	key, err := ka.repository.FindAPIKeyByID(ctx, id)
+	if errors.Cause(err) == persistence.ErrorNotFound {
+		return Principal{}, errors.Wrap(ErrorInvalidAPIKey, "unknown key")
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if !VerifySecret(secret, key.Hash) {
+		return Principal{}, errors.Wrap(ErrorInvalidAPIKey, "secret mismatch")
+	}
+	if key.RevokedAt != nil {
+		return Principal{}, errors.Wrap(ErrorInvalidAPIKey, "revoked key")
+	}
+	now := ka.now()
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return Principal{}, ErrorAPIKeyExpired
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		// failing to record the use does not fail the request
+		if err := ka.repository.TouchAPIKeyByID(ctx, id, now.UTC()); err != nil {
+			log.WithError(err).WithField("apiKeyId", id).Warn("Could not update API key last used time")
+		}
+	}
+
+	principal := Principal{Subject: "apikey:" + key.ID, Method: MethodAPIKey, Tenant: key.Tenant}
+	for _, scope := range key.Scopes {
+		if permission, ok := ParsePermission(scope); ok {
+			principal.Scopes = append(principal.Scopes, permission)
+		}
+	}
+	return principal, nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashSecret(t *testing.T) {
+	hash, err := HashSecret("secret", 4)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\$2a\$04\$[A-Za-z0-9./]{53}$`, hash)
+	assert.True(t, VerifySecret("secret", hash))
+	assert.False(t, VerifySecret("Secret", hash))
+	assert.False(t, VerifySecret("secret", "secret"))
+
+	otherHash, _ := HashSecret("secret", 4)
+	assert.NotEqual(t, hash, otherHash, "hashes must be salted")
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	now := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	name := "batch"
+	expiresAt := now.Add(time.Hour)
+
+	repository, _ := persistence.NewMemoryRepository()
+	authenticator := NewAPIKeyAuthenticator(repository)
+
+	newKey := func(scopes []string, expiresAt *time.Time) model.APIKey {
+		key, err := GenerateAPIKey(model.APIKeyRequest{Name: &name, Scopes: scopes, ExpiresAt: expiresAt}, now.Add(-time.Hour))
+		assert.NoError(t, err)
+		assert.NoError(t, repository.CreateAPIKey(context.Background(), key))
+		return key
+	}
+	readKey := newKey([]string{"messages:read", "messages:create"}, &expiresAt)
+	expiredKey := newKey([]string{"messages:read"}, &now)
+	revokedKey := newKey([]string{"messages:read"}, nil)
+	assert.NoError(t, repository.RevokeAPIKeyByID(context.Background(), revokedKey.ID, now))
+
+	testCases := []struct {
+		name        string
+		credentials string
+		expected    Principal
+		err         error
+	}{
+		{
+			name:        "valid key",
+			credentials: readKey.Key,
+			expected:    Principal{Subject: "apikey:" + readKey.ID, Scopes: []Permission{PermissionReadMessages, PermissionCreateMessages}, Method: MethodAPIKey},
+		},
+		{name: "wrong secret", credentials: readKey.ID + ".secret", err: ErrorInvalidAPIKey},
+		{name: "unknown key", credentials: "0000000000000000" + readKey.Key[16:], err: ErrorInvalidAPIKey},
+		{name: "malformed", credentials: readKey.ID, err: ErrorInvalidAPIKey},
+		{name: "expired", credentials: expiredKey.Key, err: ErrorAPIKeyExpired},
+		{name: "revoked", credentials: revokedKey.Key, err: ErrorInvalidAPIKey},
+	}
+
+	authenticator.now = func() time.Time { return now }
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(context.Background(), testCase.credentials)
+			assert.Equal(t, testCase.err, errors.Cause(err))
+			if testCase.err == nil {
+				assert.Equal(t, testCase.expected, principal)
+			}
+		})
+	}
+
+	stored, _ := repository.FindAPIKeyByID(context.Background(), readKey.ID)
+	assert.Equal(t, now, *stored.LastUsedAt)
+	assert.Empty(t, stored.Key, "the key must not be stored")
+	assert.True(t, Principal{Scopes: []Permission{PermissionReadMessages}}.Can(PermissionReadMessages))
+	assert.False(t, Principal{Scopes: []Permission{PermissionReadMessages}}.Can(PermissionDeleteMessages))
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"strings"
+)
+
+// Authenticator - authenticates the credentials of one authorization scheme
+type Authenticator interface {
+	// Scheme - the authorization scheme of the credentials (RFC 7235), such as Bearer
+	Scheme() string
+	// Authenticate - returns the principal of valid credentials
+	Authenticate(ctx context.Context, credentials string) (Principal, error)
+}
+
+// Authentication - authenticates requests by the scheme of their Authorization header
+type Authentication struct {
+	authenticators []Authenticator
+	anonymous      *Principal
+}
+
+//NewAuthentication - return an authentication accepting the schemes of the given authenticators
+func NewAuthentication(authenticators ...Authenticator) *Authentication {
+	return &Authentication{authenticators: authenticators}
+}
+
+//Disabled - return an authentication serving every request as an anonymous admin
+func Disabled() *Authentication {
+	return &Authentication{anonymous: &Principal{Subject: MethodAnonymous, Roles: []Role{RoleAdmin}, Method: MethodAnonymous}}
+}
+
+// Authenticate - returns the principal of the Authorization header of a request.
+// ErrorMissingCredentials is returned when the header is empty.
+func (a *Authentication) Authenticate(ctx context.Context, authorization string) (Principal, error) {
+	if a.anonymous != nil {
+		return *a.anonymous, nil
+	}
+
+	authorization = strings.TrimSpace(authorization)
+	if authorization == "" {
+		return Principal{}, ErrorMissingCredentials
+	}
+
+	scheme, credentials := authorization, ""
+	if index := strings.IndexByte(authorization, ' '); index >= 0 {
+		scheme, credentials = authorization[:index], strings.TrimSpace(authorization[index+1:])
+	}
+	for _, authenticator := range a.authenticators {
+		if strings.EqualFold(authenticator.Scheme(), scheme) {
+			return authenticator.Authenticate(ctx, credentials)
+		}
+	}
+
+	return Principal{}, ErrorUnsupportedScheme
+}
+
+// setKeys - replaces the keys of the token authenticator, if tokens are accepted
+func (a *Authentication) setKeys(keys KeySet) {
+	for _, authenticator := range a.authenticators {
+		if jwtAuthenticator, ok := authenticator.(*JWTAuthenticator); ok {
+			jwtAuthenticator.SetKeys(keys)
+		}
+	}
+}
+
+// Schemes - the accepted authorization schemes
+func (a *Authentication) Schemes() []string {
+	schemes := make([]string, 0, len(a.authenticators))
+	for _, authenticator := range a.authenticators {
+		schemes = append(schemes, authenticator.Scheme())
+	}
+	return schemes
+}
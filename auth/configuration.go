@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+
+	config "github.com/spf13/viper"
+)
+
+// keyConfig - a key of the auth.jwt.keys configuration list
+type keyConfig struct {
+	ID            string `mapstructure:"kid"`
+	Algorithm     string `mapstructure:"alg"`
+	Secret        string `mapstructure:"secret"`
+	PublicKey     string `mapstructure:"publicKey"`
+	PublicKeyFile string `mapstructure:"publicKeyFile"`
+}
+
+//LoadAuthentication - build the request authentication from the "auth" configuration section.
+//Authentication is disabled (every request is served as an admin) only when auth.enabled is false.
+//API keys are looked up in the given repository unless auth.apiKeys.enabled is false.
+func LoadAuthentication(apiKeys APIKeyRepository) (*Authentication, error) {
+	if !config.GetBool("auth.enabled") {
+		return Disabled(), nil
+	}
+
+	jwtAuthenticator, err := LoadJWTAuthenticator()
+	if err != nil {
+		return nil, err
+	}
+	authenticators := []Authenticator{jwtAuthenticator}
+	if config.GetBool("auth.apiKeys.enabled") {
+		authenticators = append(authenticators, NewAPIKeyAuthenticator(apiKeys))
+	}
+	return NewAuthentication(authenticators...), nil
+}
+
+//ReloadKeys - prepares the keys of the reloaded "auth.jwt" configuration section, read again from auth.jwt.keys
+//and auth.jwt.jwksFile, so rotated keys and secret files are used without a restart. The returned function switches
+//the authentication, and the users when not nil, to the prepared keys. Nothing is prepared when auth is disabled.
+func ReloadKeys(authentication *Authentication, users *Users) (func(), error) {
+	if !config.GetBool("auth.enabled") {
+		return func() {}, nil
+	}
+
+	keys, err := loadKeys()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("auth.jwt: no keys configured, set auth.jwt.keys or auth.jwt.jwksFile")
+	}
+	var signer Signer
+	if users != nil {
+		if signer, err = loadSigner(config.GetString("auth.users.signingKey")); err != nil {
+			return nil, errors.Wrap(err, "auth.users.signingKey")
+		}
+	}
+
+	return func() {
+		authentication.setKeys(keys)
+		if users != nil {
+			users.setSigner(signer)
+		}
+	}, nil
+}
+
+//LoadJWTAuthenticator - build the token authenticator from the "auth.jwt" configuration section
+func LoadJWTAuthenticator() (*JWTAuthenticator, error) {
+	keys, err := loadKeys()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("auth.jwt: no keys configured, set auth.jwt.keys or auth.jwt.jwksFile")
+	}
+
+	roleMapping := make(map[string]Role)
+	for value, name := range config.GetStringMapString("auth.jwt.roleMapping") {
+		role, ok := ParseRole(name)
+		if !ok {
+			return nil, fmt.Errorf("auth.jwt.roleMapping.%s: unknown role %q", value, name)
+		}
+		roleMapping[value] = role
+	}
+
+	return NewJWTAuthenticator(keys, JWTConfig{
+		Issuer:      config.GetString("auth.jwt.issuer"),
+		Audience:    config.GetString("auth.jwt.audience"),
+		Leeway:      config.GetDuration("auth.jwt.leeway"),
+		RolesClaim:  config.GetString("auth.jwt.rolesClaim"),
+		RoleMapping: roleMapping,
+		TenantClaim: config.GetString("auth.jwt.tenantClaim"),
+	}), nil
+}
+
+func loadKeys() (KeySet, error) {
+	var keys KeySet
+
+	if jwksFile := config.GetString("auth.jwt.jwksFile"); jwksFile != "" {
+		data, err := ioutil.ReadFile(jwksFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "auth.jwt.jwksFile")
+		}
+		if keys, err = ParseJWKS(data); err != nil {
+			return nil, errors.Wrap(err, "auth.jwt.jwksFile")
+		}
+	}
+
+	var keyConfigs []keyConfig
+	if err := config.UnmarshalKey("auth.jwt.keys", &keyConfigs); err != nil {
+		return nil, errors.Wrap(err, "auth.jwt.keys")
+	}
+	for index, keyConfig := range keyConfigs {
+		key, err := keyConfig.key()
+		if err != nil {
+			return nil, errors.Wrapf(err, "auth.jwt.keys[%d]", index)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (kc keyConfig) key() (Key, error) {
+	var key Key
+	var err error
+	switch {
+	case kc.Secret != "":
+		key, err = NewHMACKey(kc.ID, []byte(kc.Secret))
+	case kc.PublicKey != "":
+		key, err = ParsePublicKey(kc.ID, []byte(kc.PublicKey))
+	case kc.PublicKeyFile != "":
+		var data []byte
+		if data, err = ioutil.ReadFile(kc.PublicKeyFile); err == nil {
+			key, err = ParsePublicKey(kc.ID, data)
+		}
+	default:
+		return key, errors.New("one of secret, publicKey or publicKeyFile is required")
+	}
+	if err != nil {
+		return key, err
+	}
+
+	if kc.Algorithm != "" && kc.Algorithm != key.Algorithm {
+		return key, fmt.Errorf("algorithm %q does not match the %s key", kc.Algorithm, key.Algorithm)
+	}
+	return key, nil
+}
+
+//LoadUsers - build the user accounts from the "auth.users" configuration section, nil is returned
+//when auth.users.enabled or auth.enabled is false. Tokens are signed with the auth.jwt.keys secret of the
+//auth.users.signingKey key id, so they are verified by the JWT authenticator as well.
+func LoadUsers(repository UserRepository) (*Users, error) {
+	if !config.GetBool("auth.enabled") || !config.GetBool("auth.users.enabled") {
+		return nil, nil
+	}
+
+	signer, err := loadSigner(config.GetString("auth.users.signingKey"))
+	if err != nil {
+		return nil, errors.Wrap(err, "auth.users.signingKey")
+	}
+
+	var defaultRoles []Role
+	for _, name := range config.GetStringSlice("auth.users.defaultRoles") {
+		role, ok := ParseRole(name)
+		if !ok {
+			return nil, fmt.Errorf("auth.users.defaultRoles: unknown role %q", name)
+		}
+		defaultRoles = append(defaultRoles, role)
+	}
+
+	userConfig := UserConfig{
+		HashCost:        config.GetInt("auth.users.passwordHashCost"),
+		DefaultRoles:    defaultRoles,
+		TokenTTL:        config.GetDuration("auth.users.tokenTTL"),
+		Issuer:          config.GetString("auth.jwt.issuer"),
+		Audience:        config.GetString("auth.jwt.audience"),
+		RolesClaim:      config.GetString("auth.jwt.rolesClaim"),
+		TenantClaim:     config.GetString("auth.jwt.tenantClaim"),
+		MaxFailedLogins: config.GetInt("auth.users.maxFailedLogins"),
+		LockoutDuration: config.GetDuration("auth.users.lockoutDuration"),
+		ResetTokenTTL:   config.GetDuration("auth.users.resetTokenTTL"),
+	}
+	if userConfig.HashCost < bcrypt.MinCost || userConfig.HashCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("auth.users.passwordHashCost: must be %d - %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if userConfig.TokenTTL <= 0 || userConfig.ResetTokenTTL <= 0 {
+		return nil, errors.New("auth.users: tokenTTL and resetTokenTTL must be positive")
+	}
+
+	return NewUsers(repository, signer, userConfig)
+}
+
+// loadSigner - the signer of the auth.jwt.keys secret of the given key id
+func loadSigner(id string) (Signer, error) {
+	if id == "" {
+		return Signer{}, errors.New("no signing key configured")
+	}
+
+	var keyConfigs []keyConfig
+	if err := config.UnmarshalKey("auth.jwt.keys", &keyConfigs); err != nil {
+		return Signer{}, err
+	}
+	for _, keyConfig := range keyConfigs {
+		if keyConfig.ID == id {
+			if keyConfig.Secret == "" {
+				return Signer{}, fmt.Errorf("key %q has no secret, only HS256 keys can sign tokens", id)
+			}
+			return NewHMACSigner(id, []byte(keyConfig.Secret))
+		}
+	}
+	return Signer{}, fmt.Errorf("no key %q in auth.jwt.keys", id)
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"time"
+)
+
+//Error - an authentication error type
+type Error string
+
+//Error - implemenation of Error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+//ErrorMissingCredentials - the request has no credentials
+const ErrorMissingCredentials = Error("Missing credentials")
+
+//ErrorUnsupportedScheme - the authorization scheme of the request is not supported
+const ErrorUnsupportedScheme = Error("Unsupported authorization scheme")
+
+//ErrorInvalidToken - the token is malformed, its signature does not verify or its claims are not accepted
+const ErrorInvalidToken = Error("Invalid token")
+
+//ErrorTokenExpired - the token is no longer valid
+const ErrorTokenExpired = Error("Token expired")
+
+//ErrorInvalidAPIKey - the API key is malformed, unknown, revoked or does not match its hash
+const ErrorInvalidAPIKey = Error("Invalid API key")
+
+//ErrorAPIKeyExpired - the API key is no longer valid
+const ErrorAPIKeyExpired = Error("API key expired")
+
+//ErrorInvalidCredentials - the user does not exist or the password is wrong
+const ErrorInvalidCredentials = Error("Invalid username or password")
+
+//ErrorInvalidResetToken - the password reset token is malformed, unknown, used or expired
+const ErrorInvalidResetToken = Error("Invalid password reset token")
+
+//AccountLockedError - the account is locked after repeated failed logins
+type AccountLockedError struct {
+	Until time.Time
+}
+
+//Error - implemenation of Error interface
+func (e AccountLockedError) Error() string {
+	return "Account locked until " + e.Until.UTC().Format(time.RFC3339)
+}
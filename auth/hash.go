@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxSecretBytes - bcrypt uses the first 72 bytes of a secret only, longer secrets are not hashed
+const MaxSecretBytes = 72
+
+// HashSecret - returns a salted bcrypt hash of the secret, cost is the bcrypt work factor
+// (bcrypt.MinCost - bcrypt.MaxCost)
+func HashSecret(secret string, cost int) (string, error) {
+	if len(secret) > MaxSecretBytes {
+		return "", fmt.Errorf("Could not hash secret: longer than %d bytes", MaxSecretBytes)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), cost)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not hash secret")
+	}
+	return string(hash), nil
+}
+
+// VerifySecret - reports if the secret matches a hash returned by HashSecret
+func VerifySecret(secret string, encodedHash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(secret)) == nil
+}
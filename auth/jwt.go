@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JWTConfig - the claims a token must have to be accepted
+type JWTConfig struct {
+	// Issuer - the required iss claim, any issuer is accepted when empty
+	Issuer string
+	// Audience - the audience that must be in the aud claim, any audience is accepted when empty
+	Audience string
+	// Leeway - the clock skew tolerated when checking exp and nbf
+	Leeway time.Duration
+	// RolesClaim - the claim holding the roles of the subject, a list or a space separated string
+	RolesClaim string
+	// RoleMapping - maps claim values to roles, values that are role names are taken as is
+	RoleMapping map[string]Role
+	// TenantClaim - the claim holding the tenant the subject is confined to, if any
+	TenantClaim string
+}
+
+// defaultRolesClaim - the claim roles are read from unless configured otherwise
+const defaultRolesClaim = "roles"
+
+// JWTAuthenticator - authenticates bearer JSON Web Tokens (RFC 7519) signed with HS256, RS256 or EdDSA.
+// Tokens must have an exp claim.
+type JWTAuthenticator struct {
+	// keysLock - guards keys, they are replaced when rotated keys are reloaded
+	keysLock sync.RWMutex
+	keys     KeySet
+	config   JWTConfig
+	now      func() time.Time
+}
+
+//NewJWTAuthenticator - return an authenticator of tokens signed by any of the keys
+func NewJWTAuthenticator(keys KeySet, config JWTConfig) *JWTAuthenticator {
+	if config.RolesClaim == "" {
+		config.RolesClaim = defaultRolesClaim
+	}
+	return &JWTAuthenticator{keys: keys, config: config, now: time.Now}
+}
+
+// Scheme - implementation of Authenticator
+func (ja *JWTAuthenticator) Scheme() string {
+	return "Bearer"
+}
+
+// jwtHeader - the JOSE header of a token
+type jwtHeader struct {
+	Algorithm string   `json:"alg"`
+	KeyID     string   `json:"kid"`
+	Critical  []string `json:"crit"`
+}
+
+// Authenticate - implementation of Authenticator
+func (ja *JWTAuthenticator) Authenticate(ctx context.Context, token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, errors.Wrap(ErrorInvalidToken, "malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, errors.Wrap(ErrorInvalidToken, "malformed header")
+	}
+	if len(header.Critical) != 0 {
+		return Principal{}, errors.Wrap(ErrorInvalidToken, "unsupported critical header parameters")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, errors.Wrap(ErrorInvalidToken, "malformed signature")
+	}
+	if !ja.verify(header, []byte(parts[0]+"."+parts[1]), signature) {
+		return Principal{}, errors.Wrap(ErrorInvalidToken, "signature verification failed")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, errors.Wrap(ErrorInvalidToken, "malformed claims")
+	}
+	if err := ja.checkClaims(claims); err != nil {
+		return Principal{}, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	principal := Principal{
+		Subject: subject,
+		Roles:   ja.roles(claims[ja.config.RolesClaim]),
+		Method:  MethodJWT,
+	}
+	if ja.config.TenantClaim != "" {
+		principal.Tenant, _ = claims[ja.config.TenantClaim].(string)
+	}
+	if issuedAt, ok := numericDate(claims["iat"]); ok {
+		principal.IssuedAt = issuedAt.UTC()
+	}
+	return principal, nil
+}
+
+// SetKeys - replaces the keys tokens are verified with, tokens signed by the previous keys only are refused
+func (ja *JWTAuthenticator) SetKeys(keys KeySet) {
+	ja.keysLock.Lock()
+	defer ja.keysLock.Unlock()
+	ja.keys = keys
+}
+
+// verify - reports if any of the keys of the token algorithm (and key id) verifies the signature
+func (ja *JWTAuthenticator) verify(header jwtHeader, signingInput []byte, signature []byte) bool {
+	ja.keysLock.RLock()
+	keys := ja.keys
+	ja.keysLock.RUnlock()
+
+	for _, key := range keys.candidates(header.KeyID, header.Algorithm) {
+		if key.verify(signingInput, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ja *JWTAuthenticator) checkClaims(claims map[string]interface{}) error {
+	now := ja.now()
+
+	expiresAt, ok := numericDate(claims["exp"])
+	if !ok {
+		return errors.Wrap(ErrorInvalidToken, "missing exp claim")
+	}
+	if !now.Before(expiresAt.Add(ja.config.Leeway)) {
+		return ErrorTokenExpired
+	}
+	if notBefore, ok := numericDate(claims["nbf"]); ok && now.Add(ja.config.Leeway).Before(notBefore) {
+		return errors.Wrap(ErrorInvalidToken, "token is not valid yet")
+	}
+
+	if ja.config.Issuer != "" {
+		if issuer, _ := claims["iss"].(string); issuer != ja.config.Issuer {
+			return errors.Wrap(ErrorInvalidToken, "unexpected issuer")
+		}
+	}
+	if ja.config.Audience != "" && !containsString(claims["aud"], ja.config.Audience) {
+		return errors.Wrap(ErrorInvalidToken, "unexpected audience")
+	}
+
+	return nil
+}
+
+// roles - the roles of the roles claim values, unknown values are ignored
+func (ja *JWTAuthenticator) roles(claim interface{}) []Role {
+	var values []string
+	switch typedClaim := claim.(type) {
+	case string:
+		values = strings.Fields(typedClaim)
+	case []interface{}:
+		for _, value := range typedClaim {
+			if name, ok := value.(string); ok {
+				values = append(values, name)
+			}
+		}
+	}
+
+	var roles []Role
+	for _, value := range values {
+		if role, ok := ja.config.RoleMapping[value]; ok {
+			roles = append(roles, role)
+		} else if role, ok := ParseRole(value); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// decodeSegment - decode a base64url encoded JSON token segment
+func decodeSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
+
+// numericDate - the time of a NumericDate claim (seconds since the epoch)
+func numericDate(claim interface{}) (time.Time, bool) {
+	number, ok := claim.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// containsString - reports if the claim is the value or a list containing it
+func containsString(claim interface{}, value string) bool {
+	switch typedClaim := claim.(type) {
+	case string:
+		return typedClaim == value
+	case []interface{}:
+		for _, item := range typedClaim {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
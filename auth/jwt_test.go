@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	config "github.com/spf13/viper"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// signToken - a compact JWS of the header and the claims signed by sign
+func signToken(header map[string]interface{}, claims map[string]interface{}, sign func(signingInput []byte) []byte) string {
+	headerData, _ := json.Marshal(header)
+	claimsData, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerData) + "." + base64.RawURLEncoding.EncodeToString(claimsData)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+func hmacSigner(secret []byte) func([]byte) []byte {
+	return func(signingInput []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil)
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	now := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPublicKey, edPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	hmacKey, err := NewHMACKey("hmac", testSecret)
+	assert.NoError(t, err)
+	rsaPublicKey, err := NewRSAKey("rsa", &rsaKey.PublicKey)
+	assert.NoError(t, err)
+	edKey, err := NewEd25519Key("ed", edPublicKey)
+	assert.NoError(t, err)
+
+	authenticator := NewJWTAuthenticator(KeySet{hmacKey, rsaPublicKey, edKey}, JWTConfig{
+		Issuer:      "https://issuer.example.com",
+		Audience:    "messages",
+		Leeway:      time.Minute,
+		RoleMapping: map[string]Role{"messages-admins": RoleAdmin},
+		TenantClaim: "tenant",
+	})
+	authenticator.now = func() time.Time { return now }
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":   "user-1",
+			"iss":   "https://issuer.example.com",
+			"aud":   []string{"other", "messages"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"roles": []string{"editor", "unknown"},
+		}
+	}
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	rsaSigner := func(signingInput []byte) []byte {
+		digest := sha256.Sum256(signingInput)
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		return signature
+	}
+	edSigner := func(signingInput []byte) []byte {
+		return ed25519.Sign(edPrivateKey, signingInput)
+	}
+	publicKeyDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+
+	testCases := []struct {
+		name     string
+		token    string
+		expected Principal
+		err      error
+	}{
+		{
+			name:     "HS256",
+			token:    signToken(map[string]interface{}{"alg": "HS256", "kid": "hmac"}, validClaims(), hmacSigner(testSecret)),
+			expected: Principal{Subject: "user-1", Roles: []Role{RoleEditor}, Method: MethodJWT},
+		},
+		{
+			name:     "RS256 without key id",
+			token:    signToken(map[string]interface{}{"alg": "RS256"}, validClaims(), rsaSigner),
+			expected: Principal{Subject: "user-1", Roles: []Role{RoleEditor}, Method: MethodJWT},
+		},
+		{
+			name:     "EdDSA with mapped roles claim string",
+			token:    signToken(map[string]interface{}{"alg": "EdDSA", "kid": "ed"}, withClaim("roles", "reader messages-admins"), edSigner),
+			expected: Principal{Subject: "user-1", Roles: []Role{RoleReader, RoleAdmin}, Method: MethodJWT},
+		},
+		{
+			name:     "audience string and expiry within leeway",
+			token:    signToken(map[string]interface{}{"alg": "HS256"}, withClaim("exp", now.Add(-30*time.Second).Unix()), hmacSigner(testSecret)),
+			expected: Principal{Subject: "user-1", Roles: []Role{RoleEditor}, Method: MethodJWT},
+		},
+		{
+			name:     "tenant claim",
+			token:    signToken(map[string]interface{}{"alg": "HS256"}, withClaim("tenant", "team-a"), hmacSigner(testSecret)),
+			expected: Principal{Subject: "user-1", Roles: []Role{RoleEditor}, Method: MethodJWT, Tenant: "team-a"},
+		},
+		{
+			name:  "expired",
+			token: signToken(map[string]interface{}{"alg": "HS256"}, withClaim("exp", now.Add(-2*time.Minute).Unix()), hmacSigner(testSecret)),
+			err:   ErrorTokenExpired,
+		},
+		{
+			name:  "missing expiry",
+			token: signToken(map[string]interface{}{"alg": "HS256"}, withClaim("exp", nil), hmacSigner(testSecret)),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "not valid yet",
+			token: signToken(map[string]interface{}{"alg": "HS256"}, withClaim("nbf", now.Add(time.Hour).Unix()), hmacSigner(testSecret)),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "wrong issuer",
+			token: signToken(map[string]interface{}{"alg": "HS256"}, withClaim("iss", "https://evil.example.com"), hmacSigner(testSecret)),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "wrong audience",
+			token: signToken(map[string]interface{}{"alg": "HS256"}, withClaim("aud", "other"), hmacSigner(testSecret)),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "wrong secret",
+			token: signToken(map[string]interface{}{"alg": "HS256"}, validClaims(), hmacSigner([]byte("fedcba9876543210fedcba9876543210"))),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "unknown key id",
+			token: signToken(map[string]interface{}{"alg": "HS256", "kid": "other"}, validClaims(), hmacSigner(testSecret)),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "key of another algorithm",
+			token: signToken(map[string]interface{}{"alg": "HS256", "kid": "ed"}, validClaims(), hmacSigner(testSecret)),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "public key used as an HMAC secret",
+			token: signToken(map[string]interface{}{"alg": "HS256"}, validClaims(), hmacSigner(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "unsigned",
+			token: signToken(map[string]interface{}{"alg": "none"}, validClaims(), func([]byte) []byte { return nil }),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "critical header",
+			token: signToken(map[string]interface{}{"alg": "HS256", "crit": []string{"exp"}}, validClaims(), hmacSigner(testSecret)),
+			err:   ErrorInvalidToken,
+		},
+		{
+			name:  "malformed",
+			token: "not.a.token",
+			err:   ErrorInvalidToken,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(context.Background(), testCase.token)
+			assert.Equal(t, testCase.err, errors.Cause(err))
+			if testCase.err == nil {
+				assert.Equal(t, testCase.expected, principal)
+			}
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPublicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	encode := base64.RawURLEncoding.EncodeToString
+
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]interface{}{
+		{"kty": "oct", "kid": "hmac", "k": encode(testSecret), "alg": "HS256"},
+		{"kty": "RSA", "kid": "rsa", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes()), "use": "sig"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": encode(edPublicKey)},
+		{"kty": "RSA", "kid": "encryption", "n": encode(rsaKey.N.Bytes()), "e": "AQAB", "use": "enc"},
+	}})
+
+	keys, err := ParseJWKS(jwks)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+	for index, expected := range []struct{ id, algorithm string }{{"hmac", AlgorithmHS256}, {"rsa", AlgorithmRS256}, {"ed", AlgorithmEdDSA}} {
+		assert.Equal(t, expected.id, keys[index].ID)
+		assert.Equal(t, expected.algorithm, keys[index].Algorithm)
+	}
+
+	_, err = ParseJWKS([]byte(`{"keys": [{"kty": "oct", "k": "c2hvcnQ"}]}`))
+	assert.EqualError(t, err, `JWKS key 0: key "": HS256 secrets must be at least 32 bytes long`)
+
+	_, err = ParseJWKS([]byte(`{"keys": [{"kty": "OKP", "crv": "Ed25519", "alg": "RS256", "x": "` + encode(edPublicKey) + `"}]}`))
+	assert.EqualError(t, err, `JWKS key 0: algorithm "RS256" does not match key type "OKP"`)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	edPublicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKIXPublicKey(edPublicKey)
+
+	for _, expected := range []struct {
+		der       []byte
+		algorithm string
+	}{{rsaDER, AlgorithmRS256}, {edDER, AlgorithmEdDSA}} {
+		key, err := ParsePublicKey("issuer", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: expected.der}))
+		assert.NoError(t, err)
+		assert.Equal(t, expected.algorithm, key.Algorithm)
+	}
+
+	_, err := ParsePublicKey("issuer", []byte("not a key"))
+	assert.EqualError(t, err, `key "issuer": no PEM data found`)
+}
+
+func TestRoles(t *testing.T) {
+	assert.True(t, Principal{Roles: []Role{RoleReader}}.Can(PermissionReadMessages))
+	assert.False(t, Principal{Roles: []Role{RoleReader}}.Can(PermissionCreateMessages))
+	assert.True(t, Principal{Roles: []Role{RoleReader, RoleEditor}}.Can(PermissionUpdateMessages))
+	assert.False(t, Principal{Roles: []Role{RoleEditor}}.Can(PermissionDeleteMessages))
+	assert.True(t, Principal{Roles: []Role{RoleAdmin}}.Can(PermissionDeleteMessages))
+	assert.False(t, Principal{}.Can(PermissionReadMessages))
+}
+
+func TestLoadAuthentication(t *testing.T) {
+	defer config.Reset()
+
+	config.Set("auth.enabled", true)
+	_, err := LoadAuthentication(nil)
+	assert.EqualError(t, err, "auth.jwt: no keys configured, set auth.jwt.keys or auth.jwt.jwksFile")
+
+	config.Set("auth.jwt.keys", []map[string]interface{}{{"kid": "signing", "secret": string(testSecret)}})
+	authentication, err := LoadAuthentication(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, Disabled(), authentication)
+
+	config.Set("auth.enabled", false)
+	authentication, err = LoadAuthentication(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Disabled(), authentication)
+}
+
+func TestReloadKeys(t *testing.T) {
+	defer config.Reset()
+
+	config.Set("auth.enabled", true)
+	config.Set("auth.jwt.keys", []map[string]interface{}{{"kid": "signing", "secret": string(testSecret)}})
+	authentication, err := LoadAuthentication(nil)
+	assert.NoError(t, err)
+
+	rotatedSecret := []byte("fedcba9876543210fedcba9876543210")
+	header := map[string]interface{}{"alg": "HS256", "kid": "signing"}
+	claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+	token := "Bearer " + signToken(header, claims, hmacSigner(testSecret))
+	rotatedToken := "Bearer " + signToken(header, claims, hmacSigner(rotatedSecret))
+
+	config.Set("auth.jwt.keys", []map[string]interface{}{{"kid": "signing", "secret": string(rotatedSecret)}})
+	apply, err := ReloadKeys(authentication, nil)
+	assert.NoError(t, err)
+	_, err = authentication.Authenticate(context.Background(), token)
+	assert.NoError(t, err, "the keys are replaced once applied")
+
+	apply()
+	_, err = authentication.Authenticate(context.Background(), token)
+	assert.Equal(t, ErrorInvalidToken, errors.Cause(err))
+	_, err = authentication.Authenticate(context.Background(), rotatedToken)
+	assert.NoError(t, err)
+
+	config.Set("auth.jwt.keys", nil)
+	_, err = ReloadKeys(authentication, nil)
+	assert.EqualError(t, err, "auth.jwt: no keys configured, set auth.jwt.keys or auth.jwt.jwksFile")
+}
+
+func TestLoadUsers(t *testing.T) {
+	defer config.Reset()
+
+	// user tokens could not be verified without authentication
+	config.Set("auth.users.enabled", true)
+	users, err := LoadUsers(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, users)
+
+	config.Set("auth.enabled", true)
+	_, err = LoadUsers(nil)
+	assert.EqualError(t, err, "auth.users.signingKey: no signing key configured")
+}
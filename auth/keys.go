@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// Supported token signature algorithms (RFC 7518, RFC 8037)
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// minRSAKeyBits - shorter RSA keys are rejected
+const minRSAKeyBits = 2048
+
+// minHMACKeyBytes - shorter HMAC secrets are rejected (RFC 7518 section 3.2)
+const minHMACKeyBytes = 32
+
+// Key - a key verifying token signatures of a single algorithm
+type Key struct {
+	// ID - the key id (kid) tokens refer to, may be empty
+	ID string
+	// Algorithm - the only algorithm the key is used with
+	Algorithm string
+
+	verify func(signingInput []byte, signature []byte) bool
+}
+
+// NewHMACKey - returns an HS256 key of the shared secret
+func NewHMACKey(id string, secret []byte) (Key, error) {
+	if len(secret) < minHMACKeyBytes {
+		return Key{}, fmt.Errorf("key %q: HS256 secrets must be at least %d bytes long", id, minHMACKeyBytes)
+	}
+
+	return Key{ID: id, Algorithm: AlgorithmHS256, verify: func(signingInput []byte, signature []byte) bool {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		return hmac.Equal(mac.Sum(nil), signature)
+	}}, nil
+}
+
+// NewRSAKey - returns an RS256 key of the RSA public key
+func NewRSAKey(id string, publicKey *rsa.PublicKey) (Key, error) {
+	if publicKey.N.BitLen() < minRSAKeyBits {
+		return Key{}, fmt.Errorf("key %q: RSA keys must be at least %d bits long", id, minRSAKeyBits)
+	}
+
+	return Key{ID: id, Algorithm: AlgorithmRS256, verify: func(signingInput []byte, signature []byte) bool {
+		digest := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+	}}, nil
+}
+
+// NewEd25519Key - returns an EdDSA key of the Ed25519 public key
+func NewEd25519Key(id string, publicKey ed25519.PublicKey) (Key, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return Key{}, fmt.Errorf("key %q: invalid Ed25519 public key", id)
+	}
+
+	return Key{ID: id, Algorithm: AlgorithmEdDSA, verify: func(signingInput []byte, signature []byte) bool {
+		return ed25519.Verify(publicKey, signingInput, signature)
+	}}, nil
+}
+
+// ParsePublicKey - returns the key of the PEM encoded RSA or Ed25519 public key
+func ParsePublicKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %q: no PEM data found", id)
+	}
+
+	var publicKey interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return Key{}, errors.Wrapf(err, "key %q", id)
+	}
+
+	switch typedKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return NewRSAKey(id, typedKey)
+	case ed25519.PublicKey:
+		return NewEd25519Key(id, typedKey)
+	}
+	return Key{}, fmt.Errorf("key %q: unsupported public key type %T", id, publicKey)
+}
+
+// KeySet - the keys trusted to sign tokens
+type KeySet []Key
+
+// candidates - the keys that may have signed a token of the given key id and algorithm.
+// The algorithm of the token must be the algorithm of the key, so a public key can never be used as an HMAC secret.
+func (ks KeySet) candidates(id string, algorithm string) []Key {
+	var keys []Key
+	for _, key := range ks {
+		if key.Algorithm == algorithm && (id == "" || key.ID == id) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// jsonWebKey - a JSON Web Key (RFC 7517) of the supported types
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	// oct
+	K string `json:"k"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// OKP
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+}
+
+// ParseJWKS - returns the keys of a JSON Web Key Set document.
+// Keys that are not for signatures (use other than sig) are skipped.
+func ParseJWKS(data []byte) (KeySet, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, errors.Wrap(err, "Could not parse JWKS")
+	}
+
+	var keys KeySet
+	for index, webKey := range document.Keys {
+		if webKey.Use != "" && webKey.Use != "sig" {
+			continue
+		}
+		key, err := webKey.key()
+		if err == nil && webKey.Algorithm != "" && webKey.Algorithm != key.Algorithm {
+			err = fmt.Errorf("algorithm %q does not match key type %q", webKey.Algorithm, webKey.KeyType)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "JWKS key %d", index)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (wk jsonWebKey) key() (Key, error) {
+	switch wk.KeyType {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(wk.K)
+		if err != nil {
+			return Key{}, errors.Wrap(err, "invalid k")
+		}
+		return NewHMACKey(wk.KeyID, secret)
+	case "RSA":
+		modulus, err := base64.RawURLEncoding.DecodeString(wk.N)
+		if err != nil {
+			return Key{}, errors.Wrap(err, "invalid n")
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(wk.E)
+		if err != nil || len(exponent) == 0 || len(exponent) > 4 {
+			return Key{}, errors.New("invalid e")
+		}
+		return NewRSAKey(wk.KeyID, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		})
+	case "OKP":
+		if wk.Curve != "Ed25519" {
+			return Key{}, fmt.Errorf("unsupported curve %q", wk.Curve)
+		}
+		publicKey, err := base64.RawURLEncoding.DecodeString(wk.X)
+		if err != nil {
+			return Key{}, errors.Wrap(err, "invalid x")
+		}
+		return NewEd25519Key(wk.KeyID, ed25519.PublicKey(publicKey))
+	}
+	return Key{}, fmt.Errorf("unsupported key type %q", wk.KeyType)
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Authentication methods of principals
+const (
+	MethodJWT       = "jwt"
+	MethodAPIKey    = "apikey"
+	MethodAnonymous = "anonymous"
+)
+
+// Principal - the authenticated client of a request
+type Principal struct {
+	// Subject - the id of the client
+	Subject string
+	// Roles - the roles granted to the client
+	Roles []Role
+	// Scopes - permissions granted to the client directly, such as the scopes of an API key
+	Scopes []Permission
+	// Method - how the client was authenticated
+	Method string
+	// Tenant - the only tenant the client may access. Clients without a tenant
+	// reach tenants only when they are granted tenants:manage.
+	Tenant string
+	// IssuedAt - the time the credentials were issued at, zero when unknown
+	IssuedAt time.Time
+}
+
+// Can - reports if the permission is one of the scopes of the principal or is granted by any of its roles
+func (p Principal) Can(permission Permission) bool {
+	for _, scope := range p.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	for _, role := range p.Roles {
+		if role.Grants(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext - returns a copy of ctx carrying the principal
+func NewContext(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext - returns the principal carried by ctx, if any
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"strings"
+)
+
+// Role - a set of permissions granted to principals
+type Role string
+
+// Roles - each role grants the permissions of the roles before it
+const (
+	// RoleReader - can read messages
+	RoleReader = Role("reader")
+	// RoleContributor - can create messages and change its own messages
+	RoleContributor = Role("contributor")
+	// RoleEditor - can create and change any message
+	RoleEditor = Role("editor")
+	// RoleAdmin - can do anything, including reading private messages and managing API keys, users and tenants
+	RoleAdmin = Role("admin")
+)
+
+// Permission - an operation that can be authorized
+type Permission string
+
+// Permissions checked by the endpoints
+const (
+	PermissionReadMessages        = Permission("messages:read")
+	PermissionReadPrivateMessages = Permission("messages:read:private")
+	PermissionCreateMessages      = Permission("messages:create")
+	PermissionUpdateOwnMessages   = Permission("messages:update:own")
+	PermissionUpdateMessages      = Permission("messages:update")
+	PermissionDeleteMessages      = Permission("messages:delete")
+	PermissionManageAPIKeys       = Permission("apikeys:manage")
+	PermissionManageUsers         = Permission("users:manage")
+	PermissionManageTenants       = Permission("tenants:manage")
+)
+
+// Permissions - all the permissions, in the order they are listed in
+var Permissions = []Permission{
+	PermissionReadMessages, PermissionReadPrivateMessages, PermissionCreateMessages, PermissionUpdateOwnMessages,
+	PermissionUpdateMessages, PermissionDeleteMessages, PermissionManageAPIKeys, PermissionManageUsers, PermissionManageTenants,
+}
+
+// rolePermissions - the permissions granted by each role
+var rolePermissions = map[Role][]Permission{
+	RoleReader:      {PermissionReadMessages},
+	RoleContributor: {PermissionReadMessages, PermissionCreateMessages, PermissionUpdateOwnMessages},
+	RoleEditor:      {PermissionReadMessages, PermissionCreateMessages, PermissionUpdateOwnMessages, PermissionUpdateMessages},
+	RoleAdmin:       Permissions,
+}
+
+// Grants - reports if the role grants the permission
+func (r Role) Grants(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRole - returns the role of the given name, names are matched regardless of case
+func ParseRole(name string) (Role, bool) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	_, ok := rolePermissions[role]
+	return role, ok
+}
+
+// ParsePermission - returns the permission of the given name
+func ParsePermission(name string) (Permission, bool) {
+	for _, permission := range Permissions {
+		if string(permission) == name {
+			return permission, true
+		}
+	}
+	return "", false
+}
+
+// PermissionNames - the names of all the permissions
+func PermissionNames() []string {
+	names := make([]string, 0, len(Permissions))
+	for _, permission := range Permissions {
+		names = append(names, string(permission))
+	}
+	return names
+}
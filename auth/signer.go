@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Signer - signs the tokens issued by the service
+type Signer struct {
+	// KeyID - the key id (kid) of the issued tokens, verifiers look the key up by it
+	KeyID string
+	sign  func(signingInput []byte) []byte
+}
+
+// NewHMACSigner - returns an HS256 signer of the shared secret
+func NewHMACSigner(id string, secret []byte) (Signer, error) {
+	// the secret is checked the same way it is when verifying
+	if _, err := NewHMACKey(id, secret); err != nil {
+		return Signer{}, err
+	}
+
+	return Signer{KeyID: id, sign: func(signingInput []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil)
+	}}, nil
+}
+
+// Sign - returns a compact JWS (RFC 7515) of the claims
+func (s Signer) Sign(claims map[string]interface{}) (string, error) {
+	header := map[string]interface{}{"alg": AlgorithmHS256, "typ": "JWT"}
+	if s.KeyID != "" {
+		header["kid"] = s.KeyID
+	}
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsData, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerData) + "." + base64.RawURLEncoding.EncodeToString(claimsData)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(s.sign([]byte(signingInput))), nil
+}
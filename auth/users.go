@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+)
+
+// UserRepository - repository abstraction to be implemented by persisters of user accounts
+type UserRepository interface {
+	CreateUser(ctx context.Context, user model.User) error
+	FindUserByName(ctx context.Context, tenant string, username string) (*model.User, error)
+	UpdateUserByName(ctx context.Context, tenant string, username string, mutation model.UserMutation) (*model.User, error)
+}
+
+// UserConfig - the policies of user accounts
+type UserConfig struct {
+	// HashCost - the bcrypt work factor of password hashes
+	HashCost int
+	// DefaultRoles - the roles granted to registered users
+	DefaultRoles []Role
+	// TokenTTL - how long issued tokens are valid for
+	TokenTTL time.Duration
+	// Issuer, Audience - the iss and aud claims of issued tokens, omitted when empty
+	Issuer   string
+	Audience string
+	// RolesClaim - the claim the roles of the user are issued in
+	RolesClaim string
+	// TenantClaim - the claim the tenant of the user is issued in, the tenant is not issued when empty
+	TenantClaim string
+	// MaxFailedLogins - consecutive failed logins that lock the account, lockout is disabled when 0
+	MaxFailedLogins int
+	// LockoutDuration - how long a locked account stays locked
+	LockoutDuration time.Duration
+	// ResetTokenTTL - how long password reset tokens are valid for
+	ResetTokenTTL time.Duration
+}
+
+// resetTokenSecretBytes - the size of the random part of password reset tokens
+const resetTokenSecretBytes = 32
+
+// Users - registers user accounts, logs users in and manages their passwords
+type Users struct {
+	repository UserRepository
+	// signerLock - guards signer, it is replaced when a rotated signing key is reloaded
+	signerLock sync.RWMutex
+	signer     Signer
+	config     UserConfig
+	// dummyHash - verified when the user does not exist so that logins of unknown users take as long
+	dummyHash string
+	now       func() time.Time
+}
+
+//NewUsers - return the accounts of the repository, tokens are signed by the signer
+func NewUsers(repository UserRepository, signer Signer, config UserConfig) (*Users, error) {
+	if config.RolesClaim == "" {
+		config.RolesClaim = defaultRolesClaim
+	}
+	dummyHash, err := HashSecret("", config.HashCost)
+	if err != nil {
+		return nil, err
+	}
+	return &Users{repository: repository, signer: signer, config: config, dummyHash: dummyHash, now: time.Now}, nil
+}
+
+// normalizeUsername - user names are not case sensitive
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Register - creates the account of a validated request, the user is confined to the tenant
+// when it is not empty
+func (u *Users) Register(ctx context.Context, request model.UserRequest, tenant string) (model.User, error) {
+	passwordHash, err := HashSecret(*request.Password, u.config.HashCost)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	now := u.now().UTC()
+	user := model.User{
+		Username:          normalizeUsername(*request.Username),
+		Roles:             []string{},
+		Tenant:            tenant,
+		CreatedAt:         now,
+		PasswordHash:      passwordHash,
+		PasswordChangedAt: now,
+	}
+	for _, role := range u.config.DefaultRoles {
+		user.Roles = append(user.Roles, string(role))
+	}
+
+	if err := u.repository.CreateUser(ctx, user); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// Login - returns a token of the user of the tenant if the password is right, the tenant is empty
+// when the service has no tenants.
+// Every failed login of an existing user is counted, MaxFailedLogins consecutive
+// failures lock the account for LockoutDuration. Logins of a locked account fail
+// with AccountLockedError without checking the password.
+func (u *Users) Login(ctx context.Context, tenant string, username string, password string) (model.TokenResponse, error) {
+	username = normalizeUsername(username)
+	user, err := u.repository.FindUserByName(ctx, tenant, username)
+	if errors.Cause(err) == persistence.ErrorNotFound {
+		VerifySecret(password, u.dummyHash)
+		return model.TokenResponse{}, ErrorInvalidCredentials
+	}
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	now := u.now().UTC()
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return model.TokenResponse{}, AccountLockedError{Until: *user.LockedUntil}
+	}
+
+	if !VerifySecret(password, user.PasswordHash) {
+		_, err := u.repository.UpdateUserByName(ctx, tenant, username, func(current model.User) (model.User, error) {
+			current.FailedLogins++
+			if u.config.MaxFailedLogins > 0 && current.FailedLogins >= u.config.MaxFailedLogins {
+				lockedUntil := now.Add(u.config.LockoutDuration)
+				current.LockedUntil = &lockedUntil
+				current.FailedLogins = 0
+			}
+			return current, nil
+		})
+		if err != nil {
+			return model.TokenResponse{}, err
+		}
+		return model.TokenResponse{}, ErrorInvalidCredentials
+	}
+
+	user, err = u.repository.UpdateUserByName(ctx, tenant, username, func(current model.User) (model.User, error) {
+		current.FailedLogins = 0
+		current.LockedUntil = nil
+		current.LastLoginAt = &now
+		return current, nil
+	})
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	return u.issueToken(*user, now)
+}
+
+func (u *Users) issueToken(user model.User, now time.Time) (model.TokenResponse, error) {
+	expiresAt := now.Add(u.config.TokenTTL)
+	claims := map[string]interface{}{
+		"sub":               user.Username,
+		"iat":               now.Unix(),
+		"exp":               expiresAt.Unix(),
+		u.config.RolesClaim: user.Roles,
+	}
+	if u.config.Issuer != "" {
+		claims["iss"] = u.config.Issuer
+	}
+	if u.config.Audience != "" {
+		claims["aud"] = u.config.Audience
+	}
+	if user.Tenant != "" && u.config.TenantClaim != "" {
+		claims[u.config.TenantClaim] = user.Tenant
+	}
+
+	u.signerLock.RLock()
+	signer := u.signer
+	u.signerLock.RUnlock()
+
+	token, err := signer.Sign(claims)
+	if err != nil {
+		return model.TokenResponse{}, errors.Wrap(err, "Could not sign token")
+	}
+	return model.TokenResponse{Token: token, TokenType: "Bearer", ExpiresAt: expiresAt}, nil
+}
+
+// setSigner - replaces the signer of the tokens issued from now on
+func (u *Users) setSigner(signer Signer) {
+	u.signerLock.Lock()
+	defer u.signerLock.Unlock()
+	u.signer = signer
+}
+
+// Find - returns the account of the user of the tenant
+func (u *Users) Find(ctx context.Context, tenant string, username string) (*model.User, error) {
+	return u.repository.FindUserByName(ctx, tenant, normalizeUsername(username))
+}
+
+// ChangePassword - replaces the password of the user of the tenant if the current password is right.
+// The new password must have been validated.
+func (u *Users) ChangePassword(ctx context.Context, tenant string, username string, currentPassword string, newPassword string) error {
+	passwordHash, err := HashSecret(newPassword, u.config.HashCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.repository.UpdateUserByName(ctx, tenant, normalizeUsername(username), func(current model.User) (model.User, error) {
+		if !VerifySecret(currentPassword, current.PasswordHash) {
+			return current, ErrorInvalidCredentials
+		}
+		return u.withPassword(current, passwordHash), nil
+	})
+	return err
+}
+
+// IssueResetToken - returns a single use token for resetting the password of the user of the tenant.
+// Issuing a token invalidates the previous token of the user.
+func (u *Users) IssueResetToken(ctx context.Context, tenant string, username string) (model.PasswordResetToken, error) {
+	secret := make([]byte, resetTokenSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return model.PasswordResetToken{}, errors.Wrap(err, "Could not generate reset token")
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	// the secret is random, the work factor of API keys is enough
+	tokenHash, err := HashSecret(encodedSecret, apiKeyHashCost)
+	if err != nil {
+		return model.PasswordResetToken{}, err
+	}
+
+	expiresAt := u.now().UTC().Add(u.config.ResetTokenTTL)
+	user, err := u.repository.UpdateUserByName(ctx, tenant, normalizeUsername(username), func(current model.User) (model.User, error) {
+		current.ResetTokenHash = tokenHash
+		current.ResetTokenExpiresAt = &expiresAt
+		return current, nil
+	})
+	if err != nil {
+		return model.PasswordResetToken{}, err
+	}
+
+	return model.PasswordResetToken{Token: user.Username + "." + encodedSecret, ExpiresAt: expiresAt}, nil
+}
+
+// ResetPassword - replaces the password of the user of the tenant the reset token was issued to, the token can be used once.
+// The new password must have been validated. A reset also unlocks the account.
+func (u *Users) ResetPassword(ctx context.Context, tenant string, token string, newPassword string) error {
+	// the secret is base64url encoded and has no dots, user names may have
+	separator := strings.LastIndexByte(token, '.')
+	if separator <= 0 {
+		return errors.Wrap(ErrorInvalidResetToken, "malformed token")
+	}
+	username, secret := token[:separator], token[separator+1:]
+
+	passwordHash, err := HashSecret(newPassword, u.config.HashCost)
+	if err != nil {
+		return err
+	}
+
+	now := u.now()
+	_, err = u.repository.UpdateUserByName(ctx, tenant, username, func(current model.User) (model.User, error) {
+		if current.ResetTokenHash == "" || !VerifySecret(secret, current.ResetTokenHash) {
+			return current, ErrorInvalidResetToken
+		}
+		if current.ResetTokenExpiresAt == nil || !now.Before(*current.ResetTokenExpiresAt) {
+			return current, errors.Wrap(ErrorInvalidResetToken, "expired token")
+		}
+		current = u.withPassword(current, passwordHash)
+		current.FailedLogins = 0
+		current.LockedUntil = nil
+		return current, nil
+	})
+	if errors.Cause(err) == persistence.ErrorNotFound {
+		return errors.Wrap(ErrorInvalidResetToken, "unknown user")
+	}
+	return err
+}
+
+// withPassword - the user with the new password, outstanding reset tokens are invalidated
+func (u *Users) withPassword(user model.User, passwordHash string) model.User {
+	user.PasswordHash = passwordHash
+	user.PasswordChangedAt = u.now().UTC()
+	user.ResetTokenHash = ""
+	user.ResetTokenExpiresAt = nil
+	return user
+}
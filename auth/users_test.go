@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestUsers(t *testing.T) (*Users, *JWTAuthenticator, *time.Time) {
+	now := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	signer, err := NewHMACSigner("login", testSecret)
+	assert.NoError(t, err)
+	repository, _ := persistence.NewMemoryRepository()
+	users, err := NewUsers(repository, signer, UserConfig{
+		HashCost:        bcrypt.MinCost,
+		DefaultRoles:    []Role{RoleEditor},
+		TokenTTL:        time.Hour,
+		Issuer:          "messages",
+		TenantClaim:     "tenant",
+		MaxFailedLogins: 3,
+		LockoutDuration: 15 * time.Minute,
+		ResetTokenTTL:   time.Hour,
+	})
+	assert.NoError(t, err)
+	users.now = func() time.Time { return now }
+
+	key, _ := NewHMACKey("login", testSecret)
+	authenticator := NewJWTAuthenticator(KeySet{key}, JWTConfig{Issuer: "messages", TenantClaim: "tenant"})
+	authenticator.now = users.now
+
+	username, password := "Will", "to be or not to be"
+	_, err = users.Register(context.Background(), model.UserRequest{Username: &username, Password: &password}, "")
+	assert.NoError(t, err)
+	return users, authenticator, &now
+}
+
+func TestUserLogin(t *testing.T) {
+	users, authenticator, now := newTestUsers(t)
+	ctx := context.Background()
+
+	token, err := users.Login(ctx, "", "will", "to be or not to be")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, now.Add(time.Hour), token.ExpiresAt)
+
+	principal, err := authenticator.Authenticate(ctx, token.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "will", Roles: []Role{RoleEditor}, Method: MethodJWT, IssuedAt: *now}, principal)
+
+	_, err = users.Login(ctx, "", "nobody", "to be or not to be")
+	assert.Equal(t, ErrorInvalidCredentials, err)
+
+	username, password := "WILL", "another password"
+	_, err = users.Register(ctx, model.UserRequest{Username: &username, Password: &password}, "")
+	assert.Equal(t, persistence.ErrorConflict, errors.Cause(err))
+
+	// users of a tenant are confined to it by their tokens
+	username = "ada"
+	user, err := users.Register(ctx, model.UserRequest{Username: &username, Password: &password}, "team-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", user.Tenant)
+	token, err = users.Login(ctx, "team-a", "ada", "another password")
+	assert.NoError(t, err)
+	principal, err = authenticator.Authenticate(ctx, token.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", principal.Tenant)
+
+	// user names are unique within a tenant only
+	_, err = users.Login(ctx, "team-b", "ada", "another password")
+	assert.Equal(t, ErrorInvalidCredentials, err)
+	_, err = users.Register(ctx, model.UserRequest{Username: &username, Password: &password}, "team-b")
+	assert.NoError(t, err)
+	_, err = users.Register(ctx, model.UserRequest{Username: &username, Password: &password}, "team-a")
+	assert.Equal(t, persistence.ErrorConflict, errors.Cause(err))
+}
+
+func TestUserLockout(t *testing.T) {
+	users, _, now := newTestUsers(t)
+	ctx := context.Background()
+
+	for attempt := 0; attempt < 3; attempt++ {
+		_, err := users.Login(ctx, "", "will", "wrong")
+		assert.Equal(t, ErrorInvalidCredentials, err)
+	}
+
+	_, err := users.Login(ctx, "", "will", "to be or not to be")
+	assert.Equal(t, AccountLockedError{Until: now.Add(15 * time.Minute)}, err)
+
+	*now = now.Add(15 * time.Minute)
+	_, err = users.Login(ctx, "", "will", "to be or not to be")
+	assert.NoError(t, err)
+
+	user, _ := users.Find(ctx, "", "will")
+	assert.Nil(t, user.LockedUntil)
+	assert.Equal(t, 0, user.FailedLogins)
+	assert.Equal(t, *now, *user.LastLoginAt)
+}
+
+func TestUserPasswords(t *testing.T) {
+	users, _, now := newTestUsers(t)
+	ctx := context.Background()
+
+	assert.Equal(t, ErrorInvalidCredentials, errors.Cause(users.ChangePassword(ctx, "", "will", "wrong", "new password")))
+	assert.EqualError(t, users.ChangePassword(ctx, "", "will", "to be or not to be", strings.Repeat("x", 73)),
+		"Could not hash secret: longer than 72 bytes", "bcrypt would ignore the end of the password")
+	assert.NoError(t, users.ChangePassword(ctx, "", "will", "to be or not to be", "new password"))
+	_, err := users.Login(ctx, "", "will", "new password")
+	assert.NoError(t, err)
+
+	resetToken, err := users.IssueResetToken(ctx, "", "will")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), resetToken.ExpiresAt)
+
+	assert.Equal(t, ErrorInvalidResetToken, errors.Cause(users.ResetPassword(ctx, "", resetToken.Token+"x", "reset password")))
+	assert.Equal(t, ErrorInvalidResetToken, errors.Cause(users.ResetPassword(ctx, "", "nobody.secret", "reset password")))
+	assert.NoError(t, users.ResetPassword(ctx, "", resetToken.Token, "reset password"))
+	assert.Equal(t, ErrorInvalidResetToken, errors.Cause(users.ResetPassword(ctx, "", resetToken.Token, "again")), "tokens are single use")
+
+	_, err = users.Login(ctx, "", "will", "reset password")
+	assert.NoError(t, err)
+
+	resetToken, _ = users.IssueResetToken(ctx, "", "will")
+	*now = now.Add(time.Hour)
+	assert.Equal(t, ErrorInvalidResetToken, errors.Cause(users.ResetPassword(ctx, "", resetToken.Token, "expired")))
+}
@@ -0,0 +1,77 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build details, set at link time:
+//
+//	go build -ldflags "-X github.com/shauera/messages/buildinfo.Version=1.2.0 -X github.com/shauera/messages/buildinfo.Commit=$(git rev-parse --short HEAD)"
+var (
+	// Version - the version of the service, "dev" for local builds
+	Version = "dev"
+	// Commit - the revision the service was built from
+	Commit = ""
+	// Date - the time the service was built at
+	Date = ""
+)
+
+// Info - the build details of the running service
+//
+// swagger:model BuildInfo
+type Info struct {
+	// example: 1.2.0
+	Version string `json:"version"`
+	// example: 3f2a9c1
+	Commit string `json:"commit,omitempty"`
+	// example: 2019-06-01T12:00:00Z
+	Date string `json:"date,omitempty"`
+	// example: go1.12.1
+	GoVersion string `json:"goVersion"`
+}
+
+// Get - the build details of the running service
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+}
+
+// Module - a module the service is built with
+type Module struct {
+	// example: github.com/gorilla/mux
+	Path string `json:"path"`
+	// example: v1.7.2
+	Version string `json:"version,omitempty"`
+}
+
+// Details - the build details together with the modules recorded in the binary, binaries built
+// outside of module mode record none
+type Details struct {
+	Info
+	// example: github.com/shauera/messages
+	Path         string   `json:"path,omitempty"`
+	Dependencies []Module `json:"dependencies,omitempty"`
+}
+
+// Read - the build details of the running service, the version of the main module
+// is used when no version was set at link time
+func Read() Details {
+	details := Details{Info: Get()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return details
+	}
+
+	details.Path = build.Main.Path
+	if Version == "dev" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+		details.Version = build.Main.Version
+	}
+	for _, dependency := range build.Deps {
+		module := Module{Path: dependency.Path, Version: dependency.Version}
+		if dependency.Replace != nil {
+			module = Module{Path: dependency.Replace.Path, Version: dependency.Replace.Version}
+		}
+		details.Dependencies = append(details.Dependencies, module)
+	}
+	return details
+}
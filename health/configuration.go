@@ -0,0 +1,16 @@
+package health
+
+import (
+	"github.com/pkg/errors"
+
+	config "github.com/spf13/viper"
+)
+
+//LoadHealth - build the health of a starting service from the "health" configuration section
+func LoadHealth(checks ...Check) (*Health, error) {
+	timeout := config.GetDuration("health.timeout")
+	if timeout <= 0 {
+		return nil, errors.New("health.timeout must be positive")
+	}
+	return NewHealth(timeout, checks...), nil
+}
@@ -0,0 +1,137 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shauera/messages/buildinfo"
+	"github.com/shauera/messages/model"
+)
+
+// Lifecycle states of the service
+const (
+	StateStarting = "starting"
+	StateReady    = "ready"
+	StateStopping = "stopping"
+)
+
+// Check - a dependency of the service, checked for every readiness probe and health report
+type Check struct {
+	Name string
+	// Check - returns an error when the dependency is not available
+	Check func(ctx context.Context) error
+}
+
+// Pinger - a dependency that can be pinged, such as the repository
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PingCheck - the check of a dependency that can be pinged
+func PingCheck(name string, pinger Pinger) Check {
+	return Check{Name: name, Check: pinger.Ping}
+}
+
+// Health - the lifecycle state of the service and the checks of its dependencies.
+// The service is ready once started and until it begins shutting down, as long as all the checks pass.
+type Health struct {
+	checks    []Check
+	timeout   time.Duration
+	startedAt time.Time
+	state     atomic.Value
+	now       func() time.Time
+}
+
+//NewHealth - return the health of a starting service, each check must complete within the timeout
+func NewHealth(timeout time.Duration, checks ...Check) *Health {
+	health := &Health{checks: checks, timeout: timeout, startedAt: time.Now(), now: time.Now}
+	health.state.Store(StateStarting)
+	return health
+}
+
+// State - the lifecycle state of the service
+func (h *Health) State() string {
+	return h.state.Load().(string)
+}
+
+// Started - marks a starting service ready to serve requests, a service already stopping stays stopping
+func (h *Health) Started() {
+	h.state.CompareAndSwap(StateStarting, StateReady)
+}
+
+// Stopping - marks the service as shutting down, it is not ready from now on
+func (h *Health) Stopping() {
+	h.state.Store(StateStopping)
+}
+
+// Liveness - the report of a live service, the process is live as long as it serves the probe
+func (h *Health) Liveness() model.HealthReport {
+	return model.HealthReport{Status: model.HealthStatusUp}
+}
+
+// Readiness - the report of the state and the checks, up when the service is ready and all the checks pass
+func (h *Health) Readiness(ctx context.Context) model.HealthReport {
+	report := model.HealthReport{Status: model.HealthStatusUp, State: h.State(), Checks: h.runChecks(ctx)}
+	if report.State != StateReady {
+		report.Status = model.HealthStatusDown
+	}
+	for _, check := range report.Checks {
+		if check.Status != model.HealthStatusUp {
+			report.Status = model.HealthStatusDown
+		}
+	}
+	return report
+}
+
+// Report - the readiness report together with the build and the start time of the service
+func (h *Health) Report(ctx context.Context) model.HealthReport {
+	report := h.Readiness(ctx)
+	build := buildinfo.Get()
+	report.Version, report.Commit = build.Version, build.Commit
+	startedAt := h.startedAt.UTC()
+	report.StartedAt = &startedAt
+	return report
+}
+
+// runChecks - runs all the checks concurrently, a check that does not complete within the timeout fails
+func (h *Health) runChecks(ctx context.Context) []model.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	results := make([]model.HealthCheck, len(h.checks))
+	var wait sync.WaitGroup
+	for index, check := range h.checks {
+		wait.Add(1)
+		go func(index int, check Check) {
+			defer wait.Done()
+			results[index] = h.run(ctx, check)
+		}(index, check)
+	}
+	wait.Wait()
+	return results
+}
+
+func (h *Health) run(ctx context.Context, check Check) model.HealthCheck {
+	start := h.now()
+	done := make(chan error, 1)
+	go func() { done <- check.Check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := model.HealthCheck{
+		Name:      check.Name,
+		Status:    model.HealthStatusUp,
+		LatencyMs: float64(h.now().Sub(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		result.Status, result.Error = model.HealthStatusDown, err.Error()
+	}
+	return result
+}
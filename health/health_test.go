@@ -0,0 +1,51 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	var databaseErr error
+	database := Check{Name: "database", Check: func(ctx context.Context) error { return databaseErr }}
+	slow := Check{Name: "slow", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}}
+	ctx := context.Background()
+
+	health := NewHealth(time.Second, database)
+	assert.Equal(t, StateStarting, health.Readiness(ctx).State)
+	assert.Equal(t, model.HealthStatusDown, health.Readiness(ctx).Status, "not ready while starting")
+
+	health.Started()
+	report := health.Readiness(ctx)
+	assert.Equal(t, model.HealthStatusUp, report.Status)
+	assert.Equal(t, "database", report.Checks[0].Name)
+	assert.Equal(t, model.HealthStatusUp, report.Checks[0].Status)
+
+	databaseErr = errors.New("Repository unavailable")
+	report = health.Readiness(ctx)
+	assert.Equal(t, model.HealthStatusDown, report.Status)
+	assert.Equal(t, "Repository unavailable", report.Checks[0].Error)
+
+	databaseErr = nil
+	health.Stopping()
+	assert.Equal(t, model.HealthStatusDown, health.Readiness(ctx).Status, "not ready once stopping")
+	assert.Equal(t, model.HealthStatusUp, health.Liveness().Status)
+	health.Started()
+	assert.Equal(t, StateStopping, health.State(), "a service stopped while starting is not made ready")
+
+	health = NewHealth(10*time.Millisecond, database, slow)
+	health.Started()
+	report = health.Readiness(ctx)
+	assert.Equal(t, model.HealthStatusDown, report.Status)
+	assert.Equal(t, model.HealthStatusUp, report.Checks[0].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks[1].Error)
+	assert.True(t, report.Checks[1].LatencyMs >= 10)
+}
@@ -0,0 +1,23 @@
+package idempotency
+
+import (
+	"github.com/pkg/errors"
+
+	config "github.com/spf13/viper"
+)
+
+//LoadKeys - build the idempotency keys from the "idempotency" configuration section, records are stored in the given repository.
+//Returns nil when idempotency.enabled is false, Idempotency-Key headers are then ignored.
+func LoadKeys(repository Repository) (*Keys, error) {
+	if !config.GetBool("idempotency.enabled") {
+		return nil, nil
+	}
+
+	ttl := config.GetDuration("idempotency.ttl")
+	lockTimeout := config.GetDuration("idempotency.lockTimeout")
+	if ttl <= 0 || lockTimeout <= 0 {
+		return nil, errors.New("idempotency: ttl and lockTimeout must be positive")
+	}
+
+	return NewKeys(repository, ttl, lockTimeout), nil
+}
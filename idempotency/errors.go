@@ -0,0 +1,15 @@
+package idempotency
+
+//Error - an idempotency error type
+type Error string
+
+//Error - implemenation of Error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+//ErrorInProgress - a request of the same key is being served
+const ErrorInProgress = Error("Request in progress")
+
+//ErrorKeyReused - the key was used with a different request
+const ErrorKeyReused = Error("Idempotency key reused")
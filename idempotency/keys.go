@@ -0,0 +1,95 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+)
+
+// Repository - abstraction of the storage of idempotency records, records are shared by all the instances of the service
+type Repository interface {
+	// CreateIdempotencyRecord - persistence.ErrorConflict is returned if a record of the same id exists
+	CreateIdempotencyRecord(ctx context.Context, record model.IdempotencyRecord) error
+	FindIdempotencyRecord(ctx context.Context, id string) (*model.IdempotencyRecord, error)
+	// CompleteIdempotencyRecord - replaces the uncompleted record of the same id
+	CompleteIdempotencyRecord(ctx context.Context, record model.IdempotencyRecord) error
+	// DeleteIdempotencyRecord - removes the record of the id only if it still expires at the given time
+	DeleteIdempotencyRecord(ctx context.Context, id string, expiresAt time.Time) error
+}
+
+// Keys - tracks the requests made with idempotency keys.
+// The response of the first request of a key is kept for the TTL and replayed for repeated requests.
+type Keys struct {
+	repository Repository
+	// ttl - how long responses are kept
+	ttl time.Duration
+	// lockTimeout - how long a request is served before its key is considered abandoned
+	lockTimeout time.Duration
+	now         func() time.Time
+}
+
+//NewKeys - return the keys stored in the repository
+func NewKeys(repository Repository, ttl time.Duration, lockTimeout time.Duration) *Keys {
+	return &Keys{repository: repository, ttl: ttl, lockTimeout: lockTimeout, now: time.Now}
+}
+
+// Hash - the hash of a request body that identifies the request of a key
+func Hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Begin - starts serving the request of the id.
+// The record of the request is returned, the first request of the id gets a new uncompleted record and
+// should be served, repeated requests get the completed record of the first request to replay.
+// ErrorInProgress is returned while the first request is being served and ErrorKeyReused if the request
+// is different from the first request.
+func (k *Keys) Begin(ctx context.Context, id string, requestHash string) (model.IdempotencyRecord, error) {
+	record := model.IdempotencyRecord{ID: id, RequestHash: requestHash, ExpiresAt: k.now().Add(k.lockTimeout)}
+	err := k.repository.CreateIdempotencyRecord(ctx, record)
+	if errors.Cause(err) != persistence.ErrorConflict {
+		return record, err
+	}
+
+	existing, err := k.repository.FindIdempotencyRecord(ctx, id)
+	if errors.Cause(err) == persistence.ErrorNotFound {
+		// removed since, try again
+		return record, k.repository.CreateIdempotencyRecord(ctx, record)
+	}
+	if err != nil {
+		return record, err
+	}
+
+	if !existing.ExpiresAt.After(k.now()) {
+		// expired records may be kept a while by the repository
+		if err := k.repository.DeleteIdempotencyRecord(ctx, id, existing.ExpiresAt); err != nil && errors.Cause(err) != persistence.ErrorNotFound {
+			return record, err
+		}
+		return record, k.repository.CreateIdempotencyRecord(ctx, record)
+	}
+	if existing.RequestHash != requestHash {
+		return *existing, ErrorKeyReused
+	}
+	if !existing.Completed {
+		return *existing, ErrorInProgress
+	}
+	return *existing, nil
+}
+
+// Complete - keeps the response of the request of the record for the TTL
+func (k *Keys) Complete(ctx context.Context, record model.IdempotencyRecord, status int, header map[string][]string, body []byte) error {
+	record.Completed = true
+	record.Status, record.Header, record.Body = status, header, body
+	record.ExpiresAt = k.now().Add(k.ttl)
+	return k.repository.CompleteIdempotencyRecord(ctx, record)
+}
+
+// Release - forgets the uncompleted request of the record, so it can be made again
+func (k *Keys) Release(ctx context.Context, record model.IdempotencyRecord) error {
+	return k.repository.DeleteIdempotencyRecord(ctx, record.ID, record.ExpiresAt)
+}
@@ -0,0 +1,55 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	repository, _ := persistence.NewMemoryRepository()
+	keys := NewKeys(repository, time.Hour, time.Minute)
+	keys.now = func() time.Time { return now }
+	requestHash := Hash([]byte(`{"content": "abba"}`))
+
+	record, err := keys.Begin(ctx, "key", requestHash)
+	assert.NoError(t, err)
+	assert.Equal(t, model.IdempotencyRecord{ID: "key", RequestHash: requestHash, ExpiresAt: now.Add(time.Minute)}, record)
+
+	_, err = keys.Begin(ctx, "key", requestHash)
+	assert.Equal(t, ErrorInProgress, err)
+	_, err = keys.Begin(ctx, "key", Hash([]byte(`{"content": "abc"}`)))
+	assert.Equal(t, ErrorKeyReused, err)
+
+	header := map[string][]string{"Content-Type": {"application/json"}}
+	assert.NoError(t, keys.Complete(ctx, record, 200, header, []byte(`{"id":"1"}`)))
+	replayed, err := keys.Begin(ctx, "key", requestHash)
+	assert.NoError(t, err)
+	assert.True(t, replayed.Completed)
+	assert.Equal(t, 200, replayed.Status)
+	assert.Equal(t, header, replayed.Header)
+	assert.Equal(t, `{"id":"1"}`, string(replayed.Body))
+
+	// responses are forgotten after the TTL
+	now = now.Add(time.Hour)
+	record, err = keys.Begin(ctx, "key", requestHash)
+	assert.NoError(t, err)
+	assert.False(t, record.Completed)
+
+	// released requests can be made again
+	assert.NoError(t, keys.Release(ctx, record))
+	_, err = keys.Begin(ctx, "key", requestHash)
+	assert.NoError(t, err)
+
+	// abandoned requests are taken over after the lock timeout
+	now = now.Add(time.Minute)
+	record, err = keys.Begin(ctx, "key", requestHash)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), record.ExpiresAt)
+}
@@ -0,0 +1,63 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Hook - stops a part of the service, such as the HTTP server, a background worker or a database connection
+type Hook struct {
+	Name string
+	// Stop - stops the part within ctx, returns an error when it could not be stopped cleanly
+	Stop func(ctx context.Context) error
+}
+
+// Shutdown - the hooks stopping the service. Hooks run in the reverse order they were added,
+// so parts added as the service starts are stopped before the parts they depend on.
+type Shutdown struct {
+	lock  sync.Mutex
+	hooks []Hook
+}
+
+//NewShutdown - return a shutdown without hooks
+func NewShutdown() *Shutdown {
+	return &Shutdown{}
+}
+
+// OnShutdown - adds a hook stopping the named part
+func (s *Shutdown) OnShutdown(name string, stop func(ctx context.Context) error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hooks = append(s.hooks, Hook{Name: name, Stop: stop})
+}
+
+// Run - runs the hooks one after the other within ctx, hooks added last run first.
+// Every hook runs even when an earlier one failed, the first error is returned.
+func (s *Shutdown) Run(ctx context.Context) error {
+	s.lock.Lock()
+	hooks := make([]Hook, len(s.hooks))
+	copy(hooks, s.hooks)
+	s.lock.Unlock()
+
+	var firstErr error
+	for index := len(hooks) - 1; index >= 0; index-- {
+		hook := hooks[index]
+		start := time.Now()
+		err := hook.Stop(ctx)
+		logEntry := log.WithField("hook", hook.Name).WithField("duration", time.Since(start).String())
+		if err != nil {
+			logEntry.WithError(err).Error("Shutdown hook failed")
+			if firstErr == nil {
+				firstErr = errors.Wrap(err, hook.Name)
+			}
+			continue
+		}
+		logEntry.Debug("Shutdown hook done")
+	}
+	return firstErr
+}
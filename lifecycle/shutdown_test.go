@@ -0,0 +1,45 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	var stopped []string
+	stop := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			stopped = append(stopped, name)
+			return err
+		}
+	}
+
+	shutdown := NewShutdown()
+	shutdown.OnShutdown("database", stop("database", nil))
+	shutdown.OnShutdown("worker", stop("worker", errors.New("worker is stuck")))
+	shutdown.OnShutdown("http server", stop("http server", nil))
+
+	err := shutdown.Run(context.Background())
+	assert.Equal(t, []string{"http server", "worker", "database"}, stopped, "hooks run in the reverse order they were added")
+	assert.EqualError(t, err, "worker: worker is stuck", "later hooks run after a failure")
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	shutdown := NewShutdown()
+	shutdown.OnShutdown("slow", func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Minute):
+			return nil
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(shutdown.Run(ctx)))
+}
@@ -12,6 +12,16 @@
 //     Produces:
 //     - application/json
 //
+//     SecurityDefinitions:
+//     bearer:
+//          type: apiKey
+//          name: Authorization
+//          in: header
+//          description: a JSON Web Token - Bearer <token>
+//
+//     Security:
+//     - bearer: []
+//
 // swagger:meta
 package main
 
@@ -19,13 +29,12 @@ import (
 	"context"
 	"os"
 	"os/signal"
-	"time"
+	"syscall"
 
 	"github.com/shauera/messages/application"
 	rest "github.com/shauera/messages/rest"
 
 	log "github.com/sirupsen/logrus"
-	config "github.com/spf13/viper"
 )
 
 func init() {
@@ -34,34 +43,39 @@ func init() {
 }
 
 func main() {
+	// "messages config <command>" inspects the configuration instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(application.RunConfigCommand(os.Args[2:], os.Stdout, rest.CheckConfiguration))
+	}
+
 	log.Println("Starting the Messages Manager service...")
 
+	// Misconfigurations stop the service before anything starts
+	if _, err := application.LoadConfiguration(); err != nil {
+		log.WithError(err).Fatal("Invalid configuration, run \"messages config check\" to list the problems")
+	}
+	if err := rest.CheckConfiguration(); err != nil {
+		log.WithError(err).Fatal("Invalid configuration, run \"messages config check\" to list the problems")
+	}
+
 	cancellableContext, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start HTTP server
-	go rest.StartHTTPServer(cancellableContext)
-
-	// -- Wait for a SIGINT. Run cleanup when signal is received ---
-	signalChan := make(chan os.Signal, 1)
-	cleanupDone := make(chan struct{})
-	signal.Notify(signalChan, os.Interrupt)
+	// -- Stop on SIGINT or SIGTERM, a second signal stops the service right away ---
+	signalChan := make(chan os.Signal, 2)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-signalChan
-		log.Println("Received an interrupt, stopping service...")
-		// Do some cleanup...
-
-		// Stop all running routines
+		receivedSignal := <-signalChan
+		log.WithField("signal", receivedSignal.String()).Info("Received a signal, stopping service...")
 		cancel()
 
-		// Wait for routines to stop
-		shutdownGraceDuration := config.GetDuration("service.shutdownGraceDuration")
-		log.WithField("gracePeriod", shutdownGraceDuration).Info("Waiting for routines to stop")
-		time.Sleep(shutdownGraceDuration)
-
-		// Finished cleanup...
-		close(cleanupDone)
+		receivedSignal = <-signalChan
+		log.WithField("signal", receivedSignal.String()).Fatal("Received a second signal, service stopped")
 	}()
-	<-cleanupDone
-	// -------------------------------------------------------------
+
+	// Serve until stopped, then wait for in-flight requests and cleanup to finish
+	if err := rest.StartHTTPServer(cancellableContext); err != nil {
+		log.WithError(err).Fatal("Service stopped with an error")
+	}
+	log.Info("Service stopped")
 }
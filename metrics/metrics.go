@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultBuckets - latency buckets in seconds, from 5ms to 10s
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Since - the seconds passed since start, the unit of the duration metrics
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// newCounterVec - registers a counter with the given labels in the registry
+func newCounterVec(registry *prometheus.Registry, name string, help string, labels ...string) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	registry.MustRegister(counter)
+	return counter
+}
+
+// newGaugeVec - registers a gauge with the given labels in the registry
+func newGaugeVec(registry *prometheus.Registry, name string, help string, labels ...string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	registry.MustRegister(gauge)
+	return gauge
+}
+
+// newHistogramVec - registers a histogram with the given buckets and labels in the registry
+func newHistogramVec(registry *prometheus.Registry, name string, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	registry.MustRegister(histogram)
+	return histogram
+}
+
+//NewGaugeFunc - registers a gauge whose value is read from value whenever the metrics are collected
+func NewGaugeFunc(registry *prometheus.Registry, name string, help string, value func() float64) prometheus.GaugeFunc {
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, value)
+	registry.MustRegister(gauge)
+	return gauge
+}
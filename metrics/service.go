@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Default - the registry of the service metrics, exposed on /metrics
+var Default = prometheus.NewRegistry()
+
+// HTTP metrics, requests are labeled by the path template of their route ("unmatched" for no route)
+var (
+	HTTPRequests = newCounterVec(Default, "messages_http_requests_total",
+		"HTTP requests served.", "route", "method", "status")
+	HTTPRequestDuration = newHistogramVec(Default, "messages_http_request_duration_seconds",
+		"Time spent serving HTTP requests.", DefaultBuckets, "route", "method", "status")
+	HTTPRequestsInFlight = newGaugeVec(Default, "messages_http_requests_in_flight",
+		"HTTP requests being served.", "route", "method")
+)
+
+// Repository metrics, operations are labeled by the backend (memory or mongo) and the repository method
+var (
+	RepositoryOperationDuration = newHistogramVec(Default, "messages_repository_operation_duration_seconds",
+		"Time spent in repository operations.", DefaultBuckets, "backend", "operation")
+	RepositoryErrors = newCounterVec(Default, "messages_repository_errors_total",
+		"Repository operations that failed, by the kind of error.", "backend", "operation", "error")
+)
+
+// Mongo metrics, observed by the command monitor of the mongo client.
+// The driver reports no connection pool events, so the state of the pool itself is not measured.
+var (
+	MongoCommandDuration = newHistogramVec(Default, "messages_mongo_command_duration_seconds",
+		"Time spent in mongo commands.", DefaultBuckets, "command", "status")
+	MongoCommandsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{Name: "messages_mongo_commands_in_flight",
+		Help: "Mongo commands running."})
+	MongoConnectionsSeen = prometheus.NewCounter(prometheus.CounterOpts{Name: "messages_mongo_connections_seen_total",
+		Help: "Mongo connections that ran a command, counted when they run their first command."})
+)
+
+// AnalyzerDuration - the time analyzers take, by analyzer name
+var AnalyzerDuration = newHistogramVec(Default, "messages_analyzer_duration_seconds",
+	"Time spent analyzing message contents.", []float64{.00001, .0001, .001, .01, .1}, "analyzer")
+
+// ConfigReloads - the reloads of the configuration, by result: applied, unchanged or rejected
+var ConfigReloads = newCounterVec(Default, "messages_config_reloads_total",
+	"Reloads of the configuration.", "result")
+
+func init() {
+	Default.MustRegister(MongoCommandsInFlight, MongoConnectionsSeen)
+	// the runtime and process metrics of the Prometheus client, go_* and process_*
+	Default.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
@@ -0,0 +1,55 @@
+package model
+
+// Message visibilities
+const (
+	// VisibilityPublic - listed and readable by everyone, messages without a visibility are public
+	VisibilityPublic = "public"
+	// VisibilityUnlisted - readable by everyone that knows the id, listed to the owner only
+	VisibilityUnlisted = "unlisted"
+	// VisibilityPrivate - readable by the owner only
+	VisibilityPrivate = "private"
+)
+
+// Visibilities - all the message visibilities
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
+// Access - the messages a repository operation is allowed to see and change.
+// Repositories enforce it in their queries so no operation returns messages the client may not see.
+type Access struct {
+	// Subject - the client the operation is made for, it owns the messages it created
+	Subject string
+	// ReadAll - private and unlisted messages of other owners can be read and listed
+	ReadAll bool
+	// WriteAll - messages of other owners can be changed
+	WriteAll bool
+}
+
+// FullAccess - access to every message, for operations that aren't made for a client
+var FullAccess = Access{ReadAll: true, WriteAll: true}
+
+// owns - reports if the message is owned by the subject
+func (a Access) owns(message MessageResponse) bool {
+	return a.Subject != "" && message.Owner != nil && *message.Owner == a.Subject
+}
+
+// CanList - reports if the message may be returned by listing queries
+func (a Access) CanList(message MessageResponse) bool {
+	switch message.Visibility {
+	case VisibilityPrivate, VisibilityUnlisted:
+		return a.ReadAll || a.owns(message)
+	}
+	return true
+}
+
+// CanRead - reports if the message may be returned when asked for by id
+func (a Access) CanRead(message MessageResponse) bool {
+	if message.Visibility == VisibilityPrivate {
+		return a.ReadAll || a.owns(message)
+	}
+	return true
+}
+
+// CanWrite - reports if the message may be changed, messages without an owner can be changed only with WriteAll
+func (a Access) CanWrite(message MessageResponse) bool {
+	return a.WriteAll || a.owns(message)
+}
@@ -0,0 +1,23 @@
+package model
+
+// LogLevel - the minimal level of logged entries
+type LogLevel struct {
+	// One of panic, fatal, error, warn, info, debug or trace.
+	//
+	// example: debug
+	Level string `json:"level"`
+}
+
+// ServiceMode - the mode of the service
+type ServiceMode struct {
+	// One of normal, read-only or maintenance.
+	//
+	// example: read-only
+	Mode string `json:"mode"`
+}
+
+// Maintenance - whether the service is down for maintenance
+type Maintenance struct {
+	// true while only the health endpoints are served.
+	Enabled bool `json:"enabled"`
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shauera/messages/validation"
+)
+
+// APIKeyRequest describes an API key to create for a service client.
+//
+// swagger:model
+type APIKeyRequest struct {
+	// A name identifying the client of the key.
+	//
+	// required: true
+	// minimum length: 1
+	// maximum length: 64
+	// example: nightly-export
+	Name *string `json:"name,omitempty"`
+
+	// The permissions granted to the key.
+	//
+	// required: true
+	// example: ["messages:read"]
+	Scopes []string `json:"scopes,omitempty"`
+
+	// The time the key expires at, the key does not expire when missing.
+	//
+	// required: false
+	// example: 2030-01-01T00:00:00Z
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// The tenant the key is confined to. Keys created by a client of a tenant are confined
+	// to that tenant, keys without a tenant reach tenants only with the tenants:manage scope.
+	//
+	// required: false
+	// example: team-a
+	Tenant *string `json:"tenant,omitempty"`
+}
+
+// apiKeyNameRule - the constraints of API key names
+var apiKeyNameRule = validation.StringRule{Required: true, MinLength: 1, MaxLength: 64}
+
+// Validate - make sure the request names a client, grants only the given known scopes and expires in the future
+func (kr APIKeyRequest) Validate(knownScopes []string, now time.Time) []validation.FieldError {
+	fieldErrors := apiKeyNameRule.Validate("name", kr.Name)
+
+	if len(kr.Scopes) == 0 {
+		fieldErrors = append(fieldErrors, validation.FieldError{
+			Field:   "scopes",
+			Code:    validation.CodeRequired,
+			Message: "Scopes are required",
+		})
+	}
+	for index, scope := range kr.Scopes {
+		if !containsString(knownScopes, scope) {
+			fieldErrors = append(fieldErrors, validation.FieldError{
+				Field:   fmt.Sprintf("scopes[%d]", index),
+				Code:    validation.CodeUnknownValue,
+				Params:  map[string]interface{}{"allowed": knownScopes},
+				Message: fmt.Sprintf("Unknown scope %q", scope),
+			})
+		}
+	}
+
+	if kr.ExpiresAt != nil && !kr.ExpiresAt.After(now) {
+		fieldErrors = append(fieldErrors, validation.FieldError{
+			Field:   "expiresAt",
+			Code:    validation.CodeInPast,
+			Params:  map[string]interface{}{"now": now.UTC().Format(time.RFC3339)},
+			Message: "Expires at must be in the future",
+		})
+	}
+
+	return fieldErrors
+}
+
+// containsString - reports if the value is one of the values
+func containsString(values []string, value string) bool {
+	for _, known := range values {
+		if known == value {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey is a credential of a service client, only a hash of the key secret is stored.
+//
+// swagger:model
+type APIKey struct {
+	// The id of the key, the first part of the key.
+	//
+	// example: 3f2a9c1d7b6e5a40
+	ID string `json:"id" bson:"_id"`
+
+	// A name identifying the client of the key.
+	//
+	// example: nightly-export
+	Name string `json:"name" bson:"name"`
+
+	// The permissions granted to the key.
+	//
+	// example: ["messages:read"]
+	Scopes []string `json:"scopes" bson:"scopes"`
+
+	// The tenant the key is confined to, missing when the key is not confined to a tenant.
+	//
+	// example: team-a
+	Tenant string `json:"tenant,omitempty" bson:"tenant,omitempty"`
+
+	// The key to send in the Authorization header as "ApiKey <key>".
+	// It is returned only when the key is created.
+	Key string `json:"key,omitempty" bson:"-"`
+
+	// The hash of the key secret.
+	Hash string `json:"-" bson:"hash"`
+
+	// The time the key was created at.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+
+	// The time the key expires at, missing when the key does not expire.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+
+	// The time the key was last used at, updated at most once a minute.
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+
+	// The time the key was revoked at, missing while the key is active.
+	RevokedAt *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// APIKeys - a list of API keys
+type APIKeys []APIKey
@@ -1,11 +1,96 @@
 package model
 
-//ErrorResponse - template for rendering errors in HTTP responses
-type ErrorResponse struct {
-	Message string `json:"message"`
-}
+import (
+	"github.com/shauera/messages/validation"
+)
+
+//ProblemContentType - media type of error responses (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+//Problem types - identify the kind of problem an error response describes
+const (
+	//ProblemTypeMalformedRequest - the request could not be parsed
+	ProblemTypeMalformedRequest = "/problems/malformed-request"
+	//ProblemTypeValidation - the request was parsed but violates the validation rules
+	ProblemTypeValidation = "/problems/validation"
+	//ProblemTypeInvalidID - the resource id is not in a valid format
+	ProblemTypeInvalidID = "/problems/invalid-id"
+	//ProblemTypeUnauthorized - the request is not authenticated
+	ProblemTypeUnauthorized = "/problems/unauthorized"
+	//ProblemTypeForbidden - the authenticated client is not allowed to make the request
+	ProblemTypeForbidden = "/problems/forbidden"
+	//ProblemTypeAccountLocked - the account is locked after repeated failed logins
+	ProblemTypeAccountLocked = "/problems/account-locked"
+	//ProblemTypeInvalidToken - a single use token sent in the request body is not valid
+	ProblemTypeInvalidToken = "/problems/invalid-token"
+	//ProblemTypeInvalidTenant - the request does not name a tenant or names conflicting tenants
+	ProblemTypeInvalidTenant = "/problems/invalid-tenant"
+	//ProblemTypeUnknownTenant - the tenant of the request is not provisioned
+	ProblemTypeUnknownTenant = "/problems/unknown-tenant"
+	//ProblemTypeRateLimited - the client sent too many requests, see the Retry-After header
+	ProblemTypeRateLimited = "/problems/rate-limited"
+	//ProblemTypeQuotaExceeded - the client used all the writes of its daily quota, see the Retry-After header
+	ProblemTypeQuotaExceeded = "/problems/quota-exceeded"
+	//ProblemTypeIdempotencyKeyReused - the Idempotency-Key of the request was used with a different request
+	ProblemTypeIdempotencyKeyReused = "/problems/idempotency-key-reused"
+	//ProblemTypeRequestInProgress - a request with the same Idempotency-Key is being served
+	ProblemTypeRequestInProgress = "/problems/request-in-progress"
+	//ProblemTypeNotFound - the resource does not exist
+	ProblemTypeNotFound = "/problems/not-found"
+	//ProblemTypeConflict - the request conflicts with the current state of the resource
+	ProblemTypeConflict = "/problems/conflict"
+	//ProblemTypeUnavailable - a dependency of the service is unavailable
+	ProblemTypeUnavailable = "/problems/unavailable"
+	//ProblemTypeMaintenance - the service is down for maintenance, see the Retry-After header
+	ProblemTypeMaintenance = "/problems/maintenance"
+	//ProblemTypeReadOnly - the service is read-only and does not accept changes, see the Retry-After header
+	ProblemTypeReadOnly = "/problems/read-only"
+	//ProblemTypeTimeout - a dependency of the service did not respond in time
+	ProblemTypeTimeout = "/problems/timeout"
+	//ProblemTypeNotAcceptable - none of the media types accepted by the client can represent the response
+	ProblemTypeNotAcceptable = "/problems/not-acceptable"
+	//ProblemTypeUnsupportedMediaType - the request body media type is not supported
+	ProblemTypeUnsupportedMediaType = "/problems/unsupported-media-type"
+	//ProblemTypePatchFailed - the patch can't be applied to the resource
+	ProblemTypePatchFailed = "/problems/patch-failed"
+	//ProblemTypeInternal - an unexpected error occurred
+	ProblemTypeInternal = "/problems/internal"
+)
+
+// ProblemResponse - template for rendering errors in HTTP responses (RFC 7807 problem details)
+//
+// swagger:model
+type ProblemResponse struct {
+	// A URI reference that identifies the problem type.
+	//
+	// example: /problems/not-found
+	Type string `json:"type"`
+
+	// A short, human-readable summary of the problem type.
+	//
+	// example: Not Found
+	Title string `json:"title"`
 
-//ValidationErrorsResponse - template for rendering errors in HTTP responses all validation errors for a specific request 
-type ValidationErrorsResponse struct {
-	Messages []string `json:"message"`
-}
\ No newline at end of file
+	// The HTTP status code of the response.
+	//
+	// example: 404
+	Status int `json:"status"`
+
+	// A human-readable explanation specific to this occurrence of the problem.
+	//
+	// example: message 5cf3a2b1e4b0a1b2c3d4e5f6 does not exist
+	Detail string `json:"detail,omitempty"`
+
+	// A URI reference that identifies the specific occurrence of the problem.
+	//
+	// example: /messages/5cf3a2b1e4b0a1b2c3d4e5f6
+	Instance string `json:"instance,omitempty"`
+
+	// The id correlating the response with the service logs.
+	//
+	// example: 6f1c2d3e4a5b6c7d8e9f0a1b2c3d4e5f
+	CorrelationID string `json:"correlationId,omitempty"`
+
+	// The validation failures of the request, for validation problems only.
+	Errors []validation.FieldError `json:"errors,omitempty"`
+}
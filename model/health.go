@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+)
+
+// Health statuses
+const (
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+// HealthReport describes the state of the service and of its dependencies.
+//
+// swagger:model
+type HealthReport struct {
+	// up when the service can serve requests.
+	//
+	// example: up
+	Status string `json:"status"`
+
+	// The lifecycle state of the service: starting, ready or stopping.
+	//
+	// example: ready
+	State string `json:"state,omitempty"`
+
+	// The mode of the service: normal, read-only or maintenance.
+	//
+	// example: normal
+	Mode string `json:"mode,omitempty"`
+
+	// The version of the service.
+	//
+	// example: 1.2.0
+	Version string `json:"version,omitempty"`
+
+	// The revision the service was built from.
+	//
+	// example: 3f2a9c1
+	Commit string `json:"commit,omitempty"`
+
+	// The time the service started at.
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+
+	// The results of the dependency checks.
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of checking a dependency of the service.
+//
+// swagger:model
+type HealthCheck struct {
+	// The name of the dependency.
+	//
+	// example: database
+	Name string `json:"name"`
+
+	// up when the dependency is available.
+	//
+	// example: up
+	Status string `json:"status"`
+
+	// The time the check took in milliseconds.
+	//
+	// example: 1.25
+	LatencyMs float64 `json:"latencyMs"`
+
+	// Why the dependency is not available.
+	//
+	// example: Repository timeout
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// IdempotencyRecord - a request made with an Idempotency-Key header and, once completed, its response
+type IdempotencyRecord struct {
+	// ID - the key together with the client and the resource of the request
+	ID string `bson:"_id"`
+	// RequestHash - a hash of the request body, repeated requests must have the same body
+	RequestHash string `bson:"requestHash"`
+	// Completed - false while the first request is being served
+	Completed bool `bson:"completed"`
+	// Status, Header and Body - the response of the first request, once completed
+	Status int                 `bson:"status,omitempty"`
+	Header map[string][]string `bson:"header,omitempty"`
+	Body   []byte              `bson:"body,omitempty"`
+	// ExpiresAt - the time the record can be forgotten, an uncompleted record is abandoned by then
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
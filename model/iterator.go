@@ -0,0 +1,40 @@
+package model
+
+import (
+	"context"
+)
+
+// MessageIterator - messages streamed from a repository one at a time.
+// Close must be called once the iteration is done.
+type MessageIterator interface {
+	// Next - advance to the next message, returns false when there are no more messages,
+	// the context is done or an error occurred (see Err)
+	Next(ctx context.Context) bool
+	// Message - the current message
+	Message() MessageResponse
+	// Err - the error that stopped the iteration, nil when all the messages were read
+	Err() error
+	// Close - release the resources held by the iterator
+	Close(ctx context.Context) error
+}
+
+// CollectMessages - read all the remaining messages of the iterator
+func CollectMessages(ctx context.Context, iterator MessageIterator) (MessageResponses, error) {
+	var messageResponses MessageResponses
+	for iterator.Next(ctx) {
+		messageResponses = append(messageResponses, iterator.Message())
+	}
+	return messageResponses, iterator.Err()
+}
+
+// NextMessages - read up to count messages of the iterator, no messages are returned at the end
+func NextMessages(ctx context.Context, iterator MessageIterator, count int) (MessageResponses, error) {
+	messageResponses := make(MessageResponses, 0, count)
+	for len(messageResponses) < count && iterator.Next(ctx) {
+		messageResponses = append(messageResponses, iterator.Message())
+	}
+	if len(messageResponses) < count {
+		return messageResponses, iterator.Err()
+	}
+	return messageResponses, nil
+}
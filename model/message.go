@@ -2,18 +2,24 @@ package model
 
 import (
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shauera/messages/validation"
 )
 
 // MessageRequest is a word, sentence or phrase written by an author
 // on a specific date and timeproduct in the store.
 // It is used to describe the animals available in the store.
+// The constraints below are the defaults, the active rules are configured
+// in the validation section of the configuration file.
 //
 // swagger:model
 type MessageRequest struct {
 	// The contet of the message.
 	//
 	// required: true
-	// pattern: \w[\w-]+
+	// pattern: \S
 	// minimum length: 1
 	// maximum length: 256
 	// example: To be, or not to be: that is the question
@@ -26,30 +32,39 @@ type MessageRequest struct {
 	Author *string `json:"author,omitempty" bson:"author,omitempty"`
 
 	// The date and time when the message was created.
+	// Accepts RFC 3339, RFC 1123 (numeric, GMT or UTC zone) and date only (2006-01-02) strings
+	// as well as Unix epoch seconds or milliseconds numbers.
 	//
 	// required: false
 	// example: 1599-01-03T07:30:30.457Z
 	CreatedAt *MessageTime `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+
+	// Who can see the message - public (default), unlisted (only by id) or private (only the owner).
+	//
+	// required: false
+	// enum: public,unlisted,private
+	// example: public
+	Visibility *string `json:"visibility,omitempty" bson:"visibility,omitempty"`
 }
 
-// Validate - make sure that:
-// - Content: is a string 1 - 256 characters long
-func (mr MessageRequest) Validate() ValidationErrorsResponse {
-	var validationErrorsResponse ValidationErrorsResponse
-
-	if mr.Content == nil {
-		validationErrorsResponse.Messages = append(validationErrorsResponse.Messages,
-			fmt.Sprintf("Content must be between 1 and 256 characters long. Got NULL instead"))
-	} else {
-		contentLength := len(*mr.Content)
-
-		if contentLength < 1 || contentLength > 256 {
-			validationErrorsResponse.Messages = append(validationErrorsResponse.Messages,
-				fmt.Sprintf("Content must be between 1 and 256 characters long. Got %d instead", contentLength))
-		}
+// Validate - make sure that the request satisfies the given rules
+// (see validation.MessageRules for what can be constrained)
+func (mr MessageRequest) Validate(rules validation.MessageRules) []validation.FieldError {
+	var fieldErrors []validation.FieldError
+
+	fieldErrors = append(fieldErrors, rules.Content.Validate("content", mr.Content)...)
+	fieldErrors = append(fieldErrors, rules.Author.Validate("author", mr.Author)...)
+	fieldErrors = append(fieldErrors, rules.CreatedAt.Validate("createdAt", (*time.Time)(mr.CreatedAt), time.Now())...)
+	if mr.Visibility != nil && !containsString(Visibilities, *mr.Visibility) {
+		fieldErrors = append(fieldErrors, validation.FieldError{
+			Field:   "visibility",
+			Code:    validation.CodeUnknownValue,
+			Params:  map[string]interface{}{"allowed": Visibilities},
+			Message: fmt.Sprintf("Visibility must be one of %s", strings.Join(Visibilities, ", ")),
+		})
 	}
 
-	return validationErrorsResponse
+	return fieldErrors
 }
 
 // MessageResponse is a word, sentence or phrase written by an author
@@ -70,9 +85,65 @@ type MessageResponse struct {
 	// The date and time when the message was created.
 	CreatedAt *MessageTime `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
 
+	// The offset in seconds east of UTC of the time zone CreatedAt was given in.
+	// BSON DateTime is always UTC so the offset is persisted separately.
+	CreatedAtOffset *int `json:"-" bson:"createdAtOffset,omitempty"`
+
 	// Indicates if the message content is a palindrome.
 	// This is a calculated field that can't be explicitly set.
 	Palindrome bool `json:"palindrome" bson:"palindrome"`
+
+	// The user that created the message - can't be explicitly set.
+	CreatedBy *string `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+
+	// The user that owns the message and can change it - can't be explicitly set.
+	Owner *string `json:"owner,omitempty" bson:"owner,omitempty"`
+
+	// Who can see the message - public, unlisted (only by id) or private (only the owner).
+	Visibility string `json:"visibility,omitempty" bson:"visibility,omitempty"`
+
+	// The tenant the message belongs to when tenants share a collection.
+	Tenant string `json:"-" bson:"tenant,omitempty"`
+
+	// Incremented on every change, used by repositories to detect concurrent updates.
+	Revision int64 `json:"-" bson:"revision"`
+}
+
+// Request - returns the client settable fields of the message
+func (mr MessageResponse) Request() MessageRequest {
+	request := MessageRequest{
+		Content:   mr.Content,
+		Author:    mr.Author,
+		CreatedAt: mr.CreatedAt,
+	}
+	if mr.Visibility != "" {
+		visibility := mr.Visibility
+		request.Visibility = &visibility
+	}
+	return request
+}
+
+// MessageMutation - computes the new state of a message from its current state.
+// Repositories apply mutations atomically, an error aborts the change.
+type MessageMutation func(current MessageRequest) (MessageRequest, error)
+
+// formattedMessageResponse - MessageResponse rendering CreatedAt in a specific TimeFormat
+type formattedMessageResponse struct {
+	MessageResponse
+	CreatedAt interface{} `json:"createdAt,omitempty"`
+}
+
+// WithTimeFormat - returns a view of the message that renders CreatedAt in the given format
+func (mr MessageResponse) WithTimeFormat(timeFormat TimeFormat) interface{} {
+	if timeFormat == TimeFormatRFC3339 || timeFormat == "" {
+		return mr
+	}
+
+	formatted := formattedMessageResponse{MessageResponse: mr}
+	if mr.CreatedAt != nil {
+		formatted.CreatedAt = mr.CreatedAt.Format(timeFormat)
+	}
+	return formatted
 }
 
 // MessageResponses - a collection of MessageResponse objects
@@ -80,4 +151,17 @@ type MessageResponse struct {
 // swagger:model
 type MessageResponses []MessageResponse
 
+// WithTimeFormat - returns a view of the messages that renders CreatedAt in the given format
+func (mrs MessageResponses) WithTimeFormat(timeFormat TimeFormat) interface{} {
+	if timeFormat == TimeFormatRFC3339 || timeFormat == "" || mrs == nil {
+		return mrs
+	}
+
+	formatted := make([]interface{}, 0, len(mrs))
+	for _, messageResponse := range mrs {
+		formatted = append(formatted, messageResponse.WithTimeFormat(timeFormat))
+	}
+	return formatted
+}
+
 // TODO - add validation code
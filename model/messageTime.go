@@ -1,8 +1,13 @@
 package model
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mongodb/mongo-go-driver/bson/bsontype"
@@ -14,8 +19,67 @@ import (
 // swagger:model
 type MessageTime time.Time
 
+// TimeFormat - the representation used when rendering a MessageTime in a response
+type TimeFormat string
+
+const (
+	//TimeFormatRFC3339 - render as an RFC 3339 string keeping the original time zone offset (default)
+	TimeFormatRFC3339 = TimeFormat("rfc3339")
+	//TimeFormatUnix - render as a number of seconds since the Unix epoch
+	TimeFormatUnix = TimeFormat("unix")
+	//TimeFormatUnixMs - render as a number of milliseconds since the Unix epoch
+	TimeFormatUnixMs = TimeFormat("unixms")
+)
+
+// ParseTimeFormat - returns the TimeFormat matching the given name.
+// An empty name stands for the default format (RFC 3339).
+func ParseTimeFormat(name string) (TimeFormat, error) {
+	switch timeFormat := TimeFormat(strings.ToLower(strings.TrimSpace(name))); timeFormat {
+	case "":
+		return TimeFormatRFC3339, nil
+	case TimeFormatRFC3339, TimeFormatUnix, TimeFormatUnixMs:
+		return timeFormat, nil
+	}
+
+	return "", fmt.Errorf("unsupported time format %q, expected one of: %s, %s, %s",
+		name, TimeFormatRFC3339, TimeFormatUnix, TimeFormatUnixMs)
+}
+
+// Accepted string layouts for incoming times, tried in order
+var messageTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02",
+}
+
+// Zone names accepted in RFC 1123 times. time.Parse does not know the offset of other
+// abbreviations (EST, CET...) unless they are the local zone and would take them as UTC.
+var rfc1123Zones = map[string]bool{"GMT": true, "UTC": true}
+
+// Epoch values with an absolute value at or above this threshold are taken as milliseconds.
+// 1e11 seconds is in the year 5138, while 1e11 milliseconds is in early 1973.
+const epochMillisecondsThreshold = 1e11
+
+// The epoch seconds of the times that can be rendered as RFC 3339, the years 0000 - 9999
+var (
+	minEpochSeconds = time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	maxEpochSeconds = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC).Unix()
+)
+
 // UnmarshalJSON - used to accomodate passing null as "zero" time in JSON
+// Besides null the following inputs are accepted:
+// - RFC 3339 strings (the original time zone offset is kept)
+// - RFC 1123 strings with either a numeric zone or GMT/UTC
+// - date only strings (2006-01-02) taken as midnight UTC
+// - numbers as Unix epoch seconds or milliseconds (see epochMillisecondsThreshold)
 func (mt *MessageTime) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*mt = MessageTime(time.Time{}) // zero time
+		return nil
+	}
+
 	// first try unmarshaling as string and see if we got null
 	var messageTimeString string
 	if err := json.Unmarshal(b, &messageTimeString); err == nil {
@@ -23,14 +87,70 @@ func (mt *MessageTime) UnmarshalJSON(b []byte) error {
 			*mt = MessageTime(time.Time{}) // zero time
 			return nil
 		}
+		return mt.parseString(messageTimeString)
 	}
 
-	// we did not get null as time so try unmarshaling as time
-	var tryTime time.Time
-	if err := json.Unmarshal(b, &tryTime); err != nil {
-		return err
+	// we did not get a string so try unmarshaling as epoch time
+	var epoch json.Number
+	if err := json.Unmarshal(b, &epoch); err != nil {
+		return fmt.Errorf("parsing time %s: expected a string or a number", string(b))
 	}
-	*mt = MessageTime(tryTime)
+	return mt.parseEpoch(epoch)
+}
+
+func (mt *MessageTime) parseString(value string) error {
+	var firstErr error
+	for _, layout := range messageTimeLayouts {
+		parsedTime, err := time.Parse(layout, value)
+		if err == nil && layout == time.RFC1123 {
+			if zone, _ := parsedTime.Zone(); !rfc1123Zones[zone] {
+				return fmt.Errorf("parsing time %q: unsupported time zone %q, use a numeric offset or GMT", value, zone)
+			}
+		}
+		if err == nil {
+			*mt = MessageTime(parsedTime)
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// formats without typed values (XML) send epoch times as strings
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return mt.parseEpoch(json.Number(value))
+	}
+
+	// report the error of the preferred (RFC 3339) layout
+	return firstErr
+}
+
+func (mt *MessageTime) parseEpoch(epoch json.Number) error {
+	if value, err := epoch.Int64(); err == nil {
+		seconds, nanoseconds := value, int64(0)
+		if value >= epochMillisecondsThreshold || value <= -epochMillisecondsThreshold {
+			seconds, nanoseconds = value/1000, (value%1000)*int64(time.Millisecond)
+		}
+		if seconds < minEpochSeconds || seconds > maxEpochSeconds {
+			return fmt.Errorf("parsing time %s: out of range, the year must be 0000 - 9999", epoch)
+		}
+		*mt = MessageTime(time.Unix(seconds, nanoseconds).UTC())
+		return nil
+	}
+
+	value, err := epoch.Float64()
+	if err != nil {
+		return fmt.Errorf("parsing time %s: %v", epoch, err)
+	}
+	if math.Abs(value) >= epochMillisecondsThreshold {
+		value /= 1000
+	}
+	whole, fraction := math.Modf(value)
+	// checked before the conversion, out of range floats do not convert to int64
+	if whole < float64(minEpochSeconds) || whole > float64(maxEpochSeconds) {
+		return fmt.Errorf("parsing time %s: out of range, the year must be 0000 - 9999", epoch)
+	}
+	*mt = MessageTime(time.Unix(int64(whole), int64(fraction*float64(time.Second))).UTC())
 	return nil
 }
 
@@ -40,6 +160,36 @@ func (mt MessageTime) MarshalJSON() ([]byte, error) {
 	return tmpTime.MarshalJSON()
 }
 
+// Format - returns the time in the given representation,
+// a string for RFC 3339 and an integer for the epoch based formats
+func (mt MessageTime) Format(timeFormat TimeFormat) interface{} {
+	tmpTime := time.Time(mt)
+	switch timeFormat {
+	case TimeFormatUnix:
+		return tmpTime.Unix()
+	case TimeFormatUnixMs:
+		return tmpTime.UnixNano() / int64(time.Millisecond)
+	}
+
+	return mt
+}
+
+// ZoneOffset - returns the offset in seconds east of UTC of the time zone the time was given in
+func (mt MessageTime) ZoneOffset() int {
+	_, offset := time.Time(mt).Zone()
+	return offset
+}
+
+// InZoneOffset - returns the same instant expressed in a fixed time zone
+// which is offset seconds east of UTC
+func (mt MessageTime) InZoneOffset(offset int) MessageTime {
+	if offset == 0 {
+		return MessageTime(time.Time(mt).UTC())
+	}
+
+	return MessageTime(time.Time(mt).In(time.FixedZone("", offset)))
+}
+
 // UnmarshalBSONValue - unmarshal BSON to time.Time
 func (mt *MessageTime) UnmarshalBSONValue(t bsontype.Type, raw []byte) error {
 	if t == bsontype.DateTime {
@@ -53,6 +203,7 @@ func (mt *MessageTime) UnmarshalBSONValue(t bsontype.Type, raw []byte) error {
 }
 
 //MarshalBSONValue - marshals to BSON as time.Time
+//Note that BSON DateTime is always UTC, the time zone offset is kept separately (see ZoneOffset)
 func (mt *MessageTime) MarshalBSONValue() (bsontype.Type, []byte, error) {
 	tmpTime := time.Time{}
 	if mt != nil {
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMessageTimeUnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		input          string
+		expected       time.Time
+		expectedOffset int
+		expectError    bool
+	}{
+		{`null`, time.Time{}, 0, false},
+		{`"null"`, time.Time{}, 0, false},
+		{`"2019-05-20T12:23:36.138Z"`, time.Date(2019, time.May, 20, 12, 23, 36, 138000000, time.UTC), 0, false},
+		{`"2019-05-20T14:23:36+02:00"`, time.Date(2019, time.May, 20, 12, 23, 36, 0, time.UTC), 7200, false},
+		{`"Mon, 20 May 2019 12:23:36 GMT"`, time.Date(2019, time.May, 20, 12, 23, 36, 0, time.UTC), 0, false},
+		{`"Mon, 20 May 2019 12:23:36 UTC"`, time.Date(2019, time.May, 20, 12, 23, 36, 0, time.UTC), 0, false},
+		{`"Mon, 20 May 2019 07:23:36 EST"`, time.Time{}, 0, true},
+		{`"Mon, 20 May 2019 07:23:36 -0500"`, time.Date(2019, time.May, 20, 12, 23, 36, 0, time.UTC), -18000, false},
+		{`"2019-05-20"`, time.Date(2019, time.May, 20, 0, 0, 0, 0, time.UTC), 0, false},
+		{`1558355016`, time.Date(2019, time.May, 20, 12, 23, 36, 0, time.UTC), 0, false},
+		{`1558355016138`, time.Date(2019, time.May, 20, 12, 23, 36, 138000000, time.UTC), 0, false},
+		{`1558355016.5`, time.Date(2019, time.May, 20, 12, 23, 36, 500000000, time.UTC), 0, false},
+		{`-1558355016138`, time.Date(1920, time.August, 14, 11, 36, 23, 862000000, time.UTC), 0, false},
+		{`253402300799999`, time.Date(9999, time.December, 31, 23, 59, 59, 999000000, time.UTC), 0, false},
+		{`9300000000000000`, time.Time{}, 0, true},
+		{`-9300000000000000`, time.Time{}, 0, true},
+		{`99999999999999999999`, time.Time{}, 0, true},
+		{`1e300`, time.Time{}, 0, true},
+		{`"This is wrong!"`, time.Time{}, 0, true},
+		{`true`, time.Time{}, 0, true},
+	}
+
+	for _, testCase := range testCases {
+		var messageTime MessageTime
+		err := json.Unmarshal([]byte(testCase.input), &messageTime)
+		if testCase.expectError {
+			if err == nil {
+				t.Errorf("For %s expected an error but got %v", testCase.input, time.Time(messageTime))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("For %s expected no error but got %s", testCase.input, err)
+			continue
+		}
+		if !time.Time(messageTime).Equal(testCase.expected) {
+			t.Errorf("For %s expected %v but got %v", testCase.input, testCase.expected, time.Time(messageTime))
+		}
+		if messageTime.ZoneOffset() != testCase.expectedOffset {
+			t.Errorf("For %s expected offset %d but got %d", testCase.input, testCase.expectedOffset, messageTime.ZoneOffset())
+		}
+	}
+}
+
+func TestMessageTimeFormat(t *testing.T) {
+	messageTime := MessageTime(time.Date(2019, time.May, 20, 14, 23, 36, 138000000, time.FixedZone("", 7200)))
+
+	testCases := []struct {
+		timeFormat TimeFormat
+		expected   string
+	}{
+		{TimeFormatRFC3339, `"2019-05-20T14:23:36.138+02:00"`},
+		{TimeFormatUnix, `1558355016`},
+		{TimeFormatUnixMs, `1558355016138`},
+	}
+
+	for _, testCase := range testCases {
+		if formatted := marshal(messageTime.Format(testCase.timeFormat)); formatted != testCase.expected {
+			t.Errorf("For %s expected %s but got %s", testCase.timeFormat, testCase.expected, formatted)
+		}
+	}
+}
+
+func TestMessageTimeInZoneOffset(t *testing.T) {
+	utcTime := MessageTime(time.Date(2019, time.May, 20, 12, 23, 36, 0, time.UTC))
+
+	restored := utcTime.InZoneOffset(-18000)
+	if marshal(restored) != `"2019-05-20T07:23:36-05:00"` {
+		t.Errorf("expected time in -05:00 but got %s", marshal(restored))
+	}
+	if !time.Time(restored).Equal(time.Time(utcTime)) {
+		t.Errorf("expected the same instant but got %v", time.Time(restored))
+	}
+}
+
+func TestParseTimeFormat(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expected    TimeFormat
+		expectError bool
+	}{
+		{"", TimeFormatRFC3339, false},
+		{"rfc3339", TimeFormatRFC3339, false},
+		{"UNIX", TimeFormatUnix, false},
+		{"unixms", TimeFormatUnixMs, false},
+		{"iso", "", true},
+	}
+
+	for _, testCase := range testCases {
+		timeFormat, err := ParseTimeFormat(testCase.name)
+		if (err != nil) != testCase.expectError || timeFormat != testCase.expected {
+			t.Errorf("For %q expected %q (error: %t) but got %q (%v)", testCase.name, testCase.expected, testCase.expectError, timeFormat, err)
+		}
+	}
+}
@@ -2,8 +2,12 @@ package model
 
 import (
 	"encoding/json"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/shauera/messages/validation"
 )
 
 func getNewString(str string) *string {
@@ -82,14 +86,94 @@ func TestMessageValidation(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		errs := testCase.messageRequest.Validate()
-		if len(errs.Messages) != testCase.expectedLength {
+		errs := testCase.messageRequest.Validate(validation.DefaultMessageRules())
+		if len(errs) != testCase.expectedLength {
 			t.Errorf("For %s expected errors length of %d but got %d with %s",
 				marshal(testCase.messageRequest),
 				testCase.expectedLength,
-				len(errs.Messages),
+				len(errs),
 				marshal(errs),
 			)
 		}
 	}
 }
+
+func TestMessageValidationWithRules(t *testing.T) {
+	rules := validation.MessageRules{
+		Content: validation.StringRule{
+			Required:  true,
+			MinLength: 1,
+			MaxLength: 100,
+			Pattern:   regexp.MustCompile(`\S`),
+		},
+		Author: validation.StringRule{
+			MaxLength: 20,
+			Charsets:  []string{"letter", "space", "punctuation"},
+		},
+		CreatedAt: validation.TimeRule{
+			NotInFuture: true,
+			ClockSkew:   time.Minute,
+		},
+	}
+
+	testCases := []struct {
+		messageRequest MessageRequest
+		expectedCodes  []string
+	}{
+		{
+			MessageRequest{
+				// 100 Hebrew characters are 200 bytes long
+				Content: getNewString(strings.Repeat("ש", 100)),
+			},
+			nil,
+		},
+		{
+			MessageRequest{
+				Content: getNewString(strings.Repeat("ש", 101)),
+			},
+			[]string{validation.CodeTooLong},
+		},
+		{
+			MessageRequest{
+				Content: getNewString("   "),
+			},
+			[]string{validation.CodePatternMismatch},
+		},
+		{
+			MessageRequest{
+				Author: getNewString("R2-D2 <droid>"),
+			},
+			[]string{validation.CodeRequired, validation.CodeInvalidCharacters},
+		},
+		{
+			MessageRequest{
+				Content:   getNewString("Not yet written"),
+				Author:    getNewString("ויליאם שייקספיר"),
+				CreatedAt: getNewMessageTime(time.Now().Add(time.Hour)),
+			},
+			[]string{validation.CodeInFuture},
+		},
+		{
+			MessageRequest{
+				Content:   getNewString("Just written"),
+				CreatedAt: getNewMessageTime(time.Now().Add(30 * time.Second)),
+			},
+			nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		errs := testCase.messageRequest.Validate(rules)
+		var codes []string
+		for _, fieldError := range errs {
+			codes = append(codes, fieldError.Code)
+		}
+		if strings.Join(codes, ",") != strings.Join(testCase.expectedCodes, ",") {
+			t.Errorf("For %s expected error codes %v but got %v",
+				marshal(testCase.messageRequest),
+				testCase.expectedCodes,
+				codes,
+			)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Message fields that can be selected in responses
+const (
+	FieldID         = "id"
+	FieldContent    = "content"
+	FieldAuthor     = "author"
+	FieldCreatedAt  = "createdAt"
+	FieldPalindrome = "palindrome"
+	FieldCreatedBy  = "createdBy"
+	FieldOwner      = "owner"
+	FieldVisibility = "visibility"
+)
+
+// MessageFields - all the fields of a message response in rendering order
+var MessageFields = []string{FieldID, FieldContent, FieldAuthor, FieldCreatedAt, FieldPalindrome, FieldCreatedBy, FieldOwner, FieldVisibility}
+
+// Projection - the message fields selected for a response, a nil projection selects all of them
+type Projection []string
+
+// ParseProjection - returns the projection selecting the comma separated fields
+// without the comma separated excluded fields. Empty fields select all the fields.
+func ParseProjection(fields string, exclude string) (Projection, error) {
+	included, err := parseFieldList(fields)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := parseFieldList(exclude)
+	if err != nil {
+		return nil, err
+	}
+	if included == nil && excluded == nil {
+		return nil, nil
+	}
+
+	projection := Projection{}
+	for _, field := range MessageFields {
+		if (included == nil || included[field]) && !excluded[field] {
+			projection = append(projection, field)
+		}
+	}
+	return projection, nil
+}
+
+func parseFieldList(list string) (map[string]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	fields := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		field, ok := lookupField(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q, expected any of: %s", name, strings.Join(MessageFields, ", "))
+		}
+		fields[field] = true
+	}
+	return fields, nil
+}
+
+// lookupField - field names are matched regardless of case
+func lookupField(name string) (string, bool) {
+	for _, field := range MessageFields {
+		if strings.EqualFold(field, name) {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// Includes - reports if the field is selected by the projection
+func (p Projection) Includes(field string) bool {
+	if p == nil {
+		return true
+	}
+	for _, selected := range p {
+		if selected == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Message expansions - related resources that can be embedded in message responses
+const (
+	// ExpandAuthor - the author name is replaced by an Author object
+	ExpandAuthor = "author"
+	// ExpandAnalysis - an analysis of the message content is added
+	ExpandAnalysis = "analysis"
+)
+
+// MessageExpansions - all the supported expansions
+var MessageExpansions = []string{ExpandAuthor, ExpandAnalysis}
+
+// Expansions - the related resources to embed in a response
+type Expansions map[string]bool
+
+// ParseExpansions - returns the comma separated expansions
+func ParseExpansions(expand string) (Expansions, error) {
+	if strings.TrimSpace(expand) == "" {
+		return nil, nil
+	}
+
+	expansions := make(Expansions)
+	for _, name := range strings.Split(expand, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, expansion := range MessageExpansions {
+			if strings.EqualFold(expansion, name) {
+				expansions[expansion] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown expansion %q, expected any of: %s", name, strings.Join(MessageExpansions, ", "))
+		}
+	}
+	return expansions, nil
+}
+
+// Requires - the projection extended with the fields the expansions are resolved from
+func (e Expansions) Requires(fields Projection) Projection {
+	if fields == nil {
+		return nil
+	}
+
+	required := append(Projection{}, fields...)
+	if e[ExpandAuthor] && !required.Includes(FieldAuthor) {
+		required = append(required, FieldAuthor)
+	}
+	if e[ExpandAnalysis] && !required.Includes(FieldContent) {
+		required = append(required, FieldContent)
+	}
+	return required
+}
+
+// Author - the author of messages, embedded in message responses when expanded
+//
+// swagger:model
+type Author struct {
+	// The name of the author.
+	//
+	// example: William Shakespeare
+	Name string `json:"name" bson:"_id"`
+
+	// The number of messages written by the author.
+	//
+	// example: 154
+	MessageCount int64 `json:"messageCount" bson:"messageCount"`
+
+	// The creation time of the first message of the author.
+	FirstMessageAt *MessageTime `json:"firstMessageAt,omitempty" bson:"firstMessageAt,omitempty"`
+
+	// The creation time of the latest message of the author.
+	LastMessageAt *MessageTime `json:"lastMessageAt,omitempty" bson:"lastMessageAt,omitempty"`
+}
+
+// View - how message responses are shaped for the client
+type View struct {
+	// TimeFormat - the representation of times
+	TimeFormat TimeFormat
+	// Fields - the selected fields
+	Fields Projection
+	// Authors - the expanded authors by name, nil when authors are not expanded
+	Authors map[string]Author
+	// Analyze - returns the analysis of a message content, nil when the analysis is not expanded
+	Analyze func(content string) interface{}
+}
+
+// shapedMessageResponse - MessageResponse limited to the fields selected by a View
+type shapedMessageResponse struct {
+	ID         interface{} `json:"id,omitempty"`
+	Content    *string     `json:"content,omitempty"`
+	Author     interface{} `json:"author,omitempty"`
+	CreatedAt  interface{} `json:"createdAt,omitempty"`
+	Palindrome *bool       `json:"palindrome,omitempty"`
+	CreatedBy  *string     `json:"createdBy,omitempty"`
+	Owner      *string     `json:"owner,omitempty"`
+	Visibility string      `json:"visibility,omitempty"`
+	Analysis   interface{} `json:"analysis,omitempty"`
+}
+
+// Shape - returns a view of the message rendering the fields and the expansions of the given view
+func (mr MessageResponse) Shape(view View) interface{} {
+	if view.Fields == nil && view.Authors == nil && view.Analyze == nil {
+		return mr.WithTimeFormat(view.TimeFormat)
+	}
+
+	shaped := shapedMessageResponse{}
+	if view.Fields.Includes(FieldID) {
+		shaped.ID = mr.ID
+	}
+	if view.Fields.Includes(FieldContent) {
+		shaped.Content = mr.Content
+	}
+	// an expanded author is rendered even if the author field is not selected
+	if (view.Fields.Includes(FieldAuthor) || view.Authors != nil) && mr.Author != nil {
+		shaped.Author = *mr.Author
+		if author, ok := view.Authors[*mr.Author]; ok {
+			shaped.Author = author
+		}
+	}
+	if view.Fields.Includes(FieldCreatedAt) && mr.CreatedAt != nil {
+		shaped.CreatedAt = mr.CreatedAt.Format(view.TimeFormat)
+	}
+	if view.Fields.Includes(FieldPalindrome) {
+		palindrome := mr.Palindrome
+		shaped.Palindrome = &palindrome
+	}
+	if view.Fields.Includes(FieldCreatedBy) {
+		shaped.CreatedBy = mr.CreatedBy
+	}
+	if view.Fields.Includes(FieldOwner) {
+		shaped.Owner = mr.Owner
+	}
+	if view.Fields.Includes(FieldVisibility) {
+		shaped.Visibility = mr.Visibility
+	}
+	if view.Analyze != nil && mr.Content != nil {
+		shaped.Analysis = view.Analyze(*mr.Content)
+	}
+	return shaped
+}
+
+// Shape - returns a view of the messages rendering the fields and the expansions of the given view
+func (mrs MessageResponses) Shape(view View) interface{} {
+	if view.Fields == nil && view.Authors == nil && view.Analyze == nil {
+		return mrs.WithTimeFormat(view.TimeFormat)
+	}
+	if mrs == nil {
+		return mrs
+	}
+
+	shaped := make([]interface{}, 0, len(mrs))
+	for _, messageResponse := range mrs {
+		shaped = append(shaped, messageResponse.Shape(view))
+	}
+	return shaped
+}
+
+// AuthorNames - the distinct authors of the messages
+func (mrs MessageResponses) AuthorNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, messageResponse := range mrs {
+		if messageResponse.Author != nil && !seen[*messageResponse.Author] {
+			seen[*messageResponse.Author] = true
+			names = append(names, *messageResponse.Author)
+		}
+	}
+	return names
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProjection(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fields   string
+		exclude  string
+		expected Projection
+		err      string
+	}{
+		{name: "all fields", expected: nil},
+		{name: "selected fields in rendering order", fields: "content, ID", expected: Projection{"id", "content"}},
+		{name: "excluded fields", exclude: "palindrome,createdAt,createdBy,owner,visibility", expected: Projection{"id", "content", "author"}},
+		{name: "selected and excluded", fields: "id,content", exclude: "content", expected: Projection{"id"}},
+		{name: "nothing left", fields: "id", exclude: "id", expected: Projection{}},
+		{name: "unknown field", fields: "id,revision", err: `unknown field "revision", expected any of: id, content, author, createdAt, palindrome, createdBy, owner, visibility`},
+		{name: "unknown excluded field", exclude: "x", err: `unknown field "x", expected any of: id, content, author, createdAt, palindrome, createdBy, owner, visibility`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			projection, err := ParseProjection(testCase.fields, testCase.exclude)
+			if testCase.err != "" {
+				assert.EqualError(t, err, testCase.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, projection)
+		})
+	}
+}
+
+func TestParseExpansions(t *testing.T) {
+	expansions, err := ParseExpansions("Author,analysis")
+	assert.NoError(t, err)
+	assert.Equal(t, Expansions{"author": true, "analysis": true}, expansions)
+
+	expansions, err = ParseExpansions("")
+	assert.NoError(t, err)
+	assert.Nil(t, expansions)
+
+	_, err = ParseExpansions("author,comments")
+	assert.EqualError(t, err, `unknown expansion "comments", expected any of: author, analysis`)
+}
+
+func TestShape(t *testing.T) {
+	content := "abba"
+	author := "Author 1"
+	createdAt := MessageTime(time.Date(2019, time.May, 20, 12, 23, 36, 0, time.UTC))
+	message := MessageResponse{ID: "1", Content: &content, Author: &author, CreatedAt: &createdAt, Palindrome: true}
+
+	testCases := []struct {
+		name     string
+		view     View
+		expected string
+	}{
+		{
+			name:     "full message",
+			view:     View{},
+			expected: `{"id":"1","content":"abba","author":"Author 1","createdAt":"2019-05-20T12:23:36Z","palindrome":true}`,
+		},
+		{
+			name:     "selected fields",
+			view:     View{Fields: Projection{FieldID, FieldCreatedAt}, TimeFormat: TimeFormatUnix},
+			expected: `{"id":"1","createdAt":1558355016}`,
+		},
+		{
+			name:     "palindrome only",
+			view:     View{Fields: Projection{FieldPalindrome}},
+			expected: `{"palindrome":true}`,
+		},
+		{
+			name:     "expanded author",
+			view:     View{Fields: Projection{FieldAuthor}, Authors: map[string]Author{"Author 1": {Name: "Author 1", MessageCount: 2}}},
+			expected: `{"author":{"name":"Author 1","messageCount":2}}`,
+		},
+		{
+			name: "analysis",
+			view: View{Fields: Projection{FieldContent}, Analyze: func(content string) interface{} {
+				return len(content)
+			}},
+			expected: `{"content":"abba","analysis":4}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			data, err := json.Marshal(message.Shape(testCase.view))
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, string(data))
+		})
+	}
+}
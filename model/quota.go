@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+)
+
+// QuotaUsage - the uses counted against a quota of a principal in a period
+type QuotaUsage struct {
+	// ID - the principal and the period of the quota
+	ID string `bson:"_id"`
+	// Count - the uses counted in the period
+	Count int `bson:"count"`
+	// ExpiresAt - the time the usage can be forgotten, after the period ends
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/shauera/messages/validation"
+)
+
+// TenantRequest provisions a tenant.
+//
+// swagger:model
+type TenantRequest struct {
+	// The id of the tenant, sent by clients in the tenant header or as the subdomain.
+	// Ids are DNS labels so they can be used as subdomains and database names. When each tenant
+	// has a database of its own the id is shorter, the database name must fit in 63 characters.
+	//
+	// required: true
+	// minimum length: 1
+	// maximum length: 63
+	// pattern: ^[a-z0-9]([a-z0-9-]*[a-z0-9])?$
+	// example: team-a
+	ID *string `json:"id,omitempty"`
+
+	// A display name of the tenant.
+	//
+	// required: false
+	// maximum length: 128
+	// example: Team A
+	Name *string `json:"name,omitempty"`
+
+	// The configuration of the tenant.
+	//
+	// required: false
+	Settings TenantSettings `json:"settings"`
+}
+
+// TenantSettings is the configuration of a tenant, anything not set falls back to the service configuration.
+//
+// swagger:model
+type TenantSettings struct {
+	// Length limits of message contents.
+	Content *validation.LengthLimits `json:"content,omitempty" bson:"content,omitempty"`
+
+	// Length limits of message authors.
+	Author *validation.LengthLimits `json:"author,omitempty" bson:"author,omitempty"`
+
+	// The analyzers available to expand=analysis, all the analyzers when missing.
+	//
+	// example: ["palindrome", "wordCount"]
+	Analyzers []string `json:"analyzers,omitempty" bson:"analyzers,omitempty"`
+}
+
+// tenant request rules
+var (
+	tenantIDRule   = validation.StringRule{Required: true, MinLength: 1, MaxLength: 63, Pattern: regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)}
+	tenantNameRule = validation.StringRule{MaxLength: 128}
+)
+
+// Validate - make sure the request has a valid id of at most maxIDLength characters (not limited
+// further when 0) and valid settings
+func (tr TenantRequest) Validate(knownAnalyzers []string, maxIDLength int) []validation.FieldError {
+	idRule := tenantIDRule
+	if maxIDLength > 0 && maxIDLength < idRule.MaxLength {
+		idRule.MaxLength = maxIDLength
+	}
+	fieldErrors := idRule.Validate("id", tr.ID)
+	fieldErrors = append(fieldErrors, tenantNameRule.Validate("name", tr.Name)...)
+	return append(fieldErrors, tr.Settings.Validate("settings.", knownAnalyzers)...)
+}
+
+// Validate - make sure the limits are valid and only the given known analyzers are selected,
+// field paths are prefixed by the prefix
+func (ts TenantSettings) Validate(prefix string, knownAnalyzers []string) []validation.FieldError {
+	var fieldErrors []validation.FieldError
+	if ts.Content != nil {
+		fieldErrors = append(fieldErrors, ts.Content.Validate(prefix+"content")...)
+	}
+	if ts.Author != nil {
+		fieldErrors = append(fieldErrors, ts.Author.Validate(prefix+"author")...)
+	}
+	for index, analyzer := range ts.Analyzers {
+		if !containsString(knownAnalyzers, analyzer) {
+			fieldErrors = append(fieldErrors, validation.FieldError{
+				Field:   fmt.Sprintf("%sanalyzers[%d]", prefix, index),
+				Code:    validation.CodeUnknownValue,
+				Params:  map[string]interface{}{"allowed": knownAnalyzers},
+				Message: fmt.Sprintf("Unknown analyzer %q", analyzer),
+			})
+		}
+	}
+	return fieldErrors
+}
+
+// MessageRules - the message rules of the tenant based on the service rules
+func (ts TenantSettings) MessageRules(rules validation.MessageRules) validation.MessageRules {
+	rules.Content = rules.Content.WithLimits(ts.Content)
+	rules.Author = rules.Author.WithLimits(ts.Author)
+	return rules
+}
+
+// Tenant is a team served by the service, the messages of each tenant are isolated from the other tenants.
+//
+// swagger:model
+type Tenant struct {
+	// The id of the tenant.
+	//
+	// example: team-a
+	ID string `json:"id" bson:"_id"`
+
+	// A display name of the tenant.
+	//
+	// example: Team A
+	Name string `json:"name,omitempty" bson:"name,omitempty"`
+
+	// The configuration of the tenant.
+	Settings TenantSettings `json:"settings" bson:"settings"`
+
+	// The time the tenant was provisioned at.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Tenants - a list of tenants
+type Tenants []Tenant
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shauera/messages/validation"
+)
+
+// UserRequest registers a user account.
+// The constraints below are the defaults, the active rules are configured
+// in the validation section of the configuration file.
+//
+// swagger:model
+type UserRequest struct {
+	// The name the user logs in with, names are not case sensitive.
+	//
+	// required: true
+	// minimum length: 3
+	// maximum length: 32
+	// pattern: ^[a-zA-Z0-9][a-zA-Z0-9_.-]*$
+	// example: will
+	Username *string `json:"username,omitempty"`
+
+	// The password of the user, at most 72 bytes long.
+	//
+	// required: true
+	// minimum length: 8
+	// maximum length: 72
+	Password *string `json:"password,omitempty"`
+}
+
+// Validate - make sure that the request satisfies the given rules
+func (ur UserRequest) Validate(rules validation.UserRules) []validation.FieldError {
+	fieldErrors := rules.Username.Validate("username", ur.Username)
+	return append(fieldErrors, rules.Password.Validate("password", ur.Password)...)
+}
+
+// User is a registered user account, only a hash of the password is stored.
+//
+// swagger:model
+type User struct {
+	// The name of the user in lower case, the subject of the tokens of the user. Names are unique within a tenant.
+	//
+	// example: will
+	Username string `json:"username" bson:"username"`
+
+	// The roles granted to the user.
+	//
+	// example: ["editor"]
+	Roles []string `json:"roles" bson:"roles"`
+
+	// The tenant the user registered with and is confined to, missing when the service has no tenants.
+	//
+	// example: team-a
+	Tenant string `json:"tenant,omitempty" bson:"tenant"`
+
+	// The time the account was created at.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+
+	// The time the user last logged in at.
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty" bson:"lastLoginAt,omitempty"`
+
+	// The time the account is locked until after repeated failed logins.
+	LockedUntil *time.Time `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"`
+
+	// The hash of the password.
+	PasswordHash string `json:"-" bson:"passwordHash"`
+
+	// The time the password was last changed at.
+	PasswordChangedAt time.Time `json:"-" bson:"passwordChangedAt"`
+
+	// The number of failed logins since the last successful one or the last lockout.
+	FailedLogins int `json:"-" bson:"failedLogins"`
+
+	// The hash of the outstanding password reset token, empty when there is none.
+	ResetTokenHash string `json:"-" bson:"resetTokenHash,omitempty"`
+
+	// The time the outstanding password reset token expires at.
+	ResetTokenExpiresAt *time.Time `json:"-" bson:"resetTokenExpiresAt,omitempty"`
+
+	// Incremented on every change, used by repositories to detect concurrent updates.
+	Revision int64 `json:"-" bson:"revision"`
+}
+
+// UserMutation - computes the new state of a user from its current state.
+// Repositories apply mutations atomically, an error aborts the change.
+type UserMutation func(current User) (User, error)
+
+// LoginRequest - the credentials of a user
+//
+// swagger:model
+type LoginRequest struct {
+	// required: true
+	// example: will
+	Username string `json:"username"`
+
+	// required: true
+	Password string `json:"password"`
+}
+
+// TokenResponse - a token issued to a user
+//
+// swagger:model
+type TokenResponse struct {
+	// The token to send in the Authorization header as "Bearer <token>".
+	Token string `json:"token"`
+
+	// The authorization scheme of the token.
+	//
+	// example: Bearer
+	TokenType string `json:"tokenType"`
+
+	// The time the token expires at.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// PasswordChangeRequest - changes the password of the logged in user
+//
+// swagger:model
+type PasswordChangeRequest struct {
+	// required: true
+	CurrentPassword string `json:"currentPassword"`
+
+	// required: true
+	NewPassword *string `json:"newPassword,omitempty"`
+}
+
+// PasswordResetRequest - sets a new password with a password reset token
+//
+// swagger:model
+type PasswordResetRequest struct {
+	// The password reset token issued by an administrator.
+	//
+	// required: true
+	Token string `json:"token"`
+
+	// required: true
+	NewPassword *string `json:"newPassword,omitempty"`
+}
+
+// PasswordResetToken - a single use token for resetting the password of a user
+//
+// swagger:model
+type PasswordResetToken struct {
+	// The token to hand to the user.
+	Token string `json:"token"`
+
+	// The time the token expires at.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
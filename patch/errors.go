@@ -0,0 +1,21 @@
+package patch
+
+//Error - a patch error type
+type Error string
+
+//Error - implemenation of Error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+//ErrorUnsupportedContentType - the patch media type is not supported
+const ErrorUnsupportedContentType = Error("Unsupported patch content type")
+
+//ErrorMalformedPatch - the patch document is not valid
+const ErrorMalformedPatch = Error("Malformed patch document")
+
+//ErrorPathNotFound - an operation refers to a location that does not exist in the document
+const ErrorPathNotFound = Error("Path not found")
+
+//ErrorTestFailed - a test operation did not match the document
+const ErrorTestFailed = Error("Test operation failed")
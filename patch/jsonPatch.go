@@ -0,0 +1,326 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// operation - a single JSON Patch operation
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	path  []string
+	from  []string
+	value interface{}
+}
+
+// JSONPatch - a JSON Patch (RFC 6902), a list of operations applied in order.
+// The patch is applied as a whole, if any operation fails the document is left unchanged.
+type JSONPatch struct {
+	operations []operation
+}
+
+// ParseJSONPatch - parse a JSON Patch document
+func ParseJSONPatch(body []byte) (*JSONPatch, error) {
+	var operations []operation
+	if err := json.Unmarshal(body, &operations); err != nil {
+		return nil, errors.Wrap(ErrorMalformedPatch, err.Error())
+	}
+
+	for index := range operations {
+		op := &operations[index]
+		var err error
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, errors.Wrapf(ErrorMalformedPatch, "operation %d (%s) is missing a value", index, op.Op)
+			}
+			if op.value, err = decode(op.Value); err != nil {
+				return nil, errors.Wrapf(ErrorMalformedPatch, "operation %d (%s) value: %s", index, op.Op, err)
+			}
+		case "move", "copy":
+			if op.from, err = parsePointer(op.From); err != nil {
+				return nil, errors.Wrapf(ErrorMalformedPatch, "operation %d (%s) from: %s", index, op.Op, err)
+			}
+		case "remove":
+		default:
+			return nil, errors.Wrapf(ErrorMalformedPatch, "operation %d has an unknown op %q", index, op.Op)
+		}
+
+		if op.path, err = parsePointer(op.Path); err != nil {
+			return nil, errors.Wrapf(ErrorMalformedPatch, "operation %d (%s) path: %s", index, op.Op, err)
+		}
+	}
+
+	return &JSONPatch{operations: operations}, nil
+}
+
+// Apply - returns the document with all the patch operations applied
+func (jp *JSONPatch) Apply(document []byte) ([]byte, error) {
+	target, err := decode(document)
+	if err != nil {
+		return nil, err
+	}
+
+	for index, op := range jp.operations {
+		if target, err = op.apply(target); err != nil {
+			return nil, errors.Wrapf(err, "operation %d (%s %s)", index, op.Op, op.Path)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op operation) apply(target interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		return add(target, op.path, op.value)
+	case "remove":
+		target, _, err := remove(target, op.path)
+		return target, err
+	case "replace":
+		target, _, err := remove(target, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(target, op.path, op.value)
+	case "move":
+		if isPrefix(op.from, op.path) && len(op.from) < len(op.path) {
+			return nil, errors.Wrap(ErrorMalformedPatch, "a value can't be moved into one of its children")
+		}
+		target, value, err := remove(target, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(target, op.path, value)
+	case "copy":
+		value, err := get(target, op.from)
+		if err != nil {
+			return nil, err
+		}
+		copied, err := deepCopy(value)
+		if err != nil {
+			return nil, err
+		}
+		return add(target, op.path, copied)
+	case "test":
+		value, err := get(target, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(value, op.value) {
+			return nil, ErrorTestFailed
+		}
+		return target, nil
+	}
+
+	return nil, ErrorMalformedPatch
+}
+
+// parsePointer - split a JSON Pointer (RFC 6901) into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for index, token := range tokens {
+		tokens[index] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, tokens []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for index := range prefix {
+		if prefix[index] != tokens[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex - parse an array index token, "-" stands for the end of the array when allowed
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	if token == "" || len(token) > 1 && token[0] == '0' {
+		return 0, ErrorPathNotFound
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || index == length && !allowEnd {
+		return 0, ErrorPathNotFound
+	}
+	return index, nil
+}
+
+func get(node interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch typedNode := node.(type) {
+		case map[string]interface{}:
+			child, ok := typedNode[token]
+			if !ok {
+				return nil, ErrorPathNotFound
+			}
+			node = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(typedNode), false)
+			if err != nil {
+				return nil, err
+			}
+			node = typedNode[index]
+		default:
+			return nil, ErrorPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// add - returns node with value added at the location of tokens
+func add(node interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token, last := tokens[0], len(tokens) == 1
+
+	switch typedNode := node.(type) {
+	case map[string]interface{}:
+		if last {
+			typedNode[token] = value
+			return typedNode, nil
+		}
+		child, ok := typedNode[token]
+		if !ok {
+			return nil, ErrorPathNotFound
+		}
+		newChild, err := add(child, tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		typedNode[token] = newChild
+		return typedNode, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(typedNode), last)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			typedNode = append(typedNode, nil)
+			copy(typedNode[index+1:], typedNode[index:])
+			typedNode[index] = value
+			return typedNode, nil
+		}
+		newChild, err := add(typedNode[index], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		typedNode[index] = newChild
+		return typedNode, nil
+	}
+
+	return nil, ErrorPathNotFound
+}
+
+// remove - returns node without the value at the location of tokens and the removed value
+func remove(node interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, node, nil
+	}
+	token, last := tokens[0], len(tokens) == 1
+
+	switch typedNode := node.(type) {
+	case map[string]interface{}:
+		child, ok := typedNode[token]
+		if !ok {
+			return nil, nil, ErrorPathNotFound
+		}
+		if last {
+			delete(typedNode, token)
+			return typedNode, child, nil
+		}
+		newChild, removed, err := remove(child, tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		typedNode[token] = newChild
+		return typedNode, removed, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(typedNode), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if last {
+			removed := typedNode[index]
+			return append(typedNode[:index], typedNode[index+1:]...), removed, nil
+		}
+		newChild, removed, err := remove(typedNode[index], tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		typedNode[index] = newChild
+		return typedNode, removed, nil
+	}
+
+	return nil, nil, ErrorPathNotFound
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// equal - JSON equality, numbers are compared by value and objects regardless of member order
+func equal(a, b interface{}) bool {
+	switch typedA := a.(type) {
+	case map[string]interface{}:
+		typedB, ok := b.(map[string]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for name, valueA := range typedA {
+			valueB, ok := typedB[name]
+			if !ok || !equal(valueA, valueB) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		typedB, ok := b.([]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for index := range typedA {
+			if !equal(typedA[index], typedB[index]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		typedB, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		floatA, errA := typedA.Float64()
+		floatB, errB := typedB.Float64()
+		return errA == nil && errB == nil && floatA == floatB
+	}
+
+	return a == b
+}
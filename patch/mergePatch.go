@@ -0,0 +1,56 @@
+package patch
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// MergePatch - a JSON Merge Patch (RFC 7396).
+// Members set to null are removed from the target, objects are merged recursively
+// and any other value replaces the target member.
+type MergePatch struct {
+	patch interface{}
+}
+
+// ParseMergePatch - parse a JSON Merge Patch document
+func ParseMergePatch(body []byte) (*MergePatch, error) {
+	value, err := decode(body)
+	if err != nil {
+		return nil, errors.Wrap(ErrorMalformedPatch, err.Error())
+	}
+
+	return &MergePatch{patch: value}, nil
+}
+
+// Apply - returns the document with the patch applied
+func (mp *MergePatch) Apply(document []byte) ([]byte, error) {
+	target, err := decode(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(target, mp.patch))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+
+	return targetObject
+}
@@ -0,0 +1,44 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+//MergePatchContentType - media type of JSON Merge Patch documents (RFC 7396)
+const MergePatchContentType = "application/merge-patch+json"
+
+//JSONPatchContentType - media type of JSON Patch documents (RFC 6902)
+const JSONPatchContentType = "application/json-patch+json"
+
+// Patch - a parsed patch document that can be applied to JSON documents
+type Patch interface {
+	Apply(document []byte) ([]byte, error)
+}
+
+// Parse - parse a patch document of the given media type
+func Parse(contentType string, body []byte) (Patch, error) {
+	switch contentType {
+	case MergePatchContentType:
+		return ParseMergePatch(body)
+	case JSONPatchContentType:
+		return ParseJSONPatch(body)
+	}
+
+	return nil, ErrorUnsupportedContentType
+}
+
+// decode - unmarshal JSON keeping numbers as json.Number so they survive a round trip unchanged
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, ErrorMalformedPatch
+	}
+	return value, nil
+}
@@ -0,0 +1,93 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	testCases := []struct {
+		document string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, testCase := range testCases {
+		mergePatch, err := ParseMergePatch([]byte(testCase.patch))
+		assert.NoError(t, err, testCase.patch)
+		patched, err := mergePatch.Apply([]byte(testCase.document))
+		assert.NoError(t, err, testCase.patch)
+		assert.JSONEq(t, testCase.expected, string(patched), testCase.patch)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	testCases := []struct {
+		document    string
+		patch       string
+		expected    string
+		expectedErr error
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`, nil},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`, nil},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{`{"foo":"bar"}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"foo":"bar","baz":"bar"}`, nil},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`, `{"a/b":3}`, nil},
+		{`{"foo":null}`, `[{"op":"replace","path":"/foo","value":"bar"}]`, `{"foo":"bar"}`, nil},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, ErrorTestFailed},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, ErrorPathNotFound},
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, ``, ErrorPathNotFound},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/01","value":"qux"}]`, ``, ErrorPathNotFound},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/foo","value":"baz"},{"op":"test","path":"/foo","value":"bar"}]`, ``, ErrorTestFailed},
+	}
+
+	for _, testCase := range testCases {
+		jsonPatch, err := ParseJSONPatch([]byte(testCase.patch))
+		assert.NoError(t, err, testCase.patch)
+		patched, err := jsonPatch.Apply([]byte(testCase.document))
+		if testCase.expectedErr != nil {
+			assert.Equal(t, testCase.expectedErr, errors.Cause(err), testCase.patch)
+			continue
+		}
+		assert.NoError(t, err, testCase.patch)
+		assert.JSONEq(t, testCase.expected, string(patched), testCase.patch)
+	}
+}
+
+func TestParseJSONPatchErrors(t *testing.T) {
+	testCases := []string{
+		`{"op":"add"}`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"jump","path":"/a"}]`,
+		`[{"op":"remove","path":"a"}]`,
+		`[{"op":"move","from":"b","path":"/a"}]`,
+	}
+
+	for _, testCase := range testCases {
+		_, err := ParseJSONPatch([]byte(testCase))
+		assert.Equal(t, ErrorMalformedPatch, errors.Cause(err), testCase)
+	}
+
+	_, err := Parse("application/json", []byte(`{}`))
+	assert.Equal(t, ErrorUnsupportedContentType, err)
+}
@@ -2,26 +2,114 @@ package persistence
 
 import (
 	"time"
+
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/utils"
 )
 
-//updateString - Use in an update opertion to figure out if a string value should be removed
-func updateString(oldValue, newValue *string) *string {
-	if newValue != nil {
-		if *newValue == "" { // update is explicitly removing the field
-			return nil
-		}
-		return newValue // update is explicitly setting the field to a new value
+//buildMessage - the stored representation of a message request created by and owned by the given users (nil if unknown).
+//All client settable fields are taken as is, a missing field is left unset and a missing visibility keeps the given visibility
+//(the stored one of a replaced message, public if none).
+func buildMessage(id interface{}, message model.MessageRequest, createdBy *string, owner *string, visibility string, revision int64) model.MessageResponse {
+	if visibility == "" {
+		visibility = model.VisibilityPublic
+	}
+
+	newMessage := model.MessageResponse{
+		ID:         id,
+		Author:     message.Author,
+		Content:    message.Content,
+		CreatedAt:  nonZeroTime(message.CreatedAt),
+		CreatedBy:  createdBy,
+		Owner:      owner,
+		Visibility: visibility,
+		Revision:   revision,
+	}
+	if message.Visibility != nil {
+		newMessage.Visibility = *message.Visibility
+	}
+	newMessage.CreatedAtOffset = zoneOffset(newMessage.CreatedAt)
+
+	if newMessage.Content != nil {
+		newMessage.Palindrome = utils.IsPalindrome(*newMessage.Content)
+	}
+
+	return newMessage
+}
+
+//optionalString - an empty string is treated as unset
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+//nonZeroTime - a zero time can't be stored, it is treated as unset
+func nonZeroTime(value *model.MessageTime) *model.MessageTime {
+	if value == nil || time.Time(*value).IsZero() {
+		return nil
 	}
-	return oldValue // update did not explicitly set this field
+	return value
 }
 
-//updateTime - Use in an update opertion to figure out if a time value should be removed
-func updateTime(oldValue, newValue *time.Time) *time.Time {
-	if newValue != nil {
-		if time.Time.IsZero(*newValue) { // update is explicitly removing the field
-			return nil
-		}
-		return newValue // update is explicitly setting the field to a new value
+//zoneOffset - the time zone offset to persist alongside a message creation time
+func zoneOffset(createdAt *model.MessageTime) *int {
+	if createdAt == nil {
+		return nil
+	}
+
+	offset := createdAt.ZoneOffset()
+	return &offset
+}
+
+//project - clear the fields of a message that are not selected by the projection
+func project(message model.MessageResponse, fields model.Projection) model.MessageResponse {
+	if fields == nil {
+		return message
+	}
+
+	projected := model.MessageResponse{Revision: message.Revision}
+	if fields.Includes(model.FieldID) {
+		projected.ID = message.ID
+	}
+	if fields.Includes(model.FieldContent) {
+		projected.Content = message.Content
+	}
+	if fields.Includes(model.FieldAuthor) {
+		projected.Author = message.Author
+	}
+	if fields.Includes(model.FieldCreatedAt) {
+		projected.CreatedAt = message.CreatedAt
+		projected.CreatedAtOffset = message.CreatedAtOffset
+	}
+	if fields.Includes(model.FieldPalindrome) {
+		projected.Palindrome = message.Palindrome
+	}
+	if fields.Includes(model.FieldCreatedBy) {
+		projected.CreatedBy = message.CreatedBy
+	}
+	if fields.Includes(model.FieldOwner) {
+		projected.Owner = message.Owner
+	}
+	if fields.Includes(model.FieldVisibility) {
+		projected.Visibility = message.Visibility
+	}
+	return projected
+}
+
+//addToAuthor - account for a message of the author
+func addToAuthor(author model.Author, message model.MessageResponse) model.Author {
+	author.MessageCount++
+	if message.CreatedAt == nil {
+		return author
+	}
+	createdAt := time.Time(*message.CreatedAt)
+	if author.FirstMessageAt == nil || createdAt.Before(time.Time(*author.FirstMessageAt)) {
+		author.FirstMessageAt = message.CreatedAt
+	}
+	if author.LastMessageAt == nil || createdAt.After(time.Time(*author.LastMessageAt)) {
+		author.LastMessageAt = message.CreatedAt
 	}
-	return oldValue // update did not explicitly set this field
+	return author
 }
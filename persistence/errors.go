@@ -10,3 +10,18 @@ func (e Error) Error() string {
 
 //ErrorNotFound - record could not be found in the repository
 const ErrorNotFound = Error("Not found")
+
+//ErrorInvalidID - the given id is not in the format used by the repository
+const ErrorInvalidID = Error("Invalid id")
+
+//ErrorForbidden - the record exists but the operation is not allowed to change it
+const ErrorForbidden = Error("Forbidden")
+
+//ErrorConflict - the operation conflicts with an existing record
+const ErrorConflict = Error("Conflict")
+
+//ErrorUnavailable - the repository could not be reached
+const ErrorUnavailable = Error("Repository unavailable")
+
+//ErrorTimeout - the repository did not complete the operation in time
+const ErrorTimeout = Error("Repository timeout")
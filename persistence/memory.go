@@ -3,103 +3,526 @@ package persistence
 import (
 	"context"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/shauera/messages/model"
-	"github.com/shauera/messages/utils"
 )
 
 //MemoryRepository - in memory repository for use with demo, mocking out real database and tests
 //ALL RECORDS WILL BE DELETED ONCE THE INSTANCE IS RESTARTED!
 type MemoryRepository struct {
-	messageIDCounter int64
-	messagesStorage  map[string]model.MessageResponse
+	messageIDCounter   int64
+	lock               sync.RWMutex
+	messagesStorage    map[string]model.MessageResponse
+	apiKeysStorage     map[string]model.APIKey
+	usersStorage       map[userKey]model.User
+	tenantsStorage     map[string]model.Tenant
+	quotasStorage      map[string]model.QuotaUsage
+	idempotencyStorage map[string]model.IdempotencyRecord
+	// tenantRepositories - the messages of each tenant are kept in a repository of their own
+	tenantRepositories map[string]*MemoryRepository
+}
+
+//userKey - user names are unique within a tenant only
+type userKey struct {
+	tenant   string
+	username string
 }
 
 //NewMemoryRepository - initialize and return a new MemoryRepository
 func NewMemoryRepository() (*MemoryRepository, error) {
 	return &MemoryRepository{
-		messagesStorage: make(map[string]model.MessageResponse),
+		messagesStorage:    make(map[string]model.MessageResponse),
+		apiKeysStorage:     make(map[string]model.APIKey),
+		usersStorage:       make(map[userKey]model.User),
+		tenantsStorage:     make(map[string]model.Tenant),
+		quotasStorage:      make(map[string]model.QuotaUsage),
+		idempotencyStorage: make(map[string]model.IdempotencyRecord),
+		tenantRepositories: make(map[string]*MemoryRepository),
 	}, nil
 }
 
-//CreateMessage - adds a new message record into repository
-func (mr *MemoryRepository) CreateMessage(ctx context.Context, newMessage model.MessageRequest) (*model.MessageResponse, error) {
+//ForTenant - returns the repository of the messages of the tenant, the messages of each tenant are stored separately
+//Only the message methods of the returned repository are scoped to the tenant
+func (mr *MemoryRepository) ForTenant(tenant string) *MemoryRepository {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	tenantRepository, ok := mr.tenantRepositories[tenant]
+	if !ok {
+		tenantRepository, _ = NewMemoryRepository()
+		mr.tenantRepositories[tenant] = tenantRepository
+	}
+	return tenantRepository
+}
+
+//Ping - the memory repository is always available
+func (mr *MemoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+//CreateMessage - adds a new message record into repository, createdBy is the user creating it (empty if unknown)
+func (mr *MemoryRepository) CreateMessage(ctx context.Context, newMessage model.MessageRequest, createdBy string) (*model.MessageResponse, error) {
 	id := strconv.FormatInt(atomic.AddInt64(&mr.messageIDCounter, 1), 10)
 
-	messageResponse := mr.storeMessage(ctx, id, model.MessageResponse{}, newMessage)
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	messageResponse := mr.storeMessage(id, newMessage, optionalString(createdBy), optionalString(createdBy), model.VisibilityPublic, 1)
 	return messageResponse, nil
 }
 
-//UpdateMessageByID - updates an existing message record
-//An error will be returned if the given id does not exist 
-func (mr *MemoryRepository) UpdateMessageByID(ctx context.Context, id string, updateMessage model.MessageRequest) (*model.MessageResponse, error) {
+//ReplaceMessageByID - replaces all the fields of an existing message record
+//An error will be returned if the given id does not exist or can't be changed with the access
+func (mr *MemoryRepository) ReplaceMessageByID(ctx context.Context, id string, message model.MessageRequest, access model.Access) (*model.MessageResponse, error) {
+	return mr.PatchMessageByID(ctx, id, access, func(model.MessageRequest) (model.MessageRequest, error) {
+		return message, nil
+	})
+}
+
+//PatchMessageByID - atomically applies a mutation to an existing message record
+//An error will be returned if the given id does not exist, can't be changed with the access or the mutation fails
+func (mr *MemoryRepository) PatchMessageByID(ctx context.Context, id string, access model.Access, mutation model.MessageMutation) (*model.MessageResponse, error) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
 
-	if oldMessage, ok := mr.messagesStorage[id]; ok {
-		return mr.storeMessage(ctx, id, oldMessage, updateMessage), nil
+	oldMessage, ok := mr.messagesStorage[id]
+	if !ok || !access.CanRead(oldMessage) {
+		return nil, ErrorNotFound
+	}
+	if !access.CanWrite(oldMessage) {
+		return nil, ErrorForbidden
 	}
 
-	return nil, ErrorNotFound
+	newMessage, err := mutation(oldMessage.Request())
+	if err != nil {
+		return nil, err
+	}
+
+	return mr.storeMessage(id, newMessage, oldMessage.CreatedBy, oldMessage.Owner, oldMessage.Visibility, oldMessage.Revision+1), nil
 }
 
-//ListMessages - returns all message records in the repository
-func (mr *MemoryRepository) ListMessages(ctx context.Context) (model.MessageResponses, error) {
+//StreamMessages - returns an iterator over the message records listed with the access with the projected fields only
+//The iterator reads a snapshot of the repository taken when it is created
+func (mr *MemoryRepository) StreamMessages(ctx context.Context, fields model.Projection, access model.Access) (model.MessageIterator, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
 
 	messageResponses := make(model.MessageResponses, 0, len(mr.messagesStorage))
 
 	for _, value := range mr.messagesStorage {
-		messageResponses = append(messageResponses, value)
+		if !access.CanList(value) {
+			continue
+		}
+		messageResponses = append(messageResponses, project(value, fields))
 	}
 
-	if len(messageResponses) == 0 {
-		return nil, nil
+	return &memoryMessageIterator{messages: messageResponses, index: -1}, nil
+}
+
+//memoryMessageIterator - iterates over a snapshot of the memory repository
+type memoryMessageIterator struct {
+	messages model.MessageResponses
+	index    int
+	err      error
+}
+
+//Next - implementation of model.MessageIterator
+func (mi *memoryMessageIterator) Next(ctx context.Context) bool {
+	if mi.err != nil {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		mi.err = err
+		return false
 	}
+	if mi.index+1 >= len(mi.messages) {
+		return false
+	}
+	mi.index++
+	return true
+}
+
+//Message - implementation of model.MessageIterator
+func (mi *memoryMessageIterator) Message() model.MessageResponse {
+	return mi.messages[mi.index]
+}
+
+//Err - implementation of model.MessageIterator
+func (mi *memoryMessageIterator) Err() error {
+	return mi.err
+}
 
-	return messageResponses, nil
+//Close - implementation of model.MessageIterator
+func (mi *memoryMessageIterator) Close(ctx context.Context) error {
+	mi.messages = nil
+	return nil
 }
 
-//FindMessageByID - returns an existing message record
-//An error will be returned if the given id does not exist  
-func (mr *MemoryRepository) FindMessageByID(ctx context.Context, id string) (*model.MessageResponse, error) {
-	if messageResponse, ok := mr.messagesStorage[id]; ok {
+//FindMessageByID - returns an existing message record with the projected fields only
+//An error will be returned if the given id does not exist or can't be read with the access
+func (mr *MemoryRepository) FindMessageByID(ctx context.Context, id string, fields model.Projection, access model.Access) (*model.MessageResponse, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	if messageResponse, ok := mr.messagesStorage[id]; ok && access.CanRead(messageResponse) {
+		messageResponse = project(messageResponse, fields)
 		return &messageResponse, nil
 	}
 
 	return nil, ErrorNotFound
 }
 
-//DeleteMessageByID - removes an existing message record from the repository
-//An error will be returned if the given id does not exist 
-func (mr *MemoryRepository) DeleteMessageByID(ctx context.Context, id string) error {
-	if _, ok := mr.messagesStorage[id]; ok {
-		delete(mr.messagesStorage, id)
-		return nil
+//FindAuthors - returns the authors of the given names that wrote any message listed with the access, by name
+func (mr *MemoryRepository) FindAuthors(ctx context.Context, names []string, access model.Access) (map[string]model.Author, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	authors := make(map[string]model.Author, len(names))
+	for _, name := range names {
+		authors[name] = model.Author{}
 	}
 
-	return ErrorNotFound
-}
+	for _, message := range mr.messagesStorage {
+		if message.Author == nil || !access.CanList(message) {
+			continue
+		}
+		if author, ok := authors[*message.Author]; ok {
+			author.Name = *message.Author
+			authors[*message.Author] = addToAuthor(author, message)
+		}
+	}
 
-func (mr *MemoryRepository) storeMessage(ctx context.Context, id string, oldMessage model.MessageResponse, updateMessage model.MessageRequest) *model.MessageResponse {
-	newMessageResponse := model.MessageResponse{
-		ID:        id,
-		Author:    updateString(oldMessage.Author, updateMessage.Author),
-		Content:   updateString(oldMessage.Content, updateMessage.Content),
-		CreatedAt: (*model.MessageTime)(updateTime((*time.Time)(oldMessage.CreatedAt), (*time.Time)(updateMessage.CreatedAt))),
+	for name, author := range authors {
+		if author.MessageCount == 0 {
+			delete(authors, name)
+		}
 	}
 
-	if oldMessage.Content == nil ||
-		updateMessage.Content != nil && *newMessageResponse.Content != *oldMessage.Content {
-		// message content got a new value, calculating new palindrome state
-		newMessageResponse.Palindrome = utils.IsPalindrome(*newMessageResponse.Content)
+	return authors, nil
+}
+
+//DeleteMessageByID - removes an existing message record from the repository
+//An error will be returned if the given id does not exist or can't be changed with the access
+func (mr *MemoryRepository) DeleteMessageByID(ctx context.Context, id string, access model.Access) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	message, ok := mr.messagesStorage[id]
+	if !ok || !access.CanRead(message) {
+		return ErrorNotFound
+	}
+	if !access.CanWrite(message) {
+		return ErrorForbidden
 	}
 
+	delete(mr.messagesStorage, id)
+	return nil
+}
+
+//storeMessage - must be called while holding the write lock
+func (mr *MemoryRepository) storeMessage(id string, message model.MessageRequest, createdBy *string, owner *string, visibility string, revision int64) *model.MessageResponse {
+	newMessageResponse := buildMessage(id, message, createdBy, owner, visibility, revision)
 	mr.messagesStorage[id] = newMessageResponse
 
 	return &newMessageResponse
 }
 
+//CreateAPIKey - adds a new API key record into repository
+//An error will be returned if a key of the same id exists
+func (mr *MemoryRepository) CreateAPIKey(ctx context.Context, key model.APIKey) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	if _, ok := mr.apiKeysStorage[key.ID]; ok {
+		return ErrorConflict
+	}
+	key.Key = ""
+	mr.apiKeysStorage[key.ID] = key
+	return nil
+}
+
+//FindAPIKeyByID - returns an existing API key record
+//An error will be returned if the given id does not exist
+func (mr *MemoryRepository) FindAPIKeyByID(ctx context.Context, id string) (*model.APIKey, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	if key, ok := mr.apiKeysStorage[id]; ok {
+		return &key, nil
+	}
+
+	return nil, ErrorNotFound
+}
+
+//ListAPIKeys - returns all API key records in the repository, revoked keys included
+func (mr *MemoryRepository) ListAPIKeys(ctx context.Context) (model.APIKeys, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	keys := make(model.APIKeys, 0, len(mr.apiKeysStorage))
+	for _, key := range mr.apiKeysStorage {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+//RevokeAPIKeyByID - marks an existing API key record as revoked, revoking a revoked key keeps its revocation time
+//An error will be returned if the given id does not exist
+func (mr *MemoryRepository) RevokeAPIKeyByID(ctx context.Context, id string, revokedAt time.Time) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	key, ok := mr.apiKeysStorage[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+		mr.apiKeysStorage[id] = key
+	}
+	return nil
+}
+
+//TouchAPIKeyByID - records the last time an existing API key was used
+//An error will be returned if the given id does not exist
+func (mr *MemoryRepository) TouchAPIKeyByID(ctx context.Context, id string, usedAt time.Time) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	key, ok := mr.apiKeysStorage[id]
+	if !ok {
+		return ErrorNotFound
+	}
+	key.LastUsedAt = &usedAt
+	mr.apiKeysStorage[id] = key
+	return nil
+}
+
+//CreateUser - adds a new user record into repository
+//An error will be returned if a user of the same name exists in the tenant of the user
+func (mr *MemoryRepository) CreateUser(ctx context.Context, user model.User) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	key := userKey{tenant: user.Tenant, username: user.Username}
+	if _, ok := mr.usersStorage[key]; ok {
+		return ErrorConflict
+	}
+	user.Revision = 1
+	mr.usersStorage[key] = user
+	return nil
+}
+
+//FindUserByName - returns an existing user record of the tenant (empty when the service has no tenants)
+//An error will be returned if the given user does not exist
+func (mr *MemoryRepository) FindUserByName(ctx context.Context, tenant string, username string) (*model.User, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	if user, ok := mr.usersStorage[userKey{tenant: tenant, username: username}]; ok {
+		return &user, nil
+	}
+
+	return nil, ErrorNotFound
+}
+
+//UpdateUserByName - atomically applies a mutation to an existing user record of the tenant
+//An error will be returned if the given user does not exist or the mutation fails
+func (mr *MemoryRepository) UpdateUserByName(ctx context.Context, tenant string, username string, mutation model.UserMutation) (*model.User, error) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	key := userKey{tenant: tenant, username: username}
+	oldUser, ok := mr.usersStorage[key]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+
+	newUser, err := mutation(oldUser)
+	if err != nil {
+		return nil, err
+	}
+	newUser.Username = oldUser.Username
+	newUser.Tenant = oldUser.Tenant
+	newUser.Revision = oldUser.Revision + 1
+	mr.usersStorage[key] = newUser
+
+	return &newUser, nil
+}
+
+//MaxTenantIDLength - the memory repository does not limit tenant ids
+func (mr *MemoryRepository) MaxTenantIDLength() int {
+	return 0
+}
+
+//CreateTenant - adds a new tenant record into repository
+//An error will be returned if a tenant of the same id exists
+func (mr *MemoryRepository) CreateTenant(ctx context.Context, tenant model.Tenant) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	if _, ok := mr.tenantsStorage[tenant.ID]; ok {
+		return ErrorConflict
+	}
+	mr.tenantsStorage[tenant.ID] = tenant
+	return nil
+}
+
+//FindTenantByID - returns an existing tenant record
+//An error will be returned if the given id does not exist
+func (mr *MemoryRepository) FindTenantByID(ctx context.Context, id string) (*model.Tenant, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	if tenant, ok := mr.tenantsStorage[id]; ok {
+		return &tenant, nil
+	}
+
+	return nil, ErrorNotFound
+}
+
+//ListTenants - returns all tenant records in the repository
+func (mr *MemoryRepository) ListTenants(ctx context.Context) (model.Tenants, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	tenants := make(model.Tenants, 0, len(mr.tenantsStorage))
+	for _, tenant := range mr.tenantsStorage {
+		tenants = append(tenants, tenant)
+	}
+
+	return tenants, nil
+}
+
+//UpdateTenantSettings - replaces the settings of an existing tenant record
+//An error will be returned if the given id does not exist
+func (mr *MemoryRepository) UpdateTenantSettings(ctx context.Context, id string, settings model.TenantSettings) (*model.Tenant, error) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	tenant, ok := mr.tenantsStorage[id]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	tenant.Settings = settings
+	mr.tenantsStorage[id] = tenant
+	return &tenant, nil
+}
+
+//DeleteTenantByID - removes an existing tenant record with all the messages, users and API keys of the tenant
+//from the repository, so the credentials of a deleted tenant can't reach a tenant created again with its id
+//An error will be returned if the given id does not exist
+func (mr *MemoryRepository) DeleteTenantByID(ctx context.Context, id string) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	if _, ok := mr.tenantsStorage[id]; !ok {
+		return ErrorNotFound
+	}
+	for key, user := range mr.usersStorage {
+		if user.Tenant == id {
+			delete(mr.usersStorage, key)
+		}
+	}
+	for keyID, key := range mr.apiKeysStorage {
+		if key.Tenant == id {
+			delete(mr.apiKeysStorage, keyID)
+		}
+	}
+	delete(mr.tenantsStorage, id)
+	delete(mr.tenantRepositories, id)
+	return nil
+}
+
+//IncrementQuota - atomically counts a use of the quota of the given id and returns the count
+//An error will be returned without counting if the count reached the limit
+//Expired usage is kept until the instance is restarted
+func (mr *MemoryRepository) IncrementQuota(ctx context.Context, id string, limit int, expiresAt time.Time) (int, error) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	usage, ok := mr.quotasStorage[id]
+	if !ok {
+		usage = model.QuotaUsage{ID: id, ExpiresAt: expiresAt}
+	}
+	if usage.Count >= limit {
+		return usage.Count, ErrorConflict
+	}
+	usage.Count++
+	mr.quotasStorage[id] = usage
+	return usage.Count, nil
+}
+
+//DecrementQuota - atomically takes back a use of the quota of the given id
+//Unknown quotas and quotas of a count of 0 are not changed
+func (mr *MemoryRepository) DecrementQuota(ctx context.Context, id string) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	if usage, ok := mr.quotasStorage[id]; ok && usage.Count > 0 {
+		usage.Count--
+		mr.quotasStorage[id] = usage
+	}
+	return nil
+}
+
+//CreateIdempotencyRecord - adds a new idempotency record into repository
+//An error will be returned if a record of the same id exists
+func (mr *MemoryRepository) CreateIdempotencyRecord(ctx context.Context, record model.IdempotencyRecord) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	if _, ok := mr.idempotencyStorage[record.ID]; ok {
+		return ErrorConflict
+	}
+	mr.idempotencyStorage[record.ID] = record
+	return nil
+}
+
+//FindIdempotencyRecord - returns an existing idempotency record
+//An error will be returned if the given id does not exist
+func (mr *MemoryRepository) FindIdempotencyRecord(ctx context.Context, id string) (*model.IdempotencyRecord, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	if record, ok := mr.idempotencyStorage[id]; ok {
+		return &record, nil
+	}
+
+	return nil, ErrorNotFound
+}
+
+//CompleteIdempotencyRecord - replaces an existing uncompleted idempotency record
+//An error will be returned if no uncompleted record of the id exists
+func (mr *MemoryRepository) CompleteIdempotencyRecord(ctx context.Context, record model.IdempotencyRecord) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	if existing, ok := mr.idempotencyStorage[record.ID]; !ok || existing.Completed {
+		return ErrorNotFound
+	}
+	mr.idempotencyStorage[record.ID] = record
+	return nil
+}
+
+//DeleteIdempotencyRecord - removes an existing idempotency record if it still expires at the given time
+//An error will be returned if no such record exists
+func (mr *MemoryRepository) DeleteIdempotencyRecord(ctx context.Context, id string, expiresAt time.Time) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	if existing, ok := mr.idempotencyStorage[id]; !ok || !existing.ExpiresAt.Equal(expiresAt) {
+		return ErrorNotFound
+	}
+	delete(mr.idempotencyStorage, id)
+	return nil
+}
+
 //GetMessagesStorage - allows direct manipualtion of the storage to facilitate testing
 func (mr *MemoryRepository) GetMessagesStorage() map[string]model.MessageResponse {
 	return mr.messagesStorage
-}
\ No newline at end of file
+}
@@ -0,0 +1,68 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shauera/messages/model"
+)
+
+func TestMemoryRepositoryReplaceMessage(t *testing.T) {
+	ctx := context.Background()
+	repository, _ := NewMemoryRepository()
+	owner := model.Access{Subject: "alice"}
+
+	content, private, unlisted := "Hello", model.VisibilityPrivate, model.VisibilityUnlisted
+	created, err := repository.CreateMessage(ctx, model.MessageRequest{Content: &content, Visibility: &private}, "alice")
+	assert.NoError(t, err)
+	id := created.ID.(string)
+
+	t.Run("Success path - a replacement without a visibility keeps the stored one", func(t *testing.T) {
+		replacement := "Goodbye"
+		replaced, err := repository.ReplaceMessageByID(ctx, id, model.MessageRequest{Content: &replacement}, owner)
+		assert.NoError(t, err)
+		assert.Equal(t, model.VisibilityPrivate, replaced.Visibility)
+		assert.Equal(t, replacement, *replaced.Content)
+
+		_, err = repository.FindMessageByID(ctx, id, nil, model.Access{Subject: "bob"})
+		assert.Equal(t, ErrorNotFound, err, "the replaced message is still private")
+	})
+
+	t.Run("Success path - a replacement with a visibility changes it", func(t *testing.T) {
+		replaced, err := repository.ReplaceMessageByID(ctx, id, model.MessageRequest{Content: &content, Visibility: &unlisted}, owner)
+		assert.NoError(t, err)
+		assert.Equal(t, model.VisibilityUnlisted, replaced.Visibility)
+	})
+
+	t.Run("Success path - a new message without a visibility is public", func(t *testing.T) {
+		created, err := repository.CreateMessage(ctx, model.MessageRequest{Content: &content}, "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, model.VisibilityPublic, created.Visibility)
+	})
+}
+
+func TestMemoryRepositoryDeleteTenant(t *testing.T) {
+	ctx := context.Background()
+	repository, _ := NewMemoryRepository()
+
+	for _, tenant := range []string{"team-a", "team-b"} {
+		assert.NoError(t, repository.CreateTenant(ctx, model.Tenant{ID: tenant}))
+		assert.NoError(t, repository.CreateUser(ctx, model.User{Username: "ada", Tenant: tenant}))
+		assert.NoError(t, repository.CreateAPIKey(ctx, model.APIKey{ID: "key-" + tenant, Tenant: tenant}))
+	}
+	assert.Equal(t, ErrorConflict, repository.CreateUser(ctx, model.User{Username: "ada", Tenant: "team-a"}), "user names are unique within a tenant")
+
+	assert.NoError(t, repository.DeleteTenantByID(ctx, "team-a"))
+
+	_, err := repository.FindUserByName(ctx, "team-a", "ada")
+	assert.Equal(t, ErrorNotFound, err)
+	_, err = repository.FindAPIKeyByID(ctx, "key-team-a")
+	assert.Equal(t, ErrorNotFound, err)
+
+	_, err = repository.FindUserByName(ctx, "team-b", "ada")
+	assert.NoError(t, err, "the users of other tenants are kept")
+	_, err = repository.FindAPIKeyByID(ctx, "key-team-b")
+	assert.NoError(t, err, "the API keys of other tenants are kept")
+}
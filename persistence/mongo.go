@@ -2,16 +2,20 @@ package persistence
 
 import (
 	"context"
+	"net"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/shauera/messages/model"
-	"github.com/shauera/messages/utils"
 
 	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
 	"github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"github.com/mongodb/mongo-go-driver/x/network/command"
+	"github.com/mongodb/mongo-go-driver/x/network/connection"
 
 	log "github.com/sirupsen/logrus"
 	config "github.com/spf13/viper"
@@ -19,63 +23,252 @@ import (
 
 //MongoRepository - mongo collection (database) for persisting message documents
 type MongoRepository struct {
-	client       *mongo.Client
+	connection   *mongoConnection
 	databaseName string
+	// isolation - how the messages of tenants are kept apart, see ForTenant
+	isolation string
+	// tenant - the tenant the messages are scoped to when tenants share the messages collection
+	tenant string
+	// timeouts - the timeouts of each type of operation
+	timeouts MongoTimeouts
 }
 
-//NewMongoRepository - initialize and return a new MongoRepository
-func NewMongoRepository(ctx context.Context) (*MongoRepository, error) {
-	mongoConnectionString := `mongodb://` + config.GetString("database.server")
-	username := config.GetString("database.username")
-	password := config.GetString("database.password")
+// Tenant isolation modes of the mongo repository
+const (
+	// TenantIsolationField - the messages of all tenants share a collection and are told apart by a tenant field
+	TenantIsolationField = "field"
+	// TenantIsolationDatabase - the messages of each tenant are kept in a database of their own
+	TenantIsolationDatabase = "database"
+)
+
+//mongoConnection - the client shared by a repository and the repositories of its tenants,
+//it is replaced when the database credentials are reloaded
+type mongoConnection struct {
+	lock   sync.RWMutex
+	client *mongo.Client
+	// config - the configuration the client connected with
+	config MongoConfig
+}
+
+//clientDrainPeriod - how long the operations of a replaced client have to end before it is disconnected
+const clientDrainPeriod = time.Minute
+
+//NewMongoRepository - initialize and return a new MongoRepository connected as configured
+func NewMongoRepository(ctx context.Context, mongoConfig MongoConfig) (*MongoRepository, error) {
+	isolation := config.GetString("tenancy.isolation")
+	switch isolation {
+	case "":
+		isolation = TenantIsolationField
+	case TenantIsolationField, TenantIsolationDatabase:
+	default:
+		return nil, errors.Errorf("Unknown tenant isolation %q", isolation)
+	}
+	if isolation == TenantIsolationDatabase && len(tenantDatabaseName(mongoConfig.DatabaseName, "a")) > maxDatabaseNameLength {
+		return nil, errors.Errorf("The database name %q leaves no room for tenant databases, use a name shorter than %d characters",
+			mongoConfig.DatabaseName, maxDatabaseNameLength-1)
+	}
+
+	client, err := connectClient(ctx, mongoConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	repositoryContext, cancel := getRepositoryContext(ctx)
+	repository := &MongoRepository{
+		connection:   &mongoConnection{client: client, config: mongoConfig},
+		databaseName: mongoConfig.DatabaseName,
+		isolation:    isolation,
+		timeouts:     mongoConfig.Timeouts,
+	}
+	indexContext, cancel := context.WithTimeout(ctx, mongoConfig.Timeouts.Index)
 	defer cancel()
+	if config.GetBool("tenancy.enabled") && isolation == TenantIsolationField {
+		// queries of shared collections are always scoped to a tenant
+		if err := createMessageIndexes(indexContext, repository.messages(), bson.E{Key: "tenant", Value: 1}); err != nil {
+			client.Disconnect(context.Background())
+			return nil, err
+		}
+	}
+
+	// user names are unique within a tenant only
+	userIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := repository.users().Indexes().CreateOne(indexContext, userIndex); err != nil {
+		client.Disconnect(context.Background())
+		return nil, translateMongoError(err)
+	}
+
+	// quota usage and idempotency records are removed once they expired
+	for _, collectionName := range []string{"quotas", "idempotency"} {
+		expiryIndex := mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		}
+		if _, err := repository.client().Database(repository.databaseName).Collection(collectionName).Indexes().CreateOne(indexContext, expiryIndex); err != nil {
+			client.Disconnect(context.Background())
+			return nil, translateMongoError(err)
+		}
+	}
+
+	return repository, nil
+}
 
-	clientOptions := options.Client().SetAuth(options.Credential{Username: username, Password: password})
-	client, err := mongo.Connect(repositoryContext, mongoConnectionString, clientOptions)
+//connectClient - returns a client connected as configured that answered a ping
+func connectClient(ctx context.Context, mongoConfig MongoConfig) (*mongo.Client, error) {
+	connectContext, cancel := context.WithTimeout(ctx, mongoConfig.Timeouts.Connect)
+	defer cancel()
+
+	clientOptions := mongoConfig.clientOptions().SetMonitor(newCommandMonitor())
+	client, err := mongo.Connect(connectContext, mongoConfig.URI, clientOptions)
 	if err != nil {
 		log.WithError(err).Debug("Could not connect to database")
 		return nil, errors.Wrap(err, "Could not connect to database")
 	}
-	err = client.Ping(repositoryContext, nil)
+	err = client.Ping(connectContext, nil)
 	if err != nil {
-		log.WithError(err).WithField("server", mongoConnectionString).Debug("Could not ping database")
+		log.WithError(err).WithField("server", redactURI(mongoConfig.URI)).Debug("Could not ping database")
+		// connecting may be retried, the client of a failed attempt is not used again
+		client.Disconnect(context.Background())
 		return nil, errors.Wrap(err, "Could not ping database")
 	}
+	return client, nil
+}
 
-	go func() {
-		<-ctx.Done()
-		log.Debug("Closing mongodb connection")
-		if client.Disconnect(ctx) != nil {
-			log.Debug("Failed to close mongodb connection")
-		}
-		log.Debug("Mongodb connection closed")
-	}()
+//client - the current client of the repository
+func (mr *MongoRepository) client() *mongo.Client {
+	mr.connection.lock.RLock()
+	defer mr.connection.lock.RUnlock()
+	return mr.connection.client
+}
+
+//ReloadCredentials - prepares a client connected with the username and password of mongoConfig when they differ
+//from the ones of the current client, so rotated database credentials are used without a restart. The other
+//settings of the current client are kept. The returned function switches the repository to the new client,
+//the previous client is disconnected once its running operations had clientDrainPeriod to end.
+func (mr *MongoRepository) ReloadCredentials(ctx context.Context, mongoConfig MongoConfig) (func(), error) {
+	mr.connection.lock.RLock()
+	clientConfig := mr.connection.config
+	mr.connection.lock.RUnlock()
+
+	if mongoConfig.Username == clientConfig.Username && mongoConfig.Password == clientConfig.Password {
+		return func() {}, nil
+	}
+	clientConfig.Username, clientConfig.Password = mongoConfig.Username, mongoConfig.Password
+	client, err := connectClient(ctx, clientConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	return &MongoRepository{
-		client:       client,
-		databaseName: config.GetString("database.dbname"),
+	return func() {
+		mr.connection.lock.Lock()
+		previous := mr.connection.client
+		mr.connection.client, mr.connection.config = client, clientConfig
+		mr.connection.lock.Unlock()
+
+		log.Info("Database credentials replaced, the previous connections are closed once their operations ended")
+		time.AfterFunc(clientDrainPeriod, func() {
+			if err := previous.Disconnect(context.Background()); err != nil {
+				log.WithError(err).Warn("Could not close the previous mongodb connection")
+			}
+		})
 	}, nil
 }
 
-//CreateMessage - adds a new message record into repository
-func (mr *MongoRepository) CreateMessage(ctx context.Context, message model.MessageRequest) (*model.MessageResponse, error) {
-	repositoryContext, cancel := getRepositoryContext(ctx)
-	defer cancel()
+//Close - closes the connections of the repository, waiting within ctx for running operations to end
+func (mr *MongoRepository) Close(ctx context.Context) error {
+	log.Debug("Closing mongodb connection")
+	if err := mr.client().Disconnect(ctx); err != nil {
+		return errors.Wrap(err, "Could not close mongodb connection")
+	}
+	log.Debug("Mongodb connection closed")
+	return nil
+}
 
-	createMessage := model.MessageResponse{
-		ID:         primitive.NewObjectID(),
-		Author:     updateString(nil, message.Author),
-		Content:    updateString(nil, message.Content),
-		CreatedAt:  (*model.MessageTime)(updateTime(nil, (*time.Time)(message.CreatedAt))),
-		Palindrome: utils.IsPalindrome(*message.Content),
+//ForTenant - returns the repository of the messages of the tenant, isolated as configured by tenancy.isolation
+//Only the message methods of the returned repository are scoped to the tenant
+func (mr *MongoRepository) ForTenant(tenant string) *MongoRepository {
+	scoped := *mr
+	if mr.isolation == TenantIsolationDatabase {
+		scoped.databaseName = tenantDatabaseName(mr.databaseName, tenant)
+	} else {
+		scoped.tenant = tenant
 	}
+	return &scoped
+}
+
+//tenantDatabaseName - the database of the messages of the tenant when each tenant has a database of its own
+func tenantDatabaseName(databaseName string, tenant string) string {
+	return databaseName + "_" + tenant
+}
+
+//maxDatabaseNameLength - mongodb database names must have fewer than 64 characters
+const maxDatabaseNameLength = 63
+
+//MaxTenantIDLength - the longest tenant id whose database name fits when each tenant has a database of its own,
+//tenant ids are not limited by the repository when 0
+func (mr *MongoRepository) MaxTenantIDLength() int {
+	if mr.isolation != TenantIsolationDatabase {
+		return 0
+	}
+	return maxDatabaseNameLength - len(tenantDatabaseName(mr.databaseName, ""))
+}
 
-	collection := mr.client.Database(mr.databaseName).Collection("messages")
+//messages - the collection of the messages of the repository
+func (mr *MongoRepository) messages() *mongo.Collection {
+	return mr.client().Database(mr.databaseName).Collection("messages")
+}
+
+//scope - restricts the filter to the messages of the tenant of the repository
+func (mr *MongoRepository) scope(filter bson.D) bson.D {
+	if mr.tenant == "" {
+		return filter
+	}
+	return append(bson.D{{Key: "tenant", Value: mr.tenant}}, filter...)
+}
+
+//users - the collection of the user accounts of all the tenants
+func (mr *MongoRepository) users() *mongo.Collection {
+	return mr.client().Database(mr.databaseName).Collection("users")
+}
+
+//userFilter - the user of the tenant (empty when the service has no tenants)
+func userFilter(tenant string, username string) bson.D {
+	return bson.D{{Key: "tenant", Value: tenant}, {Key: "username", Value: username}}
+}
+
+//createMessageIndexes - creates the indexes of the message queries, the keys of every index start with the prefix
+func createMessageIndexes(ctx context.Context, collection *mongo.Collection, prefix ...bson.E) error {
+	indexes := []mongo.IndexModel{
+		{Keys: append(append(bson.D{}, prefix...), bson.E{Key: "author", Value: 1})},
+		{Keys: append(append(bson.D{}, prefix...), bson.E{Key: "visibility", Value: 1}, bson.E{Key: "owner", Value: 1})},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return errors.Wrap(translateMongoError(err), "Could not create message indexes")
+	}
+	return nil
+}
+
+//Ping - checks the database can be reached
+func (mr *MongoRepository) Ping(ctx context.Context) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Ping)
+	defer cancel()
+
+	return translateMongoError(mr.client().Ping(repositoryContext, nil))
+}
+
+//CreateMessage - adds a new message record into repository, createdBy is the user creating it (empty if unknown)
+func (mr *MongoRepository) CreateMessage(ctx context.Context, message model.MessageRequest, createdBy string) (*model.MessageResponse, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	createMessage := buildMessage(primitive.NewObjectID(), message, optionalString(createdBy), optionalString(createdBy), model.VisibilityPublic, 1)
+	createMessage.Tenant = mr.tenant
+
+	collection := mr.messages()
 	result, err := collection.InsertOne(repositoryContext, createMessage)
 	if err != nil {
-		return nil, err
+		return nil, translateMongoError(err)
 	}
 
 	createMessage.ID = result.InsertedID.(primitive.ObjectID).Hex()
@@ -83,148 +276,808 @@ func (mr *MongoRepository) CreateMessage(ctx context.Context, message model.Mess
 	return &createMessage, nil
 }
 
-//UpdateMessageByID - updates an existing message record
-//An error will be returned if the given id does not exist
-func (mr *MongoRepository) UpdateMessageByID(ctx context.Context, id string, updateMessage model.MessageRequest) (*model.MessageResponse, error) {
-	repositoryContext, cancel := getRepositoryContext(ctx)
+//ReplaceMessageByID - replaces all the fields of an existing message record
+//An error will be returned if the given id does not exist or can't be changed with the access
+func (mr *MongoRepository) ReplaceMessageByID(ctx context.Context, id string, message model.MessageRequest, access model.Access) (*model.MessageResponse, error) {
+	return mr.PatchMessageByID(ctx, id, access, func(model.MessageRequest) (model.MessageRequest, error) {
+		return message, nil
+	})
+}
+
+// maxPatchAttempts - how many times a patch is retried when the record keeps changing concurrently
+const maxPatchAttempts = 5
+
+//PatchMessageByID - atomically applies a mutation to an existing message record
+//The record is replaced only if it was not changed since it was read (optimistic concurrency),
+//otherwise the mutation is applied again to the fresh record.
+//An error will be returned if the given id does not exist, can't be changed with the access or the mutation fails
+func (mr *MongoRepository) PatchMessageByID(ctx context.Context, id string, access model.Access, mutation model.MessageMutation) (*model.MessageResponse, error) {
+	messageID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrorInvalidID
+	}
+
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
 	defer cancel()
 
-	oldMessage, err := mr.FindMessageByID(repositoryContext, id)
+	collection := mr.messages()
+
+	for attempt := 0; attempt < maxPatchAttempts; attempt++ {
+		var oldMessage model.MessageResponse
+		err = collection.FindOne(repositoryContext, mr.scope(messageFilter(messageID, readFilter(access)))).Decode(&oldMessage)
+		if err != nil {
+			return nil, translateMongoError(err)
+		}
+		if !access.CanWrite(oldMessage) {
+			return nil, ErrorForbidden
+		}
+		restoreZoneOffset(&oldMessage)
+
+		newMessage, err := mutation(oldMessage.Request())
+		if err != nil {
+			return nil, err
+		}
+
+		replacement := buildMessage(messageID, newMessage, oldMessage.CreatedBy, oldMessage.Owner, oldMessage.Visibility, oldMessage.Revision+1)
+		replacement.Tenant = oldMessage.Tenant
+		filter := bson.D{{Key: "_id", Value: messageID}, revisionFilter(oldMessage.Revision)}
+		replaceOptions := options.FindOneAndReplace().SetReturnDocument(options.After)
+
+		var replacedMessage model.MessageResponse
+		err = collection.FindOneAndReplace(repositoryContext, filter, replacement, replaceOptions).Decode(&replacedMessage)
+		if err == mongo.ErrNoDocuments {
+			// deleted or changed since read, try again
+			log.WithField("id", id).WithField("attempt", attempt).Debug("Message changed concurrently")
+			continue
+		}
+		if err != nil {
+			return nil, translateMongoError(err)
+		}
+
+		restoreZoneOffset(&replacedMessage)
+		return &replacedMessage, nil
+	}
+
+	return nil, errors.Wrapf(ErrorConflict, "message %s kept changing concurrently", id)
+}
+
+//revisionFilter - matches the given revision, records created before revisions were introduced have none
+func revisionFilter(revision int64) bson.E {
+	if revision == 0 {
+		return bson.E{Key: "revision", Value: bson.D{{Key: "$exists", Value: false}}}
+	}
+	return bson.E{Key: "revision", Value: revision}
+}
+
+//messageFilter - matches the message of the id that matches all the conditions
+func messageFilter(messageID primitive.ObjectID, conditions ...bson.D) bson.D {
+	filter := bson.D{{Key: "_id", Value: messageID}}
+	var all bson.A
+	for _, condition := range conditions {
+		if len(condition) != 0 {
+			all = append(all, condition)
+		}
+	}
+	if len(all) != 0 {
+		filter = append(filter, bson.E{Key: "$and", Value: all})
+	}
+	return filter
+}
+
+//ownerFilter - matches the messages owned by the subject of the access
+func ownerFilter(access model.Access) bson.D {
+	if access.Subject == "" {
+		return nil
+	}
+	return bson.D{{Key: "owner", Value: access.Subject}}
+}
+
+//visibilityFilter - matches the messages of the access subject and the messages of other visibilities than the hidden ones
+//Messages stored without a visibility are public
+func visibilityFilter(access model.Access, hidden ...string) bson.D {
+	conditions := bson.A{bson.D{{Key: "visibility", Value: bson.D{{Key: "$nin", Value: hidden}}}}}
+	if owned := ownerFilter(access); owned != nil {
+		conditions = append(conditions, owned)
+	}
+	return bson.D{{Key: "$or", Value: conditions}}
+}
+
+//listFilter - matches the messages listed with the access, see model.Access.CanList
+func listFilter(access model.Access) bson.D {
+	if access.ReadAll {
+		return bson.D{}
+	}
+	return visibilityFilter(access, model.VisibilityPrivate, model.VisibilityUnlisted)
+}
+
+//readFilter - matches the messages read by id with the access, see model.Access.CanRead
+func readFilter(access model.Access) bson.D {
+	if access.ReadAll {
+		return bson.D{}
+	}
+	return visibilityFilter(access, model.VisibilityPrivate)
+}
+
+//writeFilter - matches the messages changed with the access, see model.Access.CanWrite
+func writeFilter(access model.Access) bson.D {
+	if access.WriteAll {
+		return bson.D{}
+	}
+	if owned := ownerFilter(access); owned != nil {
+		return owned
+	}
+	// nothing can be changed, no message has an empty owner
+	return bson.D{{Key: "owner", Value: bson.D{{Key: "$in", Value: bson.A{}}}}}
+}
+
+//StreamMessages - returns an iterator over the message records listed with the access with the projected fields only
+//Messages are read from the database in batches as the iteration advances
+func (mr *MongoRepository) StreamMessages(ctx context.Context, fields model.Projection, access model.Access) (model.MessageIterator, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
+	defer cancel()
+
+	collection := mr.messages()
+
+	findOptions := options.Find()
+	if fields != nil {
+		findOptions.SetProjection(projectionDocument(fields))
+	}
+	cursor, err := collection.Find(repositoryContext, mr.scope(listFilter(access)), findOptions)
 	if err != nil {
-		return nil, err
+		return nil, translateMongoError(err)
+	}
+
+	return &mongoMessageIterator{cursor: cursor, timeout: mr.timeouts.Stream}, nil
+}
+
+//mongoMessageIterator - iterates over a mongo cursor
+type mongoMessageIterator struct {
+	cursor  *mongo.Cursor
+	message model.MessageResponse
+	err     error
+	// timeout - the timeout of fetching each batch of documents
+	timeout time.Duration
+}
+
+//Next - implementation of model.MessageIterator
+//Fetching the next batch of documents is bound by the context and the stream timeout
+func (mi *mongoMessageIterator) Next(ctx context.Context) bool {
+	if mi.err != nil {
+		return false
+	}
+
+	repositoryContext, cancel := context.WithTimeout(ctx, mi.timeout)
+	defer cancel()
+
+	if !mi.cursor.Next(repositoryContext) {
+		if err := mi.cursor.Err(); err != nil {
+			mi.err = translateMongoError(err)
+		} else if err := ctx.Err(); err != nil {
+			mi.err = err
+		}
+		return false
 	}
 
-	collection := mr.client.Database(mr.databaseName).Collection("messages")
+	var messageResponse model.MessageResponse
+	if err := mi.cursor.Decode(&messageResponse); err != nil {
+		mi.err = errors.Wrap(err, "Could not decode message")
+		return false
+	}
+	restoreZoneOffset(&messageResponse)
+	mi.message = messageResponse
+	return true
+}
+
+//Message - implementation of model.MessageIterator
+func (mi *mongoMessageIterator) Message() model.MessageResponse {
+	return mi.message
+}
+
+//Err - implementation of model.MessageIterator
+func (mi *mongoMessageIterator) Err() error {
+	return mi.err
+}
+
+//Close - implementation of model.MessageIterator
+func (mi *mongoMessageIterator) Close(ctx context.Context) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mi.timeout)
+	defer cancel()
+
+	return translateMongoError(mi.cursor.Close(repositoryContext))
+}
+
+//FindMessageByID - returns an existing message record with the projected fields only
+//An error will be returned if the given id does not exist or can't be read with the access
+func (mr *MongoRepository) FindMessageByID(ctx context.Context, id string, fields model.Projection, access model.Access) (*model.MessageResponse, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
+	defer cancel()
+
+	collection := mr.messages()
 
 	messageID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, ErrorInvalidID
+	}
+
+	findOptions := options.FindOne()
+	if fields != nil {
+		findOptions.SetProjection(projectionDocument(fields))
+	}
+	var messageResponse model.MessageResponse
+	err = collection.FindOne(repositoryContext, mr.scope(messageFilter(messageID, readFilter(access))), findOptions).Decode(&messageResponse)
+	if err != nil {
+		return nil, translateMongoError(err)
 	}
 
-	filter := model.MessageResponse{ID: messageID}
+	restoreZoneOffset(&messageResponse)
+	return &messageResponse, nil
+}
 
-	updatedAuthor := updateString(oldMessage.Author, updateMessage.Author)
-	updatedCreatedAt := (*model.MessageTime)(updateTime((*time.Time)(oldMessage.CreatedAt), (*time.Time)(updateMessage.CreatedAt)))
-	upadtedContent := updateString(oldMessage.Content, updateMessage.Content)
-	var updatedPalindrome bool
-	if updateMessage.Content != nil && *upadtedContent != *oldMessage.Content {
-		// message content got a new value, calculating new palindrome state
-		updatedPalindrome = utils.IsPalindrome(*updateMessage.Content)
+//FindAuthors - returns the authors of the given names that wrote any message listed with the access, by name
+//All the authors are aggregated by a single query
+func (mr *MongoRepository) FindAuthors(ctx context.Context, names []string, access model.Access) (map[string]model.Author, error) {
+	authors := make(map[string]model.Author, len(names))
+	if len(names) == 0 {
+		return authors, nil
 	}
 
-	update := bson.D{
-		//{Key: "$set", Value: bson.D{
-		{Key: op(updatedAuthor), Value: bson.D{
-			{Key: "author", Value: updatedAuthor},
-		}},
-		{Key: op(upadtedContent), Value: bson.D{
-			{Key: "content", Value: upadtedContent},
-		}},
-		{Key: op(updatedCreatedAt), Value: bson.D{
-			{Key: "createdAt", Value: updatedCreatedAt},
-		}},
-		{Key: "$set", Value: bson.D{
-			{Key: "palindrome", Value: updatedPalindrome},
-		}},
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
+	defer cancel()
+
+	collection := mr.messages()
+
+	pipeline := bson.A{
+		bson.D{{Key: "$match", Value: mr.scope(append(bson.D{{Key: "author", Value: bson.D{{Key: "$in", Value: names}}}}, listFilter(access)...))}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$author"},
+			{Key: "messageCount", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "firstMessageAt", Value: bson.D{{Key: "$min", Value: "$createdAt"}}},
+			{Key: "lastMessageAt", Value: bson.D{{Key: "$max", Value: "$createdAt"}}},
+		}}},
+	}
+	cursor, err := collection.Aggregate(repositoryContext, pipeline)
+	if err != nil {
+		return nil, translateMongoError(err)
 	}
+	defer cursor.Close(repositoryContext)
 
-	updateOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	for cursor.Next(repositoryContext) {
+		var author model.Author
+		if err := cursor.Decode(&author); err != nil {
+			return nil, errors.Wrap(err, "Could not decode author")
+		}
+		authors[author.Name] = author
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, translateMongoError(err)
+	}
+
+	return authors, nil
+}
 
-	var updatedMessage model.MessageResponse
-	err = collection.FindOneAndUpdate(repositoryContext, filter, update, updateOptions).Decode(&updatedMessage)
-	if err != nil && err.Error() == "mongo: no documents in result" {
-		return nil, ErrorNotFound
+//projectionFields - the document fields holding each message field
+var projectionFields = map[string][]string{
+	model.FieldID:         {"_id"},
+	model.FieldContent:    {"content"},
+	model.FieldAuthor:     {"author"},
+	model.FieldCreatedAt:  {"createdAt", "createdAtOffset"},
+	model.FieldPalindrome: {"palindrome"},
+	model.FieldCreatedBy:  {"createdBy"},
+	model.FieldOwner:      {"owner"},
+	model.FieldVisibility: {"visibility"},
+}
+
+//projectionDocument - the mongo projection selecting the given fields
+func projectionDocument(fields model.Projection) bson.D {
+	projection := bson.D{{Key: "revision", Value: 1}}
+	if !fields.Includes(model.FieldID) {
+		projection = append(projection, bson.E{Key: "_id", Value: 0})
+	}
+	for _, field := range fields {
+		for _, documentField := range projectionFields[field] {
+			projection = append(projection, bson.E{Key: documentField, Value: 1})
+		}
 	}
+	return projection
+}
 
+//DeleteMessageByID - removes an existing message record from the repository
+//An error will be returned if the given id does not exist or can't be changed with the access
+func (mr *MongoRepository) DeleteMessageByID(ctx context.Context, id string, access model.Access) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.messages()
+
+	messageID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return ErrorInvalidID
 	}
 
-	return &updatedMessage, nil
+	result, err := collection.DeleteOne(repositoryContext, mr.scope(messageFilter(messageID, readFilter(access), writeFilter(access))))
+	if err != nil {
+		return translateMongoError(err)
+	}
+	if result.DeletedCount == 0 {
+		// tell apart a message that does not exist from one the access can't change
+		if _, err := mr.FindMessageByID(ctx, id, model.Projection{model.FieldID}, access); err != nil {
+			return err
+		}
+		return ErrorForbidden
+	}
+
+	return nil
+}
+
+//CreateAPIKey - adds a new API key record into repository
+//An error will be returned if a key of the same id exists
+func (mr *MongoRepository) CreateAPIKey(ctx context.Context, key model.APIKey) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("apikeys")
+	_, err := collection.InsertOne(repositoryContext, key)
+	return translateMongoError(err)
 }
 
-//ListMessages - returns all message records in the repository
-func (mr *MongoRepository) ListMessages(ctx context.Context) (model.MessageResponses, error) {
-	repositoryContext, cancel := getRepositoryContext(ctx)
+//FindAPIKeyByID - returns an existing API key record
+//An error will be returned if the given id does not exist
+func (mr *MongoRepository) FindAPIKeyByID(ctx context.Context, id string) (*model.APIKey, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
 	defer cancel()
 
-	collection := mr.client.Database(mr.databaseName).Collection("messages")
+	collection := mr.client().Database(mr.databaseName).Collection("apikeys")
 
+	var key model.APIKey
+	err := collection.FindOne(repositoryContext, bson.D{{Key: "_id", Value: id}}).Decode(&key)
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+
+	return &key, nil
+}
+
+//ListAPIKeys - returns all API key records in the repository, revoked keys included
+func (mr *MongoRepository) ListAPIKeys(ctx context.Context) (model.APIKeys, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("apikeys")
 	cursor, err := collection.Find(repositoryContext, bson.M{})
 	if err != nil {
-		return nil, err
+		return nil, translateMongoError(err)
 	}
 	defer cursor.Close(repositoryContext)
 
-	var MessageResponses model.MessageResponses
+	keys := model.APIKeys{}
 	for cursor.Next(repositoryContext) {
-		var MessageResponse model.MessageResponse
-		cursor.Decode(&MessageResponse)
-		MessageResponses = append(MessageResponses, MessageResponse)
+		var key model.APIKey
+		if err := cursor.Decode(&key); err != nil {
+			return nil, errors.Wrap(err, "Could not decode API key")
+		}
+		keys = append(keys, key)
 	}
 
 	if err := cursor.Err(); err != nil {
-		return nil, err
+		return nil, translateMongoError(err)
 	}
 
-	return MessageResponses, nil
+	return keys, nil
 }
 
-//FindMessageByID - returns an existing message record
+//RevokeAPIKeyByID - marks an existing API key record as revoked, revoking a revoked key keeps its revocation time
 //An error will be returned if the given id does not exist
-func (mr *MongoRepository) FindMessageByID(ctx context.Context, id string) (*model.MessageResponse, error) {
-	repositoryContext, cancel := getRepositoryContext(ctx)
+func (mr *MongoRepository) RevokeAPIKeyByID(ctx context.Context, id string, revokedAt time.Time) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
 	defer cancel()
 
-	collection := mr.client.Database(mr.databaseName).Collection("messages")
+	collection := mr.client().Database(mr.databaseName).Collection("apikeys")
 
-	messageID, err := primitive.ObjectIDFromHex(id)
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "revokedAt", Value: bson.D{{Key: "$exists", Value: false}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revokedAt", Value: revokedAt}}}}
+	result, err := collection.UpdateOne(repositoryContext, filter, update)
 	if err != nil {
-		return nil, err
+		return translateMongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		// revoked already or missing
+		_, err = mr.FindAPIKeyByID(ctx, id)
+		return err
 	}
 
-	var messageResponse model.MessageResponse
-	err = collection.FindOne(repositoryContext, model.MessageResponse{ID: messageID}).Decode(&messageResponse)
-	if err != nil && err.Error() == "mongo: no documents in result" {
-		return nil, ErrorNotFound
+	return nil
+}
+
+//TouchAPIKeyByID - records the last time an existing API key was used
+//An error will be returned if the given id does not exist
+func (mr *MongoRepository) TouchAPIKeyByID(ctx context.Context, id string, usedAt time.Time) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("apikeys")
+
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "lastUsedAt", Value: usedAt}}}}
+	result, err := collection.UpdateOne(repositoryContext, filter, update)
+	if err != nil {
+		return translateMongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrorNotFound
 	}
 
+	return nil
+}
+
+//CreateUser - adds a new user record into repository
+//An error will be returned if a user of the same name exists in the tenant of the user
+func (mr *MongoRepository) CreateUser(ctx context.Context, user model.User) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	user.Revision = 1
+	_, err := mr.users().InsertOne(repositoryContext, user)
+	return translateMongoError(err)
+}
+
+//FindUserByName - returns an existing user record of the tenant (empty when the service has no tenants)
+//An error will be returned if the given user does not exist
+func (mr *MongoRepository) FindUserByName(ctx context.Context, tenant string, username string) (*model.User, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
+	defer cancel()
+
+	var user model.User
+	err := mr.users().FindOne(repositoryContext, userFilter(tenant, username)).Decode(&user)
 	if err != nil {
-		return nil, err
+		return nil, translateMongoError(err)
 	}
 
-	return &messageResponse, nil
+	return &user, nil
 }
 
-//DeleteMessageByID - removes an existing message record from the repository
+//UpdateUserByName - atomically applies a mutation to an existing user record of the tenant
+//The record is replaced only if it was not changed since it was read (optimistic concurrency),
+//otherwise the mutation is applied again to the fresh record.
+//An error will be returned if the given user does not exist or the mutation fails
+func (mr *MongoRepository) UpdateUserByName(ctx context.Context, tenant string, username string, mutation model.UserMutation) (*model.User, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.users()
+
+	for attempt := 0; attempt < maxPatchAttempts; attempt++ {
+		var oldUser model.User
+		err := collection.FindOne(repositoryContext, userFilter(tenant, username)).Decode(&oldUser)
+		if err != nil {
+			return nil, translateMongoError(err)
+		}
+
+		newUser, err := mutation(oldUser)
+		if err != nil {
+			return nil, err
+		}
+		newUser.Username = oldUser.Username
+		newUser.Tenant = oldUser.Tenant
+		newUser.Revision = oldUser.Revision + 1
+
+		filter := append(userFilter(tenant, username), revisionFilter(oldUser.Revision))
+		result, err := collection.ReplaceOne(repositoryContext, filter, newUser)
+		if err != nil {
+			return nil, translateMongoError(err)
+		}
+		if result.MatchedCount == 0 {
+			// deleted or changed since read, try again
+			log.WithField("username", username).WithField("tenant", tenant).WithField("attempt", attempt).Debug("User changed concurrently")
+			continue
+		}
+
+		return &newUser, nil
+	}
+
+	return nil, errors.Wrapf(ErrorConflict, "user %s kept changing concurrently", username)
+}
+
+//mongoDuplicateKeyCode - mongo duplicate key error code
+const mongoDuplicateKeyCode = 11000
+
+//CreateTenant - adds a new tenant record into repository
+//The indexes of the messages of the tenant are created when each tenant has a database of its own
+//An error will be returned if a tenant of the same id exists
+func (mr *MongoRepository) CreateTenant(ctx context.Context, tenant model.Tenant) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("tenants")
+	if _, err := collection.InsertOne(repositoryContext, tenant); err != nil {
+		return translateMongoError(err)
+	}
+
+	if mr.isolation == TenantIsolationDatabase {
+		return createMessageIndexes(repositoryContext, mr.ForTenant(tenant.ID).messages())
+	}
+	return nil
+}
+
+//FindTenantByID - returns an existing tenant record
 //An error will be returned if the given id does not exist
-func (mr *MongoRepository) DeleteMessageByID(ctx context.Context, id string) error {
-	repositoryContext, cancel := getRepositoryContext(ctx)
+func (mr *MongoRepository) FindTenantByID(ctx context.Context, id string) (*model.Tenant, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
 	defer cancel()
 
-	collection := mr.client.Database(mr.databaseName).Collection("messages")
+	collection := mr.client().Database(mr.databaseName).Collection("tenants")
 
-	messageID, err := primitive.ObjectIDFromHex(id)
+	var tenant model.Tenant
+	err := collection.FindOne(repositoryContext, bson.D{{Key: "_id", Value: id}}).Decode(&tenant)
 	if err != nil {
+		return nil, translateMongoError(err)
+	}
+
+	return &tenant, nil
+}
+
+//ListTenants - returns all tenant records in the repository
+func (mr *MongoRepository) ListTenants(ctx context.Context) (model.Tenants, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("tenants")
+	cursor, err := collection.Find(repositoryContext, bson.M{})
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+	defer cursor.Close(repositoryContext)
+
+	tenants := model.Tenants{}
+	for cursor.Next(repositoryContext) {
+		var tenant model.Tenant
+		if err := cursor.Decode(&tenant); err != nil {
+			return nil, errors.Wrap(err, "Could not decode tenant")
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, translateMongoError(err)
+	}
+
+	return tenants, nil
+}
+
+//UpdateTenantSettings - replaces the settings of an existing tenant record
+//An error will be returned if the given id does not exist
+func (mr *MongoRepository) UpdateTenantSettings(ctx context.Context, id string, settings model.TenantSettings) (*model.Tenant, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("tenants")
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "settings", Value: settings}}}}
+	updateOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var tenant model.Tenant
+	err := collection.FindOneAndUpdate(repositoryContext, bson.D{{Key: "_id", Value: id}}, update, updateOptions).Decode(&tenant)
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+
+	return &tenant, nil
+}
+
+//DeleteTenantByID - removes an existing tenant record with all the messages, users and API keys of the tenant
+//from the repository, so the credentials of a deleted tenant can't reach a tenant created again with its id
+//The records of the tenant are removed before the tenant so a failed deletion can be retried
+//An error will be returned if the given id does not exist
+func (mr *MongoRepository) DeleteTenantByID(ctx context.Context, id string) error {
+	if _, err := mr.FindTenantByID(ctx, id); err != nil {
 		return err
 	}
 
-	result, err := collection.DeleteOne(repositoryContext, model.MessageResponse{ID: messageID})
-	if err == nil && result.DeletedCount == 0 {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	tenantRepository := mr.ForTenant(id)
+	var err error
+	if mr.isolation == TenantIsolationDatabase {
+		err = mr.client().Database(tenantRepository.databaseName).Drop(repositoryContext)
+	} else {
+		_, err = tenantRepository.messages().DeleteMany(repositoryContext, tenantRepository.scope(bson.D{}))
+	}
+	if err != nil {
+		return translateMongoError(err)
+	}
+	tenantFilter := bson.D{{Key: "tenant", Value: id}}
+	if _, err := mr.users().DeleteMany(repositoryContext, tenantFilter); err != nil {
+		return translateMongoError(err)
+	}
+	if _, err := mr.client().Database(mr.databaseName).Collection("apikeys").DeleteMany(repositoryContext, tenantFilter); err != nil {
+		return translateMongoError(err)
+	}
+
+	collection := mr.client().Database(mr.databaseName).Collection("tenants")
+	result, err := collection.DeleteOne(repositoryContext, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return translateMongoError(err)
+	}
+	if result.DeletedCount == 0 {
 		return ErrorNotFound
 	}
 
-	return err
+	return nil
+}
+
+//IncrementQuota - atomically counts a use of the quota of the given id and returns the count
+//An error will be returned without counting if the count reached the limit
+func (mr *MongoRepository) IncrementQuota(ctx context.Context, id string, limit int, expiresAt time.Time) (int, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("quotas")
+
+	// a usage that reached the limit is not matched, upserting it again fails on the duplicate id
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "count", Value: bson.D{{Key: "$lt", Value: limit}}}}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "expiresAt", Value: expiresAt}}},
+	}
+	updateOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var usage model.QuotaUsage
+	err := collection.FindOneAndUpdate(repositoryContext, filter, update, updateOptions).Decode(&usage)
+	if err != nil {
+		return 0, translateMongoError(err)
+	}
+
+	return usage.Count, nil
+}
+
+//DecrementQuota - atomically takes back a use of the quota of the given id
+//Unknown quotas and quotas of a count of 0 are not changed
+func (mr *MongoRepository) DecrementQuota(ctx context.Context, id string) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("quotas")
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "count", Value: bson.D{{Key: "$gt", Value: 0}}}}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "count", Value: -1}}}}
+	_, err := collection.UpdateOne(repositoryContext, filter, update)
+	return translateMongoError(err)
+}
+
+//CreateIdempotencyRecord - adds a new idempotency record into repository
+//An error will be returned if a record of the same id exists
+func (mr *MongoRepository) CreateIdempotencyRecord(ctx context.Context, record model.IdempotencyRecord) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("idempotency")
+	_, err := collection.InsertOne(repositoryContext, record)
+	return translateMongoError(err)
+}
+
+//FindIdempotencyRecord - returns an existing idempotency record
+//An error will be returned if the given id does not exist
+func (mr *MongoRepository) FindIdempotencyRecord(ctx context.Context, id string) (*model.IdempotencyRecord, error) {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Read)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("idempotency")
+
+	var record model.IdempotencyRecord
+	err := collection.FindOne(repositoryContext, bson.D{{Key: "_id", Value: id}}).Decode(&record)
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+
+	return &record, nil
+}
+
+//CompleteIdempotencyRecord - replaces an existing uncompleted idempotency record
+//An error will be returned if no uncompleted record of the id exists
+func (mr *MongoRepository) CompleteIdempotencyRecord(ctx context.Context, record model.IdempotencyRecord) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("idempotency")
+
+	filter := bson.D{{Key: "_id", Value: record.ID}, {Key: "completed", Value: false}}
+	result, err := collection.ReplaceOne(repositoryContext, filter, record)
+	if err != nil {
+		return translateMongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+//DeleteIdempotencyRecord - removes an existing idempotency record if it still expires at the given time
+//An error will be returned if no such record exists
+func (mr *MongoRepository) DeleteIdempotencyRecord(ctx context.Context, id string, expiresAt time.Time) error {
+	repositoryContext, cancel := context.WithTimeout(ctx, mr.timeouts.Write)
+	defer cancel()
+
+	collection := mr.client().Database(mr.databaseName).Collection("idempotency")
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "expiresAt", Value: expiresAt}}
+	result, err := collection.DeleteOne(repositoryContext, filter)
+	if err != nil {
+		return translateMongoError(err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
 }
 
-func op(value interface{}) string {
-	if !utils.IsNilValue(value) {
-		return "$set"
+//translateMongoError - map a mongo driver error to one of the persistence errors.
+//The driver error is kept as the message of the returned error, use errors.Cause to
+//get to the persistence error. Errors that can't be classified are returned as is.
+func translateMongoError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == mongo.ErrNoDocuments {
+		return ErrorNotFound
+	}
+
+	switch typedErr := errors.Cause(err).(type) {
+	case Error:
+		return err
+	case mongo.WriteException:
+		if hasDuplicateKey(typedErr.WriteErrors) {
+			return errors.Wrap(ErrorConflict, err.Error())
+		}
+	case mongo.WriteErrors:
+		if hasDuplicateKey(typedErr) {
+			return errors.Wrap(ErrorConflict, err.Error())
+		}
+	case command.Error:
+		if typedErr.Code == mongoDuplicateKeyCode {
+			return errors.Wrap(ErrorConflict, err.Error())
+		}
+		if typedErr.Retryable() {
+			return errors.Wrap(ErrorUnavailable, err.Error())
+		}
+	case connection.Error, connection.NetworkError:
+		return errors.Wrap(ErrorUnavailable, err.Error())
+	case net.Error:
+		if typedErr.Timeout() {
+			return errors.Wrap(ErrorTimeout, err.Error())
+		}
+		return errors.Wrap(ErrorUnavailable, err.Error())
+	}
+
+	switch {
+	case errors.Cause(err) == context.DeadlineExceeded:
+		return errors.Wrap(ErrorTimeout, err.Error())
+	case err == mongo.ErrClientDisconnected,
+		strings.HasPrefix(err.Error(), "server selection error"):
+		return errors.Wrap(ErrorUnavailable, err.Error())
 	}
 
-	return "$unset"
+	return err
 }
 
-func getRepositoryContext(ctx context.Context) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(ctx, config.GetDuration("database.timeout"))
+func hasDuplicateKey(writeErrors mongo.WriteErrors) bool {
+	for _, writeError := range writeErrors {
+		if writeError.Code == mongoDuplicateKeyCode {
+			return true
+		}
+	}
+	return false
+}
+
+//restoreZoneOffset - express a decoded message creation time in the time zone it was originally given in
+func restoreZoneOffset(message *model.MessageResponse) {
+	if message.CreatedAt == nil {
+		return
+	}
+
+	offset := 0
+	if message.CreatedAtOffset != nil {
+		offset = *message.CreatedAtOffset
+	}
+	createdAt := message.CreatedAt.InZoneOffset(offset)
+	message.CreatedAt = &createdAt
 }
@@ -0,0 +1,330 @@
+package persistence
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"github.com/mongodb/mongo-go-driver/mongo/readpref"
+	"github.com/mongodb/mongo-go-driver/mongo/writeconcern"
+	"github.com/mongodb/mongo-go-driver/x/network/connstring"
+
+	config "github.com/spf13/viper"
+)
+
+//MongoTLS - TLS settings of the connections to MongoDB
+type MongoTLS struct {
+	Enabled bool
+	// CAFile - the certificate authorities verifying the server certificate, the system ones when empty
+	CAFile string
+	// CertificateKeyFile - a PEM file holding the client certificate and its key, for mutual TLS or X.509 authentication
+	CertificateKeyFile string
+	// CertificateKeyPassword - the password of an encrypted client key
+	CertificateKeyPassword string
+	// Insecure - skip verifying the server certificate, for development only
+	Insecure bool
+}
+
+//MongoWriteConcern - the acknowledgement requested for writes
+type MongoWriteConcern struct {
+	// W - "majority", a number of members or a tag set, the server default when empty
+	W string
+	// Journal - writes are acknowledged once written to the journal
+	Journal bool
+	// Timeout - how long the server waits for the acknowledgement, without limit when 0
+	Timeout time.Duration
+}
+
+//MongoTimeouts - the timeouts of each type of mongo operation
+type MongoTimeouts struct {
+	// Connect - connecting and the first ping at startup
+	Connect time.Duration
+	// Ping - the readiness ping
+	Ping time.Duration
+	// Read - finding documents
+	Read time.Duration
+	// Write - inserting, updating and deleting documents
+	Write time.Duration
+	// Stream - fetching each batch of documents of a streamed list
+	Stream time.Duration
+	// Index - creating indexes at startup
+	Index time.Duration
+}
+
+//MongoConfig - the connection to MongoDB
+type MongoConfig struct {
+	// URI - a mongodb:// or mongodb+srv:// connection string, built from the servers when empty.
+	// The other settings override the options of the URI.
+	URI          string
+	DatabaseName string
+
+	Username      string
+	Password      string
+	AuthSource    string
+	AuthMechanism string
+
+	ReplicaSet     string
+	TLS            MongoTLS
+	ReadPreference string
+	WriteConcern   MongoWriteConcern
+
+	MaxPoolSize            int
+	MaxConnIdleTime        time.Duration
+	ServerSelectionTimeout time.Duration
+	Timeouts               MongoTimeouts
+}
+
+// authMechanisms - the authentication mechanisms supported by the driver
+var authMechanisms = []string{"SCRAM-SHA-256", "SCRAM-SHA-1", "MONGODB-CR", "PLAIN", "GSSAPI", "MONGODB-X509"}
+
+//LoadMongoConfig - read and validate the mongo connection from the "database" configuration section.
+//All the problems of the configuration are reported in the returned error.
+//Operation timeouts that are not configured in database.timeouts fall back to database.timeout.
+func LoadMongoConfig() (MongoConfig, error) {
+	timeout := func(key string) time.Duration {
+		if config.IsSet("database.timeouts." + key) {
+			return config.GetDuration("database.timeouts." + key)
+		}
+		return config.GetDuration("database.timeout")
+	}
+
+	mongoConfig := MongoConfig{
+		URI:           config.GetString("database.uri"),
+		DatabaseName:  config.GetString("database.dbname"),
+		Username:      config.GetString("database.username"),
+		Password:      config.GetString("database.password"),
+		AuthSource:    config.GetString("database.authSource"),
+		AuthMechanism: config.GetString("database.authMechanism"),
+		ReplicaSet:    config.GetString("database.replicaSet"),
+		TLS: MongoTLS{
+			Enabled:                config.GetBool("database.tls.enabled"),
+			CAFile:                 config.GetString("database.tls.caFile"),
+			CertificateKeyFile:     config.GetString("database.tls.certificateKeyFile"),
+			CertificateKeyPassword: config.GetString("database.tls.certificateKeyPassword"),
+			Insecure:               config.GetBool("database.tls.insecure"),
+		},
+		ReadPreference: config.GetString("database.readPreference"),
+		WriteConcern: MongoWriteConcern{
+			W:       config.GetString("database.writeConcern.w"),
+			Journal: config.GetBool("database.writeConcern.journal"),
+			Timeout: config.GetDuration("database.writeConcern.timeout"),
+		},
+		MaxPoolSize:            config.GetInt("database.pool.maxSize"),
+		MaxConnIdleTime:        config.GetDuration("database.pool.maxIdleTime"),
+		ServerSelectionTimeout: config.GetDuration("database.serverSelectionTimeout"),
+		Timeouts: MongoTimeouts{
+			Connect: timeout("connect"),
+			Ping:    timeout("ping"),
+			Read:    timeout("read"),
+			Write:   timeout("write"),
+			Stream:  timeout("stream"),
+			Index:   timeout("index"),
+		},
+	}
+
+	server := config.GetString("database.server")
+	if mongoConfig.URI != "" && server != "" {
+		// the environment overrides the other setting of the configuration file
+		uriFromEnv, serverFromEnv := setInEnvironment("database.uri"), setInEnvironment("database.server")
+		switch {
+		case uriFromEnv && !serverFromEnv:
+			server = ""
+		case serverFromEnv && !uriFromEnv:
+			mongoConfig.URI = ""
+		default:
+			return mongoConfig, errors.New("Invalid database configuration: set either database.uri or database.server, not both")
+		}
+	}
+	if mongoConfig.URI == "" && server != "" {
+		mongoConfig.URI = "mongodb://" + server
+	}
+
+	return mongoConfig, mongoConfig.Validate()
+}
+
+//setInEnvironment - reports if the setting is given by its MESSAGES_ environment variable or the *_FILE variant of it
+func setInEnvironment(key string) bool {
+	variable := "MESSAGES_" + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+	if _, ok := os.LookupEnv(variable); ok {
+		return true
+	}
+	_, ok := os.LookupEnv(variable + "_FILE")
+	return ok
+}
+
+//Validate - reports all the problems of the configuration in a single error
+func (mc MongoConfig) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if mc.URI == "" {
+		problem("database.uri or database.server is required")
+	} else if connectionString, err := connstring.Parse(mc.URI); err != nil {
+		problem("database.uri: %v", err)
+	} else if connectionString.Username != "" && mc.Username != "" {
+		problem("database.username: the credentials are given in database.uri already")
+	}
+	if mc.DatabaseName == "" {
+		problem("database.dbname is required")
+	}
+	if mc.Password != "" && mc.Username == "" {
+		problem("database.password is set without database.username")
+	}
+	if mc.AuthMechanism != "" && !containsFold(authMechanisms, mc.AuthMechanism) {
+		problem("database.authMechanism: unknown mechanism %q, use one of %s", mc.AuthMechanism, strings.Join(authMechanisms, ", "))
+	}
+
+	if !mc.TLS.Enabled && (mc.TLS.CAFile != "" || mc.TLS.CertificateKeyFile != "" || mc.TLS.Insecure) {
+		problem("database.tls: caFile, certificateKeyFile and insecure require database.tls.enabled")
+	}
+	for _, file := range []struct{ key, path string }{{"caFile", mc.TLS.CAFile}, {"certificateKeyFile", mc.TLS.CertificateKeyFile}} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			problem("database.tls.%s: %v", file.key, err)
+		}
+	}
+	if mc.TLS.CertificateKeyPassword != "" && mc.TLS.CertificateKeyFile == "" {
+		problem("database.tls.certificateKeyPassword is set without database.tls.certificateKeyFile")
+	}
+
+	if mc.ReadPreference != "" {
+		if _, err := readpref.ModeFromString(mc.ReadPreference); err != nil {
+			problem("database.readPreference: unknown read preference %q, use primary, primaryPreferred, secondary, secondaryPreferred or nearest", mc.ReadPreference)
+		}
+	}
+	if w, err := strconv.Atoi(mc.WriteConcern.W); err == nil && w < 0 {
+		problem("database.writeConcern.w must not be negative")
+	}
+	if mc.WriteConcern.Timeout < 0 {
+		problem("database.writeConcern.timeout must not be negative")
+	}
+
+	if mc.MaxPoolSize < 0 || mc.MaxPoolSize > math.MaxUint16 {
+		problem("database.pool.maxSize must be between 0 (the driver default) and %d", math.MaxUint16)
+	}
+	if mc.MaxConnIdleTime < 0 || mc.ServerSelectionTimeout < 0 {
+		problem("database.pool.maxIdleTime and database.serverSelectionTimeout must not be negative")
+	}
+	timeouts := []struct {
+		key     string
+		timeout time.Duration
+	}{{"connect", mc.Timeouts.Connect}, {"ping", mc.Timeouts.Ping}, {"read", mc.Timeouts.Read},
+		{"write", mc.Timeouts.Write}, {"stream", mc.Timeouts.Stream}, {"index", mc.Timeouts.Index}}
+	for _, operation := range timeouts {
+		if operation.timeout <= 0 {
+			problem("database.timeouts.%s must be positive", operation.key)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.Errorf("Invalid database configuration: %s", strings.Join(problems, "; "))
+}
+
+//clientOptions - the client options of the configuration, set on top of the options of the URI
+func (mc MongoConfig) clientOptions() *options.ClientOptions {
+	clientOptions := options.Client()
+	if mc.Username != "" || mc.AuthSource != "" || mc.AuthMechanism != "" {
+		clientOptions.SetAuth(options.Credential{
+			Username:      mc.Username,
+			Password:      mc.Password,
+			AuthSource:    mc.AuthSource,
+			AuthMechanism: strings.ToUpper(mc.AuthMechanism),
+		})
+	}
+	if mc.ReplicaSet != "" {
+		clientOptions.SetReplicaSet(mc.ReplicaSet)
+	}
+	if mc.TLS.Enabled {
+		tls := &options.SSLOpt{Enabled: true, CaFile: mc.TLS.CAFile, ClientCertificateKeyFile: mc.TLS.CertificateKeyFile, Insecure: mc.TLS.Insecure}
+		if password := mc.TLS.CertificateKeyPassword; password != "" {
+			tls.ClientCertificateKeyPassword = func() string { return password }
+		}
+		clientOptions.SetSSL(tls)
+	}
+	if mc.ReadPreference != "" {
+		mode, _ := readpref.ModeFromString(mc.ReadPreference)
+		if readPreference, err := readpref.New(mode); err == nil {
+			clientOptions.SetReadPreference(readPreference)
+		}
+	}
+	if writeConcern := mc.writeConcern(); writeConcern != nil {
+		clientOptions.SetWriteConcern(writeConcern)
+	}
+	if mc.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(uint16(mc.MaxPoolSize))
+	}
+	if mc.MaxConnIdleTime > 0 {
+		clientOptions.SetMaxConnIdleTime(mc.MaxConnIdleTime)
+	}
+	if mc.ServerSelectionTimeout > 0 {
+		clientOptions.SetServerSelectionTimeout(mc.ServerSelectionTimeout)
+	}
+	return clientOptions.SetConnectTimeout(mc.Timeouts.Connect)
+}
+
+//writeConcern - the configured write concern, nil for the server default
+func (mc MongoConfig) writeConcern() *writeconcern.WriteConcern {
+	var concern []writeconcern.Option
+	switch w, err := strconv.Atoi(mc.WriteConcern.W); {
+	case mc.WriteConcern.W == "":
+	case mc.WriteConcern.W == "majority":
+		concern = append(concern, writeconcern.WMajority())
+	case err == nil:
+		concern = append(concern, writeconcern.W(w))
+	default:
+		concern = append(concern, writeconcern.WTagSet(mc.WriteConcern.W))
+	}
+	if mc.WriteConcern.Journal {
+		concern = append(concern, writeconcern.J(true))
+	}
+	if mc.WriteConcern.Timeout > 0 {
+		concern = append(concern, writeconcern.WTimeout(mc.WriteConcern.Timeout))
+	}
+	if len(concern) == 0 {
+		return nil
+	}
+	return writeconcern.New(concern...)
+}
+
+//redactURI - the connection string without its password, for logging
+func redactURI(uri string) string {
+	schemeEnd := strings.Index(uri, "://")
+	if schemeEnd < 0 {
+		return uri
+	}
+	authority := uri[schemeEnd+3:]
+	if slash := strings.Index(authority, "/"); slash >= 0 {
+		authority = authority[:slash]
+	}
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return uri
+	}
+	userInfo := authority[:at]
+	if colon := strings.Index(userInfo, ":"); colon >= 0 {
+		userInfo = userInfo[:colon] + ":xxxxx"
+	}
+	return uri[:schemeEnd+3] + userInfo + uri[schemeEnd+3+at:]
+}
+
+//containsFold - reports if the value is one of the values, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, known := range values {
+		if strings.EqualFold(known, value) {
+			return true
+		}
+	}
+	return false
+}
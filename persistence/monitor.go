@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/event"
+	"github.com/shauera/messages/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName - the name of the tracer of the persistence package
+const instrumentationName = "github.com/shauera/messages/persistence"
+
+// newCommandMonitor - a mongo command monitor recording the command metrics and a client span
+// of each command in the trace of its context.
+// The driver reports no pool events, so only what the commands show is measured: the commands
+// running and the connections that ran a command, counted the first time they run one.
+func newCommandMonitor() *event.CommandMonitor {
+	var lock sync.Mutex
+	connections := make(map[string]struct{})
+	// spans - the spans of the running commands by request id
+	spans := make(map[int64]trace.Span)
+
+	finished := func(requestID int64, commandName string, durationNanos int64, status string, failure string) {
+		metrics.MongoCommandsInFlight.Dec()
+		metrics.MongoCommandDuration.WithLabelValues(commandName, status).Observe(time.Duration(durationNanos).Seconds())
+
+		lock.Lock()
+		span, ok := spans[requestID]
+		delete(spans, requestID)
+		lock.Unlock()
+		if !ok {
+			return
+		}
+		if failure != "" {
+			span.SetStatus(codes.Error, failure)
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, started *event.CommandStartedEvent) {
+			metrics.MongoCommandsInFlight.Inc()
+			_, span := otel.Tracer(instrumentationName).Start(ctx, "mongodb."+started.CommandName,
+				trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(commandAttributes(started)...))
+
+			lock.Lock()
+			defer lock.Unlock()
+			if _, ok := connections[started.ConnectionID]; !ok {
+				connections[started.ConnectionID] = struct{}{}
+				metrics.MongoConnectionsSeen.Inc()
+			}
+			if span.IsRecording() {
+				spans[started.RequestID] = span
+			}
+		},
+		Succeeded: func(ctx context.Context, succeeded *event.CommandSucceededEvent) {
+			finished(succeeded.RequestID, succeeded.CommandName, succeeded.DurationNanos, "success", "")
+		},
+		Failed: func(ctx context.Context, failed *event.CommandFailedEvent) {
+			finished(failed.RequestID, failed.CommandName, failed.DurationNanos, "failure", failed.Failure)
+		},
+	}
+}
+
+// commandAttributes - the span attributes of a command, the statement itself is left out as it holds message contents
+func commandAttributes(started *event.CommandStartedEvent) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.name", started.DatabaseName),
+		attribute.String("db.operation", started.CommandName),
+		attribute.String("db.connection_id", started.ConnectionID),
+	}
+	// connection ids are the address of the server followed by [-n]
+	if end := strings.LastIndex(started.ConnectionID, "["); end > 0 {
+		attributes = append(attributes, attribute.String("net.peer.name", started.ConnectionID[:end]))
+	}
+	// the value of the first element of a command is the collection it runs on
+	if element, err := bson.Raw(started.Command).IndexErr(0); err == nil {
+		if collection, ok := element.Value().StringValueOK(); ok {
+			attributes = append(attributes, attribute.String("db.mongodb.collection", collection))
+		}
+	}
+	return attributes
+}
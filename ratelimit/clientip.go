@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies - the networks of the proxies whose X-Forwarded-For headers are trusted
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies - returns the networks of the given CIDRs or addresses
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusts - reports if the address is one of a trusted proxy
+func (tp TrustedProxies) trusts(ip net.IP) bool {
+	for _, network := range tp {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP - the address of the client of the request.
+// When the request comes from a trusted proxy the X-Forwarded-For addresses are walked from the
+// closest one back and the first address that is not of a trusted proxy is the client.
+// Addresses clients add themselves can't be trusted, they are never reached unless all the proxies are trusted.
+func (tp TrustedProxies) ClientIP(request *http.Request) string {
+	remote := request.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	ip := net.ParseIP(remote)
+	if ip == nil || !tp.trusts(ip) {
+		return remote
+	}
+
+	var forwarded []string
+	for _, header := range request.Header[http.CanonicalHeaderKey("X-Forwarded-For")] {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for index := len(forwarded) - 1; index >= 0; index-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[index]))
+		if hop == nil {
+			// a malformed address, the hops before it can't be trusted
+			break
+		}
+		remote = hop.String()
+		if !tp.trusts(hop) {
+			break
+		}
+	}
+	return remote
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/auth"
+
+	config "github.com/spf13/viper"
+)
+
+// RateLimiting - how the requests of clients are limited
+type RateLimiting struct {
+	// Limiter - the buckets of the clients, nil when rateLimit.enabled is false
+	Limiter *Limiter
+	Policy  Policy
+	// TrustedProxies - the proxies whose X-Forwarded-For headers name the clients of requests
+	TrustedProxies TrustedProxies
+	// Quotas - the daily write quotas, nil when quotas.enabled is false
+	Quotas *Quotas
+}
+
+// routeConfig - a route of the rateLimit.routes configuration section, or the rateLimit.default section
+type routeConfig struct {
+	Requests int              `mapstructure:"requests"`
+	Per      time.Duration    `mapstructure:"per"`
+	Burst    int              `mapstructure:"burst"`
+	Roles    map[string]Limit `mapstructure:"roles"`
+}
+
+//LoadRateLimiting - build the rate limits from the "rateLimit" configuration section and the daily write quotas
+//from the "quotas" configuration section, quota usage is counted in the given repository.
+//Returns nil when both are disabled.
+func LoadRateLimiting(quotas QuotaRepository) (*RateLimiting, error) {
+	rateLimiting := &RateLimiting{}
+
+	if config.GetBool("rateLimit.enabled") {
+		policy, err := loadPolicy()
+		if err != nil {
+			return nil, err
+		}
+		rateLimiting.Limiter, rateLimiting.Policy = NewLimiter(), policy
+	}
+
+	trustedProxies, err := LoadTrustedProxies()
+	if err != nil {
+		return nil, err
+	}
+	rateLimiting.TrustedProxies = trustedProxies
+
+	if config.GetBool("quotas.enabled") {
+		policy, err := loadQuotaPolicy()
+		if err != nil {
+			return nil, err
+		}
+		rateLimiting.Quotas = NewQuotas(quotas, policy)
+	}
+
+	if rateLimiting.Limiter == nil && rateLimiting.Quotas == nil {
+		return nil, nil
+	}
+	return rateLimiting, nil
+}
+
+//LoadTrustedProxies - the proxies of the rateLimit.trustedProxies configuration list
+func LoadTrustedProxies() (TrustedProxies, error) {
+	trustedProxies, err := ParseTrustedProxies(config.GetStringSlice("rateLimit.trustedProxies"))
+	if err != nil {
+		return nil, errors.Wrap(err, "rateLimit.trustedProxies")
+	}
+	return trustedProxies, nil
+}
+
+func loadPolicy() (Policy, error) {
+	var defaultConfig routeConfig
+	if err := config.UnmarshalKey("rateLimit.default", &defaultConfig); err != nil {
+		return Policy{}, errors.Wrap(err, "rateLimit.default")
+	}
+	defaultPolicy, err := defaultConfig.policy()
+	if err != nil {
+		return Policy{}, errors.Wrap(err, "rateLimit.default")
+	}
+
+	var routeConfigs map[string]routeConfig
+	if err := config.UnmarshalKey("rateLimit.routes", &routeConfigs); err != nil {
+		return Policy{}, errors.Wrap(err, "rateLimit.routes")
+	}
+	routes := make(map[string]RoutePolicy)
+	for name, routeConfig := range routeConfigs {
+		// configuration keys are case insensitive, methods are matched in upper case
+		fields := strings.Fields(name)
+		if len(fields) != 2 {
+			return Policy{}, fmt.Errorf("rateLimit.routes: %q is not a \"<METHOD> <path template>\" route", name)
+		}
+		routePolicy, err := routeConfig.policy()
+		if err != nil {
+			return Policy{}, errors.Wrapf(err, "rateLimit.routes.%s", name)
+		}
+		routes[RouteName(fields[0], fields[1])] = routePolicy
+	}
+
+	return Policy{Default: defaultPolicy, Routes: routes}, nil
+}
+
+func (rc routeConfig) policy() (RoutePolicy, error) {
+	policy := RoutePolicy{Limit: Limit{Requests: rc.Requests, Per: rc.Per, Burst: rc.Burst}, Roles: make(map[auth.Role]Limit)}
+	if !policy.Limit.valid() {
+		return RoutePolicy{}, errors.New("requests and per must be positive and burst must not be negative")
+	}
+
+	for name, limit := range rc.Roles {
+		role, ok := auth.ParseRole(name)
+		if !ok {
+			return RoutePolicy{}, fmt.Errorf("roles: unknown role %q", name)
+		}
+		if !limit.valid() {
+			return RoutePolicy{}, fmt.Errorf("roles.%s: requests and per must be positive and burst must not be negative", name)
+		}
+		policy.Roles[role] = limit
+	}
+	return policy, nil
+}
+
+func loadQuotaPolicy() (QuotaPolicy, error) {
+	policy := QuotaPolicy{WritesPerDay: config.GetInt("quotas.writesPerDay"), Roles: make(map[auth.Role]int)}
+	if policy.WritesPerDay < 0 {
+		return QuotaPolicy{}, errors.New("quotas.writesPerDay must not be negative")
+	}
+
+	for name := range config.GetStringMap("quotas.roles") {
+		role, ok := auth.ParseRole(name)
+		if !ok {
+			return QuotaPolicy{}, fmt.Errorf("quotas.roles: unknown role %q", name)
+		}
+		writesPerDay := config.GetInt("quotas.roles." + name)
+		if writesPerDay < 0 {
+			return QuotaPolicy{}, fmt.Errorf("quotas.roles.%s must not be negative", name)
+		}
+		policy.Roles[role] = writesPerDay
+	}
+	return policy, nil
+}
+
+// RouteName - the name routes are configured by, "<METHOD> <path template>"
+func RouteName(method string, pathTemplate string) string {
+	return strings.ToUpper(method) + " " + pathTemplate
+}
@@ -0,0 +1,12 @@
+package ratelimit
+
+//Error - a rate limiting error type
+type Error string
+
+//Error - implemenation of Error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+//ErrorQuotaExceeded - the principal used all the writes of its daily quota
+const ErrorQuotaExceeded = Error("Daily write quota exceeded")
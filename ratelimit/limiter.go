@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit - the rate requests are allowed at, a token bucket holding Burst tokens that refills Requests tokens every Per
+type Limit struct {
+	Requests int           `mapstructure:"requests"`
+	Per      time.Duration `mapstructure:"per"`
+	// Burst - the requests allowed at once, Requests when 0
+	Burst int `mapstructure:"burst"`
+}
+
+// rate - the tokens added to the bucket per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// capacity - the tokens the bucket holds when full
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// valid - reports if the limit allows any request
+func (l Limit) valid() bool {
+	return l.Requests > 0 && l.Per > 0 && l.Burst >= 0
+}
+
+// Decision - the outcome of taking a token from a bucket
+type Decision struct {
+	Allowed bool
+	// Limit - the capacity of the bucket
+	Limit int
+	// Remaining - the whole tokens left in the bucket
+	Remaining int
+	// Reset - the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter - the time until the next token is added when the request is not allowed
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// sweepInterval - how often buckets that refilled completely are dropped
+const sweepInterval = time.Minute
+
+// Limiter - the token buckets of all the clients, buckets are created on first use
+type Limiter struct {
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+//NewLimiter - return a limiter without buckets
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket)}
+}
+
+// Allow - takes a token from the bucket of the key, the bucket is refilled according to the limit first.
+// A bucket whose limit changed is refilled according to the new limit.
+func (l *Limiter) Allow(key string, limit Limit, now time.Time) Decision {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+
+	capacity := limit.capacity()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now, limit: limit}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed.Seconds()*limit.rate())
+		b.last = now
+	}
+	b.tokens = math.Min(capacity, b.tokens)
+	b.limit = limit
+
+	decision := Decision{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = seconds((1 - b.tokens) / limit.rate())
+	}
+	decision.Remaining = int(b.tokens)
+	decision.Reset = seconds((capacity - b.tokens) / limit.rate())
+	return decision
+}
+
+// sweep - drops the buckets that are full by now, must be called while holding the lock
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.rate() >= b.limit.capacity() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// seconds - the duration of the given number of seconds
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"github.com/shauera/messages/auth"
+)
+
+// RoutePolicy - the limits of a route, by the role of the client
+type RoutePolicy struct {
+	Limit Limit
+	Roles map[auth.Role]Limit
+}
+
+// Policy - the limits of clients, a route has limits of its own or shares the default limits with the other routes
+type Policy struct {
+	Default RoutePolicy
+	// Routes - the routes with limits of their own, by "<METHOD> <path template>" (e.g. "POST /messages")
+	Routes map[string]RoutePolicy
+}
+
+// defaultBucket - the bucket of all the routes without limits of their own
+const defaultBucket = "default"
+
+// LimitOf - returns the name of the bucket and the limit of a request of the route made by a client of the roles.
+// Clients of several roles get the most generous limit of their roles.
+func (p Policy) LimitOf(route string, roles []auth.Role) (string, Limit) {
+	bucketName, routePolicy := defaultBucket, p.Default
+	if policy, ok := p.Routes[route]; ok {
+		bucketName, routePolicy = route, policy
+	}
+
+	limit, found := routePolicy.Limit, false
+	for _, role := range roles {
+		roleLimit, ok := routePolicy.Roles[role]
+		if !ok {
+			roleLimit, ok = p.Default.Roles[role]
+		}
+		if ok && (!found || roleLimit.rate() > limit.rate()) {
+			limit, found = roleLimit, true
+		}
+	}
+	return bucketName, limit
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/persistence"
+)
+
+// QuotaRepository - abstraction of the storage of quota usage, usage is stored so it is kept across restarts
+type QuotaRepository interface {
+	// IncrementQuota - atomically counts a use of the quota of the given id and returns the count,
+	// persistence.ErrorConflict is returned without counting when the count reached the limit
+	IncrementQuota(ctx context.Context, id string, limit int, expiresAt time.Time) (int, error)
+	// DecrementQuota - atomically takes back a use of the quota of the given id, a count of 0 is kept
+	DecrementQuota(ctx context.Context, id string) error
+}
+
+// QuotaPolicy - the daily writes allowed to principals, 0 allows unlimited writes
+type QuotaPolicy struct {
+	WritesPerDay int
+	// Roles - the writes allowed to principals of the role instead of WritesPerDay
+	Roles map[auth.Role]int
+}
+
+// LimitOf - the daily writes allowed to a principal of the roles, principals of several roles get the most generous quota
+func (qp QuotaPolicy) LimitOf(roles []auth.Role) int {
+	limit, found := qp.WritesPerDay, false
+	for _, role := range roles {
+		roleLimit, ok := qp.Roles[role]
+		if !ok {
+			continue
+		}
+		if roleLimit == 0 {
+			return 0
+		}
+		if !found || roleLimit > limit {
+			limit, found = roleLimit, true
+		}
+	}
+	return limit
+}
+
+// QuotaUsage - the state of the daily quota of a principal after a write
+type QuotaUsage struct {
+	Limit     int
+	Remaining int
+	// Reset - the time the quota is renewed at, midnight UTC
+	Reset time.Time
+}
+
+// Quotas - counts the daily writes of principals
+type Quotas struct {
+	repository QuotaRepository
+	policy     QuotaPolicy
+	now        func() time.Time
+}
+
+//NewQuotas - return the quotas of the policy, counted in the given repository
+func NewQuotas(repository QuotaRepository, policy QuotaPolicy) *Quotas {
+	return &Quotas{repository: repository, policy: policy, now: time.Now}
+}
+
+// Write - counts a write of the principal against its daily quota.
+// ErrorQuotaExceeded is returned when the principal used all the writes of the day.
+// A zero usage is returned when the principal has no quota.
+func (q *Quotas) Write(ctx context.Context, principal auth.Principal) (QuotaUsage, error) {
+	limit := q.policy.LimitOf(principal.Roles)
+	if limit == 0 {
+		return QuotaUsage{}, nil
+	}
+
+	now := q.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	usage := QuotaUsage{Limit: limit, Reset: day.AddDate(0, 0, 1)}
+
+	// usage is kept a day longer so clocks of several instances that are slightly apart agree
+	count, err := q.repository.IncrementQuota(ctx, quotaID(principal, day), limit, usage.Reset.AddDate(0, 0, 1))
+	if errors.Cause(err) == persistence.ErrorConflict {
+		return usage, ErrorQuotaExceeded
+	}
+	if err != nil {
+		return usage, err
+	}
+
+	usage.Remaining = limit - count
+	return usage, nil
+}
+
+// Refund - takes back a write counted by Write that was not made, usage is the usage Write returned.
+// The write is taken back from the day it was counted on, even when the quota was renewed since.
+func (q *Quotas) Refund(ctx context.Context, principal auth.Principal, usage QuotaUsage) error {
+	if usage.Limit == 0 {
+		return nil
+	}
+	return q.repository.DecrementQuota(ctx, quotaID(principal, usage.Reset.AddDate(0, 0, -1)))
+}
+
+// quotaID - the id of the usage of the principal on the day
+func quotaID(principal auth.Principal, day time.Time) string {
+	return principal.Method + ":" + principal.Subject + "|" + day.Format("2006-01-02")
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter()
+	now := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	limit := Limit{Requests: 1, Per: time.Second, Burst: 2}
+
+	assert.Equal(t, Decision{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, limiter.Allow("client", limit, now))
+	assert.Equal(t, Decision{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Second}, limiter.Allow("client", limit, now))
+	assert.Equal(t, Decision{Allowed: false, Limit: 2, Remaining: 0, Reset: 2 * time.Second, RetryAfter: time.Second}, limiter.Allow("client", limit, now))
+	assert.True(t, limiter.Allow("other client", limit, now).Allowed, "clients have buckets of their own")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, limiter.Allow("client", limit, now).RetryAfter)
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, limiter.Allow("client", limit, now).Allowed)
+
+	// full buckets are dropped
+	now = now.Add(sweepInterval)
+	limiter.Allow("client", limit, now)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestPolicy(t *testing.T) {
+	defaultLimit := Limit{Requests: 10, Per: time.Minute}
+	adminLimit := Limit{Requests: 100, Per: time.Minute}
+	createLimit := Limit{Requests: 2, Per: time.Minute}
+	editorCreateLimit := Limit{Requests: 5, Per: time.Minute}
+	policy := Policy{
+		Default: RoutePolicy{Limit: defaultLimit, Roles: map[auth.Role]Limit{auth.RoleAdmin: adminLimit}},
+		Routes: map[string]RoutePolicy{
+			"POST /messages": {Limit: createLimit, Roles: map[auth.Role]Limit{auth.RoleEditor: editorCreateLimit}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		route  string
+		roles  []auth.Role
+		bucket string
+		limit  Limit
+	}{
+		{"default", "GET /messages", []auth.Role{auth.RoleReader}, defaultBucket, defaultLimit},
+		{"default role", "GET /messages", []auth.Role{auth.RoleAdmin}, defaultBucket, adminLimit},
+		{"route", "POST /messages", nil, "POST /messages", createLimit},
+		{"route role", "POST /messages", []auth.Role{auth.RoleEditor}, "POST /messages", editorCreateLimit},
+		{"default role of route", "POST /messages", []auth.Role{auth.RoleAdmin}, "POST /messages", adminLimit},
+		{"most generous role", "POST /messages", []auth.Role{auth.RoleEditor, auth.RoleAdmin}, "POST /messages", adminLimit},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bucket, limit := policy.LimitOf(test.route, test.roles)
+			assert.Equal(t, test.bucket, bucket)
+			assert.Equal(t, test.limit, limit)
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	assert.NoError(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/99"})
+	assert.Error(t, err)
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  string
+		expectedValue string
+	}{
+		{"direct", "203.0.113.7:4242", "", "203.0.113.7"},
+		{"untrusted proxy", "203.0.113.7:4242", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:4242", "198.51.100.1", "198.51.100.1"},
+		{"trusted proxies", "10.1.2.3:4242", "198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"spoofed hops", "10.1.2.3:4242", "1.1.1.1, 198.51.100.1", "198.51.100.1"},
+		{"malformed hop", "10.1.2.3:4242", "1.1.1.1, junk", "10.1.2.3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/messages", nil)
+			request.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				request.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			assert.Equal(t, test.expectedValue, trustedProxies.ClientIP(request))
+		})
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	repository, _ := persistence.NewMemoryRepository()
+	quotas := NewQuotas(repository, QuotaPolicy{WritesPerDay: 2, Roles: map[auth.Role]int{auth.RoleAdmin: 0}})
+	quotas.now = func() time.Time { return now }
+	principal := auth.Principal{Subject: "will", Roles: []auth.Role{auth.RoleEditor}, Method: auth.MethodJWT}
+	midnight := time.Date(2019, time.June, 2, 0, 0, 0, 0, time.UTC)
+
+	usage, err := quotas.Write(ctx, principal)
+	assert.NoError(t, err)
+	assert.Equal(t, QuotaUsage{Limit: 2, Remaining: 1, Reset: midnight}, usage)
+	assert.NoError(t, quotas.Refund(ctx, principal, usage))
+	quotas.Write(ctx, principal)
+	usage, _ = quotas.Write(ctx, principal)
+	assert.Equal(t, 0, usage.Remaining, "refunded writes are not counted")
+	_, err = quotas.Write(ctx, principal)
+	assert.Equal(t, ErrorQuotaExceeded, err)
+
+	usage, err = quotas.Write(ctx, auth.Principal{Subject: "admin", Roles: []auth.Role{auth.RoleEditor, auth.RoleAdmin}, Method: auth.MethodJWT})
+	assert.NoError(t, err)
+	assert.Equal(t, QuotaUsage{}, usage, "admins have no quota")
+
+	now = midnight
+	_, err = quotas.Write(ctx, principal)
+	assert.NoError(t, err, "quotas are renewed daily")
+	assert.NoError(t, quotas.Refund(ctx, principal, usage))
+	_, err = quotas.Write(ctx, principal)
+	assert.NoError(t, err, "refunds of the previous day do not change the quota of the day")
+	_, err = quotas.Write(ctx, principal)
+	assert.Equal(t, ErrorQuotaExceeded, err)
+}
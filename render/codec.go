@@ -0,0 +1,167 @@
+package render
+
+import (
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Error - a render error type
+type Error string
+
+//Error - implemenation of Error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+//ErrorNotAcceptable - none of the accepted media types can represent the response
+const ErrorNotAcceptable = Error("Not acceptable")
+
+//ErrorUnsupportedMediaType - the request body media type can't be decoded
+const ErrorUnsupportedMediaType = Error("Unsupported media type")
+
+// Codec - encodes responses to and decodes requests from a media type
+type Codec interface {
+	// MediaTypes - the media types handled by the codec, the first one is used in responses
+	MediaTypes() []string
+	// CanEncode - reports if the codec can represent the value
+	CanEncode(value interface{}) bool
+	// Encode - write the value, name is the element name used by formats that need one
+	Encode(w io.Writer, name string, value interface{}) error
+	// Decode - read the request body into target
+	Decode(r io.Reader, target interface{}) error
+}
+
+// ListEncoder - implemented by codecs that can write a list one item at a time
+type ListEncoder interface {
+	// NewListWriter - returns a writer of the list items to w, name is the element name of the list
+	NewListWriter(w io.Writer, name string) ListWriter
+}
+
+// ListWriter - writes the items of a list as they come
+type ListWriter interface {
+	// WriteItem - write the next item of the list
+	WriteItem(value interface{}) error
+	// Close - write the end of the list, must be called after the last item
+	Close() error
+}
+
+// Registry - the codecs available for content negotiation
+type Registry struct {
+	codecs []Codec
+}
+
+//NewRegistry - return a registry of the given codecs, the first codec is the default one
+func NewRegistry(codecs ...Codec) *Registry {
+	return &Registry{codecs: codecs}
+}
+
+// Default - the registry shared by all the controllers
+var Default = NewRegistry(JSON{}, XML{}, YAML{}, CSV{}, MessagePack{}, NDJSON{})
+
+// MediaTypes - the response media types of all the codecs in the registry
+func (r *Registry) MediaTypes() []string {
+	mediaTypes := make([]string, 0, len(r.codecs))
+	for _, codec := range r.codecs {
+		mediaTypes = append(mediaTypes, codec.MediaTypes()[0])
+	}
+	return mediaTypes
+}
+
+// Negotiate - return the codec best matching the Accept header that can represent the value
+func (r *Registry) Negotiate(accept string, value interface{}) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		for _, codec := range r.codecs {
+			if codec.CanEncode(value) && matches(codec, mediaRange.mediaType) {
+				return codec, nil
+			}
+		}
+	}
+
+	return nil, ErrorNotAcceptable
+}
+
+// ForContentType - return the codec decoding the given Content-Type header.
+// Requests without a content type are taken as JSON (the default codec).
+func (r *Registry) ForContentType(contentType string) (Codec, error) {
+	if strings.TrimSpace(contentType) == "" {
+		return r.codecs[0], nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrorUnsupportedMediaType
+	}
+	for _, codec := range r.codecs {
+		for _, codecMediaType := range codec.MediaTypes() {
+			if codecMediaType == mediaType {
+				return codec, nil
+			}
+		}
+	}
+
+	return nil, ErrorUnsupportedMediaType
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept - the acceptable media ranges ordered by preference, ranges with q=0 are left out
+func parseAccept(accept string) []mediaRange {
+	var mediaRanges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			mediaRanges = append(mediaRanges, mediaRange{mediaType: mediaType, quality: quality})
+		}
+	}
+
+	// higher quality first, then more specific ranges first, otherwise keep the client's order
+	sort.SliceStable(mediaRanges, func(i, j int) bool {
+		if mediaRanges[i].quality != mediaRanges[j].quality {
+			return mediaRanges[i].quality > mediaRanges[j].quality
+		}
+		return strings.Count(mediaRanges[i].mediaType, "*") < strings.Count(mediaRanges[j].mediaType, "*")
+	})
+
+	return mediaRanges
+}
+
+func matches(codec Codec, mediaRange string) bool {
+	if mediaRange == "*/*" {
+		return true
+	}
+	for _, mediaType := range codec.MediaTypes() {
+		if mediaType == mediaRange {
+			return true
+		}
+		if strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isList - reports if the value is a slice or an array
+func isList(value interface{}) bool {
+	kind := reflect.ValueOf(value).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
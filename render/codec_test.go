@@ -0,0 +1,207 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	Name   string     `json:"name"`
+	Count  int        `json:"count"`
+	Ratio  float64    `json:"ratio,omitempty"`
+	Nested *testItem  `json:"nested,omitempty"`
+	Tags   []string   `json:"tags,omitempty"`
+	Items  []testItem `json:"items,omitempty"`
+}
+
+func TestNegotiate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		accept    string
+		value     interface{}
+		mediaType string
+		err       error
+	}{
+		{name: "no accept header", accept: "", value: testItem{}, mediaType: "application/json"},
+		{name: "any media type", accept: "*/*", value: testItem{}, mediaType: "application/json"},
+		{name: "exact media type", accept: "application/msgpack", value: testItem{}, mediaType: "application/msgpack"},
+		{name: "alias media type", accept: "text/xml", value: testItem{}, mediaType: "application/xml"},
+		{name: "quality", accept: "application/xml;q=0.2, application/yaml;q=0.8", value: testItem{}, mediaType: "application/yaml"},
+		{name: "specific before wildcard", accept: "text/*, text/csv", value: []testItem{}, mediaType: "text/csv"},
+		{name: "wildcard subtype", accept: "text/*", value: testItem{}, mediaType: "application/xml"},
+		{name: "csv needs a list", accept: "text/csv", value: testItem{}, err: ErrorNotAcceptable},
+		{name: "ndjson list", accept: "application/x-ndjson", value: []testItem{}, mediaType: "application/x-ndjson"},
+		{name: "ndjson needs a list", accept: "application/x-ndjson", value: testItem{}, err: ErrorNotAcceptable},
+		{name: "csv needs a list, fallback", accept: "text/csv, */*;q=0.1", value: testItem{}, mediaType: "application/json"},
+		{name: "q=0 is not acceptable", accept: "application/json;q=0", value: testItem{}, err: ErrorNotAcceptable},
+		{name: "unknown media type", accept: "image/png", value: testItem{}, err: ErrorNotAcceptable},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			codec, err := Default.Negotiate(testCase.accept, testCase.value)
+			assert.Equal(t, testCase.err, err)
+			if testCase.err == nil {
+				assert.Equal(t, testCase.mediaType, codec.MediaTypes()[0])
+			}
+		})
+	}
+}
+
+func TestForContentType(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		mediaType   string
+		err         error
+	}{
+		{contentType: "", mediaType: "application/json"},
+		{contentType: "application/json; charset=utf-8", mediaType: "application/json"},
+		{contentType: "application/x-yaml", mediaType: "application/yaml"},
+		{contentType: "application/x-msgpack", mediaType: "application/msgpack"},
+		{contentType: "text/plain", err: ErrorUnsupportedMediaType},
+		{contentType: ";;", err: ErrorUnsupportedMediaType},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.contentType, func(t *testing.T) {
+			codec, err := Default.ForContentType(testCase.contentType)
+			assert.Equal(t, testCase.err, err)
+			if testCase.err == nil {
+				assert.Equal(t, testCase.mediaType, codec.MediaTypes()[0])
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	value := []testItem{
+		{Name: "a", Count: 1, Tags: []string{"x", "y"}},
+		{Name: "b & c", Count: -2, Ratio: 0.5, Nested: &testItem{Name: "n"}},
+	}
+
+	testCases := []struct {
+		codec    Codec
+		expected string
+	}{
+		{
+			codec:    JSON{},
+			expected: `[{"name":"a","count":1,"tags":["x","y"]},{"name":"b \u0026 c","count":-2,"ratio":0.5,"nested":{"name":"n","count":0}}]` + "\n",
+		},
+		{
+			codec: XML{},
+			expected: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<items><item><name>a</name><count>1</count><tags><tag>x</tag><tag>y</tag></tags></item>` +
+				`<item><name>b &amp; c</name><count>-2</count><ratio>0.5</ratio><nested><name>n</name><count>0</count></nested></item></items>` + "\n",
+		},
+		{
+			codec: YAML{},
+			expected: "- name: a\n  count: 1\n  tags:\n  - x\n  - \"y\"\n" +
+				"- name: b & c\n  count: -2\n  ratio: 0.5\n  nested:\n    name: \"n\"\n    count: 0\n",
+		},
+		{
+			codec:    NDJSON{},
+			expected: `{"name":"a","count":1,"tags":["x","y"]}` + "\n" + `{"name":"b \u0026 c","count":-2,"ratio":0.5,"nested":{"name":"n","count":0}}` + "\n",
+		},
+		{
+			codec:    CSV{},
+			expected: "name,count,tags,ratio,nested.name,nested.count\na,1,\"[\"\"x\"\",\"\"y\"\"]\",,,\nb & c,-2,,0.5,n,0\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.codec.MediaTypes()[0], func(t *testing.T) {
+			var buffer bytes.Buffer
+			assert.NoError(t, testCase.codec.Encode(&buffer, "items", value))
+			assert.Equal(t, testCase.expected, buffer.String())
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	value := testItem{
+		Name:   strings.Repeat("long ", 60),
+		Count:  -70000,
+		Ratio:  1.25,
+		Nested: &testItem{Name: "nested", Count: 300},
+		Items:  []testItem{{Name: "1"}, {Name: "2", Count: 127}},
+	}
+
+	for _, codec := range []Codec{JSON{}, XML{}, YAML{}, MessagePack{}} {
+		t.Run(codec.MediaTypes()[0], func(t *testing.T) {
+			var buffer bytes.Buffer
+			assert.NoError(t, codec.Encode(&buffer, "item", value))
+
+			var decoded testItem
+			err := codec.Decode(&buffer, &decoded)
+			if _, isXML := codec.(XML); isXML {
+				// XML has no types, numbers are decoded as strings
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, value, decoded)
+		})
+	}
+}
+
+func TestMessagePackEncoding(t *testing.T) {
+	var buffer bytes.Buffer
+	assert.NoError(t, MessagePack{}.Encode(&buffer, "", map[string]interface{}{"a": []interface{}{1, -1, true, nil, "b"}}))
+	assert.Equal(t, []byte{0x81, 0xa1, 'a', 0x95, 0x01, 0xff, 0xc3, 0xc0, 0xa1, 'b'}, buffer.Bytes())
+}
+
+func TestDecodeEmptyBody(t *testing.T) {
+	for _, codec := range []Codec{XML{}, YAML{}, MessagePack{}} {
+		var decoded testItem
+		assert.EqualError(t, codec.Decode(strings.NewReader(" "), &decoded), "EOF")
+	}
+}
+
+func TestCSVFormulas(t *testing.T) {
+	value := []testItem{
+		{Name: "=HYPERLINK(\"http://example.com\")", Count: -2},
+		{Name: "+1", Tags: []string{"@x"}},
+		{Name: "-1"},
+		{Name: "@SUM(A1)"},
+		{Name: "\tcell"},
+		{Name: "\rcell"},
+		{Name: "a = b"},
+	}
+
+	var buffer bytes.Buffer
+	assert.NoError(t, CSV{}.Encode(&buffer, "items", value))
+	assert.Equal(t, "name,count,tags\n"+
+		"\"'=HYPERLINK(\"\"http://example.com\"\")\",-2,\n"+
+		"'+1,0,\"[\"\"@x\"\"]\"\n"+
+		"'-1,0,\n"+
+		"'@SUM(A1),0,\n"+
+		"'\tcell,0,\n"+
+		"\"'\rcell\",0,\n"+
+		"a = b,0,\n", buffer.String())
+}
+
+func TestListWriter(t *testing.T) {
+	testCases := []struct {
+		codec    ListEncoder
+		items    []interface{}
+		expected string
+	}{
+		{codec: JSON{}, items: nil, expected: "null\n"},
+		{codec: JSON{}, items: []interface{}{testItem{Name: "a"}, 2}, expected: `[{"name":"a","count":0},2]` + "\n"},
+		{codec: NDJSON{}, items: nil, expected: ""},
+		{codec: NDJSON{}, items: []interface{}{testItem{Name: "a"}, 2}, expected: `{"name":"a","count":0}` + "\n2\n"},
+	}
+
+	for _, testCase := range testCases {
+		var buffer bytes.Buffer
+		listWriter := testCase.codec.NewListWriter(&buffer, "items")
+		for _, item := range testCase.items {
+			assert.NoError(t, listWriter.WriteItem(item))
+		}
+		assert.NoError(t, listWriter.Close())
+		assert.Equal(t, testCase.expected, buffer.String())
+	}
+}
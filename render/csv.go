@@ -0,0 +1,103 @@
+package render
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// CSV - text/csv codec, lists only.
+// Every object in the list is a row, the header holds the union of their members
+// in order of appearance. Nested objects are flattened with dot separated names.
+// Strings that spreadsheets would take as formulas are prefixed with a quote, see escapeFormula.
+type CSV struct{}
+
+// formulaPrefixes - the first characters that make spreadsheets evaluate a cell as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// MediaTypes - implementation of Codec
+func (CSV) MediaTypes() []string {
+	return []string{"text/csv"}
+}
+
+// CanEncode - implementation of Codec
+func (CSV) CanEncode(value interface{}) bool {
+	return isList(value)
+}
+
+// Encode - implementation of Codec
+func (CSV) Encode(w io.Writer, name string, value interface{}) error {
+	tree, err := toTree(value)
+	if err != nil {
+		return err
+	}
+	items, _ := tree.([]interface{})
+
+	var columns []string
+	seen := make(map[string]bool)
+	rows := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		row := make(map[string]string)
+		flatten("", item, row, func(column string) {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		})
+		rows = append(rows, row)
+	}
+
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for index, column := range columns {
+			record[index] = row[column]
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// Decode - implementation of Codec, CSV request bodies are not supported
+func (CSV) Decode(r io.Reader, target interface{}) error {
+	return ErrorUnsupportedMediaType
+}
+
+func flatten(prefix string, value interface{}, row map[string]string, addColumn func(string)) {
+	if members, ok := value.(object); ok {
+		for _, m := range members {
+			column := m.Key
+			if prefix != "" {
+				column = prefix + "." + m.Key
+			}
+			flatten(column, m.Value, row, addColumn)
+		}
+		return
+	}
+
+	if prefix == "" {
+		prefix = "value"
+	}
+	addColumn(prefix)
+	if text, ok := value.(string); ok {
+		row[prefix] = escapeFormula(text)
+		return
+	}
+	row[prefix] = scalarText(value)
+}
+
+// escapeFormula - prefixes strings starting like a formula with a quote, so user submitted values
+// such as =HYPERLINK(...) are shown as text when the list is opened in a spreadsheet. Numbers are not
+// escaped, a negative number is not a formula.
+func escapeFormula(text string) string {
+	if text != "" && strings.IndexByte(formulaPrefixes, text[0]) >= 0 {
+		return "'" + text
+	}
+	return text
+}
@@ -0,0 +1,64 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSON - application/json codec
+type JSON struct{}
+
+// MediaTypes - implementation of Codec
+func (JSON) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+// CanEncode - implementation of Codec
+func (JSON) CanEncode(value interface{}) bool {
+	return true
+}
+
+// Encode - implementation of Codec
+func (JSON) Encode(w io.Writer, name string, value interface{}) error {
+	return json.NewEncoder(w).Encode(value)
+}
+
+// Decode - implementation of Codec
+func (JSON) Decode(r io.Reader, target interface{}) error {
+	return json.NewDecoder(r).Decode(target)
+}
+
+// NewListWriter - implementation of ListEncoder, the items are written as a JSON array.
+// An empty list is written as null, the same as encoding a nil slice.
+func (JSON) NewListWriter(w io.Writer, name string) ListWriter {
+	return &jsonListWriter{w: w}
+}
+
+type jsonListWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (jw *jsonListWriter) WriteItem(value interface{}) error {
+	separator := ","
+	if jw.count == 0 {
+		separator = "["
+	}
+	jw.count++
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = jw.w.Write(append([]byte(separator), data...))
+	return err
+}
+
+func (jw *jsonListWriter) Close() error {
+	end := "]\n"
+	if jw.count == 0 {
+		end = "null\n"
+	}
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
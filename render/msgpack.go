@@ -0,0 +1,261 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MessagePack - application/msgpack codec (https://github.com/msgpack/msgpack/blob/master/spec.md)
+type MessagePack struct{}
+
+// MediaTypes - implementation of Codec
+func (MessagePack) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack"}
+}
+
+// CanEncode - implementation of Codec
+func (MessagePack) CanEncode(value interface{}) bool {
+	return true
+}
+
+// Encode - implementation of Codec
+func (MessagePack) Encode(w io.Writer, name string, value interface{}) error {
+	tree, err := toTree(value)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(w)
+	if err := encodeMessagePack(writer, tree); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+func encodeMessagePack(w *bufio.Writer, value interface{}) error {
+	switch typedValue := value.(type) {
+	case nil:
+		return w.WriteByte(0xc0)
+	case bool:
+		if typedValue {
+			return w.WriteByte(0xc3)
+		}
+		return w.WriteByte(0xc2)
+	case json.Number:
+		if integer, err := typedValue.Int64(); err == nil {
+			return encodeMessagePackInt(w, integer)
+		}
+		float, err := typedValue.Float64()
+		if err != nil {
+			return err
+		}
+		w.WriteByte(0xcb)
+		return binary.Write(w, binary.BigEndian, math.Float64bits(float))
+	case string:
+		length := len(typedValue)
+		switch {
+		case length < 32:
+			w.WriteByte(0xa0 | byte(length))
+		case length <= math.MaxUint8:
+			w.Write([]byte{0xd9, byte(length)})
+		case length <= math.MaxUint16:
+			w.WriteByte(0xda)
+			binary.Write(w, binary.BigEndian, uint16(length))
+		default:
+			w.WriteByte(0xdb)
+			binary.Write(w, binary.BigEndian, uint32(length))
+		}
+		_, err := w.WriteString(typedValue)
+		return err
+	case []interface{}:
+		writeMessagePackLength(w, len(typedValue), 0x90, 0xdc, 0xdd)
+		for _, item := range typedValue {
+			if err := encodeMessagePack(w, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case object:
+		writeMessagePackLength(w, len(typedValue), 0x80, 0xde, 0xdf)
+		for _, m := range typedValue {
+			if err := encodeMessagePack(w, m.Key); err != nil {
+				return err
+			}
+			if err := encodeMessagePack(w, m.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("msgpack: can't encode %T", value)
+}
+
+func encodeMessagePackInt(w *bufio.Writer, integer int64) error {
+	switch {
+	case integer >= 0 && integer <= 0x7f:
+		return w.WriteByte(byte(integer))
+	case integer < 0 && integer >= -32:
+		return w.WriteByte(byte(integer))
+	case integer >= math.MinInt32 && integer <= math.MaxInt32:
+		w.WriteByte(0xd2)
+		return binary.Write(w, binary.BigEndian, int32(integer))
+	}
+	w.WriteByte(0xd3)
+	return binary.Write(w, binary.BigEndian, integer)
+}
+
+// writeMessagePackLength - write the header of a map or an array of the given length
+func writeMessagePackLength(w *bufio.Writer, length int, fix, header16, header32 byte) {
+	switch {
+	case length < 16:
+		w.WriteByte(fix | byte(length))
+	case length <= math.MaxUint16:
+		w.WriteByte(header16)
+		binary.Write(w, binary.BigEndian, uint16(length))
+	default:
+		w.WriteByte(header32)
+		binary.Write(w, binary.BigEndian, uint32(length))
+	}
+}
+
+// Decode - implementation of Codec
+func (MessagePack) Decode(r io.Reader, target interface{}) error {
+	data, err := readAll(r)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	value, err := decodeMessagePack(reader)
+	if err != nil {
+		return err
+	}
+	return decodeInto(value, target)
+}
+
+var errMessagePackUnsupported = errors.New("msgpack: unsupported type")
+
+func decodeMessagePack(r *bufio.Reader) (interface{}, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case header <= 0x7f:
+		return int64(header), nil
+	case header >= 0xe0:
+		return int64(int8(header)), nil
+	case header&0xf0 == 0x80:
+		return decodeMessagePackMap(r, int(header&0x0f))
+	case header&0xf0 == 0x90:
+		return decodeMessagePackArray(r, int(header&0x0f))
+	case header&0xe0 == 0xa0:
+		return readMessagePackString(r, int(header&0x1f))
+	}
+
+	switch header {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		var bits uint32
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return float64(math.Float32frombits(bits)), err
+	case 0xcb:
+		var bits uint64
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		var integer uint64
+		err := readMessagePackNumber(r, 1<<(header-0xcc), &integer)
+		return integer, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		var integer uint64
+		size := 1 << (header - 0xd0)
+		err := readMessagePackNumber(r, size, &integer)
+		// sign extend
+		shift := uint(64 - 8*size)
+		return int64(integer<<shift) >> shift, err
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		var length uint64
+		size := map[byte]int{0xd9: 1, 0xda: 2, 0xdb: 4, 0xc4: 1, 0xc5: 2, 0xc6: 4}[header]
+		if err := readMessagePackNumber(r, size, &length); err != nil {
+			return nil, err
+		}
+		return readMessagePackString(r, int(length))
+	case 0xdc, 0xdd:
+		var length uint64
+		if err := readMessagePackNumber(r, 2<<(header-0xdc), &length); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackArray(r, int(length))
+	case 0xde, 0xdf:
+		var length uint64
+		if err := readMessagePackNumber(r, 2<<(header-0xde), &length); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackMap(r, int(length))
+	}
+
+	return nil, errMessagePackUnsupported
+}
+
+// readMessagePackNumber - read a big endian unsigned number of size bytes
+func readMessagePackNumber(r *bufio.Reader, size int, number *uint64) error {
+	*number = 0
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		*number = *number<<8 | uint64(b)
+	}
+	return nil
+}
+
+func readMessagePackString(r *bufio.Reader, length int) (interface{}, error) {
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func decodeMessagePackArray(r *bufio.Reader, length int) (interface{}, error) {
+	array := make([]interface{}, 0, length)
+	for i := 0; i < length; i++ {
+		item, err := decodeMessagePack(r)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, item)
+	}
+	return array, nil
+}
+
+func decodeMessagePackMap(r *bufio.Reader, length int) (interface{}, error) {
+	decoded := make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		key, err := decodeMessagePack(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeMessagePack(r)
+		if err != nil {
+			return nil, err
+		}
+		decoded[fmt.Sprint(key)] = value
+	}
+	return decoded, nil
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+// NDJSON - application/x-ndjson codec (http://ndjson.org), lists only.
+// Every item of the list is written as a JSON document on its own line.
+type NDJSON struct{}
+
+// MediaTypes - implementation of Codec
+func (NDJSON) MediaTypes() []string {
+	return []string{"application/x-ndjson", "application/ndjson"}
+}
+
+// CanEncode - implementation of Codec
+func (NDJSON) CanEncode(value interface{}) bool {
+	return isList(value)
+}
+
+// Encode - implementation of Codec
+func (codec NDJSON) Encode(w io.Writer, name string, value interface{}) error {
+	listWriter := codec.NewListWriter(w, name)
+	list := reflect.ValueOf(value)
+	for index := 0; index < list.Len(); index++ {
+		if err := listWriter.WriteItem(list.Index(index).Interface()); err != nil {
+			return err
+		}
+	}
+	return listWriter.Close()
+}
+
+// Decode - implementation of Codec, NDJSON request bodies are not supported
+func (NDJSON) Decode(r io.Reader, target interface{}) error {
+	return ErrorUnsupportedMediaType
+}
+
+// NewListWriter - implementation of ListEncoder
+func (NDJSON) NewListWriter(w io.Writer, name string) ListWriter {
+	return ndjsonListWriter{encoder: json.NewEncoder(w)}
+}
+
+type ndjsonListWriter struct {
+	encoder *json.Encoder
+}
+
+func (nw ndjsonListWriter) WriteItem(value interface{}) error {
+	return nw.encoder.Encode(value)
+}
+
+func (nw ndjsonListWriter) Close() error {
+	return nil
+}
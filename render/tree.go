@@ -0,0 +1,153 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// object - a JSON object keeping the order of its members
+type object []member
+
+type member struct {
+	Key   string
+	Value interface{}
+}
+
+// toTree - convert a value to its generic JSON representation.
+// The value is marshaled as JSON first so that every format renders the same fields,
+// names and values (json tags, custom marshalers) as the JSON representation.
+// Objects become object, arrays []interface{}, numbers json.Number and the rest string, bool or nil.
+func toTree(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return readTreeValue(decoder)
+}
+
+func readTreeValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		node := object{}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readTreeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, member{Key: keyToken.(string), Value: value})
+		}
+		_, err = decoder.Token() // closing }
+		return node, err
+	case json.Delim('['):
+		node := []interface{}{}
+		for decoder.More() {
+			value, err := readTreeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, value)
+		}
+		_, err = decoder.Token() // closing ]
+		return node, err
+	}
+
+	return token, nil
+}
+
+// decodeInto - fill target from a generic value produced by a decoder.
+// The value goes through JSON so the target's JSON unmarshaling rules apply to every format.
+func decodeInto(value interface{}, target interface{}) error {
+	data, err := json.Marshal(normalize(value))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// normalize - convert decoded values into types that can be marshaled as JSON
+func normalize(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(typedValue))
+		for key, child := range typedValue {
+			normalized[fmt.Sprint(key)] = normalize(child)
+		}
+		return normalized
+	case map[string]interface{}:
+		for key, child := range typedValue {
+			typedValue[key] = normalize(child)
+		}
+		return typedValue
+	case []interface{}:
+		for index, child := range typedValue {
+			typedValue[index] = normalize(child)
+		}
+		return typedValue
+	case []byte:
+		return string(typedValue)
+	}
+	return value
+}
+
+// scalarText - the text representation of a scalar tree value
+func scalarText(value interface{}) string {
+	switch typedValue := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typedValue
+	case bool:
+		return strconv.FormatBool(typedValue)
+	case json.Number:
+		return typedValue.String()
+	}
+
+	data, _ := json.Marshal(treeToInterface(value))
+	return string(data)
+}
+
+// treeToInterface - convert a tree back to plain maps, for nested values rendered as JSON text
+func treeToInterface(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case object:
+		converted := make(map[string]interface{}, len(typedValue))
+		for _, m := range typedValue {
+			converted[m.Key] = treeToInterface(m.Value)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(typedValue))
+		for index, child := range typedValue {
+			converted[index] = treeToInterface(child)
+		}
+		return converted
+	}
+	return value
+}
+
+// readAll - read a request body, an empty body is reported as io.EOF like the JSON decoder does
+func readAll(r io.Reader) ([]byte, error) {
+	var buffer bytes.Buffer
+	if _, err := buffer.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(buffer.Bytes())) == 0 {
+		return nil, io.EOF
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,144 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// XML - application/xml codec.
+// The value is the root element, object members are child elements and list items
+// are child elements named after the singular of the list element name (messages - message).
+type XML struct{}
+
+// MediaTypes - implementation of Codec
+func (XML) MediaTypes() []string {
+	return []string{"application/xml", "text/xml"}
+}
+
+// CanEncode - implementation of Codec
+func (XML) CanEncode(value interface{}) bool {
+	return true
+}
+
+// Encode - implementation of Codec
+func (XML) Encode(w io.Writer, name string, value interface{}) error {
+	tree, err := toTree(value)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	if err := encodeXMLElement(encoder, name, tree); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func encodeXMLElement(encoder *xml.Encoder, name string, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch typedValue := value.(type) {
+	case object:
+		for _, m := range typedValue {
+			if err := encodeXMLElement(encoder, m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		itemName := "item"
+		if len(name) > 1 && strings.HasSuffix(name, "s") {
+			itemName = strings.TrimSuffix(name, "s")
+		}
+		for _, item := range typedValue {
+			if err := encodeXMLElement(encoder, itemName, item); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := encoder.EncodeToken(xml.CharData(scalarText(typedValue))); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+// Decode - implementation of Codec.
+// Elements with children are read as objects, repeated children as lists
+// and elements with text only as strings.
+func (XML) Decode(r io.Reader, target interface{}) error {
+	data, err := readAll(r)
+	if err != nil {
+		return err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			value, err := decodeXMLElement(decoder, start)
+			if err != nil {
+				return err
+			}
+			return decodeInto(value, target)
+		}
+	}
+}
+
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	var text strings.Builder
+	var children map[string]interface{}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typedToken := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(decoder, typedToken)
+			if err != nil {
+				return nil, err
+			}
+			if children == nil {
+				children = make(map[string]interface{})
+			}
+			name := typedToken.Name.Local
+			switch existing := children[name].(type) {
+			case nil:
+				children[name] = child
+			case []interface{}:
+				children[name] = append(existing, child)
+			default:
+				children[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(typedToken)
+		case xml.EndElement:
+			if children != nil {
+				return children, nil
+			}
+			return strings.TrimSpace(text.String()), nil
+		}
+	}
+}
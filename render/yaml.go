@@ -0,0 +1,76 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// YAML - application/yaml codec
+type YAML struct{}
+
+// MediaTypes - implementation of Codec
+func (YAML) MediaTypes() []string {
+	return []string{"application/yaml", "application/x-yaml", "text/yaml"}
+}
+
+// CanEncode - implementation of Codec
+func (YAML) CanEncode(value interface{}) bool {
+	return true
+}
+
+// Encode - implementation of Codec
+func (YAML) Encode(w io.Writer, name string, value interface{}) error {
+	tree, err := toTree(value)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(toYAML(tree))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Decode - implementation of Codec
+func (YAML) Decode(r io.Reader, target interface{}) error {
+	data, err := readAll(r)
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return decodeInto(value, target)
+}
+
+// toYAML - convert a tree to values the yaml encoder renders in order and with native scalars
+func toYAML(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case object:
+		mapSlice := make(yaml.MapSlice, 0, len(typedValue))
+		for _, m := range typedValue {
+			mapSlice = append(mapSlice, yaml.MapItem{Key: m.Key, Value: toYAML(m.Value)})
+		}
+		return mapSlice
+	case []interface{}:
+		converted := make([]interface{}, len(typedValue))
+		for index, child := range typedValue {
+			converted[index] = toYAML(child)
+		}
+		return converted
+	case json.Number:
+		if integer, err := typedValue.Int64(); err == nil {
+			return integer
+		}
+		if float, err := typedValue.Float64(); err == nil {
+			return float
+		}
+	}
+	return value
+}
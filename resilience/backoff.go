@@ -0,0 +1,54 @@
+package resilience
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Backoff - the exponentially growing delays between attempts of an operation
+type Backoff struct {
+	// Initial - the delay after the first failed attempt
+	Initial time.Duration
+	// Max - the longest delay
+	Max time.Duration
+	// Multiplier - how much each delay grows over the previous one
+	Multiplier float64
+	// Jitter - the part of each delay that is random, between 0 and 1,
+	// so instances that failed together do not retry together
+	Jitter float64
+}
+
+// Delay - the delay after the given failed attempt (starting at 1), random is a number in [0, 1)
+func (b Backoff) Delay(attempt int, random float64) time.Duration {
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt-1))
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	return time.Duration(delay * (1 - b.Jitter*random))
+}
+
+// Retry - runs the operation until it succeeds, waiting the backoff delay after each failure.
+// Gives up after maxAttempts attempts (never when 0) or when ctx is done, returning the last error.
+func Retry(ctx context.Context, backoff Backoff, maxAttempts int, operation func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := operation(ctx)
+		if err == nil {
+			return nil
+		}
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			return err
+		}
+
+		delay := backoff.Delay(attempt, rand.Float64())
+		log.WithError(err).WithField("attempt", attempt).WithField("retryIn", delay.String()).Warn("Attempt failed, retrying")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
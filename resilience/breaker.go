@@ -0,0 +1,116 @@
+package resilience
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	// StateClosed - calls go through
+	StateClosed = "closed"
+	// StateOpen - calls fail fast until the open duration passed
+	StateOpen = "open"
+	// StateHalfOpen - a single trial call goes through, its outcome closes or opens the breaker again
+	StateHalfOpen = "half-open"
+)
+
+// OpenError - the error of calls rejected by an open breaker
+type OpenError struct {
+	// RetryAfter - when the breaker lets a trial call through
+	RetryAfter time.Duration
+}
+
+// Error - implementation of error
+func (oe OpenError) Error() string {
+	return fmt.Sprintf("Circuit breaker open, retry in %s", oe.RetryAfter)
+}
+
+// Breaker - a circuit breaker. It opens after consecutive failures and fails calls fast while open,
+// after the open duration a single trial call decides if it closes again.
+// A nil breaker lets every call through.
+type Breaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+
+	lock     sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// trial - a trial call of the half-open breaker is running
+	trial bool
+	now   func() time.Time
+}
+
+//NewBreaker - return a closed breaker opening after failureThreshold consecutive failures for openDuration
+func NewBreaker(failureThreshold int, openDuration time.Duration) *Breaker {
+	return &Breaker{failureThreshold: failureThreshold, openDuration: openDuration, state: StateClosed, now: time.Now}
+}
+
+// State - the current state of the breaker
+func (b *Breaker) State() string {
+	if b == nil {
+		return StateClosed
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == StateOpen && !b.now().Before(b.openedAt.Add(b.openDuration)) {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow - reports if a call may go through, an OpenError when it may not.
+// Every allowed call must be followed by Record with its outcome.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	if b.state == StateOpen {
+		reopensAt := b.openedAt.Add(b.openDuration)
+		if now.Before(reopensAt) {
+			return OpenError{RetryAfter: reopensAt.Sub(now)}
+		}
+		b.state = StateHalfOpen
+	}
+	if b.state == StateHalfOpen {
+		if b.trial {
+			return OpenError{RetryAfter: time.Second}
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Record - records the outcome of an allowed call, failed is false for calls that reached the dependency
+// even if they failed for other reasons (such as a missing record)
+func (b *Breaker) Record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.trial = false
+		if failed {
+			b.state, b.openedAt = StateOpen, b.now()
+			return
+		}
+		b.state, b.failures = StateClosed, 0
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == StateClosed && b.failures >= b.failureThreshold {
+		b.state, b.openedAt = StateOpen, b.now()
+	}
+}
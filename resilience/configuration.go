@@ -0,0 +1,41 @@
+package resilience
+
+import (
+	"github.com/pkg/errors"
+
+	config "github.com/spf13/viper"
+)
+
+//LoadConnectRetry - the backoff and the maximal number of attempts (0 for no limit) of connecting
+//to the database at startup, from the "database.connectRetry" configuration section
+func LoadConnectRetry() (Backoff, int, error) {
+	backoff := Backoff{
+		Initial:    config.GetDuration("database.connectRetry.initialBackoff"),
+		Max:        config.GetDuration("database.connectRetry.maxBackoff"),
+		Multiplier: config.GetFloat64("database.connectRetry.multiplier"),
+		Jitter:     config.GetFloat64("database.connectRetry.jitter"),
+	}
+	maxAttempts := config.GetInt("database.connectRetry.maxAttempts")
+	if backoff.Initial <= 0 || backoff.Max < backoff.Initial {
+		return Backoff{}, 0, errors.New("database.connectRetry: initialBackoff must be positive and at most maxBackoff")
+	}
+	if backoff.Multiplier < 1 || backoff.Jitter < 0 || backoff.Jitter > 1 || maxAttempts < 0 {
+		return Backoff{}, 0, errors.New("database.connectRetry: multiplier must be at least 1, jitter between 0 and 1 and maxAttempts not negative")
+	}
+	return backoff, maxAttempts, nil
+}
+
+//LoadBreaker - build the circuit breaker of database calls from the "database.circuitBreaker" configuration section.
+//Returns nil when database.circuitBreaker.enabled is false, calls then always go through.
+func LoadBreaker() (*Breaker, error) {
+	if !config.GetBool("database.circuitBreaker.enabled") {
+		return nil, nil
+	}
+
+	failureThreshold := config.GetInt("database.circuitBreaker.failureThreshold")
+	openDuration := config.GetDuration("database.circuitBreaker.openDuration")
+	if failureThreshold <= 0 || openDuration <= 0 {
+		return nil, errors.New("database.circuitBreaker: failureThreshold and openDuration must be positive")
+	}
+	return NewBreaker(failureThreshold, openDuration), nil
+}
@@ -0,0 +1,105 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	backoff := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2, Jitter: 0.5}
+
+	testCases := []struct {
+		attempt  int
+		random   float64
+		expected time.Duration
+	}{
+		{1, 0, 100 * time.Millisecond},
+		{2, 0, 200 * time.Millisecond},
+		{4, 0, 800 * time.Millisecond},
+		{5, 0, time.Second},
+		{30, 0, time.Second},
+		{2, 0.5, 150 * time.Millisecond},
+		{5, 0.99, 505 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, backoff.Delay(tc.attempt, tc.random), "attempt %d, random %v", tc.attempt, tc.random)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+	unavailable := errors.New("connection refused")
+
+	attempts := 0
+	err := Retry(context.Background(), backoff, 0, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return unavailable
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = Retry(context.Background(), backoff, 2, func(ctx context.Context) error {
+		attempts++
+		return unavailable
+	})
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 2, attempts, "gives up after the maximal attempts")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = Retry(ctx, Backoff{Initial: time.Hour, Max: time.Hour, Multiplier: 1}, 0, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return unavailable
+	})
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 1, attempts, "stops waiting when the context is done")
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewBreaker(2, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	assert.NoError(t, breaker.Allow())
+	breaker.Record(true)
+	assert.NoError(t, breaker.Allow())
+	breaker.Record(false)
+	assert.Equal(t, StateClosed, breaker.State(), "only consecutive failures open the breaker")
+
+	for attempt := 0; attempt < 2; attempt++ {
+		assert.NoError(t, breaker.Allow())
+		breaker.Record(true)
+	}
+	assert.Equal(t, StateOpen, breaker.State())
+
+	now = now.Add(4 * time.Second)
+	assert.Equal(t, OpenError{RetryAfter: 6 * time.Second}, breaker.Allow())
+
+	now = now.Add(6 * time.Second)
+	assert.Equal(t, StateHalfOpen, breaker.State())
+	assert.NoError(t, breaker.Allow(), "a trial call goes through")
+	assert.IsType(t, OpenError{}, breaker.Allow(), "one trial call at a time")
+	breaker.Record(true)
+	assert.Equal(t, StateOpen, breaker.State(), "a failed trial opens the breaker again")
+
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, breaker.Allow())
+	breaker.Record(false)
+	assert.Equal(t, StateClosed, breaker.State(), "a successful trial closes the breaker")
+	assert.NoError(t, breaker.Allow())
+
+	var disabled *Breaker
+	assert.NoError(t, disabled.Allow())
+	disabled.Record(true)
+	assert.Equal(t, StateClosed, disabled.State())
+}
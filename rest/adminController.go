@@ -0,0 +1,156 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/shauera/messages/application"
+	"github.com/shauera/messages/buildinfo"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AdminController - handles the runtime administration endpoints. They are served on admin.port only,
+// never on the service port, and do not require authentication.
+type AdminController struct {
+	serviceMode *ServiceMode
+	codecs      *render.Registry
+}
+
+//NewAdminController - return a new admin controller switching the given mode of the service
+func NewAdminController(serviceMode *ServiceMode) AdminController {
+	return AdminController{serviceMode: serviceMode, codecs: render.Default}
+}
+
+//PublishEndpoints - implementation of ServiceController
+func (ac AdminController) PublishEndpoints(router *mux.Router) {
+	router.HandleFunc("/admin/loglevel", ac.GetLogLevel).Methods("GET")
+	router.HandleFunc("/admin/loglevel", ac.SetLogLevel).Methods("PUT")
+	router.HandleFunc("/admin/buildinfo", ac.GetBuildInfo).Methods("GET")
+	router.HandleFunc("/admin/config", ac.GetConfig).Methods("GET")
+	router.HandleFunc("/admin/mode", ac.GetMode).Methods("GET")
+	router.HandleFunc("/admin/mode", ac.SetMode).Methods("PUT")
+	router.HandleFunc("/admin/maintenance", ac.GetMaintenance).Methods("GET")
+	router.HandleFunc("/admin/maintenance", ac.SetMaintenance).Methods("PUT")
+
+	// the profiles of net/http/pprof, pprof.Index serves the named profiles under its path
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+}
+
+// GetLogLevel - returns the minimal level of logged entries
+func (ac *AdminController) GetLogLevel(response http.ResponseWriter, request *http.Request) {
+	writeAdminResponse(response, model.LogLevel{Level: log.GetLevel().String()})
+}
+
+// SetLogLevel - changes the minimal level of logged entries until the service stops or the configuration is reloaded
+func (ac *AdminController) SetLogLevel(response http.ResponseWriter, request *http.Request) {
+	var logLevel model.LogLevel
+	if err := readRequest(response, request, ac.codecs, &logLevel, "Log levels"); err != nil {
+		return
+	}
+
+	level, err := log.ParseLevel(logLevel.Level)
+	if err != nil {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeValidation,
+			Status: http.StatusBadRequest,
+			Detail: "The level must be one of panic, fatal, error, warn, info, debug or trace",
+		})
+		return
+	}
+
+	previous := log.GetLevel()
+	log.SetLevel(level)
+	log.WithFields(log.Fields{"audit": "admin.loglevel", "from": previous.String(), "to": level.String()}).Warn("Log level changed")
+	writeAdminResponse(response, model.LogLevel{Level: level.String()})
+}
+
+// GetBuildInfo - returns the build details of the running service
+func (ac *AdminController) GetBuildInfo(response http.ResponseWriter, request *http.Request) {
+	writeAdminResponse(response, buildinfo.Read())
+}
+
+// GetConfig - returns the effective configuration, secrets redacted
+func (ac *AdminController) GetConfig(response http.ResponseWriter, request *http.Request) {
+	writeAdminResponse(response, application.RedactedSettings())
+}
+
+// GetMode - returns the mode of the service
+func (ac *AdminController) GetMode(response http.ResponseWriter, request *http.Request) {
+	writeAdminResponse(response, model.ServiceMode{Mode: ac.serviceMode.Get()})
+}
+
+// SetMode - switches the service to another mode until the service restarts or service.mode is reloaded
+func (ac *AdminController) SetMode(response http.ResponseWriter, request *http.Request) {
+	var serviceMode model.ServiceMode
+	if err := readRequest(response, request, ac.codecs, &serviceMode, "Service modes"); err != nil {
+		return
+	}
+	if ac.switchMode(response, request, serviceMode.Mode) {
+		writeAdminResponse(response, model.ServiceMode{Mode: ac.serviceMode.Get()})
+	}
+}
+
+// GetMaintenance - returns whether the service is down for maintenance
+func (ac *AdminController) GetMaintenance(response http.ResponseWriter, request *http.Request) {
+	writeAdminResponse(response, model.Maintenance{Enabled: ac.serviceMode.Get() == ModeMaintenance})
+}
+
+// SetMaintenance - takes the service down for maintenance or brings it back to the normal mode
+func (ac *AdminController) SetMaintenance(response http.ResponseWriter, request *http.Request) {
+	var maintenance model.Maintenance
+	if err := readRequest(response, request, ac.codecs, &maintenance, "Maintenance states"); err != nil {
+		return
+	}
+	mode := ModeNormal
+	if maintenance.Enabled {
+		mode = ModeMaintenance
+	}
+	if ac.switchMode(response, request, mode) {
+		writeAdminResponse(response, maintenance)
+	}
+}
+
+// switchMode - switches the service to the mode, rendering a problem when the mode is not known
+func (ac *AdminController) switchMode(response http.ResponseWriter, request *http.Request, mode string) bool {
+	previous := ac.serviceMode.Get()
+	if err := ac.serviceMode.Set(mode); err != nil {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeValidation,
+			Status: http.StatusBadRequest,
+			Detail: "The mode must be one of " + strings.Join(Modes, ", "),
+		})
+		return false
+	}
+
+	log.WithFields(log.Fields{"audit": "admin.mode", "from": previous, "to": ac.serviceMode.Get()}).Warn("Service mode switched")
+	return true
+}
+
+// writeAdminResponse - renders the value as JSON, admin responses are not cached
+func writeAdminResponse(response http.ResponseWriter, value interface{}) {
+	response.Header().Set("content-type", "application/json")
+	response.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(response).Encode(value); err != nil {
+		log.WithError(err).Error("Could not encode response")
+	}
+}
+
+// setupAdminMux - the router of the admin port
+func setupAdminMux(adminController AdminController) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(correlationIDMiddleware)
+	router.NotFoundHandler = correlationIDMiddleware(http.HandlerFunc(notFoundHandler))
+	router.MethodNotAllowedHandler = correlationIDMiddleware(http.HandlerFunc(methodNotAllowedHandler))
+	adminController.PublishEndpoints(router)
+	return router
+}
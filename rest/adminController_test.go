@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/buildinfo"
+	"github.com/shauera/messages/model"
+
+	"github.com/stretchr/testify/assert"
+
+	log "github.com/sirupsen/logrus"
+	config "github.com/spf13/viper"
+)
+
+func Test_Admin(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	defer config.Reset()
+	serviceMode, _ := NewServiceMode(ModeNormal, time.Minute)
+	adminRouter := setupAdminMux(NewAdminController(serviceMode))
+
+	t.Run("Success path - the log level is changed", func(t *testing.T) {
+		log.SetLevel(log.InfoLevel)
+		response := serveRequest(adminRouter, http.MethodGet, "/admin/loglevel", "", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"level": "info"}`, response.Body.String())
+
+		response = serveRequest(adminRouter, http.MethodPut, "/admin/loglevel", `{"level": "debug"}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"level": "debug"}`, response.Body.String())
+		assert.Equal(t, log.DebugLevel, log.GetLevel())
+	})
+
+	t.Run("Fail path - unknown log level", func(t *testing.T) {
+		response := serveRequest(adminRouter, http.MethodPut, "/admin/loglevel", `{"level": "loud"}`, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, model.ProblemContentType, response.Header().Get("content-type"))
+		assert.Equal(t, log.DebugLevel, log.GetLevel())
+	})
+
+	t.Run("Success path - build info", func(t *testing.T) {
+		response := serveRequest(adminRouter, http.MethodGet, "/admin/buildinfo", "", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		var details buildinfo.Details
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &details))
+		assert.NotEmpty(t, details.Version)
+		assert.Equal(t, buildinfo.Get().GoVersion, details.GoVersion)
+	})
+
+	t.Run("Success path - the configuration is redacted", func(t *testing.T) {
+		config.Set("service.port", 8090)
+		config.Set("database.password", "example")
+		response := serveRequest(adminRouter, http.MethodGet, "/admin/config", "", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"service": {"port": 8090}, "database": {"password": "[REDACTED]"}}`, response.Body.String())
+	})
+
+	t.Run("Success path - profiles", func(t *testing.T) {
+		response := serveRequest(adminRouter, http.MethodGet, "/debug/pprof/", "", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), "goroutine")
+	})
+
+	t.Run("Success path - the mode is switched", func(t *testing.T) {
+		response := serveRequest(adminRouter, http.MethodPut, "/admin/mode", `{"mode": "read-only"}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, ModeReadOnly, serviceMode.Get())
+		response = serveRequest(adminRouter, http.MethodGet, "/admin/mode", "", "")
+		assert.JSONEq(t, `{"mode": "read-only"}`, response.Body.String())
+
+		response = serveRequest(adminRouter, http.MethodPut, "/admin/maintenance", `{"enabled": true}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"enabled": true}`, response.Body.String())
+		assert.Equal(t, ModeMaintenance, serviceMode.Get())
+		response = serveRequest(adminRouter, http.MethodGet, "/admin/maintenance", "", "")
+		assert.JSONEq(t, `{"enabled": true}`, response.Body.String())
+
+		serveRequest(adminRouter, http.MethodPut, "/admin/maintenance", `{"enabled": false}`, "")
+		assert.Equal(t, ModeNormal, serviceMode.Get())
+	})
+
+	t.Run("Fail path - unknown mode", func(t *testing.T) {
+		response := serveRequest(adminRouter, http.MethodPut, "/admin/mode", `{"mode": "frozen"}`, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, ModeNormal, serviceMode.Get())
+	})
+
+	t.Run("Fail path - admin routes are not served on the service port", func(t *testing.T) {
+		router := setupMux([]ServiceController{}, DefaultSettings(), auth.Disabled())
+		assert.Equal(t, http.StatusNotFound, serveRequest(router, http.MethodGet, "/admin/loglevel", "", "").Code)
+	})
+}
@@ -0,0 +1,332 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/render"
+	"github.com/shauera/messages/tenancy"
+
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// APIKeyController - handles the API key administration endpoints
+type APIKeyController struct {
+	repository auth.APIKeyRepository
+	codecs     *render.Registry
+	now        func() time.Time
+}
+
+//NewAPIKeyController - return a new API key controller setup with a designated API key repository
+func NewAPIKeyController(apiKeyRepository auth.APIKeyRepository) APIKeyController {
+	return APIKeyController{
+		repository: apiKeyRepository,
+		codecs:     render.Default,
+		now:        time.Now,
+	}
+}
+
+//PublishEndpoints - implementation of ServiceController
+func (kc APIKeyController) PublishEndpoints(router *mux.Router) {
+	router.Handle("/admin/apikeys", requirePermission(auth.PermissionManageAPIKeys, traced("APIKeyController.CreateAPIKey", kc.CreateAPIKey))).Methods("POST")
+	router.Handle("/admin/apikeys", requirePermission(auth.PermissionManageAPIKeys, traced("APIKeyController.ListAPIKeys", kc.ListAPIKeys))).Methods("GET")
+	router.Handle("/admin/apikeys/{id}", requirePermission(auth.PermissionManageAPIKeys, traced("APIKeyController.GetAPIKeyByID", kc.GetAPIKeyByID))).Methods("GET")
+	router.Handle("/admin/apikeys/{id}", requirePermission(auth.PermissionManageAPIKeys, traced("APIKeyController.RevokeAPIKeyByID", kc.RevokeAPIKeyByID))).Methods("DELETE")
+}
+
+// CreateAPIKey - creates a new API key
+func (kc *APIKeyController) CreateAPIKey(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation POST /admin/apikeys apikeys createAPIKey
+	//
+	// Creates a new API key, the key is returned only in this response
+	// ---
+	// consumes:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: apiKeyRequest
+	//   in: body
+	//   description: API key to be created.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/APIKeyRequest"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/APIKey"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, kc.codecs, model.APIKey{})
+	if err != nil {
+		return
+	}
+
+	var keyRequest model.APIKeyRequest
+	if err := readRequest(response, request, kc.codecs, &keyRequest, "API keys"); err != nil {
+		return
+	}
+
+	now := kc.now()
+	if fieldErrors := keyRequest.Validate(auth.PermissionNames(), now); len(fieldErrors) != 0 {
+		writeValidationProblem(response, request, "The API key request failed validation", fieldErrors)
+		return
+	}
+
+	// clients of a tenant create keys of their tenant only
+	principal, _ := auth.FromContext(request.Context())
+	if principal.Tenant != "" {
+		if keyRequest.Tenant != nil && *keyRequest.Tenant != principal.Tenant {
+			writeTenantProblem(response, request, tenancy.ErrorTenantForbidden)
+			return
+		}
+		keyRequest.Tenant = &principal.Tenant
+	}
+
+	key, err := auth.GenerateAPIKey(keyRequest, now)
+	if err == nil {
+		err = kc.repository.CreateAPIKey(request.Context(), key)
+	}
+	if err != nil {
+		writeError(response, request, err, "Could not create API key")
+		return
+	}
+
+	log.WithContext(request.Context()).WithField("apiKeyId", key.ID).WithField("scopes", key.Scopes).WithField("subject", principal.Subject).
+		WithField("correlationId", getCorrelationID(request)).Info("API key created")
+	writeResponse(response, codec, "apiKey", key)
+}
+
+// ListAPIKeys - retrieves a list of all API keys
+func (kc *APIKeyController) ListAPIKeys(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /admin/apikeys apikeys listAPIKeys
+	//
+	// Returns a list of all API keys, revoked keys included
+	// ---
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - text/csv
+	// - application/msgpack
+	// - application/problem+json
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       type: array
+	//       items:
+	//         "$ref": "#/definitions/APIKey"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, kc.codecs, model.APIKeys{})
+	if err != nil {
+		return
+	}
+
+	keys, err := kc.repository.ListAPIKeys(request.Context())
+	if err != nil {
+		writeError(response, request, err, "Could not get list of API keys")
+		return
+	}
+
+	principal, _ := auth.FromContext(request.Context())
+	visibleKeys := model.APIKeys{}
+	for _, key := range keys {
+		if visibleTo(principal, key) {
+			visibleKeys = append(visibleKeys, key)
+		}
+	}
+	writeResponse(response, codec, "apiKeys", visibleKeys)
+}
+
+// GetAPIKeyByID - retrieves an API key by id
+func (kc *APIKeyController) GetAPIKeyByID(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /admin/apikeys/{id} apikeys getAPIKey
+	//
+	// Returns an API key by id
+	// ---
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of the API key.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/APIKey"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, kc.codecs, model.APIKey{})
+	if err != nil {
+		return
+	}
+
+	key, err := kc.findAPIKey(request)
+	if err != nil {
+		writeError(response, request, err, "Could not get API key")
+		return
+	}
+
+	writeResponse(response, codec, "apiKey", key)
+}
+
+// RevokeAPIKeyByID - revokes an existing API key
+func (kc *APIKeyController) RevokeAPIKeyByID(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation DELETE /admin/apikeys/{id} apikeys revokeAPIKey
+	//
+	// Revokes an API key by id, the key is kept for auditing but is no longer accepted
+	// ---
+	// produces:
+	// - application/problem+json
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of the API key to be revoked.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '204':
+	//     description: No Content
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	key, err := kc.findAPIKey(request)
+	if err == nil {
+		err = kc.repository.RevokeAPIKeyByID(request.Context(), key.ID, kc.now().UTC())
+	}
+	if err != nil {
+		writeError(response, request, err, "Could not revoke API key")
+		return
+	}
+
+	principal, _ := auth.FromContext(request.Context())
+	log.WithContext(request.Context()).WithField("apiKeyId", key.ID).WithField("subject", principal.Subject).
+		WithField("correlationId", getCorrelationID(request)).Info("API key revoked")
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// findAPIKey - the API key of the id in the path, keys of other tenants are not found by clients of a tenant
+func (kc *APIKeyController) findAPIKey(request *http.Request) (*model.APIKey, error) {
+	key, err := kc.repository.FindAPIKeyByID(request.Context(), mux.Vars(request)["id"])
+	if err != nil {
+		return nil, err
+	}
+	if principal, _ := auth.FromContext(request.Context()); !visibleTo(principal, *key) {
+		return nil, persistence.ErrorNotFound
+	}
+	return key, nil
+}
+
+// visibleTo - reports if the principal may manage the key, clients of a tenant manage the keys of their tenant only
+func visibleTo(principal auth.Principal, key model.APIKey) bool {
+	return principal.Tenant == "" || principal.Tenant == key.Tenant
+}
@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serveRequest(router http.Handler, method string, path string, body string, authorization string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func Test_API_Key_Validation(t *testing.T) {
+	testCases := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{name: "Fail path - missing name and scopes", body: `{}`, fields: []string{"name", "scopes"}},
+		{name: "Fail path - unknown scope", body: `{"name": "batch", "scopes": ["messages:read", "messages:all"]}`, fields: []string{"scopes[1]"}},
+		{name: "Fail path - expired", body: `{"name": "batch", "scopes": ["messages:read"], "expiresAt": "2001-01-01T00:00:00Z"}`, fields: []string{"expiresAt"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repository, _ := persistence.NewMemoryRepository()
+			router := setupMux([]ServiceController{NewAPIKeyController(repository)}, DefaultSettings(), auth.Disabled())
+
+			response := serveRequest(router, http.MethodPost, "/admin/apikeys", testCase.body, "")
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+
+			var problem model.ProblemResponse
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &problem))
+			var fields []string
+			for _, fieldError := range problem.Errors {
+				fields = append(fields, fieldError.Field)
+			}
+			assert.Equal(t, testCase.fields, fields)
+		})
+	}
+}
+
+func Test_API_Keys(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	repository.GetMessagesStorage()["8"] = model.MessageResponse{ID: "8", Content: getNewString("Test Message 1")}
+	authentication := auth.NewAuthentication(auth.NewAPIKeyAuthenticator(repository))
+	router := setupMux([]ServiceController{NewMessageController(repository), NewAPIKeyController(repository)},
+		DefaultSettings(), authentication)
+
+	// the first admin key is created directly, later keys through the admin endpoints
+	adminKey, _ := auth.GenerateAPIKey(model.APIKeyRequest{Name: getNewString("admin"), Scopes: []string{"apikeys:manage"}}, time.Now())
+	assert.NoError(t, repository.CreateAPIKey(context.Background(), adminKey))
+
+	response := serveRequest(router, http.MethodPost, "/admin/apikeys", `{"name": "batch", "scopes": ["messages:read"]}`, "ApiKey "+adminKey.Key)
+	assert.Equal(t, http.StatusOK, response.Code)
+	var created model.APIKey
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &created))
+	assert.Equal(t, "batch", created.Name)
+	assert.Equal(t, []string{"messages:read"}, created.Scopes)
+	assert.True(t, strings.HasPrefix(created.Key, created.ID+"."))
+	assert.NotContains(t, response.Body.String(), "$2a$")
+
+	t.Run("Success path - scope grants reading", func(t *testing.T) {
+		response := serveRequest(router, http.MethodGet, "/messages/8", "", "ApiKey "+created.Key)
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("Fail path - scope does not grant writing", func(t *testing.T) {
+		response := serveRequest(router, http.MethodDelete, "/messages/8", "", "ApiKey "+created.Key)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+	})
+
+	t.Run("Fail path - key can't manage keys", func(t *testing.T) {
+		response := serveRequest(router, http.MethodGet, "/admin/apikeys", "", "ApiKey "+created.Key)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+	})
+
+	t.Run("Success path - get records last use without the key", func(t *testing.T) {
+		response := serveRequest(router, http.MethodGet, "/admin/apikeys/"+created.ID, "", "ApiKey "+adminKey.Key)
+		assert.Equal(t, http.StatusOK, response.Code)
+		var key model.APIKey
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &key))
+		assert.NotNil(t, key.LastUsedAt)
+		assert.Empty(t, key.Key)
+	})
+
+	t.Run("Success path - list", func(t *testing.T) {
+		response := serveRequest(router, http.MethodGet, "/admin/apikeys", "", "ApiKey "+adminKey.Key)
+		assert.Equal(t, http.StatusOK, response.Code)
+		var keys model.APIKeys
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &keys))
+		assert.Len(t, keys, 2)
+	})
+
+	t.Run("Success path - revoked key is rejected", func(t *testing.T) {
+		response := serveRequest(router, http.MethodDelete, "/admin/apikeys/"+created.ID, "", "ApiKey "+adminKey.Key)
+		assert.Equal(t, http.StatusNoContent, response.Code)
+
+		response = serveRequest(router, http.MethodGet, "/messages/8", "", "ApiKey "+created.Key)
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Equal(t, `ApiKey realm="messages"`, response.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Fail path - revoke unknown key", func(t *testing.T) {
+		response := serveRequest(router, http.MethodDelete, "/admin/apikeys/unknown", "", "ApiKey "+adminKey.Key)
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+}
+
+// unavailableAPIKeyRepository - an API key repository that can't be reached
+type unavailableAPIKeyRepository struct {
+	*persistence.MemoryRepository
+}
+
+func (unavailableAPIKeyRepository) FindAPIKeyByID(ctx context.Context, id string) (*model.APIKey, error) {
+	return nil, persistence.ErrorUnavailable
+}
+
+func Test_API_Key_Repository_Unavailable(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	authentication := auth.NewAuthentication(auth.NewAPIKeyAuthenticator(unavailableAPIKeyRepository{repository}))
+	router := setupMux([]ServiceController{NewMessageController(repository)}, DefaultSettings(), authentication)
+
+	response := serveRequest(router, http.MethodGet, "/messages", "", "ApiKey 0123456789abcdef.secret")
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+}
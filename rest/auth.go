@@ -0,0 +1,140 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// authenticationRealm - the protection space of the service (RFC 7235)
+const authenticationRealm = "messages"
+
+type authenticationKey struct{}
+
+// authenticationMiddleware - authenticates the Authorization header of requests.
+// The principal of valid credentials is available through the request context (auth.FromContext).
+// Requests without credentials are passed on unauthenticated, endpoints that need a principal
+// reject them (see requirePermission). Requests with invalid credentials are rejected.
+// Failing to look the credentials up (an unavailable API key repository) is reported as the repository error.
+func authenticationMiddleware(authentication *auth.Authentication) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			ctx := context.WithValue(request.Context(), authenticationKey{}, authentication)
+			principal, err := authentication.Authenticate(ctx, request.Header.Get("Authorization"))
+			switch {
+			case err == nil:
+				next.ServeHTTP(response, request.WithContext(auth.NewContext(ctx, principal)))
+			case err == auth.ErrorMissingCredentials:
+				next.ServeHTTP(response, request.WithContext(ctx))
+			case isAuthenticationError(err):
+				writeUnauthorized(response, request.WithContext(ctx), err)
+			default:
+				writeError(response, request.WithContext(ctx), err, "Could not authenticate request")
+			}
+		})
+	}
+}
+
+// isAuthenticationError - reports if err is about the credentials rather than about looking them up
+func isAuthenticationError(err error) bool {
+	_, ok := errors.Cause(err).(auth.Error)
+	return ok
+}
+
+// requirePermission - serves the request only if the principal of the request has the permission
+func requirePermission(permission auth.Permission, handler http.HandlerFunc) http.Handler {
+	return requireAnyPermission([]auth.Permission{permission}, handler)
+}
+
+// requireAnyPermission - serves the request only if the principal of the request has any of the permissions
+func requireAnyPermission(permissions []auth.Permission, handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		principal, ok := auth.FromContext(request.Context())
+		if !ok {
+			writeUnauthorized(response, request, auth.ErrorMissingCredentials)
+			return
+		}
+
+		names := make([]string, 0, len(permissions))
+		for _, permission := range permissions {
+			if principal.Can(permission) {
+				handler(response, request)
+				return
+			}
+			names = append(names, string(permission))
+		}
+
+		log.WithContext(request.Context()).WithField("subject", principal.Subject).WithField("permission", strings.Join(names, ",")).
+			WithField("correlationId", getCorrelationID(request)).Info("Permission denied")
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeForbidden,
+			Status: http.StatusForbidden,
+			Detail: "The " + strings.Join(names, " or ") + " permission is required",
+		})
+	})
+}
+
+// updatePermissions - either permission allows changing messages, the repository limits which ones (see messageAccess)
+var updatePermissions = []auth.Permission{auth.PermissionUpdateMessages, auth.PermissionUpdateOwnMessages}
+
+// requireAuthentication - serves the request only if it is authenticated
+func requireAuthentication(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if _, ok := auth.FromContext(request.Context()); !ok {
+			writeUnauthorized(response, request, auth.ErrorMissingCredentials)
+			return
+		}
+		handler(response, request)
+	})
+}
+
+// writeUnauthorized - renders a 401 problem challenging the client with the accepted schemes
+func writeUnauthorized(response http.ResponseWriter, request *http.Request, err error) {
+	if authentication, ok := request.Context().Value(authenticationKey{}).(*auth.Authentication); ok {
+		var challenges []string
+		for _, scheme := range authentication.Schemes() {
+			challenge := scheme + ` realm="` + authenticationRealm + `"`
+			if scheme == "Bearer" && (errors.Cause(err) == auth.ErrorInvalidToken || errors.Cause(err) == auth.ErrorTokenExpired) {
+				challenge += `, error="invalid_token"`
+			}
+			challenges = append(challenges, challenge)
+		}
+		response.Header().Set("WWW-Authenticate", strings.Join(challenges, ", "))
+	}
+
+	log.WithContext(request.Context()).WithError(err).WithField("correlationId", getCorrelationID(request)).Debug("Authentication failed")
+	writeProblem(response, request, model.ProblemResponse{
+		Type:   model.ProblemTypeUnauthorized,
+		Status: http.StatusUnauthorized,
+		Detail: errors.Cause(err).Error(),
+	})
+}
+
+// messageAccess - the messages the principal of the request can see and change.
+// Principals own the messages they created, private messages of other owners can be read with
+// the messages:read:private permission and messages of other owners can be changed with messages:update.
+// Requests of authentication disabled services are anonymous and can access all the messages.
+func messageAccess(ctx context.Context) model.Access {
+	principal, _ := auth.FromContext(ctx)
+	return model.Access{
+		Subject:  createdBy(ctx),
+		ReadAll:  principal.Can(auth.PermissionReadPrivateMessages),
+		WriteAll: principal.Can(auth.PermissionUpdateMessages),
+	}
+}
+
+// createdBy - the subject recorded as the creator of resources, empty when authentication is disabled
+func createdBy(ctx context.Context) string {
+	principal, ok := auth.FromContext(ctx)
+	if !ok || principal.Method == auth.MethodAnonymous {
+		return ""
+	}
+	return principal.Subject
+}
@@ -0,0 +1,189 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTokenSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// testToken - an HS256 token of the subject with the given roles
+func testToken(subject string, roles ...string) string {
+	return signTestClaims(map[string]interface{}{"sub": subject, "roles": roles, "exp": time.Now().Add(time.Hour).Unix()})
+}
+
+// testTenantToken - an HS256 token of the subject of the tenant with the given roles
+func testTenantToken(subject string, tenant string, roles ...string) string {
+	return signTestClaims(map[string]interface{}{"sub": subject, "tenant": tenant, "roles": roles, "exp": time.Now().Add(time.Hour).Unix()})
+}
+
+// signTestClaims - an HS256 token of the claims
+func signTestClaims(claimSet map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]interface{}{"alg": "HS256"})
+	claims, _ := json.Marshal(claimSet)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, testTokenSecret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func Test_Authorization(t *testing.T) {
+	testCases := []struct {
+		name          string
+		method        string
+		authorization string
+		status        int
+		problemType   string
+		challenge     string
+	}{
+		{name: "Fail path - no credentials", method: http.MethodGet, status: http.StatusUnauthorized,
+			problemType: model.ProblemTypeUnauthorized, challenge: `Bearer realm="messages"`},
+		{name: "Fail path - invalid token", method: http.MethodGet, authorization: "Bearer " + testToken("reader-1", "reader") + "x", status: http.StatusUnauthorized,
+			problemType: model.ProblemTypeUnauthorized, challenge: `Bearer realm="messages", error="invalid_token"`},
+		{name: "Fail path - unsupported scheme", method: http.MethodGet, authorization: "Basic dXNlcjpwYXNz", status: http.StatusUnauthorized,
+			problemType: model.ProblemTypeUnauthorized, challenge: `Bearer realm="messages"`},
+		{name: "Success path - reader can read", method: http.MethodGet, authorization: "Bearer " + testToken("reader-1", "reader"), status: http.StatusOK},
+		{name: "Fail path - reader can't update", method: http.MethodPut, authorization: "Bearer " + testToken("reader-1", "reader"), status: http.StatusForbidden,
+			problemType: model.ProblemTypeForbidden},
+		{name: "Success path - editor can update", method: http.MethodPut, authorization: "bearer " + testToken("editor-1", "editor"), status: http.StatusOK},
+		{name: "Fail path - editor can't delete", method: http.MethodDelete, authorization: "Bearer " + testToken("editor-1", "editor"), status: http.StatusForbidden,
+			problemType: model.ProblemTypeForbidden},
+		{name: "Success path - admin can delete", method: http.MethodDelete, authorization: "Bearer " + testToken("admin-1", "admin"), status: http.StatusNoContent},
+		{name: "Fail path - no roles", method: http.MethodGet, authorization: "Bearer " + testToken("nobody"), status: http.StatusForbidden,
+			problemType: model.ProblemTypeForbidden},
+	}
+
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{}))
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			messageRepository, _ := persistence.NewMemoryRepository()
+			messageRepository.GetMessagesStorage()["8"] = model.MessageResponse{ID: "8", Content: getNewString("Test Message 1")}
+			router := setupMux([]ServiceController{NewMessageController(messageRepository)}, DefaultSettings(), authentication)
+
+			request, _ := http.NewRequest(testCase.method, "/messages/8", strings.NewReader(`{"content": "abba"}`))
+			if testCase.authorization != "" {
+				request.Header.Set("Authorization", testCase.authorization)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			assert.Equal(t, testCase.status, response.Code)
+			if testCase.problemType != "" {
+				var problem model.ProblemResponse
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &problem))
+				assert.Equal(t, testCase.problemType, problem.Type)
+			}
+			assert.Equal(t, testCase.challenge, response.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func Test_Principal_In_Context(t *testing.T) {
+	var principal auth.Principal
+	handler := authenticationMiddleware(auth.Disabled())(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		principal, _ = auth.FromContext(request.Context())
+	}))
+
+	request, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(t, auth.Principal{Subject: "anonymous", Roles: []auth.Role{auth.RoleAdmin}, Method: auth.MethodAnonymous}, principal)
+}
+
+func Test_Message_Visibility(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{}))
+	router := setupMux([]ServiceController{NewMessageController(repository)}, DefaultSettings(), authentication)
+
+	owner := "Bearer " + testToken("will", "contributor")
+	other := "Bearer " + testToken("kit", "contributor")
+	editor := "Bearer " + testToken("editor-1", "editor")
+	admin := "Bearer " + testToken("admin-1", "admin")
+
+	create := func(body string) string {
+		response := serveRequest(router, http.MethodPost, "/messages", body, owner)
+		assert.Equal(t, http.StatusOK, response.Code)
+		var message model.MessageResponse
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &message))
+		assert.Equal(t, "will", *message.Owner)
+		return message.ID.(string)
+	}
+	publicID := create(`{"content": "public", "author": "will"}`)
+	unlistedID := create(`{"content": "unlisted", "author": "will", "visibility": "unlisted"}`)
+	privateID := create(`{"content": "private", "author": "will", "visibility": "private"}`)
+
+	t.Run("Fail path - unknown visibility", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPost, "/messages", `{"content": "abba", "visibility": "secret"}`, owner)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), `"field":"visibility"`)
+	})
+
+	t.Run("Success path - lists show only public messages of other owners", func(t *testing.T) {
+		testCases := []struct {
+			authorization string
+			contents      []string
+		}{
+			{authorization: other, contents: []string{"public"}},
+			{authorization: editor, contents: []string{"public"}},
+			{authorization: owner, contents: []string{"private", "public", "unlisted"}},
+			{authorization: admin, contents: []string{"private", "public", "unlisted"}},
+		}
+		for _, testCase := range testCases {
+			response := serveRequest(router, http.MethodGet, "/messages?fields=content&sort=content", "", testCase.authorization)
+			assert.Equal(t, http.StatusOK, response.Code)
+			var messages model.MessageResponses
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &messages))
+			var contents []string
+			for _, message := range messages {
+				contents = append(contents, *message.Content)
+			}
+			assert.ElementsMatch(t, testCase.contents, contents)
+		}
+	})
+
+	t.Run("Success path - unlisted messages are read by id, private ones only by the owner", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serveRequest(router, http.MethodGet, "/messages/"+unlistedID, "", other).Code)
+		assert.Equal(t, http.StatusNotFound, serveRequest(router, http.MethodGet, "/messages/"+privateID, "", other).Code)
+		assert.Equal(t, http.StatusOK, serveRequest(router, http.MethodGet, "/messages/"+privateID, "", owner).Code)
+		assert.Equal(t, http.StatusOK, serveRequest(router, http.MethodGet, "/messages/"+privateID, "", admin).Code)
+	})
+
+	t.Run("Success path - private messages are not counted in author expansions", func(t *testing.T) {
+		response := serveRequest(router, http.MethodGet, "/messages/"+publicID+"?expand=author", "", other)
+		assert.Contains(t, response.Body.String(), `"messageCount":1`)
+
+		response = serveRequest(router, http.MethodGet, "/messages/"+publicID+"?expand=author", "", owner)
+		assert.Contains(t, response.Body.String(), `"messageCount":3`)
+	})
+
+	t.Run("Fail path - only the owner and editors change messages", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPut, "/messages/"+publicID, `{"content": "changed"}`, other)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		assert.Contains(t, response.Body.String(), model.ProblemTypeForbidden)
+		assert.Equal(t, http.StatusNotFound, serveRequest(router, http.MethodPut, "/messages/"+privateID, `{"content": "changed"}`, other).Code)
+
+		response = serveRequest(router, http.MethodPut, "/messages/"+publicID, `{"content": "changed", "visibility": "private"}`, owner)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"owner":"will","visibility":"private"`)
+
+		response = serveRequest(router, http.MethodPut, "/messages/"+unlistedID, `{"content": "edited"}`, editor)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"owner":"will"`)
+	})
+}
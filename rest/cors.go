@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	config "github.com/spf13/viper"
+)
+
+// anyOrigin - the allowed origin allowing every origin
+const anyOrigin = "*"
+
+// CORSPolicy - the cross-origin requests browsers may make to the service, see corsMiddleware
+type CORSPolicy struct {
+	// origins - the allowed origins in lower case, every origin is allowed when it holds anyOrigin
+	origins          map[string]bool
+	allowedMethods   string
+	allowedHeaders   string
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+//LoadCORS - build the cross-origin policy from the "cors" configuration section.
+//Returns nil when cors.enabled is false, cross-origin requests are then served without CORS headers.
+func LoadCORS() (*CORSPolicy, error) {
+	if !config.GetBool("cors.enabled") {
+		return nil, nil
+	}
+
+	policy := &CORSPolicy{
+		origins:          make(map[string]bool),
+		allowedMethods:   strings.ToUpper(strings.Join(config.GetStringSlice("cors.allowedMethods"), ", ")),
+		allowedHeaders:   strings.Join(config.GetStringSlice("cors.allowedHeaders"), ", "),
+		exposedHeaders:   strings.Join(config.GetStringSlice("cors.exposedHeaders"), ", "),
+		allowCredentials: config.GetBool("cors.allowCredentials"),
+		maxAge:           config.GetDuration("cors.maxAge"),
+	}
+	for _, origin := range config.GetStringSlice("cors.allowedOrigins") {
+		if origin != anyOrigin {
+			originURL, err := url.Parse(origin)
+			if err != nil || (originURL.Scheme != "http" && originURL.Scheme != "https") || originURL.Host == "" ||
+				strings.TrimSuffix(originURL.Path, "/") != "" {
+				return nil, errors.Errorf("cors.allowedOrigins: %q is not an origin, such as https://app.example.com", origin)
+			}
+			origin = originURL.Scheme + "://" + originURL.Host
+		}
+		policy.origins[strings.ToLower(origin)] = true
+	}
+	if len(policy.origins) == 0 {
+		return nil, errors.New("cors.allowedOrigins: no origins configured")
+	}
+	if policy.origins[anyOrigin] && policy.allowCredentials {
+		return nil, errors.New("cors.allowCredentials: credentials can't be allowed for the * origin")
+	}
+	if policy.maxAge < 0 {
+		return nil, errors.New("cors.maxAge must not be negative")
+	}
+	return policy, nil
+}
+
+// allows - reports if the pages of the origin may call the service
+func (cp *CORSPolicy) allows(origin string) bool {
+	return cp.origins[anyOrigin] || cp.origins[strings.ToLower(origin)]
+}
+
+// isPreflight - reports if the request is a browser asking whether it may make a cross-origin request
+func isPreflight(request *http.Request) bool {
+	return request.Method == http.MethodOptions && request.Header.Get("Origin") != "" &&
+		request.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// preflightMatcher - matches the preflight requests of the allowed origins, whatever methods their path is served with
+func preflightMatcher(settings *Settings) mux.MatcherFunc {
+	return func(request *http.Request, match *mux.RouteMatch) bool {
+		policy := settings.Load().CORS
+		return policy != nil && isPreflight(request) && policy.allows(request.Header.Get("Origin"))
+	}
+}
+
+// corsMiddleware - answers the preflight requests of the allowed origins and lets their pages read the responses
+// of the service. Requests of other origins are served without CORS headers, so browsers don't expose the responses.
+// The policy is read per request, a reloaded policy applies to the requests that follow.
+func corsMiddleware(settings *Settings) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			policy := settings.Load().CORS
+			origin := request.Header.Get("Origin")
+			if policy == nil || origin == "" {
+				next.ServeHTTP(response, request)
+				return
+			}
+
+			header := response.Header()
+			header.Add("Vary", "Origin")
+			if !policy.allows(origin) {
+				next.ServeHTTP(response, request)
+				return
+			}
+			if policy.origins[anyOrigin] {
+				header.Set("Access-Control-Allow-Origin", anyOrigin)
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.allowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if isPreflight(request) {
+				header.Set("Access-Control-Allow-Methods", policy.allowedMethods)
+				if policy.allowedHeaders != "" {
+					header.Set("Access-Control-Allow-Headers", policy.allowedHeaders)
+				}
+				if policy.maxAge > 0 {
+					header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.maxAge/time.Second)))
+				}
+				response.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if policy.exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", policy.exposedHeaders)
+			}
+			next.ServeHTTP(response, request)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+
+	config "github.com/spf13/viper"
+)
+
+// serveCrossOriginRequest - serves the request of a page of the origin, preflights carry the requested method
+func serveCrossOriginRequest(router http.Handler, method string, path string, origin string, requestMethod string, authorization string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, nil)
+	request.Header.Set("Origin", origin)
+	if requestMethod != "" {
+		request.Header.Set("Access-Control-Request-Method", requestMethod)
+	}
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func Test_CORS(t *testing.T) {
+	defer config.Reset()
+	config.Set("cors.enabled", true)
+	config.Set("cors.allowedOrigins", []string{"https://App.example.com"})
+	config.Set("cors.allowedMethods", []string{"get", "post"})
+	config.Set("cors.allowedHeaders", []string{"Authorization", "Content-Type"})
+	config.Set("cors.exposedHeaders", []string{"X-Correlation-ID"})
+	config.Set("cors.maxAge", "10m")
+	policy, err := LoadCORS()
+	assert.NoError(t, err)
+
+	repository, _ := persistence.NewMemoryRepository()
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{}))
+	settings := NewSettings(RuntimeSettings{CORS: policy})
+	router := setupMux([]ServiceController{NewMessageController(repository)}, settings, authentication)
+	reader := "Bearer " + testToken("reader-1", "reader")
+
+	t.Run("Success path - preflight requests of allowed origins are answered without credentials", func(t *testing.T) {
+		response := serveCrossOriginRequest(router, http.MethodOptions, "/messages", "https://app.example.com", http.MethodPost, "")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		assert.Equal(t, "https://app.example.com", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "GET, POST", response.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Authorization, Content-Type", response.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "600", response.Header().Get("Access-Control-Max-Age"))
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("Success path - responses are exposed to the pages of allowed origins", func(t *testing.T) {
+		response := serveCrossOriginRequest(router, http.MethodGet, "/messages", "https://app.example.com", "", reader)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "https://app.example.com", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Correlation-ID", response.Header().Get("Access-Control-Expose-Headers"))
+		assert.Contains(t, response.Header()["Vary"], "Origin")
+
+		response = serveCrossOriginRequest(router, http.MethodGet, "/messages", "https://app.example.com", "", "")
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Equal(t, "https://app.example.com", response.Header().Get("Access-Control-Allow-Origin"), "rejections are readable too")
+	})
+
+	t.Run("Fail path - requests of other origins get no CORS headers", func(t *testing.T) {
+		response := serveCrossOriginRequest(router, http.MethodGet, "/messages", "https://evil.example.com", "", reader)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, response.Header()["Vary"], "Origin")
+
+		response = serveCrossOriginRequest(router, http.MethodOptions, "/messages", "https://evil.example.com", http.MethodPost, "")
+		assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Success path - a reloaded policy applies to the next requests", func(t *testing.T) {
+		config.Set("cors.allowedOrigins", []string{"*"})
+		policy, err := LoadCORS()
+		assert.NoError(t, err)
+		settings.Store(RuntimeSettings{CORS: policy})
+		response := serveCrossOriginRequest(router, http.MethodOptions, "/messages/5cfd2a7cbd0dd5f2b7e0ea2a", "https://evil.example.com", http.MethodDelete, "")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		assert.Equal(t, "*", response.Header().Get("Access-Control-Allow-Origin"))
+
+		settings.Store(RuntimeSettings{})
+		response = serveCrossOriginRequest(router, http.MethodOptions, "/messages", "https://app.example.com", http.MethodPost, "")
+		assert.Equal(t, http.StatusMethodNotAllowed, response.Code, "preflight requests are not answered once CORS is disabled")
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func Test_Load_CORS(t *testing.T) {
+	defer config.Reset()
+
+	policy, err := LoadCORS()
+	assert.NoError(t, err)
+	assert.Nil(t, policy, "disabled by default")
+
+	testCases := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		err         string
+	}{
+		{name: "Fail path - no origins", err: "cors.allowedOrigins: no origins configured"},
+		{name: "Fail path - a path is not an origin", origins: []string{"https://app.example.com/login"}, err: `cors.allowedOrigins: "https://app.example.com/login" is not an origin, such as https://app.example.com`},
+		{name: "Fail path - a host is not an origin", origins: []string{"app.example.com"}, err: `cors.allowedOrigins: "app.example.com" is not an origin, such as https://app.example.com`},
+		{name: "Fail path - credentials of any origin", origins: []string{"*"}, credentials: true, err: "cors.allowCredentials: credentials can't be allowed for the * origin"},
+	}
+	config.Set("cors.enabled", true)
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config.Set("cors.allowedOrigins", testCase.origins)
+			config.Set("cors.allowCredentials", testCase.credentials)
+			_, err := LoadCORS()
+			assert.EqualError(t, err, testCase.err)
+		})
+	}
+}
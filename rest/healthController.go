@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shauera/messages/health"
+	"github.com/shauera/messages/model"
+
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HealthController - handles the liveness, readiness and health endpoints probed by orchestrators.
+// The endpoints do not require authentication.
+type HealthController struct {
+	health      *health.Health
+	serviceMode *ServiceMode
+}
+
+//NewHealthController - return a new health controller reporting the given health
+func NewHealthController(health *health.Health) HealthController {
+	return HealthController{health: health}
+}
+
+//WithServiceMode - return a copy of the controller reporting the mode of the service in the health report
+func (hc HealthController) WithServiceMode(serviceMode *ServiceMode) HealthController {
+	hc.serviceMode = serviceMode
+	return hc
+}
+
+//PublishEndpoints - implementation of ServiceController
+func (hc HealthController) PublishEndpoints(router *mux.Router) {
+	router.HandleFunc("/healthz", traced("HealthController.Liveness", hc.Liveness)).Methods("GET")
+	router.HandleFunc("/readyz", traced("HealthController.Readiness", hc.Readiness)).Methods("GET")
+	router.HandleFunc("/health", traced("HealthController.Health", hc.Health)).Methods("GET")
+}
+
+// Liveness - reports the service is live
+func (hc *HealthController) Liveness(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /healthz health liveness
+	//
+	// Reports the service process is live, dependencies are not checked
+	// ---
+	// security: []
+	// produces:
+	// - application/json
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/HealthReport"
+
+	writeHealthReport(response, request, hc.health.Liveness())
+}
+
+// Readiness - reports if the service is ready to serve requests
+func (hc *HealthController) Readiness(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /readyz health readiness
+	//
+	// Reports if the service is ready to serve requests, it is not ready while starting,
+	// once shutting down or when a dependency is not available
+	// ---
+	// security: []
+	// produces:
+	// - application/json
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/HealthReport"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/HealthReport"
+
+	writeHealthReport(response, request, hc.health.Readiness(request.Context()))
+}
+
+// Health - reports the state of the service and the checks of its dependencies in detail
+func (hc *HealthController) Health(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /health health health
+	//
+	// Reports the readiness of the service with the latency of each dependency check, the build version and the mode
+	// ---
+	// security: []
+	// produces:
+	// - application/json
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/HealthReport"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/HealthReport"
+
+	report := hc.health.Report(request.Context())
+	if hc.serviceMode != nil {
+		report.Mode = hc.serviceMode.Get()
+	}
+	writeHealthReport(response, request, report)
+}
+
+// writeHealthReport - renders the report, 503 when the report is down
+func writeHealthReport(response http.ResponseWriter, request *http.Request, report model.HealthReport) {
+	status := http.StatusOK
+	if report.Status != model.HealthStatusUp {
+		status = http.StatusServiceUnavailable
+		log.WithContext(request.Context()).WithField("state", report.State).WithField("checks", report.Checks).
+			WithField("correlationId", getCorrelationID(request)).Warn("Service is not ready")
+	}
+
+	response.Header().Set("content-type", "application/json")
+	response.Header().Set("Cache-Control", "no-store")
+	response.WriteHeader(status)
+	json.NewEncoder(response).Encode(report)
+}
@@ -0,0 +1,56 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/buildinfo"
+	"github.com/shauera/messages/health"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Health(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	serviceHealth := health.NewHealth(time.Second, health.PingCheck("database", repository))
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{}))
+	router := setupMux([]ServiceController{NewHealthController(serviceHealth)}, DefaultSettings(), authentication)
+
+	report := func(t *testing.T, path string, expectedStatus int) model.HealthReport {
+		response := serveRequest(router, http.MethodGet, path, "", "")
+		assert.Equal(t, expectedStatus, response.Code)
+		var report model.HealthReport
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &report))
+		return report
+	}
+
+	t.Run("Success path - live while starting", func(t *testing.T) {
+		assert.Equal(t, model.HealthStatusUp, report(t, "/healthz", http.StatusOK).Status)
+		assert.Equal(t, health.StateStarting, report(t, "/readyz", http.StatusServiceUnavailable).State)
+	})
+
+	t.Run("Success path - ready once started", func(t *testing.T) {
+		serviceHealth.Started()
+		readiness := report(t, "/readyz", http.StatusOK)
+		assert.Equal(t, health.StateReady, readiness.State)
+		assert.Empty(t, readiness.Version)
+
+		detailed := report(t, "/health", http.StatusOK)
+		assert.Equal(t, buildinfo.Version, detailed.Version)
+		assert.NotNil(t, detailed.StartedAt)
+		assert.Len(t, detailed.Checks, 1)
+		assert.Equal(t, "database", detailed.Checks[0].Name)
+	})
+
+	t.Run("Fail path - not ready once stopping", func(t *testing.T) {
+		serviceHealth.Stopping()
+		assert.Equal(t, health.StateStopping, report(t, "/readyz", http.StatusServiceUnavailable).State)
+		assert.Equal(t, model.HealthStatusUp, report(t, "/healthz", http.StatusOK).Status)
+	})
+}
@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/idempotency"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/ratelimit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// idempotencyKeyHeader - the request header carrying the key that makes repeated POST requests safe
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader - the response header marking replayed responses
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength - the length of the longest key accepted
+const maxIdempotencyKeyLength = 255
+
+// idempotencyMiddleware - serves POST requests with an Idempotency-Key header at most once.
+// The response of the first request of a key is stored and replayed for repeated requests of the same
+// client, resource and body. Repeating a key with another body gets 422 and repeating it while the first
+// request is being served gets 409. Responses of server errors and of rate limited requests are not stored,
+// the request can be retried.
+// Must be applied after authenticationMiddleware, keys are scoped to the client of the request.
+// The values of the scope headers (the tenant header) are part of the scope as well.
+func idempotencyMiddleware(keys *idempotency.Keys, trustedProxies ratelimit.TrustedProxies, scopeHeaders ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			key := request.Header.Get(idempotencyKeyHeader)
+			if request.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(response, request)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeProblem(response, request, model.ProblemResponse{
+					Type:   model.ProblemTypeMalformedRequest,
+					Status: http.StatusBadRequest,
+					Detail: "The Idempotency-Key header is too long",
+				})
+				return
+			}
+
+			body, err := ioutil.ReadAll(request.Body)
+			if err != nil {
+				writeProblem(response, request, model.ProblemResponse{
+					Type:   model.ProblemTypeMalformedRequest,
+					Status: http.StatusBadRequest,
+					Detail: "The request body could not be read",
+				})
+				return
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			principal, _ := auth.FromContext(request.Context())
+			scope := []string{clientKey(request, principal, trustedProxies), request.Host, request.URL.Path}
+			for _, header := range scopeHeaders {
+				scope = append(scope, request.Header.Get(header))
+			}
+			id := idempotency.Hash([]byte(strings.Join(append(scope, key), "\n")))
+
+			record, err := keys.Begin(request.Context(), id, idempotency.Hash(body))
+			switch {
+			case err == idempotency.ErrorKeyReused:
+				writeProblem(response, request, model.ProblemResponse{
+					Type:   model.ProblemTypeIdempotencyKeyReused,
+					Status: http.StatusUnprocessableEntity,
+					Detail: "The Idempotency-Key was used with a different request body",
+				})
+				return
+			case err == idempotency.ErrorInProgress:
+				response.Header().Set("Retry-After", "1")
+				writeProblem(response, request, model.ProblemResponse{
+					Type:   model.ProblemTypeRequestInProgress,
+					Status: http.StatusConflict,
+					Detail: "A request with the same Idempotency-Key is being served",
+				})
+				return
+			case err != nil:
+				writeError(response, request, err, "Could not look up idempotency key")
+				return
+			case record.Completed:
+				log.WithContext(request.Context()).WithField("correlationId", getCorrelationID(request)).Debug("Replaying idempotent response")
+				for name, values := range record.Header {
+					response.Header()[name] = values
+				}
+				response.Header().Set(idempotentReplayedHeader, "true")
+				response.WriteHeader(record.Status)
+				response.Write(record.Body)
+				return
+			}
+
+			recorder := newResponseRecorder(response)
+			next.ServeHTTP(recorder, request)
+
+			if recorder.status >= http.StatusInternalServerError || recorder.status == http.StatusTooManyRequests {
+				err = keys.Release(request.Context(), record)
+			} else {
+				err = keys.Complete(request.Context(), record, recorder.status, recorder.handlerHeader(), recorder.body.Bytes())
+			}
+			if err != nil {
+				log.WithContext(request.Context()).WithError(err).WithField("correlationId", getCorrelationID(request)).Error("Could not store idempotent response")
+			}
+		})
+	}
+}
+
+// responseRecorder - passes a response on while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	// initialHeader - the headers set before the handler was called, by other middlewares
+	initialHeader http.Header
+}
+
+func newResponseRecorder(response http.ResponseWriter) *responseRecorder {
+	initialHeader := make(http.Header)
+	for name, values := range response.Header() {
+		initialHeader[name] = values
+	}
+	return &responseRecorder{ResponseWriter: response, status: http.StatusOK, initialHeader: initialHeader}
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	rr.body.Write(data)
+	return rr.ResponseWriter.Write(data)
+}
+
+// handlerHeader - the headers set by the handler, except the rate limit headers that describe the current limits
+func (rr *responseRecorder) handlerHeader() map[string][]string {
+	header := make(map[string][]string)
+	for name, values := range rr.Header() {
+		if _, ok := rr.initialHeader[name]; !ok {
+			header[name] = values
+		}
+	}
+	for _, name := range rateLimitHeaders {
+		delete(header, http.CanonicalHeaderKey(name))
+	}
+	return header
+}
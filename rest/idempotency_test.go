@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/idempotency"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Idempotency_Key(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{}))
+	router := setupMux([]ServiceController{NewMessageController(repository)}, DefaultSettings(), authentication)
+	keys := idempotency.NewKeys(repository, time.Hour, time.Minute)
+	router.Use(idempotencyMiddleware(keys, nil))
+
+	editor := "Bearer " + testToken("editor-1", "editor")
+	post := func(idempotencyKey string, body string, authorization string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(body))
+		request.Header.Set("content-type", "application/json")
+		request.Header.Set("Authorization", authorization)
+		request.Header.Set(idempotencyKeyHeader, idempotencyKey)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Success path - repeated requests are replayed", func(t *testing.T) {
+		first := post("create-abba", `{"content": "abba"}`, editor)
+		assert.Equal(t, http.StatusOK, first.Code)
+
+		repeated := post("create-abba", `{"content": "abba"}`, editor)
+		assert.Equal(t, http.StatusOK, repeated.Code)
+		assert.Equal(t, first.Body.String(), repeated.Body.String())
+		assert.Equal(t, "true", repeated.Header().Get(idempotentReplayedHeader))
+		assert.Equal(t, first.Header().Get("content-type"), repeated.Header().Get("content-type"))
+		assert.NotEqual(t, first.Header().Get(correlationIDHeader), repeated.Header().Get(correlationIDHeader))
+		assert.Len(t, repository.GetMessagesStorage(), 1)
+	})
+
+	t.Run("Success path - keys are scoped to clients", func(t *testing.T) {
+		response := post("create-abba", `{"content": "abba"}`, "Bearer "+testToken("editor-2", "editor"))
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Empty(t, response.Header().Get(idempotentReplayedHeader))
+		assert.Len(t, repository.GetMessagesStorage(), 2)
+	})
+
+	t.Run("Fail path - key reused with another body", func(t *testing.T) {
+		response := post("create-abba", `{"content": "abc"}`, editor)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+		assert.Contains(t, response.Body.String(), model.ProblemTypeIdempotencyKeyReused)
+	})
+
+	t.Run("Fail path - request in progress", func(t *testing.T) {
+		principal := auth.Principal{Subject: "editor-1", Method: auth.MethodJWT}
+		request := httptest.NewRequest(http.MethodPost, "/messages", nil)
+		scope := clientKey(request, principal, nil) + "\n" + request.Host + "\n/messages\nin-progress"
+		_, err := keys.Begin(request.Context(), idempotency.Hash([]byte(scope)), idempotency.Hash([]byte(`{"content": "abba"}`)))
+		assert.NoError(t, err)
+
+		response := post("in-progress", `{"content": "abba"}`, editor)
+		assert.Equal(t, http.StatusConflict, response.Code)
+		assert.Contains(t, response.Body.String(), model.ProblemTypeRequestInProgress)
+	})
+
+	t.Run("Success path - client errors are replayed", func(t *testing.T) {
+		response := post("invalid", `{"content": ""}`, editor)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		response = post("invalid", `{"content": ""}`, editor)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, "true", response.Header().Get(idempotentReplayedHeader))
+	})
+}
@@ -0,0 +1,278 @@
+package rest
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/metrics"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/resilience"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedMessageRepository - records the latency, the errors and a span of every operation of a message repository.
+// Operations fail fast while the circuit breaker of the database is open.
+type instrumentedMessageRepository struct {
+	repository MessageRepository
+	backend    string
+	breaker    *resilience.Breaker
+}
+
+// instrumentedRepository - records the latency, the errors and a span of every operation of a repository.
+// Operations fail fast while the circuit breaker of the database is open.
+type instrumentedRepository struct {
+	instrumentedMessageRepository
+	repository Repository
+}
+
+//newInstrumentedRepository - returns the repository recording the metrics of the given backend, guarded by the breaker (optional)
+func newInstrumentedRepository(repository Repository, backend string, breaker *resilience.Breaker) instrumentedRepository {
+	return instrumentedRepository{
+		instrumentedMessageRepository: instrumentedMessageRepository{repository: repository, backend: backend, breaker: breaker},
+		repository:                    repository,
+	}
+}
+
+// call - runs an operation in a span and records its latency and errors. The operation is not run
+// while the breaker is open, database outages (unavailable or timing out) count as failures of the breaker.
+func (imr instrumentedMessageRepository) call(ctx context.Context, operation string, run func(ctx context.Context) error) (err error) {
+	start := time.Now()
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "Repository."+operation, trace.WithAttributes(attribute.String("db.backend", imr.backend)))
+	defer func() {
+		metrics.RepositoryOperationDuration.WithLabelValues(imr.backend, operation).Observe(metrics.Since(start))
+		if err != nil {
+			metrics.RepositoryErrors.WithLabelValues(imr.backend, operation, errorKind(err)).Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if err = imr.breaker.Allow(); err != nil {
+		return err
+	}
+	err = run(ctx)
+	imr.breaker.Record(isOutage(err))
+	return err
+}
+
+// isOutage - reports if err tells the database is unavailable, rather than rejecting the operation
+func isOutage(err error) bool {
+	cause := errors.Cause(err)
+	return cause == persistence.ErrorUnavailable || cause == persistence.ErrorTimeout
+}
+
+// errorKind - the persistence error of err in snake case, "circuit_open" for calls rejected by the breaker
+// and "internal" for other errors
+func errorKind(err error) string {
+	switch cause := errors.Cause(err).(type) {
+	case persistence.Error:
+		return strings.Replace(strings.ToLower(cause.Error()), " ", "_", -1)
+	case resilience.OpenError:
+		return "circuit_open"
+	}
+	return "internal"
+}
+
+func (imr instrumentedMessageRepository) FindMessageByID(ctx context.Context, id string, fields model.Projection, access model.Access) (result *model.MessageResponse, err error) {
+	err = imr.call(ctx, "FindMessageByID", func(ctx context.Context) (err error) {
+		result, err = imr.repository.FindMessageByID(ctx, id, fields, access)
+		return err
+	})
+	return result, err
+}
+
+func (imr instrumentedMessageRepository) CreateMessage(ctx context.Context, message model.MessageRequest, createdBy string) (result *model.MessageResponse, err error) {
+	err = imr.call(ctx, "CreateMessage", func(ctx context.Context) (err error) {
+		result, err = imr.repository.CreateMessage(ctx, message, createdBy)
+		return err
+	})
+	return result, err
+}
+
+func (imr instrumentedMessageRepository) StreamMessages(ctx context.Context, fields model.Projection, access model.Access) (result model.MessageIterator, err error) {
+	err = imr.call(ctx, "StreamMessages", func(ctx context.Context) (err error) {
+		result, err = imr.repository.StreamMessages(ctx, fields, access)
+		return err
+	})
+	return result, err
+}
+
+func (imr instrumentedMessageRepository) DeleteMessageByID(ctx context.Context, id string, access model.Access) error {
+	return imr.call(ctx, "DeleteMessageByID", func(ctx context.Context) error {
+		return imr.repository.DeleteMessageByID(ctx, id, access)
+	})
+}
+
+func (imr instrumentedMessageRepository) ReplaceMessageByID(ctx context.Context, id string, message model.MessageRequest, access model.Access) (result *model.MessageResponse, err error) {
+	err = imr.call(ctx, "ReplaceMessageByID", func(ctx context.Context) (err error) {
+		result, err = imr.repository.ReplaceMessageByID(ctx, id, message, access)
+		return err
+	})
+	return result, err
+}
+
+func (imr instrumentedMessageRepository) PatchMessageByID(ctx context.Context, id string, access model.Access, mutation model.MessageMutation) (result *model.MessageResponse, err error) {
+	err = imr.call(ctx, "PatchMessageByID", func(ctx context.Context) (err error) {
+		result, err = imr.repository.PatchMessageByID(ctx, id, access, mutation)
+		return err
+	})
+	return result, err
+}
+
+func (imr instrumentedMessageRepository) FindAuthors(ctx context.Context, names []string, access model.Access) (result map[string]model.Author, err error) {
+	err = imr.call(ctx, "FindAuthors", func(ctx context.Context) (err error) {
+		result, err = imr.repository.FindAuthors(ctx, names, access)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) CreateAPIKey(ctx context.Context, key model.APIKey) error {
+	return ir.call(ctx, "CreateAPIKey", func(ctx context.Context) error {
+		return ir.repository.CreateAPIKey(ctx, key)
+	})
+}
+
+func (ir instrumentedRepository) FindAPIKeyByID(ctx context.Context, id string) (result *model.APIKey, err error) {
+	err = ir.call(ctx, "FindAPIKeyByID", func(ctx context.Context) (err error) {
+		result, err = ir.repository.FindAPIKeyByID(ctx, id)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) ListAPIKeys(ctx context.Context) (result model.APIKeys, err error) {
+	err = ir.call(ctx, "ListAPIKeys", func(ctx context.Context) (err error) {
+		result, err = ir.repository.ListAPIKeys(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) RevokeAPIKeyByID(ctx context.Context, id string, revokedAt time.Time) error {
+	return ir.call(ctx, "RevokeAPIKeyByID", func(ctx context.Context) error {
+		return ir.repository.RevokeAPIKeyByID(ctx, id, revokedAt)
+	})
+}
+
+func (ir instrumentedRepository) TouchAPIKeyByID(ctx context.Context, id string, usedAt time.Time) error {
+	return ir.call(ctx, "TouchAPIKeyByID", func(ctx context.Context) error {
+		return ir.repository.TouchAPIKeyByID(ctx, id, usedAt)
+	})
+}
+
+func (ir instrumentedRepository) CreateUser(ctx context.Context, user model.User) error {
+	return ir.call(ctx, "CreateUser", func(ctx context.Context) error {
+		return ir.repository.CreateUser(ctx, user)
+	})
+}
+
+func (ir instrumentedRepository) FindUserByName(ctx context.Context, tenant string, username string) (result *model.User, err error) {
+	err = ir.call(ctx, "FindUserByName", func(ctx context.Context) (err error) {
+		result, err = ir.repository.FindUserByName(ctx, tenant, username)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) UpdateUserByName(ctx context.Context, tenant string, username string, mutation model.UserMutation) (result *model.User, err error) {
+	err = ir.call(ctx, "UpdateUserByName", func(ctx context.Context) (err error) {
+		result, err = ir.repository.UpdateUserByName(ctx, tenant, username, mutation)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) CreateTenant(ctx context.Context, tenant model.Tenant) error {
+	return ir.call(ctx, "CreateTenant", func(ctx context.Context) error {
+		return ir.repository.CreateTenant(ctx, tenant)
+	})
+}
+
+func (ir instrumentedRepository) FindTenantByID(ctx context.Context, id string) (result *model.Tenant, err error) {
+	err = ir.call(ctx, "FindTenantByID", func(ctx context.Context) (err error) {
+		result, err = ir.repository.FindTenantByID(ctx, id)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) ListTenants(ctx context.Context) (result model.Tenants, err error) {
+	err = ir.call(ctx, "ListTenants", func(ctx context.Context) (err error) {
+		result, err = ir.repository.ListTenants(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) UpdateTenantSettings(ctx context.Context, id string, settings model.TenantSettings) (result *model.Tenant, err error) {
+	err = ir.call(ctx, "UpdateTenantSettings", func(ctx context.Context) (err error) {
+		result, err = ir.repository.UpdateTenantSettings(ctx, id, settings)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) DeleteTenantByID(ctx context.Context, id string) error {
+	return ir.call(ctx, "DeleteTenantByID", func(ctx context.Context) error {
+		return ir.repository.DeleteTenantByID(ctx, id)
+	})
+}
+
+// MaxTenantIDLength - no database is called, the call is not instrumented
+func (ir instrumentedRepository) MaxTenantIDLength() int {
+	return ir.repository.MaxTenantIDLength()
+}
+
+func (ir instrumentedRepository) IncrementQuota(ctx context.Context, id string, limit int, expiresAt time.Time) (result int, err error) {
+	err = ir.call(ctx, "IncrementQuota", func(ctx context.Context) (err error) {
+		result, err = ir.repository.IncrementQuota(ctx, id, limit, expiresAt)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) DecrementQuota(ctx context.Context, id string) error {
+	return ir.call(ctx, "DecrementQuota", func(ctx context.Context) error {
+		return ir.repository.DecrementQuota(ctx, id)
+	})
+}
+
+func (ir instrumentedRepository) CreateIdempotencyRecord(ctx context.Context, record model.IdempotencyRecord) error {
+	return ir.call(ctx, "CreateIdempotencyRecord", func(ctx context.Context) error {
+		return ir.repository.CreateIdempotencyRecord(ctx, record)
+	})
+}
+
+func (ir instrumentedRepository) FindIdempotencyRecord(ctx context.Context, id string) (result *model.IdempotencyRecord, err error) {
+	err = ir.call(ctx, "FindIdempotencyRecord", func(ctx context.Context) (err error) {
+		result, err = ir.repository.FindIdempotencyRecord(ctx, id)
+		return err
+	})
+	return result, err
+}
+
+func (ir instrumentedRepository) CompleteIdempotencyRecord(ctx context.Context, record model.IdempotencyRecord) error {
+	return ir.call(ctx, "CompleteIdempotencyRecord", func(ctx context.Context) error {
+		return ir.repository.CompleteIdempotencyRecord(ctx, record)
+	})
+}
+
+func (ir instrumentedRepository) DeleteIdempotencyRecord(ctx context.Context, id string, expiresAt time.Time) error {
+	return ir.call(ctx, "DeleteIdempotencyRecord", func(ctx context.Context) error {
+		return ir.repository.DeleteIdempotencyRecord(ctx, id, expiresAt)
+	})
+}
+
+func (ir instrumentedRepository) Ping(ctx context.Context) error {
+	return ir.call(ctx, "Ping", func(ctx context.Context) error {
+		return ir.repository.Ping(ctx)
+	})
+}
@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/health"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/resilience"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// outageRepository - a memory repository whose message lookups and pings fail while it is down
+type outageRepository struct {
+	*persistence.MemoryRepository
+	down  bool
+	calls int
+}
+
+func (or *outageRepository) FindMessageByID(ctx context.Context, id string, fields model.Projection, access model.Access) (*model.MessageResponse, error) {
+	or.calls++
+	if or.down {
+		return nil, errors.Wrap(persistence.ErrorUnavailable, "connection refused")
+	}
+	return or.MemoryRepository.FindMessageByID(ctx, id, fields, access)
+}
+
+func (or *outageRepository) Ping(ctx context.Context) error {
+	or.calls++
+	if or.down {
+		return errors.Wrap(persistence.ErrorUnavailable, "connection refused")
+	}
+	return nil
+}
+
+func Test_Database_Outage(t *testing.T) {
+	memoryRepository, _ := persistence.NewMemoryRepository()
+	outage := &outageRepository{MemoryRepository: memoryRepository}
+	breaker := resilience.NewBreaker(2, 50*time.Millisecond)
+	repository := newInstrumentedRepository(outage, "memory", breaker)
+	serviceHealth := health.NewHealth(time.Second, health.PingCheck("database", repository))
+	serviceHealth.Started()
+	router := setupMux([]ServiceController{NewMessageController(repository), NewHealthController(serviceHealth)}, DefaultSettings(), auth.Disabled())
+
+	t.Run("Fail path - outages are reported as unavailable", func(t *testing.T) {
+		outage.down = true
+		for attempt := 0; attempt < 2; attempt++ {
+			response := serveRequest(router, http.MethodGet, "/messages/1", "", "")
+			assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+			assert.Equal(t, "1", response.Header().Get("Retry-After"))
+			assert.Contains(t, response.Body.String(), model.ProblemTypeUnavailable)
+		}
+		assert.Equal(t, resilience.StateOpen, breaker.State())
+	})
+
+	t.Run("Fail path - calls fail fast while the breaker is open", func(t *testing.T) {
+		calls := outage.calls
+		response := serveRequest(router, http.MethodGet, "/messages/1", "", "")
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.NotEmpty(t, response.Header().Get("Retry-After"))
+		assert.Contains(t, response.Body.String(), model.ProblemTypeUnavailable)
+
+		response = serveRequest(router, http.MethodGet, "/readyz", "", "")
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Contains(t, response.Body.String(), "Circuit breaker open")
+		assert.Equal(t, calls, outage.calls, "the database is not called")
+	})
+
+	t.Run("Success path - the breaker closes once the database is back", func(t *testing.T) {
+		outage.down = false
+		time.Sleep(50 * time.Millisecond)
+
+		response := serveRequest(router, http.MethodGet, "/readyz", "", "")
+		assert.Equal(t, http.StatusOK, response.Code, "the readiness ping is the trial call")
+		assert.Equal(t, resilience.StateClosed, breaker.State())
+
+		response = serveRequest(router, http.MethodGet, "/messages/1", "", "")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Equal(t, resilience.StateClosed, breaker.State(), "missing records are not outages")
+	})
+}
@@ -1,48 +1,127 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io/ioutil"
+	"mime"
 	"net/http"
 
 	"github.com/pkg/errors"
+	"github.com/shauera/messages/analysis"
+	"github.com/shauera/messages/auth"
 	"github.com/shauera/messages/model"
-	modelCommon "github.com/shauera/messages/model"
-	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/patch"
+	"github.com/shauera/messages/render"
+	"github.com/shauera/messages/tenancy"
+	"github.com/shauera/messages/validation"
 
 	"github.com/gorilla/mux"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// MessageRepository - repository abstraction to be implemented by persisters
+// MessageRepository - repository abstraction to be implemented by persisters.
+// Reads and changes are limited to the messages the access allows, messages that can't be read
+// are reported as not found and messages that can be read but not changed as forbidden.
 type MessageRepository interface {
-	FindMessageByID(ctx context.Context, id string) (*model.MessageResponse, error)
-	CreateMessage(ctx context.Context, message model.MessageRequest) (*model.MessageResponse, error)
-	ListMessages(ctx context.Context) (model.MessageResponses, error)
-	DeleteMessageByID(ctx context.Context, id string) error
-	UpdateMessageByID(ctx context.Context, id string, message model.MessageRequest) (*model.MessageResponse, error)
+	FindMessageByID(ctx context.Context, id string, fields model.Projection, access model.Access) (*model.MessageResponse, error)
+	CreateMessage(ctx context.Context, message model.MessageRequest, createdBy string) (*model.MessageResponse, error)
+	StreamMessages(ctx context.Context, fields model.Projection, access model.Access) (model.MessageIterator, error)
+	DeleteMessageByID(ctx context.Context, id string, access model.Access) error
+	ReplaceMessageByID(ctx context.Context, id string, message model.MessageRequest, access model.Access) (*model.MessageResponse, error)
+	PatchMessageByID(ctx context.Context, id string, access model.Access, mutation model.MessageMutation) (*model.MessageResponse, error)
+	FindAuthors(ctx context.Context, names []string, access model.Access) (map[string]model.Author, error)
 }
 
 // MessageController - handles message resource endpoints
 type MessageController struct {
-	repository MessageRepository
+	repository   MessageRepository
+	settings     *Settings
+	codecs       *render.Registry
+	tenancy      *tenancy.Tenancy
+	repositories MessageRepositories
 }
 
 //NewMessageController - return a new message controller setup with a designated message repository
+//Requests are validated with the default rules and analyzed by all the analyzers, see WithSettings
+//Responses and requests are encoded by the shared registry of codecs (render.Default)
 func NewMessageController(messageRepository MessageRepository) MessageController {
 	return MessageController{
 		repository: messageRepository,
+		settings:   DefaultSettings(),
+		codecs:     render.Default,
 	}
 }
 
+//WithValidationRules - return a copy of the controller validating message requests with the given rules
+func (mc MessageController) WithValidationRules(rules validation.MessageRules) MessageController {
+	runtimeSettings := mc.settings.Load()
+	runtimeSettings.MessageRules = rules
+	mc.settings = NewSettings(runtimeSettings)
+	return mc
+}
+
+//WithSettings - return a copy of the controller validating and analyzing messages according to the
+//current runtime settings, so reloaded settings apply to the requests that follow
+func (mc MessageController) WithSettings(settings *Settings) MessageController {
+	mc.settings = settings
+	return mc
+}
+
+//WithTenancy - return a copy of the controller serving the messages of the tenant of each request.
+//The messages of a tenant are kept in the repository returned by repositories and are validated and
+//analyzed according to the tenant settings.
+func (mc MessageController) WithTenancy(tenants *tenancy.Tenancy, repositories MessageRepositories) MessageController {
+	mc.tenancy = tenants
+	mc.repositories = repositories
+	return mc
+}
+
 //PublishEndpoints - implementation of ServiceController
 func (mc MessageController) PublishEndpoints(router *mux.Router) {
-	router.HandleFunc("/messages", mc.CreateMessage).Methods("POST")
-	router.HandleFunc("/messages", mc.ListMessages).Methods("GET")
-	router.HandleFunc("/messages/{id}", mc.GetMessageByID).Methods("GET")
-	router.HandleFunc("/messages/{id}", mc.UpdateMessageByID).Methods("PUT")
-	router.HandleFunc("/messages/{id}", mc.DeleteMessageByID).Methods("DELETE")
+	router.Handle("/messages", requirePermission(auth.PermissionCreateMessages, mc.scoped(traced("MessageController.CreateMessage", mc.CreateMessage)))).Methods("POST")
+	router.Handle("/messages", requirePermission(auth.PermissionReadMessages, mc.scoped(traced("MessageController.ListMessages", mc.ListMessages)))).Methods("GET")
+	router.Handle("/messages/export", requirePermission(auth.PermissionReadMessages, mc.scoped(traced("MessageController.ExportMessages", mc.ExportMessages)))).Methods("GET")
+	router.Handle("/messages/{id}", requirePermission(auth.PermissionReadMessages, mc.scoped(traced("MessageController.GetMessageByID", mc.GetMessageByID)))).Methods("GET")
+	router.Handle("/messages/{id}", requireAnyPermission(updatePermissions, mc.scoped(traced("MessageController.UpdateMessageByID", mc.UpdateMessageByID)))).Methods("PUT")
+	router.Handle("/messages/{id}", requireAnyPermission(updatePermissions, mc.scoped(traced("MessageController.PatchMessageByID", mc.PatchMessageByID)))).Methods("PATCH")
+	router.Handle("/messages/{id}", requirePermission(auth.PermissionDeleteMessages, mc.scoped(traced("MessageController.DeleteMessageByID", mc.DeleteMessageByID)))).Methods("DELETE")
+}
+
+//scoped - serves the request in the context of its tenant when the service has tenants
+func (mc MessageController) scoped(handler http.HandlerFunc) http.HandlerFunc {
+	if mc.tenancy == nil {
+		return handler
+	}
+	return requireTenant(mc.tenancy, handler)
+}
+
+//repositoryFor - the repository of the messages of the tenant of the request
+func (mc *MessageController) repositoryFor(ctx context.Context) MessageRepository {
+	if tenant, ok := tenantFromContext(ctx); ok && mc.repositories != nil {
+		return mc.repositories(tenant.ID)
+	}
+	return mc.repository
+}
+
+//rulesFor - the validation rules of the tenant of the request
+func (mc *MessageController) rulesFor(ctx context.Context) validation.MessageRules {
+	rules := mc.settings.Load().MessageRules
+	if tenant, ok := tenantFromContext(ctx); ok {
+		return tenant.Settings.MessageRules(rules)
+	}
+	return rules
+}
+
+//analyzersFor - the analyzers of the tenant of the request
+func (mc *MessageController) analyzersFor(ctx context.Context) analysis.Analyzers {
+	analyzers := mc.settings.Load().Analyzers
+	if tenant, ok := tenantFromContext(ctx); ok {
+		return analyzers.Select(tenant.Settings.Analyzers)
+	}
+	return analyzers
 }
 
 //------------------------------- Create -----------------------------------------
@@ -55,8 +134,15 @@ func (mc *MessageController) CreateMessage(response http.ResponseWriter, request
 	// ---
 	// consumes:
 	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
 	// produces:
 	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
 	// parameters:
 	// - name: messageRequest
 	//   in: body
@@ -65,29 +151,72 @@ func (mc *MessageController) CreateMessage(response http.ResponseWriter, request
 	//   type: MessageRequest
 	//   schema:
 	//     "$ref": "#/definitions/MessageRequest"
+	// - name: timeFormat
+	//   in: query
+	//   description: representation of times in the response - rfc3339 (default), unix or unixms.
+	//   required: false
+	//   type: string
+	//   enum: [rfc3339, unix, unixms]
+	// - name: X-Time-Format
+	//   in: header
+	//   description: same as timeFormat, the query parameter takes precedence.
+	//   required: false
+	//   type: string
 	// responses:
 	//   '200':
 	//     description: OK
 	//     type: string
 	//   '400':
 	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	//   '500':
 	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	timeFormat, err := getTimeFormat(response, request)
+	if err != nil {
+		return
+	}
+
+	codec, err := negotiate(response, request, mc.codecs, model.MessageResponse{})
+	if err != nil {
+		return
+	}
 
-	newMessage, err := validateRequest(response, request)
+	newMessage, err := mc.validateRequest(response, request)
 	if err != nil {
 		return
 	}
 
-	messageID, err := mc.repository.CreateMessage(request.Context(), *newMessage)
+	messageID, err := mc.repositoryFor(request.Context()).CreateMessage(request.Context(), *newMessage, createdBy(request.Context()))
 	if err != nil {
-		response.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(response).Encode(modelCommon.ErrorResponse{Message: err.Error()})
-		log.WithError(err).Debug("Could not create message")
+		writeError(response, request, err, "Could not create message")
 		return
 	}
 
-	json.NewEncoder(response).Encode(messageID)
+	writeResponse(response, codec, "message", messageID.WithTimeFormat(timeFormat))
 }
 
 //------------------------------- Gel All ----------------------------------------
@@ -104,24 +233,250 @@ func (mc *MessageController) ListMessages(response http.ResponseWriter, request
 	// - application/json
 	// produces:
 	// - application/json
+	// - application/x-ndjson
+	// - application/xml
+	// - application/yaml
+	// - text/csv
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: timeFormat
+	//   in: query
+	//   description: representation of times in the response - rfc3339 (default), unix or unixms.
+	//   required: false
+	//   type: string
+	//   enum: [rfc3339, unix, unixms]
+	// - name: X-Time-Format
+	//   in: header
+	//   description: same as timeFormat, the query parameter takes precedence.
+	//   required: false
+	//   type: string
+	// - name: fields
+	//   in: query
+	//   description: comma separated fields to return - id, content, author, createdAt and palindrome, all when missing.
+	//   required: false
+	//   type: string
+	// - name: exclude
+	//   in: query
+	//   description: comma separated fields to leave out of the response.
+	//   required: false
+	//   type: string
+	// - name: expand
+	//   in: query
+	//   description: comma separated related resources to embed - author (an Author object replaces the name) and analysis.
+	//   required: false
+	//   type: string
 	// responses:
 	//   '200':
 	//     description: OK
 	//     schema:
 	//       "$ref": "#/definitions/MessageResponses"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	//   '500':
 	//     description: Internal Server Error
-	response.Header().Set("content-type", "application/json")
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	view, expansions, err := getView(response, request)
+	if err != nil {
+		return
+	}
+
+	codec, err := negotiate(response, request, mc.codecs, model.MessageResponses{})
+	if err != nil {
+		return
+	}
+
+	mc.streamMessages(response, request, codec, view, expansions)
+}
+
+//------------------------------- Export -----------------------------------------
+
+// ExportMessages - streams all available messages, as NDJSON unless another media type is requested
+func (mc *MessageController) ExportMessages(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /messages/export messages exportMessages
+	//
+	// Exports all available messages as a download, one JSON document per line unless another media type is accepted
+	// ---
+	// produces:
+	// - application/x-ndjson
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - text/csv
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: timeFormat
+	//   in: query
+	//   description: representation of times in the response - rfc3339 (default), unix or unixms.
+	//   required: false
+	//   type: string
+	//   enum: [rfc3339, unix, unixms]
+	// - name: fields
+	//   in: query
+	//   description: comma separated fields to return - id, content, author, createdAt and palindrome, all when missing.
+	//   required: false
+	//   type: string
+	// - name: exclude
+	//   in: query
+	//   description: comma separated fields to leave out of the response.
+	//   required: false
+	//   type: string
+	// - name: expand
+	//   in: query
+	//   description: comma separated related resources to embed - author (an Author object replaces the name) and analysis.
+	//   required: false
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/MessageResponses"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	view, expansions, err := getView(response, request)
+	if err != nil {
+		return
+	}
+
+	if accept := request.Header.Get("accept"); accept == "" || accept == "*/*" {
+		request.Header.Set("accept", exportMediaType)
+	}
+	codec, err := negotiate(response, request, mc.codecs, model.MessageResponses{})
+	if err != nil {
+		return
+	}
+
+	response.Header().Set("Content-Disposition", "attachment")
+	mc.streamMessages(response, request, codec, view, expansions)
+}
+
+// exportMediaType - the default media type of exports
+const exportMediaType = "application/x-ndjson"
 
-	messages, err := mc.repository.ListMessages(request.Context())
+// streamBatchSize - how many messages are expanded and written at a time when streaming
+const streamBatchSize = 100
+
+// streamMessages - write all the messages as they are read from the repository.
+// Codecs that can write lists item by item (JSON, NDJSON) get the messages in batches, the response
+// is flushed after every batch so the client starts receiving messages before all of them are read.
+// Messages are read only as fast as the client consumes them and reading stops once the request is cancelled.
+// Other codecs get all the messages at once.
+func (mc *MessageController) streamMessages(response http.ResponseWriter, request *http.Request, codec render.Codec, view model.View, expansions model.Expansions) {
+	ctx := request.Context()
+
+	iterator, err := mc.repositoryFor(ctx).StreamMessages(ctx, expansions.Requires(view.Fields), messageAccess(ctx))
 	if err != nil {
-		response.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(response).Encode(modelCommon.ErrorResponse{Message: err.Error()})
-		log.WithError(err).Debug("Could not get list of messages")
+		writeError(response, request, err, "Could not get list of messages")
+		return
+	}
+	// the iterator is released even when the request was cancelled
+	defer iterator.Close(context.Background())
 
+	listEncoder, ok := codec.(render.ListEncoder)
+	if !ok {
+		messages, err := model.CollectMessages(ctx, iterator)
+		if err == nil {
+			err = mc.expand(ctx, &view, expansions, messages)
+		}
+		if err != nil {
+			writeError(response, request, err, "Could not get list of messages")
+			return
+		}
+		writeResponse(response, codec, "messages", messages.Shape(view))
 		return
 	}
-	json.NewEncoder(response).Encode(messages)
+
+	response.Header().Set("content-type", codec.MediaTypes()[0])
+	listWriter := listEncoder.NewListWriter(response, "messages")
+	flusher, _ := response.(http.Flusher)
+	written := false
+	for {
+		messages, err := model.NextMessages(ctx, iterator, streamBatchSize)
+		if err == nil {
+			err = mc.expand(ctx, &view, expansions, messages)
+		}
+		if err != nil {
+			abortStream(response, request, err, written)
+			return
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		for _, message := range messages {
+			if err := listWriter.WriteItem(message.Shape(view)); err != nil {
+				log.WithContext(request.Context()).WithError(err).Debug("Could not write message, client is gone")
+				return
+			}
+		}
+		written = true
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if err := listWriter.Close(); err != nil {
+		log.WithContext(request.Context()).WithError(err).Debug("Could not write end of messages, client is gone")
+	}
+}
+
+// abortStream - report an error that occurred while streaming a response.
+// Once messages were written the status can't change, the connection is aborted
+// instead so the client can tell that the response is incomplete.
+func abortStream(response http.ResponseWriter, request *http.Request, err error, written bool) {
+	if errors.Cause(err) == context.Canceled {
+		log.WithContext(request.Context()).WithError(err).Debug("Request cancelled while streaming messages")
+		return
+	}
+	if !written {
+		writeError(response, request, err, "Could not get list of messages")
+		return
+	}
+
+	log.WithContext(request.Context()).WithError(err).WithField("correlationId", getCorrelationID(request)).Error("Could not stream messages")
+	panic(http.ErrAbortHandler)
 }
 
 //------------------------------- Get --------------------------------------------
@@ -136,49 +491,117 @@ func (mc *MessageController) GetMessageByID(response http.ResponseWriter, reques
 	// - application/json
 	// produces:
 	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
 	// parameters:
 	// - name: id
 	//   in: path
 	//   description: id of message to be returned.
 	//   required: true
 	//   type: string
+	// - name: timeFormat
+	//   in: query
+	//   description: representation of times in the response - rfc3339 (default), unix or unixms.
+	//   required: false
+	//   type: string
+	//   enum: [rfc3339, unix, unixms]
+	// - name: X-Time-Format
+	//   in: header
+	//   description: same as timeFormat, the query parameter takes precedence.
+	//   required: false
+	//   type: string
+	// - name: fields
+	//   in: query
+	//   description: comma separated fields to return - id, content, author, createdAt and palindrome, all when missing.
+	//   required: false
+	//   type: string
+	// - name: exclude
+	//   in: query
+	//   description: comma separated fields to leave out of the response.
+	//   required: false
+	//   type: string
+	// - name: expand
+	//   in: query
+	//   description: comma separated related resources to embed - author (an Author object replaces the name) and analysis.
+	//   required: false
+	//   type: string
 	// responses:
 	//   '200':
 	//     description: OK
 	//     schema:
 	//       "$ref": "#/definitions/MessageResponse"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	//   '404':
 	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	//   '500':
 	//     description: Internal Server Error
-	response.Header().Set("content-type", "application/json")
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	view, expansions, err := getView(response, request)
+	if err != nil {
+		return
+	}
+
+	codec, err := negotiate(response, request, mc.codecs, model.MessageResponse{})
+	if err != nil {
+		return
+	}
+
 	params := mux.Vars(request)
-	message, err := mc.repository.FindMessageByID(request.Context(), params["id"])
+	message, err := mc.repositoryFor(request.Context()).FindMessageByID(request.Context(), params["id"], expansions.Requires(view.Fields), messageAccess(request.Context()))
 	if err != nil {
-		if err == persistence.ErrorNotFound {
-			response.WriteHeader(http.StatusNotFound)
-		} else {
-			response.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(response).Encode(modelCommon.ErrorResponse{Message: err.Error()})
-			log.WithError(err).Debug("Could not get message")
-		}
+		writeError(response, request, err, "Could not get message")
+		return
+	}
+	if err := mc.expand(request.Context(), &view, expansions, model.MessageResponses{*message}); err != nil {
+		writeError(response, request, err, "Could not expand message")
 		return
 	}
-	json.NewEncoder(response).Encode(message)
+	writeResponse(response, codec, "message", message.Shape(view))
 }
 
 //------------------------------- Update -----------------------------------------
 
-// UpdateMessageByID - updates an existing message
+// UpdateMessageByID - replaces an existing message
 func (mc *MessageController) UpdateMessageByID(response http.ResponseWriter, request *http.Request) {
 	// swagger:operation PUT /messages/{id} messages updateMessage
 	//
-	// Updates message by id
+	// Replaces message by id, fields missing from the request are removed from the message
 	// ---
 	// consumes:
 	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
 	// produces:
 	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
 	// parameters:
 	// - name: id
 	//   in: path
@@ -187,40 +610,276 @@ func (mc *MessageController) UpdateMessageByID(response http.ResponseWriter, req
 	//   type: string
 	// - name: messageRequest
 	//   in: body
-	//   description: message to be updated.
-	//   required: false
+	//   description: the new state of the message.
+	//   required: true
 	//   type: MessageRequest
 	//   schema:
 	//     "$ref": "#/definitions/MessageRequest"
+	// - name: timeFormat
+	//   in: query
+	//   description: representation of times in the response - rfc3339 (default), unix or unixms.
+	//   required: false
+	//   type: string
+	//   enum: [rfc3339, unix, unixms]
+	// - name: X-Time-Format
+	//   in: header
+	//   description: same as timeFormat, the query parameter takes precedence.
+	//   required: false
+	//   type: string
 	// responses:
 	//   '200':
 	//     description: OK
 	//     schema:
 	//       "$ref": "#/definitions/MessageResponse"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	//   '404':
 	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	//   '500':
 	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 
-	updatedMessage, err := validateRequest(response, request)
+	timeFormat, err := getTimeFormat(response, request)
+	if err != nil {
+		return
+	}
+
+	codec, err := negotiate(response, request, mc.codecs, model.MessageResponse{})
+	if err != nil {
+		return
+	}
+
+	updatedMessage, err := mc.validateRequest(response, request)
 	if err != nil {
 		return
 	}
 
-	response.Header().Set("content-type", "application/json")
 	params := mux.Vars(request)
-	message, err := mc.repository.UpdateMessageByID(request.Context(), params["id"], *updatedMessage)
+	message, err := mc.repositoryFor(request.Context()).ReplaceMessageByID(request.Context(), params["id"], *updatedMessage, messageAccess(request.Context()))
+	if err != nil {
+		writeError(response, request, err, "Could not update message")
+		return
+	}
+	writeResponse(response, codec, "message", message.WithTimeFormat(timeFormat))
+}
+
+//------------------------------- Patch ------------------------------------------
+
+// errPatchedMessageInvalid - the patch was applied but the result is not a valid message
+var errPatchedMessageInvalid = errors.New("patched message is invalid")
+
+// PatchMessageByID - partially updates an existing message
+func (mc *MessageController) PatchMessageByID(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation PATCH /messages/{id} messages patchMessage
+	//
+	// Partially updates message by id with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+	// ---
+	// consumes:
+	// - application/merge-patch+json
+	// - application/json-patch+json
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of message to be patched.
+	//   required: true
+	//   type: string
+	// - name: patch
+	//   in: body
+	//   description: a merge patch object (null removes a field) or a list of JSON Patch operations.
+	//   required: true
+	//   schema:
+	//     type: object
+	// - name: timeFormat
+	//   in: query
+	//   description: representation of times in the response - rfc3339 (default), unix or unixms.
+	//   required: false
+	//   type: string
+	//   enum: [rfc3339, unix, unixms]
+	// - name: X-Time-Format
+	//   in: header
+	//   description: same as timeFormat, the query parameter takes precedence.
+	//   required: false
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/MessageResponse"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '409':
+	//     description: Conflict - a test operation failed
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '422':
+	//     description: Unprocessable Entity - the patch can't be applied to the message
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	timeFormat, err := getTimeFormat(response, request)
+	if err != nil {
+		return
+	}
+
+	codec, err := negotiate(response, request, mc.codecs, model.MessageResponse{})
+	if err != nil {
+		return
+	}
+
+	messagePatch, err := parsePatch(response, request)
 	if err != nil {
-		if err == persistence.ErrorNotFound {
-			response.WriteHeader(http.StatusNotFound)
-		} else {
-			response.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(response).Encode(modelCommon.ErrorResponse{Message: err.Error()})
-			log.WithError(err).Debug("Could not update message")
-		}
 		return
 	}
-	json.NewEncoder(response).Encode(message)
+
+	var fieldErrors []validation.FieldError
+	params := mux.Vars(request)
+	message, err := mc.repositoryFor(request.Context()).PatchMessageByID(request.Context(), params["id"], messageAccess(request.Context()), func(current model.MessageRequest) (model.MessageRequest, error) {
+		currentDocument, err := json.Marshal(current)
+		if err != nil {
+			return current, err
+		}
+		patchedDocument, err := messagePatch.Apply(currentDocument)
+		if err != nil {
+			return current, err
+		}
+
+		var patched model.MessageRequest
+		decoder := json.NewDecoder(bytes.NewReader(patchedDocument))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&patched); err != nil {
+			return current, errors.Wrap(errPatchedMessageInvalid, err.Error())
+		}
+
+		fieldErrors = patched.Validate(mc.rulesFor(request.Context()))
+		if len(fieldErrors) != 0 {
+			return current, errPatchedMessageInvalid
+		}
+		return patched, nil
+	})
+
+	switch cause := errors.Cause(err); {
+	case err == nil:
+		writeResponse(response, codec, "message", message.WithTimeFormat(timeFormat))
+	case cause == patch.ErrorTestFailed:
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeConflict,
+			Status: http.StatusConflict,
+			Detail: err.Error(),
+		})
+	case cause == errPatchedMessageInvalid && len(fieldErrors) != 0:
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeValidation,
+			Status: http.StatusBadRequest,
+			Detail: "The patched message failed validation",
+			Errors: fieldErrors,
+		})
+	case cause == errPatchedMessageInvalid, cause == patch.ErrorPathNotFound, cause == patch.ErrorMalformedPatch:
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypePatchFailed,
+			Status: http.StatusUnprocessableEntity,
+			Detail: err.Error(),
+		})
+	default:
+		writeError(response, request, err, "Could not patch message")
+	}
+}
+
+// parsePatch - parse the request body as a patch document of the request content type
+func parsePatch(response http.ResponseWriter, request *http.Request) (patch.Patch, error) {
+	contentType, _, _ := mime.ParseMediaType(request.Header.Get("content-type"))
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeMalformedRequest,
+			Status: http.StatusBadRequest,
+			Detail: errors.Wrap(err, "Could not read request body").Error(),
+		})
+		return nil, err
+	}
+
+	messagePatch, err := patch.Parse(contentType, body)
+	if err == patch.ErrorUnsupportedContentType {
+		response.Header().Set("Accept-Patch", patch.MergePatchContentType+", "+patch.JSONPatchContentType)
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeUnsupportedMediaType,
+			Status: http.StatusUnsupportedMediaType,
+			Detail: "Patches must be sent as " + patch.MergePatchContentType + " or " + patch.JSONPatchContentType,
+		})
+		return nil, err
+	}
+	if err != nil {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeMalformedRequest,
+			Status: http.StatusBadRequest,
+			Detail: err.Error(),
+		})
+		log.WithContext(request.Context()).WithError(err).Debug("Could not parse patch")
+		return nil, err
+	}
+
+	return messagePatch, nil
 }
 
 //------------------------------- Delete -----------------------------------------
@@ -235,6 +894,7 @@ func (mc *MessageController) DeleteMessageByID(response http.ResponseWriter, req
 	// - application/json
 	// produces:
 	// - application/json
+	// - application/problem+json
 	// parameters:
 	// - name: id
 	//   in: path
@@ -244,21 +904,34 @@ func (mc *MessageController) DeleteMessageByID(response http.ResponseWriter, req
 	// responses:
 	//   '204':
 	//     description: No Content
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	//   '404':
 	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	//   '500':
 	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
 	response.Header().Set("content-type", "application/json")
 	params := mux.Vars(request)
-	err := mc.repository.DeleteMessageByID(request.Context(), params["id"])
+	access := messageAccess(request.Context())
+	// messages:delete is required to get here and covers the messages of every owner
+	access.WriteAll = true
+	err := mc.repositoryFor(request.Context()).DeleteMessageByID(request.Context(), params["id"], access)
 	if err != nil {
-		if err == persistence.ErrorNotFound {
-			response.WriteHeader(http.StatusNotFound)
-		} else {
-			response.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(response).Encode(modelCommon.ErrorResponse{Message: err.Error()})
-			log.WithError(err).Debug("Could not delete message")
-		}
+		writeError(response, request, err, "Could not delete message")
 		return
 	}
 	response.WriteHeader(http.StatusNoContent)
@@ -266,26 +939,98 @@ func (mc *MessageController) DeleteMessageByID(response http.ResponseWriter, req
 
 //------------------------------- Validation -------------------------------------
 
-func validateRequest(response http.ResponseWriter, request *http.Request) (*model.MessageRequest, error) {
-	response.Header().Set("content-type", "application/json")
-
+func (mc *MessageController) validateRequest(response http.ResponseWriter, request *http.Request) (*model.MessageRequest, error) {
 	var newMessage model.MessageRequest
-	err := json.NewDecoder(request.Body).Decode(&newMessage)
-	if err != nil {
-		response.WriteHeader(http.StatusBadRequest)
-		responseErr := errors.Wrap(err, "Could not decode request body")
-		json.NewEncoder(response).Encode(modelCommon.ErrorResponse{Message: responseErr.Error()})
-		log.WithError(err).Debug("Could not decode request body")
-		return nil, errors.New("validation failed")
+	if err := readRequest(response, request, mc.codecs, &newMessage, "Messages"); err != nil {
+		return nil, err
 	}
 
-	validationErrorsResponse := newMessage.Validate()
-	if len(validationErrorsResponse.Messages) != 0 {
-		response.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(response).Encode(validationErrorsResponse)
-		log.Debug("Validation of message request failed")
+	fieldErrors := newMessage.Validate(mc.rulesFor(request.Context()))
+	if len(fieldErrors) != 0 {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeValidation,
+			Status: http.StatusBadRequest,
+			Detail: "The message request failed validation",
+			Errors: fieldErrors,
+		})
+		log.WithContext(request.Context()).Debug("Validation of message request failed")
 		return nil, errors.New("validation failed")
 	}
 
 	return &newMessage, nil
 }
+
+//------------------------------- Rendering --------------------------------------
+
+// timeFormatHeader - request header selecting the representation of times in the response
+const timeFormatHeader = "X-Time-Format"
+
+// getTimeFormat - returns the time format requested by the timeFormat query parameter
+// or the X-Time-Format header, the query parameter takes precedence
+func getTimeFormat(response http.ResponseWriter, request *http.Request) (model.TimeFormat, error) {
+	timeFormatName := request.URL.Query().Get("timeFormat")
+	if timeFormatName == "" {
+		timeFormatName = request.Header.Get(timeFormatHeader)
+	}
+
+	timeFormat, err := model.ParseTimeFormat(timeFormatName)
+	if err != nil {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeMalformedRequest,
+			Status: http.StatusBadRequest,
+			Detail: err.Error(),
+		})
+		log.WithContext(request.Context()).WithError(err).Debug("Could not parse requested time format")
+		return "", err
+	}
+
+	return timeFormat, nil
+}
+
+// getView - returns the shape of the response requested by the time format (see getTimeFormat)
+// and the fields, exclude and expand query parameters
+func getView(response http.ResponseWriter, request *http.Request) (model.View, model.Expansions, error) {
+	timeFormat, err := getTimeFormat(response, request)
+	if err != nil {
+		return model.View{}, nil, err
+	}
+
+	query := request.URL.Query()
+	fields, err := model.ParseProjection(query.Get("fields"), query.Get("exclude"))
+	if err == nil {
+		var expansions model.Expansions
+		expansions, err = model.ParseExpansions(query.Get("expand"))
+		if err == nil {
+			return model.View{TimeFormat: timeFormat, Fields: fields}, expansions, nil
+		}
+	}
+
+	writeProblem(response, request, model.ProblemResponse{
+		Type:   model.ProblemTypeMalformedRequest,
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+	})
+	log.WithContext(request.Context()).WithError(err).Debug("Could not parse requested response shape")
+	return model.View{}, nil, err
+}
+
+// expand - resolve the requested related resources of the messages into the view.
+// Related resources of all the messages are fetched together.
+func (mc *MessageController) expand(ctx context.Context, view *model.View, expansions model.Expansions, messages model.MessageResponses) error {
+	if expansions[model.ExpandAuthor] {
+		authors, err := mc.repositoryFor(ctx).FindAuthors(ctx, messages.AuthorNames(), messageAccess(ctx))
+		if err != nil {
+			return err
+		}
+		view.Authors = authors
+	}
+
+	if expansions[model.ExpandAnalysis] {
+		analyzers := mc.analyzersFor(ctx)
+		view.Analyze = func(content string) interface{} {
+			return analyzers.Analyze(content)
+		}
+	}
+
+	return nil
+}
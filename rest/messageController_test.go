@@ -1,7 +1,10 @@
 package rest
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"net/http"
@@ -9,6 +12,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/metrics"
 	"github.com/shauera/messages/model"
 
 	"github.com/stretchr/testify/assert"
@@ -110,7 +117,7 @@ func Test_Create(t *testing.T) {
 				return request
 			}(),
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
-				assert.Equal(t, "{\"id\":\"1\",\"content\":\"Not a palindrome\",\"author\":\"Author 1\",\"createdAt\":\"2019-05-20T12:23:36.138Z\",\"palindrome\":false}\n",
+				assert.Equal(t, "{\"id\":\"1\",\"content\":\"Not a palindrome\",\"author\":\"Author 1\",\"createdAt\":\"2019-05-20T12:23:36.138Z\",\"palindrome\":false,\"visibility\":\"public\"}\n",
 					response.Body.String())
 				assert.Equal(t, http.StatusOK, response.Code)
 			},
@@ -130,7 +137,7 @@ func Test_Create(t *testing.T) {
 				return request
 			}(),
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
-				assert.Equal(t, "{\"id\":\"1\",\"content\":\"pal ind rome 12 3 21! emordnilap\",\"author\":\"Author 1\",\"createdAt\":\"2019-05-20T12:23:36.138Z\",\"palindrome\":true}\n",
+				assert.Equal(t, "{\"id\":\"1\",\"content\":\"pal ind rome 12 3 21! emordnilap\",\"author\":\"Author 1\",\"createdAt\":\"2019-05-20T12:23:36.138Z\",\"palindrome\":true,\"visibility\":\"public\"}\n",
 					response.Body.String())
 				assert.Equal(t, http.StatusOK, response.Code)
 			},
@@ -148,7 +155,7 @@ func Test_Create(t *testing.T) {
 				return request
 			}(),
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
-				assert.Equal(t, "{\"id\":\"1\",\"content\":\"pal ind rome 12 3 21! emordnilap\",\"palindrome\":true}\n",
+				assert.Equal(t, "{\"id\":\"1\",\"content\":\"pal ind rome 12 3 21! emordnilap\",\"palindrome\":true,\"visibility\":\"public\"}\n",
 					response.Body.String())
 				assert.Equal(t, http.StatusOK, response.Code)
 			},
@@ -161,9 +168,10 @@ func Test_Create(t *testing.T) {
 				return request
 			}(),
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
-				assert.Equal(t, "{\"message\":\"Could not decode request body: EOF\"}\n",
+				assert.Equal(t, "{\"type\":\"/problems/malformed-request\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"Could not decode request body: EOF\",\"instance\":\"/messages\"}\n",
 					response.Body.String())
 				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
 			},
 		},
 		{
@@ -174,9 +182,10 @@ func Test_Create(t *testing.T) {
 				return request
 			}(),
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
-				assert.Equal(t, "{\"message\":[\"Content must be between 1 and 256 characters long. Got NULL instead\"]}\n",
+				assert.Equal(t, "{\"type\":\"/problems/validation\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"The message request failed validation\",\"instance\":\"/messages\",\"errors\":[{\"field\":\"content\",\"code\":\"required\",\"message\":\"Content is required\"}]}\n",
 					response.Body.String())
 				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
 			},
 		},
 		{
@@ -195,6 +204,7 @@ func Test_Create(t *testing.T) {
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
 				assert.Contains(t, response.Body.String(), "Could not decode request body: parsing time")
 				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
 			},
 		},
 		{
@@ -211,9 +221,10 @@ func Test_Create(t *testing.T) {
 				return request
 			}(),
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
-				assert.Equal(t, "{\"message\":[\"Content must be between 1 and 256 characters long. Got NULL instead\"]}\n",
+				assert.Equal(t, "{\"type\":\"/problems/validation\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"The message request failed validation\",\"instance\":\"/messages\",\"errors\":[{\"field\":\"content\",\"code\":\"required\",\"message\":\"Content is required\"}]}\n",
 					response.Body.String())
 				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
 			},
 		},
 		{
@@ -231,9 +242,10 @@ func Test_Create(t *testing.T) {
 				return request
 			}(),
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
-				assert.Equal(t, "{\"message\":[\"Content must be between 1 and 256 characters long. Got 0 instead\"]}\n",
+				assert.Equal(t, "{\"type\":\"/problems/validation\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"The message request failed validation\",\"instance\":\"/messages\",\"errors\":[{\"field\":\"content\",\"code\":\"too_short\",\"params\":{\"actual\":0,\"min\":1},\"message\":\"Content must be between 1 and 256 characters long. Got 0 instead\"}]}\n",
 					response.Body.String())
 				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
 			},
 		},
 		{
@@ -251,9 +263,10 @@ func Test_Create(t *testing.T) {
 				return request
 			}(),
 			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
-				assert.Equal(t, "{\"message\":[\"Content must be between 1 and 256 characters long. Got 260 instead\"]}\n",
+				assert.Equal(t, "{\"type\":\"/problems/validation\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"The message request failed validation\",\"instance\":\"/messages\",\"errors\":[{\"field\":\"content\",\"code\":\"too_long\",\"params\":{\"actual\":260,\"max\":256},\"message\":\"Content must be between 1 and 256 characters long. Got 260 instead\"}]}\n",
 					response.Body.String())
 				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
 			},
 		},
 	}
@@ -276,10 +289,639 @@ func Test_Create(t *testing.T) {
 	}
 }
 
+//------------------------------- Time Format ------------------------------------
+func Test_Time_Format(t *testing.T) {
+	testCases := []struct {
+		name    string
+		request *http.Request
+		checker func(t *testing.T, response *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Success path - default format keeps the time zone offset",
+			request: func() *http.Request {
+				request, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+				return request
+			}(),
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "[{\"id\":\"8\",\"content\":\"Test Message 1\",\"createdAt\":\"2016-08-15T02:00:00+02:00\",\"palindrome\":false}]\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Success path - unix format from query parameter",
+			request: func() *http.Request {
+				request, _ := http.NewRequest(http.MethodGet, "/messages?timeFormat=unix", nil)
+				return request
+			}(),
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "[{\"id\":\"8\",\"content\":\"Test Message 1\",\"palindrome\":false,\"createdAt\":1471219200}]\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Success path - unixms format from header",
+			request: func() *http.Request {
+				request, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+				request.Header.Set("X-Time-Format", "unixms")
+				return request
+			}(),
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "\"createdAt\":1471219200000")
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Fail path - unsupported format",
+			request: func() *http.Request {
+				request, _ := http.NewRequest(http.MethodGet, "/messages?timeFormat=iso", nil)
+				return request
+			}(),
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "unsupported time format")
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			messageRepository, _ := persistence.NewMemoryRepository()
+			messageRepository.GetMessagesStorage()["8"] = model.MessageResponse{
+				ID:        "8",
+				Content:   getNewString("Test Message 1"),
+				CreatedAt: getNewMessageTime(time.Date(2016, time.August, 15, 2, 0, 0, 0, time.FixedZone("", 7200))),
+			}
+			messageController := NewMessageController(messageRepository)
+			handler := messageController.ListMessages
+
+			response := httptest.NewRecorder()
+			handler(response, testCase.request)
+			testCase.checker(t, response)
+		})
+	}
+}
+
 //------------------------------- Get --------------------------------------------
-//TODO
+func Test_Get(t *testing.T) {
+	testCases := []struct {
+		name    string
+		id      string
+		checker func(t *testing.T, response *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Success path - existing message",
+			id:   "8",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"id\":\"8\",\"content\":\"Test Message 1\",\"palindrome\":false}\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Fail path - message does not exist",
+			id:   "9",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"type\":\"/problems/not-found\",\"title\":\"Not Found\",\"status\":404,\"detail\":\"The requested resource does not exist\",\"instance\":\"/messages/9\",\"correlationId\":\"test-correlation-id\"}\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusNotFound, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			messageRepository, _ := persistence.NewMemoryRepository()
+			messageRepository.GetMessagesStorage()["8"] = model.MessageResponse{
+				ID:      "8",
+				Content: getNewString("Test Message 1"),
+			}
+			router := setupMux([]ServiceController{NewMessageController(messageRepository)}, DefaultSettings(), auth.Disabled())
+
+			request, _ := http.NewRequest(http.MethodGet, "/messages/"+testCase.id, nil)
+			request.Header.Set("X-Correlation-ID", "test-correlation-id")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			testCase.checker(t, response)
+			assert.Equal(t, "test-correlation-id", response.Header().Get("X-Correlation-ID"))
+		})
+	}
+}
+
 //------------------------------- Update -----------------------------------------
-//TODO
+func Test_Update(t *testing.T) {
+	testCases := []struct {
+		name    string
+		request *http.Request
+		checker func(t *testing.T, response *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Success path - fields missing from the request are removed",
+			request: func() *http.Request {
+				request, _ := http.NewRequest(http.MethodPut, "/messages/8", strings.NewReader(`{"content": "abba"}`))
+				return request
+			}(),
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"id\":\"8\",\"content\":\"abba\",\"palindrome\":true,\"visibility\":\"public\"}\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Success path - an empty author is stored",
+			request: func() *http.Request {
+				request, _ := http.NewRequest(http.MethodPut, "/messages/8", strings.NewReader(`{"content": "Test Message 1", "author": ""}`))
+				return request
+			}(),
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"id\":\"8\",\"content\":\"Test Message 1\",\"author\":\"\",\"palindrome\":false,\"visibility\":\"public\"}\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Fail path - message does not exist",
+			request: func() *http.Request {
+				request, _ := http.NewRequest(http.MethodPut, "/messages/9", strings.NewReader(`{"content": "abba"}`))
+				return request
+			}(),
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "/problems/not-found")
+				assert.Equal(t, http.StatusNotFound, response.Code)
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := setupTestRouter()
+
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, testCase.request)
+			testCase.checker(t, response)
+		})
+	}
+}
+
+//------------------------------- Patch ------------------------------------------
+func Test_Patch(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contentType string
+		body        string
+		checker     func(t *testing.T, response *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "Success path - merge patch replaces and removes fields",
+			contentType: "application/merge-patch+json",
+			body:        `{"content": "abba", "author": null}`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"id\":\"8\",\"content\":\"abba\",\"createdAt\":\"2016-08-15T00:00:00Z\",\"palindrome\":true,\"visibility\":\"public\"}\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name:        "Success path - json patch with a passing test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/author", "value": "test author 1"}, {"op": "replace", "path": "/author", "value": ""}]`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"id\":\"8\",\"content\":\"Test Message 1\",\"author\":\"\",\"createdAt\":\"2016-08-15T00:00:00Z\",\"palindrome\":false,\"visibility\":\"public\"}\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name:        "Fail path - json patch with a failing test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/author", "value": "someone else"}, {"op": "remove", "path": "/author"}]`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "/problems/conflict")
+				assert.Equal(t, http.StatusConflict, response.Code)
+			},
+		},
+		{
+			name:        "Fail path - json patch of a missing path",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "remove", "path": "/palindrome"}]`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "/problems/patch-failed")
+				assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+			},
+		},
+		{
+			name:        "Fail path - patched message is not valid",
+			contentType: "application/merge-patch+json",
+			body:        `{"content": null}`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "\"code\":\"required\"")
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+			},
+		},
+		{
+			name:        "Fail path - unsupported content type",
+			contentType: "application/json",
+			body:        `{"content": "abba"}`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "/problems/unsupported-media-type")
+				assert.Equal(t, "application/merge-patch+json, application/json-patch+json", response.Header().Get("Accept-Patch"))
+				assert.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+			},
+		},
+		{
+			name:        "Fail path - malformed json patch",
+			contentType: "application/json-patch+json",
+			body:        `{"op": "remove"}`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "/problems/malformed-request")
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := setupTestRouter()
+
+			request, _ := http.NewRequest(http.MethodPatch, "/messages/8", strings.NewReader(testCase.body))
+			request.Header.Set("content-type", testCase.contentType)
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			testCase.checker(t, response)
+		})
+	}
+}
+
+//------------------------------- Streaming --------------------------------------
+func Test_Streaming(t *testing.T) {
+	preload := func(messageRepository *persistence.MemoryRepository, count int) {
+		for index := 1; index <= count; index++ {
+			id := strconv.Itoa(index)
+			messageRepository.GetMessagesStorage()[id] = model.MessageResponse{ID: id, Content: getNewString("message " + id)}
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		path       string
+		accept     string
+		repository func() MessageRepository
+		checker    func(t *testing.T, response *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Success path - JSON array over several batches",
+			path: "/messages?fields=id",
+			repository: func() MessageRepository {
+				messageRepository, _ := persistence.NewMemoryRepository()
+				preload(messageRepository, 2*streamBatchSize+1)
+				return messageRepository
+			},
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				var messages []map[string]interface{}
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &messages))
+				assert.Len(t, messages, 2*streamBatchSize+1)
+				assert.Equal(t, "application/json", response.Header().Get("content-type"))
+				assert.True(t, response.Flushed)
+			},
+		},
+		{
+			name:   "Success path - NDJSON list",
+			path:   "/messages?fields=content",
+			accept: "application/x-ndjson",
+			repository: func() MessageRepository {
+				messageRepository, _ := persistence.NewMemoryRepository()
+				preload(messageRepository, 1)
+				return messageRepository
+			},
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"content\":\"message 1\"}\n", response.Body.String())
+				assert.Equal(t, "application/x-ndjson", response.Header().Get("content-type"))
+			},
+		},
+		{
+			name: "Success path - export defaults to NDJSON",
+			path: "/messages/export?fields=id",
+			repository: func() MessageRepository {
+				messageRepository, _ := persistence.NewMemoryRepository()
+				preload(messageRepository, 3)
+				return messageRepository
+			},
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, 3, strings.Count(response.Body.String(), "\n"))
+				assert.Equal(t, "application/x-ndjson", response.Header().Get("content-type"))
+				assert.Equal(t, "attachment", response.Header().Get("Content-Disposition"))
+			},
+		},
+		{
+			name:   "Success path - export in another media type",
+			path:   "/messages/export?fields=id",
+			accept: "text/csv",
+			repository: func() MessageRepository {
+				messageRepository, _ := persistence.NewMemoryRepository()
+				preload(messageRepository, 1)
+				return messageRepository
+			},
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "id\n1\n", response.Body.String())
+			},
+		},
+		{
+			name: "Fail path - error before the first message is a problem",
+			path: "/messages",
+			repository: func() MessageRepository {
+				messageRepository, _ := persistence.NewMemoryRepository()
+				return failingStreamRepository{MemoryRepository: messageRepository, failAfter: 0}
+			},
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+				assert.Equal(t, "application/problem+json", response.Header().Get("content-type"))
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := setupMux([]ServiceController{NewMessageController(testCase.repository())}, DefaultSettings(), auth.Disabled())
+
+			request, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+			if testCase.accept != "" {
+				request.Header.Set("accept", testCase.accept)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			testCase.checker(t, response)
+		})
+	}
+}
+
+func Test_Streaming_Errors(t *testing.T) {
+	t.Run("Fail path - error after the first batch aborts the response", func(t *testing.T) {
+		messageRepository, _ := persistence.NewMemoryRepository()
+		router := setupMux([]ServiceController{NewMessageController(failingStreamRepository{MemoryRepository: messageRepository, failAfter: streamBatchSize})},
+			DefaultSettings(), auth.Disabled())
+
+		aborted := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/messages", "GET", abortedStatus))
+
+		request, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+		response := httptest.NewRecorder()
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			router.ServeHTTP(response, request)
+		})
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.False(t, strings.HasSuffix(response.Body.String(), "]\n"))
+		assert.Equal(t, aborted+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/messages", "GET", abortedStatus)), "aborted streams are counted")
+		assert.Equal(t, float64(0), testutil.ToFloat64(metrics.HTTPRequestsInFlight.WithLabelValues("/messages", "GET")))
+	})
+
+	t.Run("Success path - cancelled request stops reading", func(t *testing.T) {
+		messageRepository, _ := persistence.NewMemoryRepository()
+		messageRepository.GetMessagesStorage()["1"] = model.MessageResponse{ID: "1"}
+		router := setupMux([]ServiceController{NewMessageController(messageRepository)}, DefaultSettings(), auth.Disabled())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		request, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request.WithContext(ctx))
+		assert.Equal(t, "", response.Body.String())
+	})
+}
+
+// failingStreamRepository - a repository whose message iterator fails after the given number of messages
+type failingStreamRepository struct {
+	*persistence.MemoryRepository
+	failAfter int
+}
+
+func (fr failingStreamRepository) StreamMessages(ctx context.Context, fields model.Projection, access model.Access) (model.MessageIterator, error) {
+	return &failingIterator{failAfter: fr.failAfter}, nil
+}
+
+type failingIterator struct {
+	failAfter int
+	count     int
+}
+
+func (fi *failingIterator) Next(ctx context.Context) bool {
+	fi.count++
+	return fi.count <= fi.failAfter
+}
+
+func (fi *failingIterator) Message() model.MessageResponse {
+	return model.MessageResponse{ID: strconv.Itoa(fi.count)}
+}
+
+func (fi *failingIterator) Err() error {
+	if fi.count > fi.failAfter {
+		return errors.Wrap(persistence.ErrorUnavailable, "connection reset")
+	}
+	return nil
+}
+
+func (fi *failingIterator) Close(ctx context.Context) error {
+	return nil
+}
+
+//------------------------------- Response Shaping -------------------------------
+func Test_Response_Shaping(t *testing.T) {
+	testCases := []struct {
+		name    string
+		path    string
+		checker func(t *testing.T, response *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Success path - selected fields",
+			path: "/messages/8?fields=id,content",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"id\":\"8\",\"content\":\"Test Message 1\"}\n", response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Success path - excluded fields in a list",
+			path: "/messages?exclude=id,createdAt,palindrome",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "[{\"content\":\"Test Message 1\",\"author\":\"test author 1\"}]\n", response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Success path - expanded author and analysis",
+			path: "/messages?fields=id&expand=author,analysis",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "[{\"id\":\"8\",\"author\":{\"name\":\"test author 1\",\"messageCount\":1,\"firstMessageAt\":\"2016-08-15T00:00:00Z\",\"lastMessageAt\":\"2016-08-15T00:00:00Z\"},"+
+					"\"analysis\":{\"length\":14,\"palindrome\":false,\"wordCount\":3}}]\n", response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name: "Fail path - unknown field",
+			path: "/messages/8?fields=id,revision",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "unknown field \\\"revision\\\"")
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+			},
+		},
+		{
+			name: "Fail path - unknown expansion",
+			path: "/messages?expand=comments",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "unknown expansion \\\"comments\\\"")
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := setupTestRouter()
+
+			request, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			testCase.checker(t, response)
+		})
+	}
+}
+
+//------------------------------- Content Negotiation ----------------------------
+func Test_Content_Negotiation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		method      string
+		path        string
+		accept      string
+		contentType string
+		body        string
+		checker     func(t *testing.T, response *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Success path - XML message",
+			method: http.MethodGet,
+			path:   "/messages/8",
+			accept: "application/xml",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<message><id>8</id><content>Test Message 1</content><author>test author 1</author><createdAt>2016-08-15T00:00:00Z</createdAt><palindrome>false</palindrome></message>\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, "application/xml", response.Header().Get("content-type"))
+				assert.Equal(t, "Accept", response.Header().Get("Vary"))
+			},
+		},
+		{
+			name:   "Success path - preferred media type by quality",
+			method: http.MethodGet,
+			path:   "/messages/8",
+			accept: "application/json;q=0.5, application/yaml",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "id: \"8\"\ncontent: Test Message 1\nauthor: test author 1\ncreatedAt: \"2016-08-15T00:00:00Z\"\npalindrome: false\n",
+					response.Body.String())
+				assert.Equal(t, "application/yaml", response.Header().Get("content-type"))
+			},
+		},
+		{
+			name:   "Success path - CSV list",
+			method: http.MethodGet,
+			path:   "/messages",
+			accept: "text/csv",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "id,content,author,createdAt,palindrome\n8,Test Message 1,test author 1,2016-08-15T00:00:00Z,false\n",
+					response.Body.String())
+				assert.Equal(t, "text/csv", response.Header().Get("content-type"))
+			},
+		},
+		{
+			name:   "Fail path - CSV is for lists only",
+			method: http.MethodGet,
+			path:   "/messages/8",
+			accept: "text/csv",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "\"type\":\"/problems/not-acceptable\"")
+				assert.Equal(t, http.StatusNotAcceptable, response.Code)
+			},
+		},
+		{
+			name:        "Fail path - not acceptable requests are not served",
+			method:      http.MethodPost,
+			path:        "/messages",
+			accept:      "image/png",
+			contentType: "application/json",
+			body:        `{"content": "abba"}`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotAcceptable, response.Code)
+				assert.Contains(t, response.Body.String(), "application/json, application/xml, application/yaml, text/csv, application/msgpack")
+			},
+		},
+		{
+			name:        "Success path - create from XML",
+			method:      http.MethodPost,
+			path:        "/messages",
+			contentType: "application/xml",
+			body:        `<message><content>abba</content><createdAt>1558355016</createdAt></message>`,
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"id\":\"1\",\"content\":\"abba\",\"createdAt\":\"2019-05-20T12:23:36Z\",\"palindrome\":true,\"visibility\":\"public\"}\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name:        "Success path - replace from YAML",
+			method:      http.MethodPut,
+			path:        "/messages/8",
+			contentType: "application/yaml; charset=utf-8",
+			body:        "content: abba\nauthor: yaml\n",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Equal(t, "{\"id\":\"8\",\"content\":\"abba\",\"author\":\"yaml\",\"palindrome\":true,\"visibility\":\"public\"}\n",
+					response.Body.String())
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		},
+		{
+			name:        "Fail path - unsupported request media type",
+			method:      http.MethodPost,
+			path:        "/messages",
+			contentType: "text/csv",
+			body:        "content\nabba\n",
+			checker: func(t *testing.T, response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "\"type\":\"/problems/unsupported-media-type\"")
+				assert.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := setupTestRouter()
+
+			request, _ := http.NewRequest(testCase.method, testCase.path, strings.NewReader(testCase.body))
+			if testCase.accept != "" {
+				request.Header.Set("accept", testCase.accept)
+			}
+			if testCase.contentType != "" {
+				request.Header.Set("content-type", testCase.contentType)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			testCase.checker(t, response)
+		})
+	}
+}
+
+// setupTestRouter - a router serving a memory repository preloaded with message 8
+func setupTestRouter() http.Handler {
+	messageRepository, _ := persistence.NewMemoryRepository()
+	messageRepository.GetMessagesStorage()["8"] = model.MessageResponse{
+		ID:        "8",
+		Content:   getNewString("Test Message 1"),
+		Author:    getNewString("test author 1"),
+		CreatedAt: getNewMessageTime(time.Date(2016, time.August, 15, 0, 0, 0, 0, time.UTC)),
+	}
+	return setupMux([]ServiceController{NewMessageController(messageRepository)}, DefaultSettings(), auth.Disabled())
+}
+
 //------------------------------- Delete -----------------------------------------
 //TODO
 //------------------------------- Validation -------------------------------------
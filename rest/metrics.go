@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shauera/messages/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// unmatchedRoute - the route label of requests that match no route
+const unmatchedRoute = "unmatched"
+
+// abortedStatus - the status label of requests whose handler panicked, such as streams aborted with http.ErrAbortHandler
+const abortedStatus = "aborted"
+
+// metricsMiddleware - records the count, the latency and the in-flight requests of each route.
+// Requests are labeled by the path template of their route so ids do not create a series each.
+// Requests are recorded even when their handler panics, with the aborted status.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		route := unmatchedRoute
+		if currentRoute := mux.CurrentRoute(request); currentRoute != nil {
+			if pathTemplate, err := currentRoute.GetPathTemplate(); err == nil {
+				route = pathTemplate
+			}
+		}
+
+		start := time.Now()
+		inFlight := metrics.HTTPRequestsInFlight.WithLabelValues(route, request.Method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		completed := false
+		defer func() {
+			status := abortedStatus
+			if completed {
+				status = strconv.Itoa(recorder.status)
+			}
+			metrics.HTTPRequests.WithLabelValues(route, request.Method, status).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(route, request.Method, status).Observe(metrics.Since(start))
+		}()
+		next.ServeHTTP(recorder, request)
+		completed = true
+	})
+}
+
+// statusRecorder - passes a response on while keeping its status
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Flush - streamed responses are flushed as they are written
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// metricsHandler - serves the metrics of the registry in the Prometheus exposition format
+func metricsHandler(registry prometheus.Gatherer) http.Handler {
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: log.StandardLogger()})
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		// swagger:operation GET /metrics metrics metrics
+		//
+		// The service metrics in the Prometheus text format
+		// ---
+		// security: []
+		// produces:
+		// - text/plain
+		// responses:
+		//   '200':
+		//     description: OK
+
+		handler.ServeHTTP(response, request)
+	})
+}
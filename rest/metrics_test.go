@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/metrics"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Metrics(t *testing.T) {
+	memoryRepository, _ := persistence.NewMemoryRepository()
+	repository := newInstrumentedRepository(memoryRepository, "memory", nil)
+	router := setupMux([]ServiceController{NewMessageController(repository)}, DefaultSettings(), auth.Disabled())
+	router.Handle("/metrics", metricsHandler(metrics.Default)).Methods("GET")
+
+	requests := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/messages/{id}", "GET", "404"))
+	unmatched := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(unmatchedRoute, "GET", "404"))
+	notFoundErrors := testutil.ToFloat64(metrics.RepositoryErrors.WithLabelValues("memory", "FindMessageByID", "not_found"))
+
+	serveRequest(router, http.MethodGet, "/messages/1", "", "")
+	serveRequest(router, http.MethodGet, "/messages/2", "", "")
+	serveRequest(router, http.MethodGet, "/nothing/here", "", "")
+
+	assert.Equal(t, requests+2, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/messages/{id}", "GET", "404")), "requests are labeled by route template")
+	assert.Equal(t, unmatched+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(unmatchedRoute, "GET", "404")))
+	assert.Equal(t, notFoundErrors+2, testutil.ToFloat64(metrics.RepositoryErrors.WithLabelValues("memory", "FindMessageByID", "not_found")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.HTTPRequestsInFlight.WithLabelValues("/messages/{id}", "GET")))
+
+	serveRequest(router, http.MethodPost, "/messages", `{"content": "abba"}`, "")
+	serveRequest(router, http.MethodGet, "/messages?expand=analysis", "", "")
+	response := serveRequest(router, http.MethodGet, "/metrics", "", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, string(expfmt.FmtText), response.Header().Get("content-type"))
+	assert.Contains(t, response.Body.String(), `messages_http_request_duration_seconds_count{method="GET",route="/messages/{id}",status="404"}`)
+	assert.Contains(t, response.Body.String(), `messages_repository_operation_duration_seconds_count{backend="memory",operation="CreateMessage"} `)
+	assert.Contains(t, response.Body.String(), `messages_analyzer_duration_seconds_count{analyzer="palindrome"} `)
+}
@@ -0,0 +1,134 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shauera/messages/model"
+
+	config "github.com/spf13/viper"
+)
+
+// Modes of the service
+const (
+	// ModeNormal - every request is served
+	ModeNormal = "normal"
+	// ModeReadOnly - messages are read but not written, for example during database migrations
+	ModeReadOnly = "read-only"
+	// ModeMaintenance - only the health endpoints are served
+	ModeMaintenance = "maintenance"
+)
+
+// Modes - all the modes of the service
+var Modes = []string{ModeNormal, ModeReadOnly, ModeMaintenance}
+
+// modeHeader - response header naming the mode of the service
+const modeHeader = "X-Service-Mode"
+
+// healthPaths - the routes still served during maintenance, so orchestrators keep probing the service
+var healthPaths = map[string]bool{"/healthz": true, "/readyz": true, "/health": true}
+
+// ServiceMode - the mode of the service, switched by the configuration and the admin API
+type ServiceMode struct {
+	mode atomic.Value
+	// retryAfter - when clients should retry requests rejected because of the mode
+	retryAfter time.Duration
+}
+
+//NewServiceMode - return the mode of a service in the given mode, rejected requests are told to retry after retryAfter
+func NewServiceMode(mode string, retryAfter time.Duration) (*ServiceMode, error) {
+	serviceMode := &ServiceMode{retryAfter: retryAfter}
+	if err := serviceMode.Set(mode); err != nil {
+		return nil, err
+	}
+	return serviceMode, nil
+}
+
+//LoadServiceMode - the mode of the service given by service.mode and service.modeRetryAfter, normal when not set
+func LoadServiceMode() (*ServiceMode, error) {
+	mode := config.GetString("service.mode")
+	if mode == "" {
+		mode = ModeNormal
+	}
+	serviceMode, err := NewServiceMode(mode, config.GetDuration("service.modeRetryAfter"))
+	if err != nil {
+		return nil, fmt.Errorf("service.mode: %v", err)
+	}
+	return serviceMode, nil
+}
+
+// Get - the current mode
+func (sm *ServiceMode) Get() string {
+	return sm.mode.Load().(string)
+}
+
+// Set - switches the service to the mode, requests starting from now on are served in it
+func (sm *ServiceMode) Set(mode string) error {
+	for _, known := range Modes {
+		if strings.EqualFold(mode, known) {
+			sm.mode.Store(known)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown mode %q, one of %s", mode, strings.Join(Modes, ", "))
+}
+
+// reject - renders the problem of a request the mode does not allow
+func (sm *ServiceMode) reject(response http.ResponseWriter, request *http.Request, problemType string, detail string) {
+	response.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(sm.retryAfter)))
+	writeProblem(response, request, model.ProblemResponse{
+		Type:   problemType,
+		Status: http.StatusServiceUnavailable,
+		Detail: detail,
+	})
+}
+
+// modeMiddleware - names the mode of the service in every response and rejects with 503 every request
+// but the health probes while the service is down for maintenance, and changes of messages while it is read-only.
+// Must be applied before authenticationMiddleware, rejected requests do not reach the database.
+func modeMiddleware(serviceMode *ServiceMode) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			mode := serviceMode.Get()
+			response.Header().Set(modeHeader, mode)
+			switch {
+			case mode == ModeMaintenance && !isHealthRequest(request):
+				serviceMode.reject(response, request, model.ProblemTypeMaintenance, "The service is down for maintenance")
+			case mode == ModeReadOnly && isMessageWrite(request):
+				serviceMode.reject(response, request, model.ProblemTypeReadOnly, "The service is read-only, changes are not accepted")
+			default:
+				next.ServeHTTP(response, request)
+			}
+		})
+	}
+}
+
+// isHealthRequest - reports if the request is served by a health endpoint
+func isHealthRequest(request *http.Request) bool {
+	return healthPaths[routePathTemplate(request)]
+}
+
+// isMessageWrite - reports if the request creates, updates, patches or deletes messages
+func isMessageWrite(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	pathTemplate := routePathTemplate(request)
+	return pathTemplate == "/messages" || strings.HasPrefix(pathTemplate, "/messages/")
+}
+
+// routePathTemplate - the path template of the route of the request, empty when no route matched
+func routePathTemplate(request *http.Request) string {
+	route := mux.CurrentRoute(request)
+	if route == nil {
+		return ""
+	}
+	pathTemplate, _ := route.GetPathTemplate()
+	return pathTemplate
+}
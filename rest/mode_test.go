@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/health"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+
+	config "github.com/spf13/viper"
+)
+
+func Test_Service_Mode(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	serviceHealth := health.NewHealth(time.Second, health.PingCheck("database", repository))
+	serviceHealth.Started()
+	serviceMode, _ := NewServiceMode(ModeNormal, 30*time.Second)
+	router := setupMux([]ServiceController{
+		NewHealthController(serviceHealth).WithServiceMode(serviceMode),
+		NewMessageController(repository),
+	}, DefaultSettings(), auth.Disabled(), modeMiddleware(serviceMode))
+
+	problem := func(t *testing.T, response string) model.ProblemResponse {
+		var problem model.ProblemResponse
+		assert.NoError(t, json.Unmarshal([]byte(response), &problem))
+		return problem
+	}
+
+	t.Run("Success path - every request is served in the normal mode", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPost, "/messages", `{"content": "hello"}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, ModeNormal, response.Header().Get(modeHeader))
+
+		var report model.HealthReport
+		response = serveRequest(router, http.MethodGet, "/health", "", "")
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &report))
+		assert.Equal(t, ModeNormal, report.Mode)
+	})
+
+	t.Run("Success path - reads are served in the read-only mode", func(t *testing.T) {
+		assert.NoError(t, serviceMode.Set(ModeReadOnly))
+		response := serveRequest(router, http.MethodGet, "/messages", "", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, ModeReadOnly, response.Header().Get(modeHeader))
+	})
+
+	t.Run("Fail path - writes are rejected in the read-only mode", func(t *testing.T) {
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			path := "/messages/1"
+			if method == http.MethodPost {
+				path = "/messages"
+			}
+			response := serveRequest(router, method, path, `{"content": "hello"}`, "")
+			assert.Equal(t, http.StatusServiceUnavailable, response.Code, method)
+			assert.Equal(t, "30", response.Header().Get("Retry-After"), method)
+			assert.Equal(t, model.ProblemTypeReadOnly, problem(t, response.Body.String()).Type, method)
+		}
+	})
+
+	t.Run("Fail path - only the health endpoints are served in the maintenance mode", func(t *testing.T) {
+		assert.NoError(t, serviceMode.Set("Maintenance"))
+		response := serveRequest(router, http.MethodGet, "/messages", "", "")
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Equal(t, "30", response.Header().Get("Retry-After"))
+		assert.Equal(t, model.ProblemTypeMaintenance, problem(t, response.Body.String()).Type)
+		assert.Equal(t, ModeMaintenance, response.Header().Get(modeHeader))
+
+		for _, path := range []string{"/healthz", "/readyz", "/health"} {
+			response = serveRequest(router, http.MethodGet, path, "", "")
+			assert.Equal(t, http.StatusOK, response.Code, path)
+		}
+		var report model.HealthReport
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &report))
+		assert.Equal(t, ModeMaintenance, report.Mode)
+	})
+
+	t.Run("Fail path - unknown modes", func(t *testing.T) {
+		assert.EqualError(t, serviceMode.Set("frozen"), `unknown mode "frozen", one of normal, read-only, maintenance`)
+		assert.Equal(t, ModeMaintenance, serviceMode.Get())
+	})
+}
+
+func Test_Service_Mode_Before_Authentication(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{}))
+	serviceMode, _ := NewServiceMode(ModeReadOnly, 30*time.Second)
+	router := setupMux([]ServiceController{NewMessageController(repository)}, DefaultSettings(), authentication, modeMiddleware(serviceMode))
+
+	t.Run("Fail path - writes are rejected before authentication in the read-only mode", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPost, "/messages", `{"content": "hello"}`, "Bearer invalid")
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Empty(t, response.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Fail path - reads are still authenticated in the read-only mode", func(t *testing.T) {
+		response := serveRequest(router, http.MethodGet, "/messages", "", "Bearer invalid")
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+	})
+
+	t.Run("Fail path - requests are rejected before authentication in the maintenance mode", func(t *testing.T) {
+		assert.NoError(t, serviceMode.Set(ModeMaintenance))
+		response := serveRequest(router, http.MethodGet, "/messages", "", "Bearer invalid")
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	})
+}
+
+func Test_Load_Service_Mode(t *testing.T) {
+	defer config.Reset()
+
+	serviceMode, err := LoadServiceMode()
+	assert.NoError(t, err)
+	assert.Equal(t, ModeNormal, serviceMode.Get())
+
+	config.Set("service.mode", "read-only")
+	serviceMode, err = LoadServiceMode()
+	assert.NoError(t, err)
+	assert.Equal(t, ModeReadOnly, serviceMode.Get())
+
+	config.Set("service.mode", "frozen")
+	_, err = LoadServiceMode()
+	assert.EqualError(t, err, `service.mode: unknown mode "frozen", one of normal, read-only, maintenance`)
+}
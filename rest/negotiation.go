@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// negotiate - select the codec of the response by the request Accept header.
+// The sample value is of the same kind as the response (a single message or a list)
+// so the selection can be made before the request is served.
+func negotiate(response http.ResponseWriter, request *http.Request, codecs *render.Registry, sample interface{}) (render.Codec, error) {
+	response.Header().Add("Vary", "Accept")
+
+	codec, err := codecs.Negotiate(request.Header.Get("accept"), sample)
+	if err != nil {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeNotAcceptable,
+			Status: http.StatusNotAcceptable,
+			Detail: "The response can be represented as " + strings.Join(codecs.MediaTypes(), ", "),
+		})
+		log.WithContext(request.Context()).WithField("accept", request.Header.Get("accept")).Debug("No acceptable response media type")
+		return nil, err
+	}
+
+	return codec, nil
+}
+
+// writeResponse - renders value with the negotiated codec, name is the element name of formats that need one
+func writeResponse(response http.ResponseWriter, codec render.Codec, name string, value interface{}) {
+	response.Header().Set("content-type", codec.MediaTypes()[0])
+	if err := codec.Encode(response, name, value); err != nil {
+		log.WithError(err).Error("Could not encode response")
+	}
+}
+
+// decodeRequest - decode the request body by the request Content-Type header
+func decodeRequest(request *http.Request, codecs *render.Registry, target interface{}) error {
+	codec, err := codecs.ForContentType(request.Header.Get("content-type"))
+	if err != nil {
+		return err
+	}
+	return codec.Decode(request.Body, target)
+}
+
+// readRequest - decode the request body into target (see decodeRequest), rendering a problem when it can't be.
+// resources names what the body holds in the problem details, for example "Messages".
+func readRequest(response http.ResponseWriter, request *http.Request, codecs *render.Registry, target interface{}, resources string) error {
+	err := decodeRequest(request, codecs, target)
+	if err == render.ErrorUnsupportedMediaType {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeUnsupportedMediaType,
+			Status: http.StatusUnsupportedMediaType,
+			Detail: resources + " can't be sent as " + request.Header.Get("content-type"),
+		})
+		log.WithContext(request.Context()).WithField("contentType", request.Header.Get("content-type")).Debug("Unsupported request media type")
+		return err
+	}
+	if err != nil {
+		responseErr := errors.Wrap(err, "Could not decode request body")
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeMalformedRequest,
+			Status: http.StatusBadRequest,
+			Detail: responseErr.Error(),
+		})
+		log.WithContext(request.Context()).WithError(err).Debug("Could not decode request body")
+		return responseErr
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/resilience"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// correlationIDHeader - request and response header carrying the correlation id
+const correlationIDHeader = "X-Correlation-ID"
+
+type correlationIDKey struct{}
+
+// correlationIDMiddleware - makes sure every request has a correlation id.
+// An id given by the client is kept, otherwise a new one is generated.
+// The id is echoed in the response headers and is available through the request context.
+func correlationIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		correlationID := request.Header.Get(correlationIDHeader)
+		if correlationID == "" {
+			correlationID = newCorrelationID()
+		}
+
+		response.Header().Set(correlationIDHeader, correlationID)
+		ctx := context.WithValue(request.Context(), correlationIDKey{}, correlationID)
+		next.ServeHTTP(response, request.WithContext(ctx))
+	})
+}
+
+// getCorrelationID - returns the correlation id of the request
+func getCorrelationID(request *http.Request) string {
+	if correlationID, ok := request.Context().Value(correlationIDKey{}).(string); ok {
+		return correlationID
+	}
+	return request.Header.Get(correlationIDHeader)
+}
+
+func newCorrelationID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// writeProblem - renders an RFC 7807 problem details response
+func writeProblem(response http.ResponseWriter, request *http.Request, problem model.ProblemResponse) {
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if problem.Instance == "" {
+		problem.Instance = request.URL.RequestURI()
+	}
+	if problem.CorrelationID == "" {
+		problem.CorrelationID = getCorrelationID(request)
+	}
+
+	response.Header().Set("content-type", model.ProblemContentType)
+	response.WriteHeader(problem.Status)
+	json.NewEncoder(response).Encode(problem)
+}
+
+// problemFromError - maps an error returned by a repository to the matching problem.
+// Errors that are not persistence errors are reported as internal errors without details.
+func problemFromError(err error) model.ProblemResponse {
+	if _, ok := errors.Cause(err).(resilience.OpenError); ok {
+		return model.ProblemResponse{Type: model.ProblemTypeUnavailable, Status: http.StatusServiceUnavailable,
+			Detail: "The database is currently unavailable"}
+	}
+
+	switch errors.Cause(err) {
+	case persistence.ErrorNotFound:
+		return model.ProblemResponse{Type: model.ProblemTypeNotFound, Status: http.StatusNotFound,
+			Detail: "The requested resource does not exist"}
+	case persistence.ErrorInvalidID:
+		return model.ProblemResponse{Type: model.ProblemTypeInvalidID, Status: http.StatusBadRequest,
+			Detail: "The given id is not a valid resource id"}
+	case persistence.ErrorForbidden:
+		return model.ProblemResponse{Type: model.ProblemTypeForbidden, Status: http.StatusForbidden,
+			Detail: "The resource can only be changed by its owner"}
+	case persistence.ErrorConflict:
+		return model.ProblemResponse{Type: model.ProblemTypeConflict, Status: http.StatusConflict,
+			Detail: "The request conflicts with an existing resource"}
+	case persistence.ErrorUnavailable:
+		return model.ProblemResponse{Type: model.ProblemTypeUnavailable, Status: http.StatusServiceUnavailable,
+			Detail: "The database is currently unavailable"}
+	case persistence.ErrorTimeout:
+		return model.ProblemResponse{Type: model.ProblemTypeTimeout, Status: http.StatusGatewayTimeout,
+			Detail: "The database did not respond in time"}
+	}
+
+	return model.ProblemResponse{Type: model.ProblemTypeInternal, Status: http.StatusInternalServerError,
+		Detail: "An unexpected error occurred"}
+}
+
+// writeError - renders the problem matching err and logs it with the given message
+func writeError(response http.ResponseWriter, request *http.Request, err error, logMessage string) {
+	problem := problemFromError(err)
+	problem.CorrelationID = getCorrelationID(request)
+	if problem.Status == http.StatusServiceUnavailable {
+		response.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter(err))))
+	}
+
+	logEntry := log.WithContext(request.Context()).WithError(err).WithField("correlationId", problem.CorrelationID)
+	if problem.Status >= http.StatusInternalServerError {
+		logEntry.Error(logMessage)
+	} else {
+		logEntry.Debug(logMessage)
+	}
+
+	writeProblem(response, request, problem)
+}
+
+// unavailableRetryAfter - when clients should retry requests failing because the database is unavailable,
+// unless the circuit breaker tells when it lets calls through again
+const unavailableRetryAfter = time.Second
+
+// retryAfter - when a request that failed with err should be retried
+func retryAfter(err error) time.Duration {
+	if openErr, ok := errors.Cause(err).(resilience.OpenError); ok && openErr.RetryAfter > unavailableRetryAfter {
+		return openErr.RetryAfter
+	}
+	return unavailableRetryAfter
+}
+
+func notFoundHandler(response http.ResponseWriter, request *http.Request) {
+	writeProblem(response, request, model.ProblemResponse{
+		Type:   model.ProblemTypeNotFound,
+		Status: http.StatusNotFound,
+		Detail: "No resource matches the request path",
+	})
+}
+
+func methodNotAllowedHandler(response http.ResponseWriter, request *http.Request) {
+	writeProblem(response, request, model.ProblemResponse{
+		Type:   model.ProblemTypeMalformedRequest,
+		Status: http.StatusMethodNotAllowed,
+		Detail: "The request method is not supported by the resource",
+	})
+}
@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Problem_From_Error(t *testing.T) {
+	testCases := []struct {
+		err            error
+		expectedType   string
+		expectedStatus int
+	}{
+		{persistence.ErrorNotFound, model.ProblemTypeNotFound, http.StatusNotFound},
+		{persistence.ErrorInvalidID, model.ProblemTypeInvalidID, http.StatusBadRequest},
+		{errors.Wrap(persistence.ErrorConflict, "E11000 duplicate key error"), model.ProblemTypeConflict, http.StatusConflict},
+		{errors.Wrap(persistence.ErrorUnavailable, "server selection error"), model.ProblemTypeUnavailable, http.StatusServiceUnavailable},
+		{errors.Wrap(persistence.ErrorTimeout, "context deadline exceeded"), model.ProblemTypeTimeout, http.StatusGatewayTimeout},
+		{errors.New("driver internals"), model.ProblemTypeInternal, http.StatusInternalServerError},
+	}
+
+	for _, testCase := range testCases {
+		problem := problemFromError(testCase.err)
+		assert.Equal(t, testCase.expectedType, problem.Type, testCase.err.Error())
+		assert.Equal(t, testCase.expectedStatus, problem.Status, testCase.err.Error())
+		assert.NotContains(t, problem.Detail, testCase.err.Error())
+	}
+}
+
+func Test_Correlation_ID_Middleware(t *testing.T) {
+	var seenCorrelationID string
+	handler := correlationIDMiddleware(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		seenCorrelationID = getCorrelationID(request)
+	}))
+
+	request, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	assert.Len(t, seenCorrelationID, 32)
+	assert.Equal(t, seenCorrelationID, response.Header().Get(correlationIDHeader))
+}
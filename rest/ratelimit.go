@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/ratelimit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rateLimitHeaders - the headers describing the limits of the client at the time of a request
+var rateLimitHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "X-Quota-Limit", "X-Quota-Remaining", "X-Quota-Reset"}
+
+// rateLimitMiddleware - limits the requests of clients and the daily writes of principals.
+// Must be applied after authenticationMiddleware, clients are told apart by their principal and
+// unauthenticated clients by their address. Every limited response carries the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, requests over the limit are rejected with 429.
+// A write is counted against the quota before it is served so concurrent writes can't exceed it,
+// and is taken back when it is not answered with 2xx, for example when it is not permitted.
+// The limits are those of the current runtime settings, requests are not limited while they have none.
+func rateLimitMiddleware(settings *Settings) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			rateLimiting := settings.Load().RateLimiting
+			if rateLimiting == nil {
+				next.ServeHTTP(response, request)
+				return
+			}
+
+			principal, _ := auth.FromContext(request.Context())
+			pathTemplate := ""
+			if route := mux.CurrentRoute(request); route != nil {
+				pathTemplate, _ = route.GetPathTemplate()
+			}
+
+			if rateLimiting.Limiter != nil {
+				bucketName, limit := rateLimiting.Policy.LimitOf(ratelimit.RouteName(request.Method, pathTemplate), principal.Roles)
+				client := clientKey(request, principal, rateLimiting.TrustedProxies)
+				decision := rateLimiting.Limiter.Allow(client+"|"+bucketName, limit, time.Now())
+
+				response.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+				response.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+				response.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+				if !decision.Allowed {
+					log.WithContext(request.Context()).WithField("client", client).WithField("bucket", bucketName).
+						WithField("correlationId", getCorrelationID(request)).Info("Rate limit exceeded")
+					response.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+					writeProblem(response, request, model.ProblemResponse{
+						Type:   model.ProblemTypeRateLimited,
+						Status: http.StatusTooManyRequests,
+						Detail: "Too many requests, retry after the time given in the Retry-After header",
+					})
+					return
+				}
+			}
+
+			if rateLimiting.Quotas != nil && isQuotaWrite(request, principal, pathTemplate) {
+				usage, err := rateLimiting.Quotas.Write(request.Context(), principal)
+				if usage.Limit > 0 {
+					response.Header().Set("X-Quota-Limit", strconv.Itoa(usage.Limit))
+					response.Header().Set("X-Quota-Remaining", strconv.Itoa(usage.Remaining))
+					response.Header().Set("X-Quota-Reset", usage.Reset.Format(time.RFC3339))
+				}
+				switch {
+				case err == ratelimit.ErrorQuotaExceeded:
+					log.WithContext(request.Context()).WithField("subject", principal.Subject).WithField("correlationId", getCorrelationID(request)).
+						Info("Daily write quota exceeded")
+					response.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(time.Until(usage.Reset))))
+					writeProblem(response, request, model.ProblemResponse{
+						Type:   model.ProblemTypeQuotaExceeded,
+						Status: http.StatusTooManyRequests,
+						Detail: "The daily write quota of " + strconv.Itoa(usage.Limit) + " writes is used up, it is renewed at midnight UTC",
+					})
+					return
+				case err != nil:
+					writeError(response, request, err, "Could not count write against the daily quota")
+					return
+				}
+
+				recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+				next.ServeHTTP(recorder, request)
+				if recorder.status < 200 || recorder.status > 299 {
+					// the client may be gone already, the write is taken back regardless
+					if err := rateLimiting.Quotas.Refund(context.Background(), principal, usage); err != nil {
+						log.WithContext(request.Context()).WithError(err).WithField("subject", principal.Subject).
+							WithField("correlationId", getCorrelationID(request)).Warn("Could not take back a failed write from the daily quota")
+					}
+				}
+				return
+			}
+
+			next.ServeHTTP(response, request)
+		})
+	}
+}
+
+// clientKey - identifies the client of a request, authenticated clients by their principal and
+// other clients by their address
+func clientKey(request *http.Request, principal auth.Principal, trustedProxies ratelimit.TrustedProxies) string {
+	if principal.Subject == "" || principal.Method == auth.MethodAnonymous {
+		return "ip:" + trustedProxies.ClientIP(request)
+	}
+	return principal.Method + ":" + principal.Subject
+}
+
+// isQuotaWrite - reports if the request changes messages on behalf of an authenticated principal
+func isQuotaWrite(request *http.Request, principal auth.Principal, pathTemplate string) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return principal.Subject != "" && principal.Method != auth.MethodAnonymous &&
+		strings.HasPrefix(pathTemplate, "/messages")
+}
+
+// ceilSeconds - the duration in whole seconds, rounded up
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
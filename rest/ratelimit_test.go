@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Rate_Limit(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{}))
+	router := setupMux([]ServiceController{NewMessageController(repository)}, DefaultSettings(), authentication)
+	router.Use(rateLimitMiddleware(NewSettings(RuntimeSettings{RateLimiting: &ratelimit.RateLimiting{
+		Limiter: ratelimit.NewLimiter(),
+		Policy: ratelimit.Policy{
+			Default: ratelimit.RoutePolicy{Limit: ratelimit.Limit{Requests: 2, Per: time.Hour}},
+			Routes: map[string]ratelimit.RoutePolicy{
+				"POST /messages": {Limit: ratelimit.Limit{Requests: 10, Per: time.Hour}},
+			},
+		},
+		Quotas: ratelimit.NewQuotas(repository, ratelimit.QuotaPolicy{WritesPerDay: 1}),
+	}})))
+
+	reader := "Bearer " + testToken("reader-1", "reader")
+	editor := "Bearer " + testToken("editor-1", "editor")
+
+	t.Run("Fail path - requests over the limit", func(t *testing.T) {
+		response := serveRequest(router, http.MethodGet, "/messages", "", reader)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "2", response.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", response.Header().Get("RateLimit-Remaining"))
+		serveRequest(router, http.MethodGet, "/messages", "", reader)
+
+		response = serveRequest(router, http.MethodGet, "/messages", "", reader)
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		assert.Equal(t, "1800", response.Header().Get("Retry-After"))
+		assert.Equal(t, "3600", response.Header().Get("RateLimit-Reset"))
+		var problem model.ProblemResponse
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &problem))
+		assert.Equal(t, model.ProblemTypeRateLimited, problem.Type)
+
+		response = serveRequest(router, http.MethodGet, "/messages", "", editor)
+		assert.Equal(t, http.StatusOK, response.Code, "clients are limited separately")
+	})
+
+	t.Run("Success path - failed writes are not counted", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPost, "/messages", `{"content": ""}`, editor)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		response = serveRequest(router, http.MethodDelete, "/messages/5cfd2a7cbd0dd5f2b7e0ea2a", "", editor)
+		assert.Equal(t, http.StatusForbidden, response.Code, "editors may not delete messages")
+	})
+
+	t.Run("Fail path - writes over the daily quota", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPost, "/messages", `{"content": "abba"}`, editor)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "10", response.Header().Get("RateLimit-Limit"), "routes are limited separately")
+		assert.Equal(t, "0", response.Header().Get("X-Quota-Remaining"))
+
+		response = serveRequest(router, http.MethodPost, "/messages", `{"content": "abba"}`, editor)
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		assert.NotEmpty(t, response.Header().Get("Retry-After"))
+		var problem model.ProblemResponse
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &problem))
+		assert.Equal(t, model.ProblemTypeQuotaExceeded, problem.Type)
+	})
+}
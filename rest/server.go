@@ -2,11 +2,23 @@ package rest
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 
+	"github.com/shauera/messages/application"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/health"
+	"github.com/shauera/messages/idempotency"
+	"github.com/shauera/messages/lifecycle"
+	"github.com/shauera/messages/metrics"
 	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/ratelimit"
+	"github.com/shauera/messages/resilience"
+	"github.com/shauera/messages/tenancy"
 
 	log "github.com/sirupsen/logrus"
 	config "github.com/spf13/viper"
@@ -17,52 +29,408 @@ type ServiceController interface {
 	PublishEndpoints(*mux.Router)
 }
 
-func setupMux(serviceControllers []ServiceController) *mux.Router {
+// setupMux - the router of the service endpoints. The guards are applied before authentication,
+// so the requests they reject are neither authenticated, made idempotent nor counted against the limits.
+// Preflight requests are answered before the guards, browsers send them without credentials.
+func setupMux(serviceControllers []ServiceController, settings *Settings, authentication *auth.Authentication,
+	guards ...mux.MiddlewareFunc) *mux.Router {
 	router := mux.NewRouter()
+	router.Use(metricsMiddleware)
+	router.Use(correlationIDMiddleware)
+	router.Use(tracingMiddleware)
+	router.Use(corsMiddleware(settings))
+	router.Use(guards...)
+	router.Use(authenticationMiddleware(authentication))
+
+	// unmatched routes are reported as problems as well
+	router.NotFoundHandler = metricsMiddleware(correlationIDMiddleware(tracingMiddleware(http.HandlerFunc(notFoundHandler))))
+	router.MethodNotAllowedHandler = metricsMiddleware(correlationIDMiddleware(tracingMiddleware(http.HandlerFunc(methodNotAllowedHandler))))
 
 	// publish all endpoint handlers
 	for _, serviceController := range serviceControllers {
 		serviceController.PublishEndpoints(router)
 	}
+	// the routes of the endpoints serve other methods, preflight requests are matched here and answered by corsMiddleware
+	router.Methods(http.MethodOptions).MatcherFunc(preflightMatcher(settings)).HandlerFunc(methodNotAllowedHandler)
 
-	// Swagger route
+	// Swagger route - the specification is served with the active validation rules
+	router.Handle("/swaggerui/swagger.json", NewSpecHandler(swaggerSpecPath, settings)).Methods("GET")
 	stripPrefixHandler := http.StripPrefix("/swaggerui/", http.FileServer(http.Dir("./dist/")))
 	router.PathPrefix("/swaggerui/").Handler(stripPrefixHandler)
-	// TODO - add middleware for JWT authorization
-	//router.Use(call JWT validation)
-	//https://medium.com/@adigunhammedolalekan/build-and-deploy-a-secure-rest-api-with-go-postgresql-jwt-and-gorm-6fadf3da505b
-	//https://www.sohamkamani.com/blog/golang/2019-01-01-jwt-authentication/
 	return router
 }
 
-// TODO - add metrics https://opencensus.io/stats/
-// TODO - add health
+// Repository - the repositories of all the resources served, implemented by every persister
+type Repository interface {
+	MessageRepository
+	auth.APIKeyRepository
+	auth.UserRepository
+	tenancy.TenantRepository
+	ratelimit.QuotaRepository
+	idempotency.Repository
+	health.Pinger
+}
+
+// StartHTTPServer - start service messages and serve until ctx is cancelled, then shut the service down gracefully.
+// The service listens right away and reports itself as starting, so probes are answered, while it connects
+// to the database in the background. Requests other than the health probes are served once it is connected.
+// Returns once the in-flight requests were served and the shutdown hooks ran, or the grace period ended.
+func StartHTTPServer(ctx context.Context) error {
+	// hooks run in the reverse order they are added, parts are added as they start
+	shutdown := lifecycle.NewShutdown()
+
+	stopTracing, err := startTracing(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid tracing configuration")
+	}
+	if stopTracing != nil {
+		// spans still queued are exported once everything else stopped
+		shutdown.OnShutdown("tracer", stopTracing)
+	}
 
-// StartHTTPServer - start service messages
-func StartHTTPServer(ctx context.Context) {
-	var messageRepository MessageRepository
-	var err error
+	var connect func(ctx context.Context) (Repository, MessageRepositories, error)
+	// parts started once connected, such as the database connection, stop after the server
+	connected := lifecycle.NewShutdown()
+	shutdown.OnShutdown("database", connected.Run)
 
 	databaseType := config.GetString("database.type")
 	switch databaseType {
 	case "memory":
-		messageRepository, err = persistence.NewMemoryRepository()
+		connect = func(ctx context.Context) (Repository, MessageRepositories, error) {
+			memoryRepository, err := persistence.NewMemoryRepository()
+			if err != nil {
+				return nil, nil, err
+			}
+			return memoryRepository, func(tenant string) MessageRepository { return memoryRepository.ForTenant(tenant) }, nil
+		}
 	case "mongo":
-		messageRepository, err = persistence.NewMongoRepository(ctx)
+		mongoConfig, configErr := persistence.LoadMongoConfig()
+		if configErr != nil {
+			log.WithError(configErr).Fatal("Invalid database configuration")
+		}
+		connectBackoff, connectAttempts, retryErr := resilience.LoadConnectRetry()
+		if retryErr != nil {
+			log.WithError(retryErr).Fatal("Invalid database configuration")
+		}
+		connect = func(ctx context.Context) (Repository, MessageRepositories, error) {
+			// the database may not be running yet, connecting is retried until it is or the service is stopped
+			var mongoRepository *persistence.MongoRepository
+			err := resilience.Retry(ctx, connectBackoff, connectAttempts, func(ctx context.Context) (err error) {
+				mongoRepository, err = persistence.NewMongoRepository(ctx, mongoConfig)
+				return err
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			connected.OnShutdown("mongo", mongoRepository.Close)
+			return mongoRepository, func(tenant string) MessageRepository { return mongoRepository.ForTenant(tenant) }, nil
+		}
 	default:
 		log.WithField("databaseType", databaseType).Fatal("Non supported database type")
 	}
 
-	//TODO - Need to make this more tollerant for the occasion that the DB is not running yet
+	serviceMode, err := LoadServiceMode()
+	if err != nil {
+		log.WithError(err).Fatal("Invalid service configuration")
+	}
+
+	// the database check fails until the service is connected
+	database := &connection{}
+	serviceHealth, err := health.LoadHealth(health.PingCheck("database", database))
 	if err != nil {
-		log.WithError(err).WithField("databaseType", databaseType).Fatal("Could not initialize database connection")
+		log.WithError(err).Fatal("Invalid health configuration")
+	}
+
+	// metrics are served on a port of their own when metrics.port is set, so they are not exposed with the API
+	metricsPort := config.GetString("metrics.port")
+	if metricsPort != "" {
+		metricsRouter := http.NewServeMux()
+		metricsRouter.Handle("/metrics", metricsHandler(metrics.Default))
+		metricsServer := &http.Server{Addr: ":" + metricsPort, Handler: metricsRouter}
+		shutdown.OnShutdown("metrics server", metricsServer.Shutdown)
+		go func() {
+			log.WithField("port", metricsPort).Info("Serving metrics")
+			if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.WithError(err).Fatal("Could not serve metrics")
+			}
+		}()
+	}
+
+	// the admin endpoints are served on a port of their own only, when admin.port is set. They require no credentials,
+	// so they listen on admin.address, the loopback interface by default
+	if adminPort := config.GetString("admin.port"); adminPort != "" {
+		adminAddress := net.JoinHostPort(config.GetString("admin.address"), adminPort)
+		adminServer := &http.Server{Addr: adminAddress, Handler: setupAdminMux(NewAdminController(serviceMode))}
+		shutdown.OnShutdown("admin server", adminServer.Shutdown)
+		go func() {
+			log.WithField("address", adminAddress).Info("Serving the admin API")
+			if err := adminServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.WithError(err).Fatal("Could not serve the admin API")
+			}
+		}()
+	}
+
+	listener, err := net.Listen("tcp", ":"+config.GetString("service.port"))
+	if err != nil {
+		return errors.Wrap(err, "Could not listen on the service port")
+	}
+	handler := &switchHandler{}
+	handler.Set(startingRouter(serviceHealth, serviceMode, metricsPort == ""))
+
+	go func() {
+		repository, repositories, err := connect(ctx)
+		if ctx.Err() != nil {
+			log.Info("Stopped before connecting to the database")
+			return
+		}
+		if err != nil {
+			log.WithError(err).WithField("databaseType", databaseType).Fatal("Could not initialize database connection")
+		}
+		router := setupServiceRouter(ctx, repository, repositories, databaseType, database, serviceHealth, serviceMode)
+		if metricsPort == "" {
+			router.Handle("/metrics", metricsHandler(metrics.Default)).Methods("GET")
+		}
+		handler.Set(router)
+		serviceHealth.Started()
+		log.Info("Connected to the database, serving requests")
+	}()
+
+	server := &http.Server{Handler: handler}
+	return serve(ctx, server, listener, serviceHealth, shutdown, ShutdownConfig{
+		Delay:       config.GetDuration("service.shutdownDelay"),
+		GracePeriod: config.GetDuration("service.shutdownGraceDuration"),
+	})
+}
+
+// CheckConfiguration - validates the configuration of every part of the service the way StartHTTPServer does,
+// without listening or connecting to the database. All the problems found are reported in the returned
+// application.ConfigurationError, nil when the service would start.
+func CheckConfiguration() error {
+	var problems []string
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	check(checkTracing())
+	switch databaseType := config.GetString("database.type"); databaseType {
+	case "memory":
+	case "mongo":
+		_, err := persistence.LoadMongoConfig()
+		check(err)
+		_, _, err = resilience.LoadConnectRetry()
+		check(err)
+	default:
+		check(errors.Errorf("database.type: non supported database type %q", databaseType))
+	}
+	_, err := resilience.LoadBreaker()
+	check(err)
+	_, err = LoadServiceMode()
+	check(err)
+	_, err = health.LoadHealth()
+	check(err)
+
+	// the parts working against the repository are not used, they are only built
+	_, err = auth.LoadAuthentication(nil)
+	check(err)
+	_, err = auth.LoadUsers(nil)
+	check(err)
+	_, err = tenancy.LoadTenancy(nil)
+	check(err)
+	// the rate limits check the trusted proxies the idempotency keys are scoped with
+	_, err = LoadRuntimeSettings(nil, nil)
+	check(err)
+	_, err = idempotency.LoadKeys(nil)
+	check(err)
+
+	if len(problems) > 0 {
+		return application.ConfigurationError{Problems: problems}
+	}
+	return nil
+}
+
+// setupServiceRouter - sets up the parts of the service working against the repository, pings the database
+// through them, and returns the router serving all the endpoints
+func setupServiceRouter(ctx context.Context, repository Repository, repositories MessageRepositories, databaseType string,
+	database *connection, serviceHealth *health.Health, serviceMode *ServiceMode) *mux.Router {
+	// while the database is down repository calls fail fast
+	breaker, err := resilience.LoadBreaker()
+	if err != nil {
+		log.WithError(err).Fatal("Invalid database configuration")
+	}
+	metrics.NewGaugeFunc(metrics.Default, "messages_database_circuit_open", "1 while database calls fail fast, 0 otherwise.", func() float64 {
+		if breaker.State() == resilience.StateOpen {
+			return 1
+		}
+		return 0
+	})
+
+	// the credentials of a mongo connection are replaced when the configuration is reloaded
+	mongoRepository, _ := repository.(*persistence.MongoRepository)
+
+	// the latency and the errors of repository operations are recorded
+	repository = newInstrumentedRepository(repository, databaseType, breaker)
+	tenantRepositories := repositories
+	repositories = func(tenant string) MessageRepository {
+		return instrumentedMessageRepository{repository: tenantRepositories(tenant), backend: databaseType, breaker: breaker}
+	}
+	database.Set(repository)
+
+	authentication, err := auth.LoadAuthentication(repository)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid authentication configuration")
+	}
+	if !config.GetBool("auth.enabled") {
+		log.Warn("Authentication is disabled, every request is served as an anonymous admin. Set auth.enabled and auth.jwt.keys to authenticate requests")
+	}
+
+	users, err := auth.LoadUsers(repository)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid user configuration")
+	}
+
+	tenants, err := tenancy.LoadTenancy(repository)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid tenancy configuration")
+	}
+
+	// validation rules, analyzers, rate limits and the CORS policy are replaced when the configuration is reloaded
+	runtimeSettings, err := LoadRuntimeSettings(repository, nil)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid configuration")
+	}
+	settings := NewSettings(runtimeSettings)
+
+	configuration, err := application.LoadConfiguration()
+	if err != nil {
+		log.WithError(err).Fatal("Invalid configuration")
+	}
+	reloader := application.NewReloader(configuration)
+	reloader.OnReload("runtime settings", func(application.Configuration) (func(), error) {
+		previous := settings.Load()
+		next, err := LoadRuntimeSettings(repository, &previous)
+		if err != nil {
+			return nil, err
+		}
+		return func() { settings.Store(next) }, nil
+	})
+	// the mode is switched when service.mode changes, a mode switched with the admin API is kept otherwise
+	configuredMode := configuration.Service.Mode
+	reloader.OnReload("service mode", func(configuration application.Configuration) (func(), error) {
+		mode := configuration.Service.Mode
+		if mode == configuredMode {
+			return func() {}, nil
+		}
+		return func() {
+			configuredMode = mode
+			serviceMode.Set(mode)
+		}, nil
+	})
+	// rotated keys and secret files are verified and signed with once the configuration is reloaded
+	reloader.OnReload("jwt keys", func(application.Configuration) (func(), error) {
+		return auth.ReloadKeys(authentication, users)
+	})
+	// connecting is prepared last, so a reload rejected by another part does not leave a connected client behind
+	if mongoRepository != nil {
+		reloader.OnReload("database credentials", func(application.Configuration) (func(), error) {
+			mongoConfig, err := persistence.LoadMongoConfig()
+			if err != nil {
+				return nil, err
+			}
+			return mongoRepository.ReloadCredentials(ctx, mongoConfig)
+		})
+	}
+
+	trustedProxies, err := ratelimit.LoadTrustedProxies()
+	if err != nil {
+		log.WithError(err).Fatal("Invalid rate limit configuration")
+	}
+
+	idempotencyKeys, err := idempotency.LoadKeys(repository)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid idempotency configuration")
+	}
+
+	messageController := NewMessageController(repository).WithSettings(settings)
+	if tenants != nil {
+		messageController = messageController.WithTenancy(tenants, repositories)
 	}
 
 	var serviceControllers []ServiceController
-	serviceControllers = append(serviceControllers, NewMessageController(messageRepository))
+	serviceControllers = append(serviceControllers, NewHealthController(serviceHealth).WithServiceMode(serviceMode))
+	serviceControllers = append(serviceControllers, messageController)
+	serviceControllers = append(serviceControllers, NewAPIKeyController(repository))
+	if tenants != nil {
+		serviceControllers = append(serviceControllers, NewTenantController(tenants.Tenants))
+	}
+	if users != nil {
+		userController := NewUserController(users).WithSettings(settings)
+		if tenants != nil {
+			userController = userController.WithTenancy(tenants)
+		}
+		serviceControllers = append(serviceControllers, userController)
+	}
+
+	// during maintenance only the health endpoints are served, while read-only messages are not changed
+	router := setupMux(serviceControllers, settings, authentication, modeMiddleware(serviceMode))
+	if idempotencyKeys != nil {
+		// requests of tenants are told apart by the tenant header, the host is part of the scope already
+		var scopeHeaders []string
+		if tenants != nil && tenants.Resolver.Header != "" {
+			scopeHeaders = append(scopeHeaders, tenants.Resolver.Header)
+		}
+		router.Use(idempotencyMiddleware(idempotencyKeys, trustedProxies, scopeHeaders...))
+	}
+	// replayed responses are not limited
+	router.Use(rateLimitMiddleware(settings))
 
-	router := setupMux(serviceControllers)
+	// reloads start once the configuration was read, the configuration is not read concurrently with a reload
+	go reloader.Watch(ctx)
+
+	return router
+}
+
+// ShutdownConfig - the timing of a graceful shutdown
+type ShutdownConfig struct {
+	// Delay - how long requests are still served once readiness fails, so load balancers stop routing to the service first
+	Delay time.Duration
+	// GracePeriod - how long in-flight requests and the shutdown hooks may take
+	GracePeriod time.Duration
+}
+
+// serve - serves requests on the listener until ctx is cancelled, the service is marked ready once it is set up.
+// The service is then marked as stopping
+// so readiness fails, and after the delay the server stops accepting connections and drains the in-flight
+// requests before the other shutdown hooks run. Requests still running at the end of the grace period are cut off.
+func serve(ctx context.Context, server *http.Server, listener net.Listener, serviceHealth *health.Health, shutdown *lifecycle.Shutdown, shutdownConfig ShutdownConfig) error {
+	shutdown.OnShutdown("http server", func(ctx context.Context) error {
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close()
+			return err
+		}
+		return nil
+	})
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	log.WithField("address", listener.Addr().String()).Info("Listening")
+
+	select {
+	case err := <-served:
+		return errors.Wrap(err, "Could not serve requests")
+	case <-ctx.Done():
+	}
+
+	log.WithField("delay", shutdownConfig.Delay).WithField("gracePeriod", shutdownConfig.GracePeriod).Info("Shutting down")
+	serviceHealth.Stopping()
+	if shutdownConfig.Delay > 0 {
+		time.Sleep(shutdownConfig.Delay)
+	}
 
-	bindPort := ":" + config.GetString("service.port")
-	log.Fatal(http.ListenAndServe(bindPort, router))
+	graceCtx, cancel := context.WithTimeout(context.Background(), shutdownConfig.GracePeriod)
+	defer cancel()
+	return shutdown.Run(graceCtx)
 }
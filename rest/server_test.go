@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/application"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/health"
+	"github.com/shauera/messages/lifecycle"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+
+	config "github.com/spf13/viper"
+)
+
+func Test_Graceful_Shutdown(t *testing.T) {
+	serviceHealth := health.NewHealth(time.Second)
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		close(started)
+		<-release
+		response.Write([]byte("done"))
+	})
+
+	var stopped []string
+	shutdown := lifecycle.NewShutdown()
+	shutdown.OnShutdown("database", func(ctx context.Context) error {
+		stopped = append(stopped, "database")
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, &http.Server{Handler: handler}, listener, serviceHealth, shutdown, ShutdownConfig{GracePeriod: 5 * time.Second})
+	}()
+
+	// a request is in flight when the shutdown begins
+	responded := make(chan string, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responded <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		responded <- string(body)
+	}()
+	<-started
+	cancel()
+
+	for deadline := time.Now().Add(time.Second); serviceHealth.State() != health.StateStopping && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, health.StateStopping, serviceHealth.State(), "readiness fails first")
+	select {
+	case <-served:
+		t.Fatal("the server stopped before the in-flight request was served")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Empty(t, stopped, "hooks run once requests are drained")
+
+	close(release)
+	assert.Equal(t, "done", <-responded)
+	assert.NoError(t, <-served)
+	assert.Equal(t, []string{"database"}, stopped)
+
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.Error(t, err, "no connections are accepted after shutdown")
+}
+
+func Test_Starting(t *testing.T) {
+	database := &connection{}
+	serviceHealth := health.NewHealth(time.Second, health.PingCheck("database", database))
+	serviceMode, _ := NewServiceMode(ModeNormal, 10*time.Second)
+	handler := &switchHandler{}
+	handler.Set(startingRouter(serviceHealth, serviceMode, true))
+
+	t.Run("Success path - probes are answered while connecting", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serveRequest(handler, http.MethodGet, "/healthz", "", "").Code)
+
+		response := serveRequest(handler, http.MethodGet, "/readyz", "", "")
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Contains(t, response.Body.String(), `"state":"starting"`)
+		assert.Contains(t, response.Body.String(), errorNotConnected.Error())
+	})
+
+	t.Run("Fail path - other requests are rejected while connecting", func(t *testing.T) {
+		response := serveRequest(handler, http.MethodPost, "/messages", `{"content": "abba"}`, "")
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Equal(t, "10", response.Header().Get("Retry-After"))
+		assert.Contains(t, response.Body.String(), model.ProblemTypeUnavailable)
+	})
+
+	t.Run("Success path - the service is served once connected", func(t *testing.T) {
+		memoryRepository, _ := persistence.NewMemoryRepository()
+		database.Set(memoryRepository)
+		handler.Set(setupMux([]ServiceController{NewHealthController(serviceHealth), NewMessageController(memoryRepository)}, DefaultSettings(), auth.Disabled()))
+		serviceHealth.Started()
+
+		assert.Equal(t, http.StatusOK, serveRequest(handler, http.MethodGet, "/readyz", "", "").Code)
+		assert.Equal(t, http.StatusOK, serveRequest(handler, http.MethodPost, "/messages", `{"content": "abba"}`, "").Code)
+	})
+}
+
+func Test_Check_Configuration(t *testing.T) {
+	defer config.Reset()
+	application.InitConfig()
+
+	t.Run("Success path - the defaults start the service", func(t *testing.T) {
+		assert.NoError(t, CheckConfiguration())
+	})
+
+	t.Run("Fail path - the problems the service would not start with are all reported", func(t *testing.T) {
+		config.Set("auth.enabled", true)
+		config.Set("tenancy.enabled", true)
+		config.Set("tenancy.cacheTTL", "-1s")
+		config.Set("idempotency.enabled", true)
+		config.Set("idempotency.ttl", "0s")
+		config.Set("rateLimit.trustedProxies", []string{"not-an-address"})
+		err := CheckConfiguration()
+		assert.IsType(t, application.ConfigurationError{}, err)
+		problems := err.(application.ConfigurationError).Problems
+		assert.Contains(t, problems, "auth.jwt: no keys configured, set auth.jwt.keys or auth.jwt.jwksFile")
+		assert.Contains(t, problems, "tenancy.cacheTTL must not be negative")
+		assert.Contains(t, problems, "idempotency: ttl and lockTimeout must be positive")
+		assert.Contains(t, problems, "rateLimit.trustedProxies: invalid CIDR address: not-an-address/128")
+		assert.Contains(t, problems, "auth.users.signingKey: no signing key configured", "user accounts are enabled by default")
+		assert.Len(t, problems, 5)
+	})
+}
@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"sync/atomic"
+
+	"github.com/shauera/messages/analysis"
+	"github.com/shauera/messages/ratelimit"
+	"github.com/shauera/messages/validation"
+)
+
+// RuntimeSettings - the settings of the running service that change without a restart when the configuration is reloaded
+type RuntimeSettings struct {
+	MessageRules validation.MessageRules
+	UserRules    validation.UserRules
+	// Analyzers - the analyzers of expand=analysis
+	Analyzers analysis.Analyzers
+	// RateLimiting - the rate limits and the daily write quotas, nil when both are disabled
+	RateLimiting *ratelimit.RateLimiting
+	// CORS - the cross-origin requests browsers may make, nil when disabled
+	CORS *CORSPolicy
+}
+
+// Settings - the current runtime settings shared by the components of the service. The settings are
+// replaced as a whole, a request reading them once sees either the settings before a reload or after it.
+type Settings struct {
+	value atomic.Value
+}
+
+//NewSettings - return settings holding the given runtime settings
+func NewSettings(runtimeSettings RuntimeSettings) *Settings {
+	settings := &Settings{}
+	settings.Store(runtimeSettings)
+	return settings
+}
+
+//DefaultSettings - return settings with the default validation rules, all the analyzers and no rate limits
+func DefaultSettings() *Settings {
+	return NewSettings(RuntimeSettings{
+		MessageRules: validation.DefaultMessageRules(),
+		UserRules:    validation.DefaultUserRules(),
+		Analyzers:    analysis.Default,
+	})
+}
+
+// Load - the current runtime settings
+func (s *Settings) Load() RuntimeSettings {
+	return s.value.Load().(RuntimeSettings)
+}
+
+// Store - replace the runtime settings, requests starting from now on are served with them
+func (s *Settings) Store(runtimeSettings RuntimeSettings) {
+	s.value.Store(runtimeSettings)
+}
+
+//LoadRuntimeSettings - build the runtime settings from the "validation", "analysis", "rateLimit", "quotas" and "cors"
+//configuration sections, quota usage is counted in the given repository. The buckets of the previous
+//rate limiter, if any, are kept so reloading the configuration does not reset the limits of clients.
+func LoadRuntimeSettings(quotas ratelimit.QuotaRepository, previous *RuntimeSettings) (RuntimeSettings, error) {
+	var runtimeSettings RuntimeSettings
+	var err error
+
+	if runtimeSettings.MessageRules, err = validation.LoadMessageRules(); err != nil {
+		return runtimeSettings, err
+	}
+	if runtimeSettings.UserRules, err = validation.LoadUserRules(); err != nil {
+		return runtimeSettings, err
+	}
+	if runtimeSettings.Analyzers, err = analysis.LoadAnalyzers(); err != nil {
+		return runtimeSettings, err
+	}
+	if runtimeSettings.RateLimiting, err = ratelimit.LoadRateLimiting(quotas); err != nil {
+		return runtimeSettings, err
+	}
+	if runtimeSettings.CORS, err = LoadCORS(); err != nil {
+		return runtimeSettings, err
+	}
+
+	if previous != nil && previous.RateLimiting != nil && previous.RateLimiting.Limiter != nil &&
+		runtimeSettings.RateLimiting != nil && runtimeSettings.RateLimiting.Limiter != nil {
+		runtimeSettings.RateLimiting.Limiter = previous.RateLimiting.Limiter
+	}
+	return runtimeSettings, nil
+}
@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+
+	config "github.com/spf13/viper"
+)
+
+func Test_Runtime_Settings(t *testing.T) {
+	defer config.Reset()
+	repository, _ := persistence.NewMemoryRepository()
+
+	t.Run("Success path - reloaded settings apply to the next requests", func(t *testing.T) {
+		runtimeSettings, err := LoadRuntimeSettings(repository, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, runtimeSettings.RateLimiting)
+		assert.Equal(t, []string{"palindrome", "length", "wordCount"}, runtimeSettings.Analyzers.Names())
+
+		settings := NewSettings(runtimeSettings)
+		router := setupMux([]ServiceController{NewMessageController(repository).WithSettings(settings)}, settings, auth.Disabled())
+		body := `{"content": "a long message"}`
+		assert.Equal(t, http.StatusOK, serveRequest(router, http.MethodPost, "/messages", body, "").Code)
+
+		config.Set("validation.content.maxLength", 5)
+		config.Set("analysis.analyzers", []string{"length"})
+		runtimeSettings, err = LoadRuntimeSettings(repository, &runtimeSettings)
+		assert.NoError(t, err)
+		settings.Store(runtimeSettings)
+		assert.Equal(t, []string{"length"}, settings.Load().Analyzers.Names())
+		assert.Equal(t, http.StatusBadRequest, serveRequest(router, http.MethodPost, "/messages", body, "").Code)
+	})
+
+	t.Run("Success path - the buckets of clients are kept", func(t *testing.T) {
+		config.Set("rateLimit.enabled", true)
+		config.Set("rateLimit.default", map[string]interface{}{"requests": 10, "per": "1m"})
+		previous, err := LoadRuntimeSettings(repository, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, previous.RateLimiting.Limiter)
+
+		config.Set("rateLimit.default", map[string]interface{}{"requests": 20, "per": "1m"})
+		next, err := LoadRuntimeSettings(repository, &previous)
+		assert.NoError(t, err)
+		assert.True(t, previous.RateLimiting.Limiter == next.RateLimiting.Limiter)
+		assert.Equal(t, 20, next.RateLimiting.Policy.Default.Limit.Requests)
+	})
+
+	t.Run("Fail path - invalid settings are reported", func(t *testing.T) {
+		config.Set("analysis.analyzers", []string{"sentiment"})
+		_, err := LoadRuntimeSettings(repository, nil)
+		assert.EqualError(t, err, `analysis.analyzers: unknown analyzer "sentiment"`)
+	})
+}
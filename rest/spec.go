@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/shauera/messages/validation"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// swaggerSpecPath - the generated API specification served by the swagger ui
+const swaggerSpecPath = "./dist/swagger.json"
+
+// SpecHandler - serves the generated API specification with the MessageRequest
+// definition reflecting the validation rules that are actually enforced
+type SpecHandler struct {
+	specPath string
+	settings *Settings
+}
+
+//NewSpecHandler - return a new SpecHandler publishing the validation rules of the current runtime settings
+func NewSpecHandler(specPath string, settings *Settings) SpecHandler {
+	return SpecHandler{
+		specPath: specPath,
+		settings: settings,
+	}
+}
+
+func (sh SpecHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	specBytes, err := ioutil.ReadFile(sh.specPath)
+	if err != nil {
+		response.WriteHeader(http.StatusNotFound)
+		log.WithError(err).Debug("Could not read API specification")
+		return
+	}
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal(specBytes, &spec); err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		log.WithError(err).Debug("Could not parse API specification")
+		return
+	}
+
+	applyValidationRules(spec, sh.settings.Load().MessageRules)
+
+	response.Header().Set("content-type", "application/json")
+	json.NewEncoder(response).Encode(spec)
+}
+
+// applyValidationRules - overwrite the MessageRequest definition constraints with the given rules
+func applyValidationRules(spec map[string]interface{}, rules validation.MessageRules) {
+	definitions, _ := spec["definitions"].(map[string]interface{})
+	messageRequest, _ := definitions["MessageRequest"].(map[string]interface{})
+	if messageRequest == nil {
+		return
+	}
+
+	properties, _ := messageRequest["properties"].(map[string]interface{})
+	if properties == nil {
+		properties = make(map[string]interface{})
+		messageRequest["properties"] = properties
+	}
+
+	ruleSchemas := map[string]map[string]interface{}{
+		"content":   rules.Content.Schema(),
+		"author":    rules.Author.Schema(),
+		"createdAt": rules.CreatedAt.Schema(),
+	}
+	for name, ruleSchema := range ruleSchemas {
+		property, _ := properties[name].(map[string]interface{})
+		if property == nil {
+			property = make(map[string]interface{})
+			properties[name] = property
+		}
+		// constraints are fully described by the rule, drop the generated ones
+		for _, keyword := range []string{"minLength", "maxLength", "pattern"} {
+			delete(property, keyword)
+		}
+		for keyword, value := range ruleSchema {
+			if keyword == "type" || keyword == "format" {
+				// keep generated types and references
+				if _, ok := property["$ref"]; ok {
+					continue
+				}
+				if _, ok := property[keyword]; ok {
+					continue
+				}
+			}
+			property[keyword] = value
+		}
+	}
+
+	if required := rules.Required(); len(required) > 0 {
+		messageRequest["required"] = required
+	} else {
+		delete(messageRequest, "required")
+	}
+}
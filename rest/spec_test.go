@@ -0,0 +1,44 @@
+package rest
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/shauera/messages/validation"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Apply_Validation_Rules(t *testing.T) {
+	spec := map[string]interface{}{
+		"definitions": map[string]interface{}{
+			"MessageRequest": map[string]interface{}{
+				"required": []interface{}{"content"},
+				"properties": map[string]interface{}{
+					"content": map[string]interface{}{
+						"type":      "string",
+						"maxLength": 256,
+						"pattern":   `\w[\w-]+`,
+					},
+					"createdAt": map[string]interface{}{
+						"$ref": "#/definitions/MessageTime",
+					},
+				},
+			},
+		},
+	}
+
+	rules := validation.DefaultMessageRules()
+	rules.Content.MaxLength = 100
+	rules.Content.Pattern = regexp.MustCompile(`\S`)
+	rules.Author.Required = true
+
+	applyValidationRules(spec, rules)
+
+	messageRequest := spec["definitions"].(map[string]interface{})["MessageRequest"].(map[string]interface{})
+	properties := messageRequest["properties"].(map[string]interface{})
+	assert.Equal(t, []string{"author", "content"}, messageRequest["required"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "minLength": 1, "maxLength": 100, "pattern": `\S`}, properties["content"])
+	assert.Equal(t, map[string]interface{}{"type": "string"}, properties["author"])
+	assert.Equal(t, map[string]interface{}{"$ref": "#/definitions/MessageTime"}, properties["createdAt"])
+}
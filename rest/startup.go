@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/health"
+	"github.com/shauera/messages/metrics"
+	"github.com/shauera/messages/model"
+)
+
+// errorNotConnected - the error of the database check until the service is connected to the database
+var errorNotConnected = errors.New("Not connected to the database yet")
+
+// connection - pings the repository once the service is connected to the database, fails until then
+type connection struct {
+	pinger atomic.Value
+}
+
+// pingerOf - wraps the pinger so every value stored in the connection has the same type
+type pingerOf struct {
+	health.Pinger
+}
+
+// Set - the repository pinged from now on
+func (c *connection) Set(pinger health.Pinger) {
+	c.pinger.Store(pingerOf{pinger})
+}
+
+// Ping - implementation of health.Pinger
+func (c *connection) Ping(ctx context.Context) error {
+	pinger, ok := c.pinger.Load().(pingerOf)
+	if !ok {
+		return errorNotConnected
+	}
+	return pinger.Ping(ctx)
+}
+
+// switchHandler - serves requests by the handler set last, so the service listens before it is set up
+type switchHandler struct {
+	handler atomic.Value
+}
+
+// handlerOf - wraps the handler so every value stored in the switch has the same type
+type handlerOf struct {
+	http.Handler
+}
+
+// Set - the handler serving the requests starting from now on
+func (sh *switchHandler) Set(handler http.Handler) {
+	sh.handler.Store(handlerOf{handler})
+}
+
+// ServeHTTP - implementation of http.Handler
+func (sh *switchHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	sh.handler.Load().(handlerOf).ServeHTTP(response, request)
+}
+
+// startingRouter - the router of a service connecting to the database: the health endpoints report the service
+// as starting and every other request is rejected with 503 and a Retry-After header
+func startingRouter(serviceHealth *health.Health, serviceMode *ServiceMode, serveMetrics bool) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(metricsMiddleware)
+	router.Use(correlationIDMiddleware)
+	router.Use(modeMiddleware(serviceMode))
+	NewHealthController(serviceHealth).WithServiceMode(serviceMode).PublishEndpoints(router)
+	if serveMetrics {
+		router.Handle("/metrics", metricsHandler(metrics.Default)).Methods("GET")
+	}
+
+	starting := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		serviceMode.reject(response, request, model.ProblemTypeUnavailable, "The service is starting, it is not connected to the database yet")
+	})
+	router.NotFoundHandler = metricsMiddleware(correlationIDMiddleware(starting))
+	router.MethodNotAllowedHandler = metricsMiddleware(correlationIDMiddleware(starting))
+	return router
+}
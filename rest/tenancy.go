@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/tenancy"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MessageRepositories - returns the repository of the messages of a tenant
+type MessageRepositories func(tenant string) MessageRepository
+
+type tenantKey struct{}
+
+// requireTenant - serves the request in the context of the tenant it is made for.
+// The tenant is available through the request context (see tenantFromContext).
+// Requests that don't resolve to a provisioned tenant are rejected.
+func requireTenant(tenants *tenancy.Tenancy, handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		principal, _ := auth.FromContext(request.Context())
+		id, err := tenants.Resolver.Resolve(request, principal)
+		if err != nil {
+			writeTenantProblem(response, request, err)
+			return
+		}
+
+		tenant, err := findTenant(response, request, tenants, id)
+		if err != nil {
+			return
+		}
+		// tokens issued before the tenant was provisioned belong to a deleted tenant of the same id,
+		// iat has a precision of seconds
+		if principal.Tenant == tenant.ID && !principal.IssuedAt.IsZero() && principal.IssuedAt.Before(tenant.CreatedAt.Truncate(time.Second)) {
+			writeTenantProblem(response, request, tenancy.ErrorTenantForbidden)
+			return
+		}
+
+		handler(response, request.WithContext(context.WithValue(request.Context(), tenantKey{}, tenant)))
+	}
+}
+
+// findTenant - returns the provisioned tenant of the id, the problem is rendered when there is none
+func findTenant(response http.ResponseWriter, request *http.Request, tenants *tenancy.Tenancy, id string) (model.Tenant, error) {
+	tenant, err := tenants.Tenants.Find(request.Context(), id)
+	if errors.Cause(err) == persistence.ErrorNotFound {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeUnknownTenant,
+			Status: http.StatusNotFound,
+			Detail: "The tenant " + id + " does not exist",
+		})
+		return model.Tenant{}, err
+	}
+	if err != nil {
+		writeError(response, request, err, "Could not find tenant")
+		return model.Tenant{}, err
+	}
+	return tenant, nil
+}
+
+// writeTenantProblem - renders the problem of a request that could not be resolved to a tenant
+func writeTenantProblem(response http.ResponseWriter, request *http.Request, err error) {
+	problem := model.ProblemResponse{Type: model.ProblemTypeInvalidTenant, Status: http.StatusBadRequest, Detail: err.Error()}
+	if err == tenancy.ErrorTenantForbidden {
+		principal, _ := auth.FromContext(request.Context())
+		log.WithContext(request.Context()).WithField("subject", principal.Subject).WithField("tenant", principal.Tenant).
+			WithField("correlationId", getCorrelationID(request)).Info("Tenant denied")
+		problem = model.ProblemResponse{Type: model.ProblemTypeForbidden, Status: http.StatusForbidden,
+			Detail: "The credentials are not valid for the requested tenant"}
+	}
+	writeProblem(response, request, problem)
+}
+
+// tenantFromContext - returns the tenant the request of ctx is made for, if the service has tenants
+func tenantFromContext(ctx context.Context) (model.Tenant, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(model.Tenant)
+	return tenant, ok
+}
@@ -0,0 +1,390 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/shauera/messages/analysis"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/render"
+	"github.com/shauera/messages/tenancy"
+
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TenantController - handles the tenant administration endpoints
+type TenantController struct {
+	tenants   *tenancy.Tenants
+	analyzers analysis.Analyzers
+	codecs    *render.Registry
+}
+
+//NewTenantController - return a new tenant controller provisioning tenants of the given tenants
+func NewTenantController(tenants *tenancy.Tenants) TenantController {
+	return TenantController{
+		tenants:   tenants,
+		analyzers: analysis.Default,
+		codecs:    render.Default,
+	}
+}
+
+//PublishEndpoints - implementation of ServiceController
+func (tc TenantController) PublishEndpoints(router *mux.Router) {
+	router.Handle("/admin/tenants", requirePermission(auth.PermissionManageTenants, traced("TenantController.ProvisionTenant", tc.ProvisionTenant))).Methods("POST")
+	router.Handle("/admin/tenants", requirePermission(auth.PermissionManageTenants, traced("TenantController.ListTenants", tc.ListTenants))).Methods("GET")
+	router.Handle("/admin/tenants/{id}", requirePermission(auth.PermissionManageTenants, traced("TenantController.GetTenantByID", tc.GetTenantByID))).Methods("GET")
+	router.Handle("/admin/tenants/{id}", requirePermission(auth.PermissionManageTenants, traced("TenantController.DeleteTenantByID", tc.DeleteTenantByID))).Methods("DELETE")
+	router.Handle("/admin/tenants/{id}/settings", requirePermission(auth.PermissionManageTenants, traced("TenantController.UpdateTenantSettings", tc.UpdateTenantSettings))).Methods("PUT")
+}
+
+// ProvisionTenant - creates a new tenant
+func (tc *TenantController) ProvisionTenant(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation POST /admin/tenants tenants provisionTenant
+	//
+	// Provisions a new tenant, the tenant has no messages
+	// ---
+	// consumes:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: tenantRequest
+	//   in: body
+	//   description: Tenant to be provisioned.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/TenantRequest"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/Tenant"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '409':
+	//     description: Conflict
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, tc.codecs, model.Tenant{})
+	if err != nil {
+		return
+	}
+
+	var tenantRequest model.TenantRequest
+	if err := readRequest(response, request, tc.codecs, &tenantRequest, "Tenants"); err != nil {
+		return
+	}
+
+	if fieldErrors := tenantRequest.Validate(tc.analyzers.Names(), tc.tenants.MaxIDLength()); len(fieldErrors) != 0 {
+		writeValidationProblem(response, request, "The tenant request failed validation", fieldErrors)
+		return
+	}
+
+	tenant, err := tc.tenants.Provision(request.Context(), tenantRequest)
+	if err != nil {
+		writeError(response, request, err, "Could not provision tenant")
+		return
+	}
+
+	principal, _ := auth.FromContext(request.Context())
+	log.WithContext(request.Context()).WithField("tenant", tenant.ID).WithField("subject", principal.Subject).
+		WithField("correlationId", getCorrelationID(request)).Info("Tenant provisioned")
+	writeResponse(response, codec, "tenant", tenant)
+}
+
+// ListTenants - retrieves a list of all tenants
+func (tc *TenantController) ListTenants(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /admin/tenants tenants listTenants
+	//
+	// Returns a list of all tenants
+	// ---
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - text/csv
+	// - application/msgpack
+	// - application/problem+json
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       type: array
+	//       items:
+	//         "$ref": "#/definitions/Tenant"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, tc.codecs, model.Tenants{})
+	if err != nil {
+		return
+	}
+
+	tenants, err := tc.tenants.List(request.Context())
+	if err != nil {
+		writeError(response, request, err, "Could not get list of tenants")
+		return
+	}
+
+	writeResponse(response, codec, "tenants", tenants)
+}
+
+// GetTenantByID - retrieves a tenant by id
+func (tc *TenantController) GetTenantByID(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /admin/tenants/{id} tenants getTenant
+	//
+	// Returns a tenant by id
+	// ---
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of the tenant.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/Tenant"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, tc.codecs, model.Tenant{})
+	if err != nil {
+		return
+	}
+
+	tenant, err := tc.tenants.Find(request.Context(), mux.Vars(request)["id"])
+	if err != nil {
+		writeError(response, request, err, "Could not get tenant")
+		return
+	}
+
+	writeResponse(response, codec, "tenant", tenant)
+}
+
+// UpdateTenantSettings - replaces the settings of an existing tenant
+func (tc *TenantController) UpdateTenantSettings(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation PUT /admin/tenants/{id}/settings tenants updateTenantSettings
+	//
+	// Replaces the settings of a tenant, the settings apply to requests of the tenant immediately
+	// ---
+	// consumes:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of the tenant.
+	//   required: true
+	//   type: string
+	// - name: tenantSettings
+	//   in: body
+	//   description: The new settings of the tenant.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/TenantSettings"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/Tenant"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, tc.codecs, model.Tenant{})
+	if err != nil {
+		return
+	}
+
+	var settings model.TenantSettings
+	if err := readRequest(response, request, tc.codecs, &settings, "Tenant settings"); err != nil {
+		return
+	}
+
+	if fieldErrors := settings.Validate("", tc.analyzers.Names()); len(fieldErrors) != 0 {
+		writeValidationProblem(response, request, "The tenant settings failed validation", fieldErrors)
+		return
+	}
+
+	tenant, err := tc.tenants.UpdateSettings(request.Context(), mux.Vars(request)["id"], settings)
+	if err != nil {
+		writeError(response, request, err, "Could not update tenant settings")
+		return
+	}
+
+	principal, _ := auth.FromContext(request.Context())
+	log.WithContext(request.Context()).WithField("tenant", tenant.ID).WithField("subject", principal.Subject).
+		WithField("correlationId", getCorrelationID(request)).Info("Tenant settings updated")
+	writeResponse(response, codec, "tenant", tenant)
+}
+
+// DeleteTenantByID - deletes an existing tenant with all its messages, users and API keys
+func (tc *TenantController) DeleteTenantByID(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation DELETE /admin/tenants/{id} tenants deleteTenant
+	//
+	// Deletes a tenant with all its messages, users and API keys, this can't be undone
+	// ---
+	// produces:
+	// - application/problem+json
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of the tenant to be deleted.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '204':
+	//     description: No Content
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	id := mux.Vars(request)["id"]
+	if err := tc.tenants.Delete(request.Context(), id); err != nil {
+		writeError(response, request, err, "Could not delete tenant")
+		return
+	}
+
+	principal, _ := auth.FromContext(request.Context())
+	log.WithContext(request.Context()).WithField("tenant", id).WithField("subject", principal.Subject).
+		WithField("correlationId", getCorrelationID(request)).Info("Tenant deleted")
+	response.WriteHeader(http.StatusNoContent)
+}
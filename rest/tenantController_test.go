@@ -0,0 +1,281 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/shauera/messages/tenancy"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// serveTenantRequest - serves a JSON request of the tenant named by the X-Tenant-ID header
+func serveTenantRequest(router http.Handler, method string, path string, body string, tenant string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("content-type", "application/json")
+	if tenant != "" {
+		request.Header.Set("X-Tenant-ID", tenant)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func Test_Tenants(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	tenants := &tenancy.Tenancy{
+		Resolver: tenancy.Resolver{Header: "X-Tenant-ID"},
+		Tenants:  tenancy.NewTenants(repository, 0),
+	}
+	repositories := func(tenant string) MessageRepository { return repository.ForTenant(tenant) }
+	router := setupMux([]ServiceController{
+		NewMessageController(repository).WithTenancy(tenants, repositories),
+		NewTenantController(tenants.Tenants),
+	}, DefaultSettings(), auth.Disabled())
+
+	t.Run("Fail path - invalid tenant request", func(t *testing.T) {
+		response := serveTenantRequest(router, http.MethodPost, "/admin/tenants", `{"id": "Team A", "settings": {"content": {"minLength": -1}, "analyzers": ["sentiment"]}}`, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), `"field":"id"`)
+		assert.Contains(t, response.Body.String(), `"field":"settings.content.minLength"`)
+		assert.Contains(t, response.Body.String(), `"field":"settings.analyzers[0]"`)
+	})
+
+	t.Run("Success path - provision tenants", func(t *testing.T) {
+		response := serveTenantRequest(router, http.MethodPost, "/admin/tenants", `{"id": "team-a", "settings": {"content": {"maxLength": 5}, "analyzers": ["length"]}}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"id":"team-a"`)
+
+		response = serveTenantRequest(router, http.MethodPost, "/admin/tenants", `{"id": "team-b"}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		response = serveTenantRequest(router, http.MethodPost, "/admin/tenants", `{"id": "team-b"}`, "")
+		assert.Equal(t, http.StatusConflict, response.Code)
+	})
+
+	t.Run("Fail path - messages need a provisioned tenant", func(t *testing.T) {
+		response := serveTenantRequest(router, http.MethodGet, "/messages", "", "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), model.ProblemTypeInvalidTenant)
+
+		response = serveTenantRequest(router, http.MethodGet, "/messages", "", "team-z")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Contains(t, response.Body.String(), model.ProblemTypeUnknownTenant)
+	})
+
+	t.Run("Success path - tenants have separate messages and settings", func(t *testing.T) {
+		response := serveTenantRequest(router, http.MethodPost, "/messages", `{"content": "abcdef"}`, "team-a")
+		assert.Equal(t, http.StatusBadRequest, response.Code, "team-a limits contents to 5 characters")
+
+		response = serveTenantRequest(router, http.MethodPost, "/messages", `{"content": "abba"}`, "team-a")
+		assert.Equal(t, http.StatusOK, response.Code)
+		response = serveTenantRequest(router, http.MethodPost, "/messages", `{"content": "abcdef"}`, "team-b")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		response = serveTenantRequest(router, http.MethodGet, "/messages?fields=content&expand=analysis", "", "team-a")
+		assert.Equal(t, "[{\"content\":\"abba\",\"analysis\":{\"length\":4}}]\n", response.Body.String())
+		response = serveTenantRequest(router, http.MethodGet, "/messages?fields=content", "", "team-b")
+		assert.Equal(t, "[{\"content\":\"abcdef\"}]\n", response.Body.String())
+	})
+
+	t.Run("Success path - settings changes apply immediately", func(t *testing.T) {
+		response := serveTenantRequest(router, http.MethodPut, "/admin/tenants/team-a/settings", `{"content": {"maxLength": 10}}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		response = serveTenantRequest(router, http.MethodPost, "/messages", `{"content": "abcdef"}`, "team-a")
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("Success path - deleting a tenant deletes its messages", func(t *testing.T) {
+		response := serveTenantRequest(router, http.MethodDelete, "/admin/tenants/team-b", "", "")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+
+		response = serveTenantRequest(router, http.MethodGet, "/messages", "", "team-b")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+
+		response = serveTenantRequest(router, http.MethodPost, "/admin/tenants", `{"id": "team-b"}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		response = serveTenantRequest(router, http.MethodGet, "/messages", "", "team-b")
+		assert.Equal(t, "null\n", response.Body.String())
+	})
+}
+
+func Test_Tenant_Claim(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	tenants := &tenancy.Tenancy{
+		Resolver: tenancy.Resolver{Header: "X-Tenant-ID"},
+		Tenants:  tenancy.NewTenants(repository, 0),
+	}
+	for _, id := range []string{"team-a", "team-b"} {
+		tenantID := id
+		tenants.Tenants.Provision(context.Background(), model.TenantRequest{ID: &tenantID})
+	}
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{TenantClaim: "tenant"}))
+	router := setupMux([]ServiceController{
+		NewMessageController(repository).WithTenancy(tenants, func(tenant string) MessageRepository { return repository.ForTenant(tenant) }),
+	}, DefaultSettings(), authentication)
+
+	token := "Bearer " + testTenantToken("will", "team-a", "reader")
+
+	response := serveRequest(router, http.MethodGet, "/messages", "", token)
+	assert.Equal(t, http.StatusOK, response.Code, "the claim names the tenant")
+
+	request, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+	request.Header.Set("Authorization", token)
+	request.Header.Set("X-Tenant-ID", "team-b")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func Test_Tenant_Users(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	tenants := &tenancy.Tenancy{
+		Resolver: tenancy.Resolver{Header: "X-Tenant-ID"},
+		Tenants:  tenancy.NewTenants(repository, 0),
+	}
+	for _, id := range []string{"team-a", "team-b"} {
+		tenantID := id
+		tenants.Tenants.Provision(context.Background(), model.TenantRequest{ID: &tenantID})
+	}
+	signer, _ := auth.NewHMACSigner("", testTokenSecret)
+	users, _ := auth.NewUsers(repository, signer, auth.UserConfig{
+		HashCost:      bcrypt.MinCost,
+		DefaultRoles:  []auth.Role{auth.RoleAdmin},
+		TokenTTL:      time.Hour,
+		TenantClaim:   "tenant",
+		ResetTokenTTL: time.Hour,
+	})
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(
+		auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{TenantClaim: "tenant"}),
+		auth.NewAPIKeyAuthenticator(repository),
+	)
+	router := setupMux([]ServiceController{
+		NewMessageController(repository).WithTenancy(tenants, func(tenant string) MessageRepository { return repository.ForTenant(tenant) }),
+		NewUserController(users).WithTenancy(tenants),
+		NewAPIKeyController(repository),
+		NewTenantController(tenants.Tenants),
+	}, DefaultSettings(), authentication)
+
+	serve := func(method string, path string, body string, authorization string, tenant string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("content-type", "application/json")
+		request.Header.Set("Authorization", authorization)
+		if tenant != "" {
+			request.Header.Set("X-Tenant-ID", tenant)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Fail path - users register with a provisioned tenant", func(t *testing.T) {
+		response := serve(http.MethodPost, "/users", `{"username": "ada", "password": "to be or not to be"}`, "", "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		response = serve(http.MethodPost, "/users", `{"username": "ada", "password": "to be or not to be"}`, "", "team-c")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+
+	var token, apiKeyAuthorization string
+	t.Run("Success path - registered users are confined to their tenant", func(t *testing.T) {
+		response := serve(http.MethodPost, "/users", `{"username": "ada", "password": "to be or not to be"}`, "", "team-a")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"tenant":"team-a"`)
+
+		response = serve(http.MethodPost, "/auth/login", `{"username": "ada", "password": "to be or not to be"}`, "", "")
+		assert.Equal(t, http.StatusBadRequest, response.Code, "users log in with the tenant they registered with")
+		response = serve(http.MethodPost, "/auth/login", `{"username": "ada", "password": "to be or not to be"}`, "", "team-b")
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		response = serve(http.MethodPost, "/auth/login", `{"username": "ada", "password": "to be or not to be"}`, "", "team-a")
+		assert.Equal(t, http.StatusOK, response.Code)
+		var tokenResponse model.TokenResponse
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &tokenResponse))
+		token = "Bearer " + tokenResponse.Token
+
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/messages", "", token, "").Code)
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/messages", "", token, "team-a").Code)
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/messages", "", token, "team-b").Code)
+	})
+
+	t.Run("Fail path - principals without a tenant", func(t *testing.T) {
+		response := serve(http.MethodGet, "/messages", "", "Bearer "+testToken("will", "editor"), "team-b")
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		response = serve(http.MethodGet, "/messages", "", "Bearer "+testToken("root", "admin"), "team-b")
+		assert.Equal(t, http.StatusOK, response.Code, "tenants:manage reaches every tenant")
+	})
+
+	t.Run("Success path - API keys are confined to the tenant of their creator", func(t *testing.T) {
+		response := serve(http.MethodPost, "/admin/apikeys", `{"name": "export", "scopes": ["messages:read"], "tenant": "team-b"}`, token, "")
+		assert.Equal(t, http.StatusForbidden, response.Code)
+
+		response = serve(http.MethodPost, "/admin/apikeys", `{"name": "export", "scopes": ["messages:read"]}`, token, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		var apiKey model.APIKey
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &apiKey))
+		assert.Equal(t, "team-a", apiKey.Tenant)
+
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/messages", "", "ApiKey "+apiKey.Key, "").Code)
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/messages", "", "ApiKey "+apiKey.Key, "team-b").Code)
+		apiKeyAuthorization = "ApiKey " + apiKey.Key
+	})
+
+	t.Run("Success path - user names are unique within a tenant", func(t *testing.T) {
+		response := serve(http.MethodPost, "/users", `{"username": "ada", "password": "another password"}`, "", "team-b")
+		assert.Equal(t, http.StatusOK, response.Code)
+		response = serve(http.MethodPost, "/auth/login", `{"username": "ada", "password": "another password"}`, "", "team-b")
+		assert.Equal(t, http.StatusOK, response.Code)
+		response = serve(http.MethodPost, "/auth/login", `{"username": "ada", "password": "another password"}`, "", "team-a")
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+	})
+
+	t.Run("Success path - the credentials of a deleted tenant don't reach a tenant of the same id", func(t *testing.T) {
+		response := serve(http.MethodDelete, "/admin/tenants/team-a", "", "Bearer "+testToken("root", "admin"), "")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		// provisioned again later
+		assert.NoError(t, repository.CreateTenant(context.Background(), model.Tenant{ID: "team-a", CreatedAt: time.Now().Add(time.Minute)}))
+
+		response = serve(http.MethodPost, "/auth/login", `{"username": "ada", "password": "to be or not to be"}`, "", "team-a")
+		assert.Equal(t, http.StatusUnauthorized, response.Code, "the users of the tenant are deleted")
+		assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/messages", "", apiKeyAuthorization, "").Code, "the API keys of the tenant are deleted")
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/messages", "", token, "").Code, "tokens issued before the tenant was provisioned")
+
+		response = serve(http.MethodPost, "/auth/login", `{"username": "ada", "password": "another password"}`, "", "team-b")
+		assert.Equal(t, http.StatusOK, response.Code, "the users of other tenants are kept")
+	})
+}
+
+// limitedTenantRepository - a repository keeping the messages of tenants of ids up to maxIDLength characters only
+type limitedTenantRepository struct {
+	*persistence.MemoryRepository
+	maxIDLength int
+}
+
+func (r limitedTenantRepository) MaxTenantIDLength() int {
+	return r.maxIDLength
+}
+
+func Test_Tenant_ID_Length(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	router := setupMux([]ServiceController{
+		NewTenantController(tenancy.NewTenants(limitedTenantRepository{MemoryRepository: repository, maxIDLength: 8}, 0)),
+	}, DefaultSettings(), auth.Disabled())
+
+	response := serveTenantRequest(router, http.MethodPost, "/admin/tenants", `{"id": "team-a-long"}`, "")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), `"field":"id"`)
+	assert.Contains(t, response.Body.String(), `"max":8`)
+
+	response = serveTenantRequest(router, http.MethodPost, "/admin/tenants", `{"id": "team-a"}`, "")
+	assert.Equal(t, http.StatusOK, response.Code)
+}
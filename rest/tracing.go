@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	log "github.com/sirupsen/logrus"
+	config "github.com/spf13/viper"
+)
+
+// instrumentationName - the name of the tracer of the rest package
+const instrumentationName = "github.com/shauera/messages/rest"
+
+// Exporters of the tracing.exporter configuration
+const (
+	exporterOTLP   = "otlp"
+	exporterStdout = "stdout"
+	exporterFile   = "file"
+)
+
+// startTracing - sets the tracer provider of the service from the "tracing" configuration section and propagates
+// traces in the W3C trace context headers. Returns the function exporting the spans still queued and stopping the
+// export, nil when tracing.enabled is false.
+func startTracing(ctx context.Context) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if !config.GetBool("tracing.enabled") {
+		return nil, nil
+	}
+
+	if err := checkTracing(); err != nil {
+		return nil, err
+	}
+	sampleRatio := config.GetFloat64("tracing.sampleRatio")
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch exporterName := config.GetString("tracing.exporter"); exporterName {
+	case exporterOTLP:
+		options, err := otlpOptions()
+		if err != nil {
+			return nil, err
+		}
+		if exporter, err = otlptracehttp.New(ctx, options...); err != nil {
+			return nil, errors.Wrap(err, "tracing.otlp")
+		}
+	case exporterStdout:
+		exporter, _ = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case exporterFile:
+		var err error
+		if file, err = os.OpenFile(config.GetString("tracing.file.path"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			return nil, errors.Wrap(err, "tracing.file.path")
+		}
+		exporter, _ = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, errors.Errorf("tracing.exporter: unknown exporter %q, use otlp, stdout or file", exporterName)
+	}
+
+	// traces continued from other services keep the sampling decision of the other service
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.GetString("tracing.serviceName")))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.WithError(err).Warn("Could not export spans")
+	}))
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// checkTracing - validates the "tracing" configuration section without exporting anything
+func checkTracing() error {
+	if !config.GetBool("tracing.enabled") {
+		return nil
+	}
+
+	sampleRatio := config.GetFloat64("tracing.sampleRatio")
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return errors.New("tracing.sampleRatio must be between 0 and 1")
+	}
+	switch exporterName := config.GetString("tracing.exporter"); exporterName {
+	case exporterOTLP:
+		_, err := otlpOptions()
+		return err
+	case exporterStdout, exporterFile:
+		return nil
+	default:
+		return errors.Errorf("tracing.exporter: unknown exporter %q, use otlp, stdout or file", exporterName)
+	}
+}
+
+// otlpOptions - the options of the OTLP/HTTP exporter from the "tracing.otlp" configuration section
+func otlpOptions() ([]otlptracehttp.Option, error) {
+	endpoint, err := url.Parse(config.GetString("tracing.otlp.endpoint"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, errors.New("tracing.otlp.endpoint must be an http or https url, such as http://collector:4318/v1/traces")
+	}
+	timeout := config.GetDuration("tracing.otlp.timeout")
+	if timeout <= 0 {
+		return nil, errors.New("tracing.otlp.timeout must be positive")
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.Host),
+		otlptracehttp.WithURLPath(endpoint.Path),
+		otlptracehttp.WithTimeout(timeout),
+		otlptracehttp.WithHeaders(config.GetStringMapString("tracing.otlp.headers")),
+	}
+	if endpoint.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return options, nil
+}
+
+// tracingMiddleware - starts a server span for each request, continuing the trace of the traceparent header.
+// Spans are named by the path template of their route so ids do not make a span name each.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		route := unmatchedRoute
+		if currentRoute := mux.CurrentRoute(request); currentRoute != nil {
+			if pathTemplate, err := currentRoute.GetPathTemplate(); err == nil {
+				route = pathTemplate
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", request.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.target", request.URL.RequestURI()),
+				attribute.String("http.host", request.Host),
+				attribute.String("http.user_agent", request.UserAgent()),
+				attribute.String("correlation.id", getCorrelationID(request)),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// traced - runs the handler in a span of the given name, such as "MessageController.GetMessageByID"
+func traced(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		ctx, span := otel.Tracer(instrumentationName).Start(request.Context(), name)
+		defer span.End()
+		handler(response, request.WithContext(ctx))
+	}
+}
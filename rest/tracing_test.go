@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/persistence"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	config "github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// named - the ended span of the name
+func named(recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func Test_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	memoryRepository, _ := persistence.NewMemoryRepository()
+	repository := newInstrumentedRepository(memoryRepository, "memory", nil)
+	router := setupMux([]ServiceController{NewMessageController(repository)}, DefaultSettings(), auth.Disabled())
+
+	response := serveRequest(router, http.MethodPost, "/messages", `{"content": "abba"}`, "")
+	var message struct{ ID string }
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &message))
+
+	request, _ := http.NewRequest(http.MethodPut, "/messages/"+message.ID, strings.NewReader(`{"content": "abc"}`))
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	recorded := httptest.NewRecorder()
+	router.ServeHTTP(recorded, request)
+	assert.Equal(t, http.StatusOK, recorded.Code)
+
+	server := named(recorder, "PUT /messages/{id}")
+	if assert.NotNil(t, server, "server spans are named by route template") {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String(), "the incoming trace is continued")
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+		assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+		assert.Contains(t, server.Attributes(), attribute.Int("http.status_code", http.StatusOK))
+	}
+
+	handler := named(recorder, "MessageController.UpdateMessageByID")
+	if assert.NotNil(t, handler) && server != nil {
+		assert.Equal(t, server.SpanContext().SpanID(), handler.Parent().SpanID())
+
+		replace := named(recorder, "Repository.ReplaceMessageByID")
+		if assert.NotNil(t, replace) {
+			assert.Equal(t, handler.SpanContext().TraceID(), replace.SpanContext().TraceID())
+			assert.Equal(t, handler.SpanContext().SpanID(), replace.Parent().SpanID())
+		}
+	}
+
+	serveRequest(router, http.MethodGet, "/messages/missing", "", "")
+	find := named(recorder, "Repository.FindMessageByID")
+	if assert.NotNil(t, find) {
+		assert.Equal(t, codes.Error, find.Status().Code, "failed operations are marked as errors")
+	}
+}
+
+func Test_Start_Tracing(t *testing.T) {
+	defer config.Reset()
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	t.Run("Success path - disabled", func(t *testing.T) {
+		stop, err := startTracing(context.Background())
+		assert.NoError(t, err)
+		assert.Nil(t, stop)
+	})
+
+	t.Run("Success path - spans are appended to the file", func(t *testing.T) {
+		directory, err := ioutil.TempDir("", "tracing")
+		assert.NoError(t, err)
+		defer os.RemoveAll(directory)
+		path := filepath.Join(directory, "traces.jsonl")
+
+		config.Set("tracing.enabled", true)
+		config.Set("tracing.sampleRatio", 1)
+		config.Set("tracing.exporter", "file")
+		config.Set("tracing.file.path", path)
+		stop, err := startTracing(context.Background())
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, span := otel.Tracer(instrumentationName).Start(context.Background(), "GET /messages")
+		span.End()
+		assert.NoError(t, stop(context.Background()))
+
+		traces, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Contains(t, string(traces), `"Name":"GET /messages"`)
+	})
+
+	t.Run("Fail path - invalid configuration", func(t *testing.T) {
+		config.Set("tracing.enabled", true)
+		config.Set("tracing.exporter", "otlp")
+		config.Set("tracing.otlp.endpoint", "collector:4318")
+		_, err := startTracing(context.Background())
+		assert.EqualError(t, err, "tracing.otlp.endpoint must be an http or https url, such as http://collector:4318/v1/traces")
+
+		config.Set("tracing.exporter", "zipkin")
+		_, err = startTracing(context.Background())
+		assert.EqualError(t, err, `tracing.exporter: unknown exporter "zipkin", use otlp, stdout or file`)
+	})
+}
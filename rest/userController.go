@@ -0,0 +1,574 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/render"
+	"github.com/shauera/messages/tenancy"
+	"github.com/shauera/messages/validation"
+
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// UserController - handles the user account and login endpoints
+type UserController struct {
+	users    *auth.Users
+	settings *Settings
+	codecs   *render.Registry
+	// tenants - users register and log in with the tenant the request names when set
+	tenants *tenancy.Tenancy
+}
+
+//NewUserController - return a new user controller managing the given accounts
+//User names and passwords are validated with the default rules, see WithSettings
+func NewUserController(users *auth.Users) UserController {
+	return UserController{
+		users:    users,
+		settings: DefaultSettings(),
+		codecs:   render.Default,
+	}
+}
+
+//WithValidationRules - return a copy of the controller validating user names and passwords with the given rules
+func (uc UserController) WithValidationRules(rules validation.UserRules) UserController {
+	runtimeSettings := uc.settings.Load()
+	runtimeSettings.UserRules = rules
+	uc.settings = NewSettings(runtimeSettings)
+	return uc
+}
+
+//WithSettings - return a copy of the controller validating user names and passwords according to the
+//current runtime settings, so reloaded rules apply to the requests that follow
+func (uc UserController) WithSettings(settings *Settings) UserController {
+	uc.settings = settings
+	return uc
+}
+
+//WithTenancy - return a copy of the controller registering and logging in users with the tenant named by the request,
+//the tokens of the users are confined to that tenant
+func (uc UserController) WithTenancy(tenants *tenancy.Tenancy) UserController {
+	uc.tenants = tenants
+	return uc
+}
+
+// namedTenant - the tenant named by a request made before logging in, empty when the service has no tenants.
+// The problem is rendered when the request does not name a tenant.
+func (uc *UserController) namedTenant(response http.ResponseWriter, request *http.Request) (string, bool) {
+	if uc.tenants == nil {
+		return "", true
+	}
+	id, err := uc.tenants.Resolver.Named(request)
+	if err != nil {
+		writeTenantProblem(response, request, err)
+		return "", false
+	}
+	return id, true
+}
+
+//PublishEndpoints - implementation of ServiceController
+func (uc UserController) PublishEndpoints(router *mux.Router) {
+	router.HandleFunc("/users", traced("UserController.RegisterUser", uc.RegisterUser)).Methods("POST")
+	router.Handle("/users/me", requireAuthentication(traced("UserController.GetCurrentUser", uc.GetCurrentUser))).Methods("GET")
+	router.Handle("/users/{username}/password-reset", requirePermission(auth.PermissionManageUsers, traced("UserController.IssuePasswordResetToken", uc.IssuePasswordResetToken))).Methods("POST")
+	router.HandleFunc("/auth/login", traced("UserController.Login", uc.Login)).Methods("POST")
+	router.Handle("/auth/password", requireAuthentication(traced("UserController.ChangePassword", uc.ChangePassword))).Methods("POST")
+	router.HandleFunc("/auth/password-reset", traced("UserController.ResetPassword", uc.ResetPassword)).Methods("POST")
+}
+
+// RegisterUser - creates a new user account
+func (uc *UserController) RegisterUser(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation POST /users users registerUser
+	//
+	// Registers a new user account with the default roles
+	// ---
+	// security: []
+	// consumes:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: userRequest
+	//   in: body
+	//   description: user to be registered.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/UserRequest"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/User"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found - the tenant does not exist
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '409':
+	//     description: Conflict - the user name is taken
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, uc.codecs, model.User{})
+	if err != nil {
+		return
+	}
+
+	var userRequest model.UserRequest
+	if err := readRequest(response, request, uc.codecs, &userRequest, "Users"); err != nil {
+		return
+	}
+	if fieldErrors := userRequest.Validate(uc.settings.Load().UserRules); len(fieldErrors) != 0 {
+		writeValidationProblem(response, request, "The user request failed validation", fieldErrors)
+		return
+	}
+
+	var tenant model.Tenant
+	if uc.tenants != nil {
+		id, ok := uc.namedTenant(response, request)
+		if !ok {
+			return
+		}
+		if tenant, err = findTenant(response, request, uc.tenants, id); err != nil {
+			return
+		}
+	}
+
+	user, err := uc.users.Register(request.Context(), userRequest, tenant.ID)
+	if err != nil {
+		writeError(response, request, err, "Could not register user")
+		return
+	}
+
+	log.WithContext(request.Context()).WithField("username", user.Username).WithField("correlationId", getCorrelationID(request)).Info("User registered")
+	writeResponse(response, codec, "user", user)
+}
+
+// GetCurrentUser - retrieves the account of the logged in user
+func (uc *UserController) GetCurrentUser(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation GET /users/me users getCurrentUser
+	//
+	// Returns the account of the logged in user
+	// ---
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/User"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found - the client is not a user
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, uc.codecs, model.User{})
+	if err != nil {
+		return
+	}
+
+	principal, _ := auth.FromContext(request.Context())
+	user, err := uc.users.Find(request.Context(), principal.Tenant, principal.Subject)
+	if err != nil {
+		writeError(response, request, err, "Could not get user")
+		return
+	}
+
+	writeResponse(response, codec, "user", user)
+}
+
+// Login - issues a token to a user
+func (uc *UserController) Login(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation POST /auth/login users login
+	//
+	// Issues a bearer token to a user. Repeated failed logins lock the account for a while.
+	// ---
+	// security: []
+	// consumes:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: loginRequest
+	//   in: body
+	//   description: the credentials of the user.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/LoginRequest"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/TokenResponse"
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized - wrong user name or password
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '423':
+	//     description: Locked - the account is locked, see the Retry-After header
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, uc.codecs, model.TokenResponse{})
+	if err != nil {
+		return
+	}
+
+	var loginRequest model.LoginRequest
+	if err := readRequest(response, request, uc.codecs, &loginRequest, "Credentials"); err != nil {
+		return
+	}
+
+	tenant, ok := uc.namedTenant(response, request)
+	if !ok {
+		return
+	}
+
+	token, err := uc.users.Login(request.Context(), tenant, loginRequest.Username, loginRequest.Password)
+	if locked, ok := errors.Cause(err).(auth.AccountLockedError); ok {
+		retryAfter := int(time.Until(locked.Until).Seconds()) + 1
+		response.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeAccountLocked,
+			Status: http.StatusLocked,
+			Detail: locked.Error(),
+		})
+		log.WithContext(request.Context()).WithField("username", loginRequest.Username).WithField("correlationId", getCorrelationID(request)).Info("Login to locked account")
+		return
+	}
+	if errors.Cause(err) == auth.ErrorInvalidCredentials {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeUnauthorized,
+			Status: http.StatusUnauthorized,
+			Detail: auth.ErrorInvalidCredentials.Error(),
+		})
+		log.WithContext(request.Context()).WithField("username", loginRequest.Username).WithField("correlationId", getCorrelationID(request)).Info("Login failed")
+		return
+	}
+	if err != nil {
+		writeError(response, request, err, "Could not log user in")
+		return
+	}
+
+	response.Header().Set("Cache-Control", "no-store")
+	writeResponse(response, codec, "token", token)
+}
+
+// ChangePassword - changes the password of the logged in user
+func (uc *UserController) ChangePassword(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation POST /auth/password users changePassword
+	//
+	// Changes the password of the logged in user
+	// ---
+	// consumes:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// produces:
+	// - application/problem+json
+	// parameters:
+	// - name: passwordChangeRequest
+	//   in: body
+	//   description: the current and the new password.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/PasswordChangeRequest"
+	// responses:
+	//   '204':
+	//     description: No Content
+	//   '400':
+	//     description: Bad Request
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden - the current password is wrong
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found - the client is not a user
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	var changeRequest model.PasswordChangeRequest
+	if err := readRequest(response, request, uc.codecs, &changeRequest, "Passwords"); err != nil {
+		return
+	}
+	if fieldErrors := uc.settings.Load().UserRules.Password.Validate("newPassword", changeRequest.NewPassword); len(fieldErrors) != 0 {
+		writeValidationProblem(response, request, "The new password failed validation", fieldErrors)
+		return
+	}
+
+	principal, _ := auth.FromContext(request.Context())
+	err := uc.users.ChangePassword(request.Context(), principal.Tenant, principal.Subject, changeRequest.CurrentPassword, *changeRequest.NewPassword)
+	if errors.Cause(err) == auth.ErrorInvalidCredentials {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeForbidden,
+			Status: http.StatusForbidden,
+			Detail: "The current password is wrong",
+		})
+		return
+	}
+	if err != nil {
+		writeError(response, request, err, "Could not change password")
+		return
+	}
+
+	log.WithContext(request.Context()).WithField("username", principal.Subject).WithField("correlationId", getCorrelationID(request)).Info("Password changed")
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// IssuePasswordResetToken - issues a password reset token of a user
+func (uc *UserController) IssuePasswordResetToken(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation POST /users/{username}/password-reset users issuePasswordResetToken
+	//
+	// Issues a single use password reset token to hand to the user, previous tokens of the user are invalidated
+	// ---
+	// produces:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// - application/problem+json
+	// parameters:
+	// - name: username
+	//   in: path
+	//   description: the name of the user.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/PasswordResetToken"
+	//   '401':
+	//     description: Unauthorized
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '403':
+	//     description: Forbidden
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '404':
+	//     description: Not Found
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '406':
+	//     description: Not Acceptable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	codec, err := negotiate(response, request, uc.codecs, model.PasswordResetToken{})
+	if err != nil {
+		return
+	}
+
+	// the user is one of the tenant of the request, clients of a tenant reach the users of their tenant only
+	principal, _ := auth.FromContext(request.Context())
+	var tenant string
+	if uc.tenants != nil {
+		if tenant, err = uc.tenants.Resolver.Resolve(request, principal); err != nil {
+			writeTenantProblem(response, request, err)
+			return
+		}
+	}
+
+	username := mux.Vars(request)["username"]
+	token, err := uc.users.IssueResetToken(request.Context(), tenant, username)
+	if err != nil {
+		writeError(response, request, err, "Could not issue password reset token")
+		return
+	}
+
+	log.WithContext(request.Context()).WithField("username", username).WithField("subject", principal.Subject).
+		WithField("correlationId", getCorrelationID(request)).Info("Password reset token issued")
+	response.Header().Set("Cache-Control", "no-store")
+	writeResponse(response, codec, "passwordResetToken", token)
+}
+
+// ResetPassword - sets a new password with a password reset token
+func (uc *UserController) ResetPassword(response http.ResponseWriter, request *http.Request) {
+	// swagger:operation POST /auth/password-reset users resetPassword
+	//
+	// Sets a new password with a password reset token and unlocks the account
+	// ---
+	// security: []
+	// consumes:
+	// - application/json
+	// - application/xml
+	// - application/yaml
+	// - application/msgpack
+	// produces:
+	// - application/problem+json
+	// parameters:
+	// - name: passwordResetRequest
+	//   in: body
+	//   description: the reset token and the new password.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/PasswordResetRequest"
+	// responses:
+	//   '204':
+	//     description: No Content
+	//   '400':
+	//     description: Bad Request - invalid password or token
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '415':
+	//     description: Unsupported Media Type
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+	//   '503':
+	//     description: Service Unavailable
+	//     schema:
+	//       "$ref": "#/definitions/ProblemResponse"
+
+	var resetRequest model.PasswordResetRequest
+	if err := readRequest(response, request, uc.codecs, &resetRequest, "Passwords"); err != nil {
+		return
+	}
+	if fieldErrors := uc.settings.Load().UserRules.Password.Validate("newPassword", resetRequest.NewPassword); len(fieldErrors) != 0 {
+		writeValidationProblem(response, request, "The new password failed validation", fieldErrors)
+		return
+	}
+
+	tenant, ok := uc.namedTenant(response, request)
+	if !ok {
+		return
+	}
+
+	err := uc.users.ResetPassword(request.Context(), tenant, resetRequest.Token, *resetRequest.NewPassword)
+	if errors.Cause(err) == auth.ErrorInvalidResetToken {
+		writeProblem(response, request, model.ProblemResponse{
+			Type:   model.ProblemTypeInvalidToken,
+			Status: http.StatusBadRequest,
+			Detail: "The password reset token is not valid",
+		})
+		log.WithContext(request.Context()).WithError(err).WithField("correlationId", getCorrelationID(request)).Info("Password reset failed")
+		return
+	}
+	if err != nil {
+		writeError(response, request, err, "Could not reset password")
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// writeValidationProblem - renders the validation failures of a request
+func writeValidationProblem(response http.ResponseWriter, request *http.Request, detail string, fieldErrors []validation.FieldError) {
+	writeProblem(response, request, model.ProblemResponse{
+		Type:   model.ProblemTypeValidation,
+		Status: http.StatusBadRequest,
+		Detail: detail,
+		Errors: fieldErrors,
+	})
+	log.WithContext(request.Context()).WithField("correlationId", getCorrelationID(request)).Debug(detail)
+}
@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shauera/messages/auth"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_Users(t *testing.T) {
+	repository, _ := persistence.NewMemoryRepository()
+	signer, _ := auth.NewHMACSigner("", testTokenSecret)
+	users, _ := auth.NewUsers(repository, signer, auth.UserConfig{
+		HashCost:        bcrypt.MinCost,
+		DefaultRoles:    []auth.Role{auth.RoleEditor},
+		TokenTTL:        time.Hour,
+		MaxFailedLogins: 2,
+		LockoutDuration: time.Minute,
+		ResetTokenTTL:   time.Hour,
+	})
+	key, _ := auth.NewHMACKey("", testTokenSecret)
+	authentication := auth.NewAuthentication(auth.NewJWTAuthenticator(auth.KeySet{key}, auth.JWTConfig{}))
+	router := setupMux([]ServiceController{NewMessageController(repository), NewUserController(users)}, DefaultSettings(), authentication)
+
+	login := func(t *testing.T, password string) string {
+		response := serveRequest(router, http.MethodPost, "/auth/login", `{"username": "Will", "password": "`+password+`"}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		var token model.TokenResponse
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &token))
+		return token.Token
+	}
+
+	t.Run("Fail path - invalid registration", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPost, "/users", `{"username": "w", "password": "short"}`, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		var problem model.ProblemResponse
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &problem))
+		assert.Len(t, problem.Errors, 2)
+
+		// 40 characters, 80 bytes
+		response = serveRequest(router, http.MethodPost, "/users", `{"username": "will", "password": "`+strings.Repeat("é", 40)+`"}`, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), `"maxBytes":72`)
+	})
+
+	t.Run("Success path - register", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPost, "/users", `{"username": "Will", "password": "to be or not to be"}`, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"username":"will","roles":["editor"]`)
+		assert.NotContains(t, response.Body.String(), "$2a$")
+
+		response = serveRequest(router, http.MethodPost, "/users", `{"username": "will", "password": "to be or not to be"}`, "")
+		assert.Equal(t, http.StatusConflict, response.Code)
+	})
+
+	t.Run("Success path - messages record their creator", func(t *testing.T) {
+		token := login(t, "to be or not to be")
+
+		response := serveRequest(router, http.MethodPost, "/messages", `{"content": "abba"}`, "Bearer "+token)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"createdBy":"will"`)
+
+		response = serveRequest(router, http.MethodGet, "/users/me", "", "Bearer "+token)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"lastLoginAt"`)
+	})
+
+	t.Run("Success path - change password", func(t *testing.T) {
+		token := login(t, "to be or not to be")
+
+		response := serveRequest(router, http.MethodPost, "/auth/password", `{"currentPassword": "wrong", "newPassword": "all the world's a stage"}`, "Bearer "+token)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+
+		response = serveRequest(router, http.MethodPost, "/auth/password", `{"currentPassword": "to be or not to be", "newPassword": "all the world's a stage"}`, "Bearer "+token)
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		login(t, "all the world's a stage")
+	})
+
+	t.Run("Fail path - repeated failures lock the account", func(t *testing.T) {
+		for attempt := 0; attempt < 2; attempt++ {
+			response := serveRequest(router, http.MethodPost, "/auth/login", `{"username": "will", "password": "wrong"}`, "")
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		}
+
+		response := serveRequest(router, http.MethodPost, "/auth/login", `{"username": "will", "password": "all the world's a stage"}`, "")
+		assert.Equal(t, http.StatusLocked, response.Code)
+		assert.NotEmpty(t, response.Header().Get("Retry-After"))
+	})
+
+	t.Run("Success path - admin issued reset token unlocks the account", func(t *testing.T) {
+		response := serveRequest(router, http.MethodPost, "/users/will/password-reset", "", "Bearer "+testToken("editor-1", "editor"))
+		assert.Equal(t, http.StatusForbidden, response.Code)
+
+		response = serveRequest(router, http.MethodPost, "/users/will/password-reset", "", "Bearer "+testToken("admin-1", "admin"))
+		assert.Equal(t, http.StatusOK, response.Code)
+		var resetToken model.PasswordResetToken
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &resetToken))
+
+		response = serveRequest(router, http.MethodPost, "/auth/password-reset", `{"token": "will.wrong", "newPassword": "brevity is the soul of wit"}`, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+
+		response = serveRequest(router, http.MethodPost, "/auth/password-reset", `{"token": "`+resetToken.Token+`", "newPassword": "brevity is the soul of wit"}`, "")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		login(t, "brevity is the soul of wit")
+	})
+}
@@ -0,0 +1,33 @@
+package tenancy
+
+import (
+	"github.com/pkg/errors"
+
+	config "github.com/spf13/viper"
+)
+
+// Tenancy - how the tenants of requests are resolved and looked up
+type Tenancy struct {
+	Resolver Resolver
+	Tenants  *Tenants
+}
+
+//LoadTenancy - build the tenancy from the "tenancy" configuration section, tenants are looked up in the given repository.
+//Returns nil when tenancy.enabled is false, the service then has a single set of messages.
+func LoadTenancy(repository TenantRepository) (*Tenancy, error) {
+	if !config.GetBool("tenancy.enabled") {
+		return nil, nil
+	}
+
+	resolver := Resolver{
+		Header:        config.GetString("tenancy.header"),
+		Domain:        config.GetString("tenancy.domain"),
+		DefaultTenant: config.GetString("tenancy.defaultTenant"),
+	}
+	cacheTTL := config.GetDuration("tenancy.cacheTTL")
+	if cacheTTL < 0 {
+		return nil, errors.New("tenancy.cacheTTL must not be negative")
+	}
+
+	return &Tenancy{Resolver: resolver, Tenants: NewTenants(repository, cacheTTL)}, nil
+}
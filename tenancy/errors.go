@@ -0,0 +1,18 @@
+package tenancy
+
+//Error - a tenant resolution error type
+type Error string
+
+//Error - implemenation of Error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+//ErrorTenantRequired - the request names no tenant and there is no default tenant
+const ErrorTenantRequired = Error("Tenant required")
+
+//ErrorConflictingTenants - the request names different tenants in the header and the host
+const ErrorConflictingTenants = Error("Conflicting tenants")
+
+//ErrorTenantForbidden - the principal of the request is confined to another tenant
+const ErrorTenantForbidden = Error("Tenant not allowed")
@@ -0,0 +1,98 @@
+package tenancy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/shauera/messages/auth"
+)
+
+// Resolver - finds the tenant a request is made for.
+// The tenant is named by the header or by the subdomain of the host, principals that
+// carry a tenant (the tenant claim of their token) are confined to it and need not name it.
+// Principals without a tenant reach tenants only when they are granted tenants:manage.
+type Resolver struct {
+	// Header - the request header naming the tenant, not read when empty
+	Header string
+	// Domain - the parent domain of tenant subdomains, team-a.messages.example.com is
+	// served for tenant team-a when Domain is messages.example.com. Not read when empty.
+	Domain string
+	// DefaultTenant - the tenant of requests that don't name one, a tenant must be named when empty
+	DefaultTenant string
+}
+
+// Resolve - returns the id of the tenant of the request made by the principal
+func (r Resolver) Resolve(request *http.Request, principal auth.Principal) (string, error) {
+	tenant, err := r.named(request)
+	if err != nil {
+		return "", err
+	}
+
+	if principal.Tenant != "" {
+		if tenant != "" && tenant != principal.Tenant {
+			return "", ErrorTenantForbidden
+		}
+		tenant = principal.Tenant
+	} else if !principal.Can(auth.PermissionManageTenants) {
+		return "", ErrorTenantForbidden
+	}
+
+	return r.orDefault(tenant)
+}
+
+// Named - returns the id of the tenant the request names, regardless of its principal.
+// Used by requests that are made before the client has credentials, such as registrations.
+func (r Resolver) Named(request *http.Request) (string, error) {
+	tenant, err := r.named(request)
+	if err != nil {
+		return "", err
+	}
+	return r.orDefault(tenant)
+}
+
+// named - the tenant named by the header or the subdomain, empty when the request names none
+func (r Resolver) named(request *http.Request) (string, error) {
+	var tenant string
+	if r.Header != "" {
+		tenant = strings.TrimSpace(request.Header.Get(r.Header))
+	}
+	if subdomain := r.subdomain(request.Host); subdomain != "" {
+		if tenant != "" && tenant != subdomain {
+			return "", ErrorConflictingTenants
+		}
+		tenant = subdomain
+	}
+	return tenant, nil
+}
+
+// orDefault - the tenant, DefaultTenant when empty
+func (r Resolver) orDefault(tenant string) (string, error) {
+	if tenant == "" {
+		tenant = r.DefaultTenant
+	}
+	if tenant == "" {
+		return "", ErrorTenantRequired
+	}
+	return tenant, nil
+}
+
+// subdomain - the label of the host below Domain, empty when the host is not a direct subdomain of Domain
+func (r Resolver) subdomain(host string) string {
+	if r.Domain == "" {
+		return ""
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(host)
+	suffix := "." + strings.ToLower(r.Domain)
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+	label := strings.TrimSuffix(host, suffix)
+	if strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
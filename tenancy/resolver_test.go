@@ -0,0 +1,80 @@
+package tenancy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/shauera/messages/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	resolver := Resolver{Header: "X-Tenant-ID", Domain: "messages.example.com"}
+	admin := auth.Principal{Roles: []auth.Role{auth.RoleAdmin}}
+
+	testCases := []struct {
+		name      string
+		host      string
+		header    string
+		principal auth.Principal
+		resolver  *Resolver
+		tenant    string
+		err       error
+	}{
+		{name: "header", host: "messages.example.com", header: "team-a", principal: admin, tenant: "team-a"},
+		{name: "subdomain", host: "team-b.messages.example.com:8090", principal: admin, tenant: "team-b"},
+		{name: "subdomain matching the header", host: "Team-B.Messages.Example.com", header: "team-b", principal: admin, tenant: "team-b"},
+		{name: "claim", host: "localhost", principal: auth.Principal{Tenant: "team-c"}, tenant: "team-c"},
+		{name: "claim matching the header", header: "team-c", principal: auth.Principal{Tenant: "team-c"}, tenant: "team-c"},
+		{name: "default", resolver: &Resolver{Header: "X-Tenant-ID", DefaultTenant: "shared"}, principal: admin, tenant: "shared"},
+		{name: "nested subdomain", host: "a.team-b.messages.example.com", principal: admin, err: ErrorTenantRequired},
+		{name: "none", host: "messages.example.com", principal: admin, err: ErrorTenantRequired},
+		{name: "conflicting header and subdomain", host: "team-b.messages.example.com", header: "team-a", principal: admin, err: ErrorConflictingTenants},
+		{name: "claim of another tenant", header: "team-a", principal: auth.Principal{Tenant: "team-c"}, err: ErrorTenantForbidden},
+		{name: "no claim", header: "team-a", principal: auth.Principal{Roles: []auth.Role{auth.RoleEditor}}, err: ErrorTenantForbidden},
+		{name: "no claim, default", resolver: &Resolver{DefaultTenant: "shared"}, err: ErrorTenantForbidden},
+		{name: "no claim, tenants scope", header: "team-a", principal: auth.Principal{Scopes: []auth.Permission{auth.PermissionManageTenants}}, tenant: "team-a"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+			request.Host = testCase.host
+			if testCase.header != "" {
+				request.Header.Set("X-Tenant-ID", testCase.header)
+			}
+			activeResolver := resolver
+			if testCase.resolver != nil {
+				activeResolver = *testCase.resolver
+			}
+
+			tenant, err := activeResolver.Resolve(request, testCase.principal)
+			assert.Equal(t, testCase.err, err)
+			assert.Equal(t, testCase.tenant, tenant)
+		})
+	}
+}
+
+func TestNamed(t *testing.T) {
+	resolver := Resolver{Header: "X-Tenant-ID", Domain: "messages.example.com", DefaultTenant: "shared"}
+
+	request, _ := http.NewRequest(http.MethodPost, "/users", nil)
+	request.Host = "team-b.messages.example.com"
+	tenant, err := resolver.Named(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-b", tenant)
+
+	request.Header.Set("X-Tenant-ID", "team-a")
+	_, err = resolver.Named(request)
+	assert.Equal(t, ErrorConflictingTenants, err)
+
+	request.Host = "messages.example.com"
+	tenant, err = resolver.Named(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", tenant)
+
+	request.Header.Del("X-Tenant-ID")
+	tenant, err = resolver.Named(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "shared", tenant)
+}
@@ -0,0 +1,122 @@
+package tenancy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shauera/messages/model"
+)
+
+// TenantRepository - repository abstraction to be implemented by persisters of tenants
+type TenantRepository interface {
+	CreateTenant(ctx context.Context, tenant model.Tenant) error
+	FindTenantByID(ctx context.Context, id string) (*model.Tenant, error)
+	ListTenants(ctx context.Context) (model.Tenants, error)
+	UpdateTenantSettings(ctx context.Context, id string, settings model.TenantSettings) (*model.Tenant, error)
+	DeleteTenantByID(ctx context.Context, id string) error
+	// MaxTenantIDLength - the longest tenant id the repository can keep the messages of, not limited when 0
+	MaxTenantIDLength() int
+}
+
+// Tenants - provisions tenants and looks them up for every request.
+// Found tenants are cached for the cache TTL, changes made through Tenants take effect
+// immediately, changes made by other instances of the service once the cache expires.
+type Tenants struct {
+	repository TenantRepository
+	cacheTTL   time.Duration
+	now        func() time.Time
+
+	lock  sync.Mutex
+	cache map[string]cachedTenant
+}
+
+type cachedTenant struct {
+	tenant    model.Tenant
+	expiresAt time.Time
+}
+
+//NewTenants - return the tenants of the repository, lookups are cached for cacheTTL (not cached when 0)
+func NewTenants(repository TenantRepository, cacheTTL time.Duration) *Tenants {
+	return &Tenants{
+		repository: repository,
+		cacheTTL:   cacheTTL,
+		now:        time.Now,
+		cache:      make(map[string]cachedTenant),
+	}
+}
+
+// Find - returns the tenant of the id
+func (t *Tenants) Find(ctx context.Context, id string) (model.Tenant, error) {
+	now := t.now()
+
+	t.lock.Lock()
+	cached, ok := t.cache[id]
+	t.lock.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.tenant, nil
+	}
+
+	tenant, err := t.repository.FindTenantByID(ctx, id)
+	if err != nil {
+		return model.Tenant{}, err
+	}
+
+	if t.cacheTTL > 0 {
+		t.lock.Lock()
+		t.cache[id] = cachedTenant{tenant: *tenant, expiresAt: now.Add(t.cacheTTL)}
+		t.lock.Unlock()
+	}
+	return *tenant, nil
+}
+
+// List - returns all the tenants
+func (t *Tenants) List(ctx context.Context) (model.Tenants, error) {
+	return t.repository.ListTenants(ctx)
+}
+
+// MaxIDLength - the longest tenant id that can be provisioned besides the limit of model.TenantRequest, not limited when 0
+func (t *Tenants) MaxIDLength() int {
+	return t.repository.MaxTenantIDLength()
+}
+
+// Provision - creates the tenant of a validated request
+func (t *Tenants) Provision(ctx context.Context, request model.TenantRequest) (model.Tenant, error) {
+	tenant := model.Tenant{
+		ID:        *request.ID,
+		Settings:  request.Settings,
+		CreatedAt: t.now().UTC(),
+	}
+	if request.Name != nil {
+		tenant.Name = *request.Name
+	}
+
+	if err := t.repository.CreateTenant(ctx, tenant); err != nil {
+		return model.Tenant{}, err
+	}
+	return tenant, nil
+}
+
+// UpdateSettings - replaces the validated settings of the tenant
+func (t *Tenants) UpdateSettings(ctx context.Context, id string, settings model.TenantSettings) (model.Tenant, error) {
+	tenant, err := t.repository.UpdateTenantSettings(ctx, id, settings)
+	t.forget(id)
+	if err != nil {
+		return model.Tenant{}, err
+	}
+	return *tenant, nil
+}
+
+// Delete - removes the tenant and all its messages
+func (t *Tenants) Delete(ctx context.Context, id string) error {
+	err := t.repository.DeleteTenantByID(ctx, id)
+	t.forget(id)
+	return err
+}
+
+// forget - drops the cached tenant of the id
+func (t *Tenants) forget(id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.cache, id)
+}
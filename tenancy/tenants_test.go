@@ -0,0 +1,52 @@
+package tenancy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shauera/messages/model"
+	"github.com/shauera/messages/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	repository, _ := persistence.NewMemoryRepository()
+	tenants := NewTenants(repository, time.Minute)
+	tenants.now = func() time.Time { return now }
+
+	id, name := "team-a", "Team A"
+	tenant, err := tenants.Provision(ctx, model.TenantRequest{ID: &id, Name: &name})
+	assert.NoError(t, err)
+	assert.Equal(t, model.Tenant{ID: id, Name: name, CreatedAt: now}, tenant)
+
+	_, err = tenants.Provision(ctx, model.TenantRequest{ID: &id})
+	assert.Equal(t, persistence.ErrorConflict, errors.Cause(err))
+
+	found, err := tenants.Find(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, tenant, found)
+
+	// changes made by other instances are seen once the cache expires
+	settings := model.TenantSettings{Analyzers: []string{"length"}}
+	repository.UpdateTenantSettings(ctx, id, settings)
+	found, _ = tenants.Find(ctx, id)
+	assert.Nil(t, found.Settings.Analyzers)
+	now = now.Add(time.Minute)
+	found, _ = tenants.Find(ctx, id)
+	assert.Equal(t, settings, found.Settings)
+
+	// changes made through the tenants are seen immediately
+	updated, err := tenants.UpdateSettings(ctx, id, model.TenantSettings{})
+	assert.NoError(t, err)
+	found, _ = tenants.Find(ctx, id)
+	assert.Equal(t, updated, found)
+
+	assert.NoError(t, tenants.Delete(ctx, id))
+	_, err = tenants.Find(ctx, id)
+	assert.Equal(t, persistence.ErrorNotFound, errors.Cause(err))
+	assert.Equal(t, persistence.ErrorNotFound, errors.Cause(tenants.Delete(ctx, id)))
+}
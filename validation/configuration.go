@@ -0,0 +1,94 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	config "github.com/spf13/viper"
+)
+
+//LoadMessageRules - build the message rules from the "validation" configuration section.
+//Settings that are not configured keep the value of DefaultMessageRules.
+func LoadMessageRules() (MessageRules, error) {
+	rules := DefaultMessageRules()
+
+	var err error
+	if rules.Content, err = loadStringRule("validation.content", rules.Content); err != nil {
+		return rules, err
+	}
+	if rules.Author, err = loadStringRule("validation.author", rules.Author); err != nil {
+		return rules, err
+	}
+	rules.CreatedAt = loadTimeRule("validation.createdAt", rules.CreatedAt)
+
+	return rules, nil
+}
+
+//LoadUserRules - build the user rules from the "validation.username" and "validation.password" configuration sections.
+//Settings that are not configured keep the value of DefaultUserRules.
+func LoadUserRules() (UserRules, error) {
+	rules := DefaultUserRules()
+
+	var err error
+	if rules.Username, err = loadStringRule("validation.username", rules.Username); err != nil {
+		return rules, err
+	}
+	if rules.Password, err = loadStringRule("validation.password", rules.Password); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+func loadStringRule(prefix string, rule StringRule) (StringRule, error) {
+	if config.IsSet(prefix + ".required") {
+		rule.Required = config.GetBool(prefix + ".required")
+	}
+	if config.IsSet(prefix + ".minLength") {
+		rule.MinLength = config.GetInt(prefix + ".minLength")
+	}
+	if config.IsSet(prefix + ".maxLength") {
+		rule.MaxLength = config.GetInt(prefix + ".maxLength")
+	}
+	if rule.MinLength < 0 || rule.MaxLength < 0 || rule.MaxLength > 0 && rule.MinLength > rule.MaxLength {
+		return rule, fmt.Errorf("%s: invalid length limits %d - %d", prefix, rule.MinLength, rule.MaxLength)
+	}
+
+	if config.IsSet(prefix + ".pattern") {
+		rule.Pattern = nil
+		if pattern := config.GetString(prefix + ".pattern"); pattern != "" {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return rule, errors.Wrapf(err, "%s.pattern", prefix)
+			}
+			rule.Pattern = compiled
+		}
+	}
+
+	if config.IsSet(prefix + ".charsets") {
+		rule.Charsets = config.GetStringSlice(prefix + ".charsets")
+		for _, charset := range rule.Charsets {
+			if _, ok := Charsets[charset]; !ok {
+				return rule, fmt.Errorf("%s.charsets: unknown character set %q", prefix, charset)
+			}
+		}
+	}
+
+	return rule, nil
+}
+
+func loadTimeRule(prefix string, rule TimeRule) TimeRule {
+	if config.IsSet(prefix + ".required") {
+		rule.Required = config.GetBool(prefix + ".required")
+	}
+	if config.IsSet(prefix + ".notInFuture") {
+		rule.NotInFuture = config.GetBool(prefix + ".notInFuture")
+	}
+	if config.IsSet(prefix + ".clockSkew") {
+		rule.ClockSkew = config.GetDuration(prefix + ".clockSkew")
+	}
+
+	return rule
+}
@@ -0,0 +1,62 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	config "github.com/spf13/viper"
+)
+
+func TestLoadMessageRules(t *testing.T) {
+	defer config.Reset()
+
+	config.Set("validation.content.maxLength", 100)
+	config.Set("validation.content.pattern", `\S`)
+	config.Set("validation.author.charsets", []string{"letter", "space"})
+	config.Set("validation.createdAt.notInFuture", true)
+
+	rules, err := LoadMessageRules()
+	assert.NoError(t, err)
+	assert.True(t, rules.Content.Required)
+	assert.Equal(t, 1, rules.Content.MinLength)
+	assert.Equal(t, 100, rules.Content.MaxLength)
+	assert.Equal(t, `\S`, rules.Content.Pattern.String())
+	assert.Equal(t, []string{"letter", "space"}, rules.Author.Charsets)
+	assert.True(t, rules.CreatedAt.NotInFuture)
+
+	config.Set("validation.author.charsets", []string{"klingon"})
+	_, err = LoadMessageRules()
+	assert.EqualError(t, err, `validation.author.charsets: unknown character set "klingon"`)
+
+	config.Set("validation.author.charsets", []string{})
+	config.Set("validation.content.pattern", `(`)
+	_, err = LoadMessageRules()
+	assert.Contains(t, err.Error(), "validation.content.pattern")
+}
+
+func TestLoadUserRules(t *testing.T) {
+	defer config.Reset()
+
+	config.Set("validation.password.minLength", 12)
+
+	rules, err := LoadUserRules()
+	assert.NoError(t, err)
+	assert.Equal(t, 12, rules.Password.MinLength)
+	assert.Equal(t, 72, rules.Password.MaxLength)
+	password := strings.Repeat("é", 40)
+	assert.Equal(t, []FieldError{{
+		Field:   "password",
+		Code:    CodeTooLong,
+		Params:  map[string]interface{}{"maxBytes": 72, "actual": 80},
+		Message: "Password must be at most 72 bytes long. Got 80 instead",
+	}}, rules.Password.Validate("password", &password))
+	assert.Equal(t, 32, rules.Username.MaxLength)
+	username := "no spaces"
+	assert.NotEmpty(t, rules.Username.Validate("username", &username))
+
+	config.Set("validation.username.minLength", 40)
+	_, err = LoadUserRules()
+	assert.EqualError(t, err, "validation.username: invalid length limits 40 - 32")
+}
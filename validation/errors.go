@@ -0,0 +1,46 @@
+package validation
+
+//Machine readable codes of validation failures
+const (
+	//CodeRequired - a required field is missing
+	CodeRequired = "required"
+	//CodeTooShort - a string field has less characters than allowed
+	CodeTooShort = "too_short"
+	//CodeTooLong - a string field has more characters (or bytes) than allowed
+	CodeTooLong = "too_long"
+	//CodePatternMismatch - a string field does not match the required pattern
+	CodePatternMismatch = "pattern_mismatch"
+	//CodeInvalidCharacters - a string field contains characters outside of the allowed character sets
+	CodeInvalidCharacters = "invalid_characters"
+	//CodeInFuture - a time field is later than the current time
+	CodeInFuture = "in_future"
+	//CodeInPast - a time field is earlier than the current time
+	CodeInPast = "in_past"
+	//CodeUnknownValue - a field has a value that is not one of the allowed values
+	CodeUnknownValue = "unknown_value"
+	//CodeOutOfRange - a number field is outside of the allowed range
+	CodeOutOfRange = "out_of_range"
+)
+
+// FieldError - a single validation failure of a request field
+//
+// swagger:model
+type FieldError struct {
+	// The path of the field that failed validation.
+	//
+	// example: content
+	Field string `json:"field"`
+
+	// Machine readable code of the failure.
+	//
+	// example: too_long
+	Code string `json:"code"`
+
+	// The parameters of the rule that failed, for example its limits.
+	Params map[string]interface{} `json:"params,omitempty"`
+
+	// Human readable description of the failure.
+	//
+	// example: Content must be between 1 and 256 characters long. Got 260 instead
+	Message string `json:"message"`
+}
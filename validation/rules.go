@@ -0,0 +1,311 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Charsets - named character sets that string fields can be restricted to
+var Charsets = map[string]*unicode.RangeTable{
+	"letter":      unicode.Letter,
+	"mark":        unicode.Mark,
+	"number":      unicode.Number,
+	"space":       unicode.Zs,
+	"punctuation": unicode.Punct,
+	"symbol":      unicode.Symbol,
+}
+
+// StringRule - constraints of a string field.
+// Lengths are counted in characters (runes) not bytes, a zero limit is not enforced.
+type StringRule struct {
+	Required  bool
+	MinLength int
+	MaxLength int
+	// MaxBytes - the maximal length of the UTF-8 encoded value, for values kept in fields of a fixed size
+	MaxBytes int
+	Pattern  *regexp.Regexp
+	Charsets []string
+}
+
+// TimeRule - constraints of a time field
+type TimeRule struct {
+	Required    bool
+	NotInFuture bool
+	// ClockSkew - how far into the future a time may be when NotInFuture is set
+	ClockSkew time.Duration
+}
+
+// MessageRules - the rules a message request must satisfy
+type MessageRules struct {
+	Content   StringRule
+	Author    StringRule
+	CreatedAt TimeRule
+}
+
+// DefaultMessageRules - returns the rules used when nothing is configured
+func DefaultMessageRules() MessageRules {
+	return MessageRules{
+		Content: StringRule{
+			Required:  true,
+			MinLength: 1,
+			MaxLength: 256,
+		},
+	}
+}
+
+// LengthLimits - length limits overriding the limits of a string rule, a zero limit keeps the rule limit
+//
+// swagger:model
+type LengthLimits struct {
+	// The minimum length in characters.
+	//
+	// minimum: 0
+	MinLength int `json:"minLength,omitempty" bson:"minLength,omitempty"`
+
+	// The maximum length in characters.
+	//
+	// minimum: 0
+	MaxLength int `json:"maxLength,omitempty" bson:"maxLength,omitempty"`
+}
+
+// Validate - checks the limits are not negative and the maximum is not below the minimum
+func (ll LengthLimits) Validate(field string) []FieldError {
+	var fieldErrors []FieldError
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{{"minLength", ll.MinLength}, {"maxLength", ll.MaxLength}} {
+		if limit.value < 0 {
+			fieldErrors = append(fieldErrors, FieldError{
+				Field:   field + "." + limit.name,
+				Code:    CodeOutOfRange,
+				Params:  map[string]interface{}{"min": 0},
+				Message: fmt.Sprintf("%s must not be negative", displayName(limit.name)),
+			})
+		}
+	}
+	if ll.MinLength > 0 && ll.MaxLength > 0 && ll.MaxLength < ll.MinLength {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field + ".maxLength",
+			Code:    CodeOutOfRange,
+			Params:  map[string]interface{}{"min": ll.MinLength},
+			Message: fmt.Sprintf("MaxLength must not be less than minLength %d", ll.MinLength),
+		})
+	}
+	return fieldErrors
+}
+
+// WithLimits - returns the rule with the limits set by the length limits
+func (sr StringRule) WithLimits(limits *LengthLimits) StringRule {
+	if limits == nil {
+		return sr
+	}
+	if limits.MinLength > 0 {
+		sr.MinLength = limits.MinLength
+	}
+	if limits.MaxLength > 0 {
+		sr.MaxLength = limits.MaxLength
+	}
+	return sr
+}
+
+// UserRules - the rules user names and passwords must satisfy
+type UserRules struct {
+	Username StringRule
+	Password StringRule
+}
+
+// DefaultUserRules - returns the user rules used when nothing is configured
+func DefaultUserRules() UserRules {
+	return UserRules{
+		Username: StringRule{
+			Required:  true,
+			MinLength: 3,
+			MaxLength: 32,
+			Pattern:   regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`),
+		},
+		Password: StringRule{
+			Required:  true,
+			MinLength: 8,
+			MaxLength: 72,
+			// passwords are hashed with bcrypt, which uses the first 72 bytes only (see auth.MaxSecretBytes)
+			MaxBytes: 72,
+		},
+	}
+}
+
+// Validate - returns the violations of the rule by the given value of field
+func (sr StringRule) Validate(field string, value *string) []FieldError {
+	if value == nil {
+		if sr.Required {
+			return []FieldError{{
+				Field:   field,
+				Code:    CodeRequired,
+				Message: fmt.Sprintf("%s is required", displayName(field)),
+			}}
+		}
+		return nil
+	}
+
+	var fieldErrors []FieldError
+
+	length := utf8.RuneCountInString(*value)
+	if sr.MinLength > 0 && length < sr.MinLength {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Code:    CodeTooShort,
+			Params:  map[string]interface{}{"min": sr.MinLength, "actual": length},
+			Message: sr.lengthMessage(field, length),
+		})
+	}
+	if sr.MaxLength > 0 && length > sr.MaxLength {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Code:    CodeTooLong,
+			Params:  map[string]interface{}{"max": sr.MaxLength, "actual": length},
+			Message: sr.lengthMessage(field, length),
+		})
+	}
+	if sr.MaxBytes > 0 && len(*value) > sr.MaxBytes && (sr.MaxLength == 0 || length <= sr.MaxLength) {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Code:    CodeTooLong,
+			Params:  map[string]interface{}{"maxBytes": sr.MaxBytes, "actual": len(*value)},
+			Message: fmt.Sprintf("%s must be at most %d bytes long. Got %d instead", displayName(field), sr.MaxBytes, len(*value)),
+		})
+	}
+
+	if sr.Pattern != nil && !sr.Pattern.MatchString(*value) {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Code:    CodePatternMismatch,
+			Params:  map[string]interface{}{"pattern": sr.Pattern.String()},
+			Message: fmt.Sprintf("%s must match the pattern %s", displayName(field), sr.Pattern.String()),
+		})
+	}
+
+	if invalid := sr.invalidCharacters(*value); invalid != "" {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Code:    CodeInvalidCharacters,
+			Params:  map[string]interface{}{"charsets": sr.Charsets, "invalid": invalid},
+			Message: fmt.Sprintf("%s may only contain %s characters. Got %q", displayName(field), strings.Join(sr.Charsets, ", "), invalid),
+		})
+	}
+
+	return fieldErrors
+}
+
+func (sr StringRule) lengthMessage(field string, length int) string {
+	switch {
+	case sr.MinLength > 0 && sr.MaxLength > 0:
+		return fmt.Sprintf("%s must be between %d and %d characters long. Got %d instead", displayName(field), sr.MinLength, sr.MaxLength, length)
+	case sr.MaxLength > 0:
+		return fmt.Sprintf("%s must be at most %d characters long. Got %d instead", displayName(field), sr.MaxLength, length)
+	default:
+		return fmt.Sprintf("%s must be at least %d characters long. Got %d instead", displayName(field), sr.MinLength, length)
+	}
+}
+
+// invalidCharacters - returns the distinct characters of value that are not in any of the allowed charsets
+func (sr StringRule) invalidCharacters(value string) string {
+	if len(sr.Charsets) == 0 {
+		return ""
+	}
+
+	tables := make([]*unicode.RangeTable, 0, len(sr.Charsets))
+	for _, charset := range sr.Charsets {
+		tables = append(tables, Charsets[charset])
+	}
+
+	seen := make(map[rune]bool)
+	var invalid []rune
+	for _, character := range value {
+		if !seen[character] && !unicode.In(character, tables...) {
+			invalid = append(invalid, character)
+		}
+		seen[character] = true
+	}
+
+	return string(invalid)
+}
+
+// Validate - returns the violations of the rule by the given value of field
+func (tr TimeRule) Validate(field string, value *time.Time, now time.Time) []FieldError {
+	if value == nil || value.IsZero() {
+		if tr.Required {
+			return []FieldError{{
+				Field:   field,
+				Code:    CodeRequired,
+				Message: fmt.Sprintf("%s is required", displayName(field)),
+			}}
+		}
+		return nil
+	}
+
+	if tr.NotInFuture && value.After(now.Add(tr.ClockSkew)) {
+		return []FieldError{{
+			Field:   field,
+			Code:    CodeInFuture,
+			Params:  map[string]interface{}{"now": now.UTC().Format(time.RFC3339)},
+			Message: fmt.Sprintf("%s must not be in the future", displayName(field)),
+		}}
+	}
+
+	return nil
+}
+
+// Schema - returns the rule as JSON schema (swagger 2.0) property keywords
+func (sr StringRule) Schema() map[string]interface{} {
+	schema := map[string]interface{}{"type": "string"}
+	if sr.MinLength > 0 {
+		schema["minLength"] = sr.MinLength
+	}
+	if sr.MaxLength > 0 {
+		schema["maxLength"] = sr.MaxLength
+	}
+	if sr.Pattern != nil {
+		schema["pattern"] = sr.Pattern.String()
+	}
+	if len(sr.Charsets) > 0 {
+		schema["x-charsets"] = sr.Charsets
+	}
+	return schema
+}
+
+// Schema - returns the rule as JSON schema (swagger 2.0) property keywords
+func (tr TimeRule) Schema() map[string]interface{} {
+	schema := map[string]interface{}{"type": "string", "format": "date-time"}
+	if tr.NotInFuture {
+		schema["x-notInFuture"] = true
+	}
+	return schema
+}
+
+// Required - returns the names of the required message fields sorted by name
+func (mr MessageRules) Required() []string {
+	var required []string
+	if mr.Author.Required {
+		required = append(required, "author")
+	}
+	if mr.Content.Required {
+		required = append(required, "content")
+	}
+	if mr.CreatedAt.Required {
+		required = append(required, "createdAt")
+	}
+	sort.Strings(required)
+	return required
+}
+
+func displayName(field string) string {
+	if field == "" {
+		return field
+	}
+	return strings.ToUpper(field[:1]) + field[1:]
+}